@@ -0,0 +1,277 @@
+// Package api holds the request and response bodies of the sentinel api, shared by the
+// handlers serving them, the openapi spec describing them and the client calling them.
+package api
+
+import (
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/search"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// ErrorCode tells apart the kinds of errors, whatever their message says
+type ErrorCode string
+
+const (
+	// the request is malformed or failed validation
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	// the api key is missing or wrong
+	CodeUnauthorized ErrorCode = "unauthorized"
+	// what the request is about doesn't exist
+	CodeNotFound ErrorCode = "not_found"
+	// the route doesn't support the method
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	// the request conflicts with the current state, e.g. it creates something that already exists
+	CodeConflict ErrorCode = "conflict"
+	// the body is over the size limit of the server
+	CodePayloadTooLarge ErrorCode = "payload_too_large"
+	// the server failed, what went wrong is logged rather than returned
+	CodeInternal ErrorCode = "internal_error"
+	// the server can't do what is asked with its configuration, e.g. its storage backend
+	CodeNotImplemented ErrorCode = "not_implemented"
+)
+
+// Error is the body of every error response
+type Error struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an error
+type ErrorBody struct {
+	Code    ErrorCode     `json:"code"`
+	Message string        `json:"message"`
+	Details *ErrorDetails `json:"details,omitempty"`
+}
+
+// ErrorDetails help with fixing the request of some errors
+type ErrorDetails struct {
+	// the fields a search query can use, when the query is invalid
+	Fields []string `json:"fields,omitempty"`
+	// the supported formats, when the format is invalid
+	Formats []string `json:"formats,omitempty"`
+	// what a failed import got done before it failed
+	Report *scheduler.ImportReport `json:"report,omitempty"`
+}
+
+// Message confirms a change, deletions running in the background return their job
+type Message struct {
+	Message string      `json:"message"`
+	Job     *models.Job `json:"job,omitempty"`
+}
+
+// DomainList lists the names of the domains
+type DomainList struct {
+	Domains []string `json:"domains"`
+}
+
+// DomainResponse is a domain with the seeds it is enumerated from and the names of its subdomains
+type DomainResponse struct {
+	Domain     models.Domain `json:"domain"`
+	Seeds      []string      `json:"seeds"`
+	Subdomains []string      `json:"subdomains"`
+}
+
+// ArchivedDomain confirms that a domain was archived
+type ArchivedDomain struct {
+	Message string        `json:"message"`
+	Domain  models.Domain `json:"domain"`
+}
+
+// ArchivedSubdomain confirms that a subdomain was archived
+type ArchivedSubdomain struct {
+	Message   string           `json:"message"`
+	Subdomain models.Subdomain `json:"subdomain"`
+}
+
+// SubdomainResponse is a subdomain with its latest dns and http snapshots
+type SubdomainResponse struct {
+	Subdomain models.Subdomain `json:"subdomain"`
+	DNS       models.DNS       `json:"latest_dns"`
+	HTTP      models.HTTP      `json:"latest_http"`
+}
+
+// SubdomainListing is a page of subdomains, the next page starts at NextCursor. Listings
+// projected to some fields only carry those.
+type SubdomainListing struct {
+	Subdomains []models.Subdomain `json:"subdomains"`
+	Count      int                `json:"count"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// SubdomainUpdate changes a subdomain, only the given fields are changed
+type SubdomainUpdate struct {
+	WatchDNS  *bool `json:"watch_dns,omitempty"`
+	WatchHTTP *bool `json:"watch_http,omitempty"`
+	// Tags replaces the tags, AddTags and RemoveTags change the existing ones
+	Tags       *[]string          `json:"tags,omitempty"`
+	AddTags    []string           `json:"add_tags,omitempty"`
+	RemoveTags []string           `json:"remove_tags,omitempty"`
+	Triage     models.TriageState `json:"triage,omitempty"`
+}
+
+// AddedName reports what happened to one of the names of a request adding subdomains
+type AddedName struct {
+	// the name as it was given
+	Input string `json:"input"`
+	// the normalized name, unless it is invalid
+	Name   string                 `json:"name,omitempty"`
+	Status scheduler.ImportStatus `json:"status"`
+	Reason string                 `json:"reason,omitempty"`
+}
+
+// AddedSubdomains reports what happened to every name of a request adding subdomains, with the
+// statuses of an import
+type AddedSubdomains struct {
+	Accepted   int `json:"accepted"`
+	Duplicate  int `json:"duplicate"`
+	Invalid    int `json:"invalid"`
+	OutOfScope int `json:"out_of_scope"`
+	// the subdomains that were added
+	Added   []models.Subdomain `json:"added"`
+	Results []AddedName        `json:"results"`
+}
+
+// BulkUpdate reports how many subdomains matched a bulk update and how many of them changed
+type BulkUpdate struct {
+	Matched int `json:"matched"`
+	Updated int `json:"updated"`
+}
+
+// HTTPHistoryResponse is the http snapshots of a subdomain, newest first, with the changes between them
+type HTTPHistoryResponse struct {
+	Snapshots []models.HTTP     `json:"snapshots"`
+	Diffs     []models.HTTPDiff `json:"diffs"`
+}
+
+// DNSHistoryResponse is the dns snapshots of a subdomain, newest first
+type DNSHistoryResponse struct {
+	Snapshots []models.DNS `json:"snapshots"`
+}
+
+// JobList is the latest runs of the jobs
+type JobList struct {
+	Jobs []models.Job `json:"jobs"`
+}
+
+// TagsRequest are the tags to set on or add to a domain or subdomain
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// NoteRequest is the text of a note
+type NoteRequest struct {
+	Text string `json:"text"`
+}
+
+// TriageRequest is the triage state to move a domain or subdomain to
+type TriageRequest struct {
+	State models.TriageState `json:"state"`
+}
+
+// SearchResults is a page of search results, the next page starts at NextCursor
+type SearchResults struct {
+	Results    []search.Result `json:"results"`
+	Count      int             `json:"count"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// EventList is a page of the asset timeline, newest first
+type EventList struct {
+	Events []models.Event `json:"events"`
+}
+
+// ProgramRequest creates a program, optionally moving existing domains into it
+type ProgramRequest struct {
+	models.Program
+	// Existing domains to add to the program
+	Domains []string `json:"domains,omitempty"`
+}
+
+// ProgramList lists the names of the programs
+type ProgramList struct {
+	Programs []string `json:"programs"`
+}
+
+// ProgramResponse is a program with the names of its domains
+type ProgramResponse struct {
+	Program models.Program `json:"program"`
+	Domains []string       `json:"domains"`
+}
+
+// ProgramDomains lists the domains of a program after one was added or removed
+type ProgramDomains struct {
+	Program string   `json:"program"`
+	Domains []string `json:"domains"`
+}
+
+// DeletedProgram confirms that a program was deleted along with its domains
+type DeletedProgram struct {
+	Message string   `json:"message"`
+	Domains []string `json:"domains"`
+}
+
+// ProgramStatsResponse counts the domains of a program and their subdomains by status
+type ProgramStatsResponse struct {
+	Program             string         `json:"program"`
+	Domains             int            `json:"domains"`
+	Subdomains          int            `json:"subdomains"`
+	SubdomainsPerDomain map[string]int `json:"subdomains_per_domain"`
+	DNSStatus           map[string]int `json:"dns_status"`
+	HTTPStatus          map[string]int `json:"http_status"`
+}
+
+// Stats are the statistics of a domain, or of every domain, over a period of days
+type Stats struct {
+	Domain     string                 `json:"domain,omitempty"`
+	Days       int                    `json:"days"`
+	Subdomains storage.SubdomainStats `json:"subdomains"`
+	// active subdomains by the providers that found them and the technologies of their latest http snapshot,
+	// as of the latest rollup
+	Providers    map[string]int `json:"providers"`
+	Technologies map[string]int `json:"technologies"`
+	// subdomains discovered per day and per week (starting on monday) of the period, oldest first
+	NewPerDay  []DateCount `json:"new_per_day"`
+	NewPerWeek []DateCount `json:"new_per_week"`
+	// runs of the jobs started during the period by type, only the global stats have them
+	Jobs map[models.JobType]JobStats `json:"jobs,omitempty"`
+	// daily rollups of the period, oldest first
+	History []models.StatsRollup `json:"history"`
+}
+
+// DateCount is a count of a day, or of the week starting on it
+type DateCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// JobStats sums up the runs of a job type
+type JobStats struct {
+	Runs      int `json:"runs"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Running   int `json:"running"`
+	// share of the finished runs that succeeded, from 0 to 1
+	SuccessRate float64 `json:"success_rate"`
+	// average duration of the finished runs
+	AverageDuration float64 `json:"average_duration_seconds"`
+}
+
+// RetentionPolicyResponse is the global retention policy and how long finished jobs are kept
+type RetentionPolicyResponse struct {
+	Policy           models.RetentionPolicy `json:"policy"`
+	JobRetentionDays int                    `json:"job_retention_days"`
+}
+
+// ScopeRules replaces the scope rules of a domain or program
+type ScopeRules struct {
+	InScope    []string `json:"in_scope"`
+	OutOfScope []string `json:"out_of_scope"`
+}
+
+// The reports are made where the work is done
+type (
+	ImportReport    = scheduler.ImportReport
+	RetentionReport = scheduler.RetentionReport
+	ScopeReport     = scheduler.ScopeReport
+	OrphanReport    = storage.OrphanReport
+)
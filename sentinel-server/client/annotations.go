@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// Target is the domain, or subdomain of a domain, an annotation is made on
+type Target struct {
+	Domain string
+	// Subdomain is empty when the annotation is made on the domain
+	Subdomain string
+}
+
+func (t Target) path(segments ...string) string {
+	if t.Subdomain == "" {
+		return apiPath(append([]string{"domains", t.Domain}, segments...)...)
+	}
+	return apiPath(append([]string{"domains", t.Domain, t.Subdomain}, segments...)...)
+}
+
+// SetTags replaces the tags of the target
+func (c *Client) SetTags(ctx context.Context, target Target, tags ...string) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodPut, target.path("tags"), api.TagsRequest{Tags: tags})
+}
+
+// AddTags adds tags to the target, keeping the existing ones
+func (c *Client) AddTags(ctx context.Context, target Target, tags ...string) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodPost, target.path("tags"), api.TagsRequest{Tags: tags})
+}
+
+// RemoveTag removes a tag from the target
+func (c *Client) RemoveTag(ctx context.Context, target Target, tag string) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodDelete, target.path("tags", tag), nil)
+}
+
+// AddNote attaches a note to the target, written by the analyst of the client
+func (c *Client) AddNote(ctx context.Context, target Target, text string) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodPost, target.path("notes"), api.NoteRequest{Text: text})
+}
+
+// UpdateNote changes the text of a note of the target
+func (c *Client) UpdateNote(ctx context.Context, target Target, noteID bson.ObjectID, text string) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodPatch, target.path("notes", noteID.Hex()), api.NoteRequest{Text: text})
+}
+
+// DeleteNote removes a note of the target
+func (c *Client) DeleteNote(ctx context.Context, target Target, noteID bson.ObjectID) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodDelete, target.path("notes", noteID.Hex()), nil)
+}
+
+// SetTriage moves the target to a triage state
+func (c *Client) SetTriage(ctx context.Context, target Target, state models.TriageState) (models.Annotations, error) {
+	return c.annotate(ctx, http.MethodPut, target.path("triage"), api.TriageRequest{State: state})
+}
+
+func (c *Client) annotate(ctx context.Context, method, path string, body any) (models.Annotations, error) {
+	annotations := models.Annotations{}
+	_, err := c.do(ctx, method, path, nil, body, &annotations)
+	return annotations, err
+}
@@ -0,0 +1,167 @@
+// Package client is a typed client of the sentinel api. Its methods follow the operations of the
+// openapi document served at /api/openapi.json and use the same request and response types as the server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/0xgwyn/sentinel/api"
+)
+
+// Client calls the api of a sentinel server
+type Client struct {
+	baseURL    string
+	apiKey     string
+	analyst    string
+	httpClient *http.Client
+}
+
+// Option configures a client
+type Option func(*Client)
+
+// WithAPIKey authenticates the requests with the api key of the server
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithAnalyst names who makes the requests, it is recorded with notes and triage changes
+func WithAnalyst(name string) Option {
+	return func(c *Client) { c.analyst = name }
+}
+
+// WithHTTPClient sends the requests with the given http client instead of http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:9000
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Error is an error response of the api, its code tells what kind of error it is
+type Error struct {
+	StatusCode int
+	api.ErrorBody
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("sentinel: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// HasCode reports whether err is an error response of the api with the code
+func HasCode(err error, code api.ErrorCode) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsNotFound reports whether err is a response of the api saying that what was asked for doesn't exist
+func IsNotFound(err error) bool {
+	return HasCode(err, api.CodeNotFound)
+}
+
+// IsConflict reports whether err is a response of the api saying that the request conflicts with
+// the current state, e.g. it creates something that already exists
+func IsConflict(err error) bool {
+	return HasCode(err, api.CodeConflict)
+}
+
+// apiPath joins the segments of a path of the api, escaping each of them
+func apiPath(segments ...string) string {
+	escaped := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	return "/api/v1/" + strings.Join(escaped, "/")
+}
+
+// do sends a json request and decodes the json response into out, unless it is nil.
+// It returns the status of the response.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) (int, error) {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	resp, err := c.send(ctx, method, path, query, reader, contentType)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("sentinel: invalid response to %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// send sends a request and returns the response if it is successful, error responses are returned as *Error
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.analyst != "" {
+		req.Header.Set("X-Analyst", c.analyst)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	response := api.Error{}
+	if err := json.Unmarshal(data, &response); err != nil || response.Error.Code == "" {
+		// not an error of the api, e.g. one of a proxy in front of it
+		response.Error = api.ErrorBody{Code: api.CodeInternal, Message: strings.TrimSpace(string(data))}
+		if resp.StatusCode < 500 {
+			response.Error.Code = api.CodeInvalidRequest
+		}
+		if response.Error.Message == "" {
+			response.Error.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	return nil, &Error{StatusCode: resp.StatusCode, ErrorBody: response.Error}
+}
+
+// OpenAPI returns the openapi document of the server
+func (c *Client) OpenAPI(ctx context.Context) (map[string]any, error) {
+	document := map[string]any{}
+	_, err := c.do(ctx, http.MethodGet, "/api/v1/openapi.json", nil, nil, &document)
+	return document, err
+}
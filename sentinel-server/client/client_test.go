@@ -0,0 +1,196 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/client"
+	"github.com/0xgwyn/sentinel/events"
+	"github.com/0xgwyn/sentinel/export"
+	"github.com/0xgwyn/sentinel/handler"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/router"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// newTestClient serves the api from a fresh bolt store and returns a client of it
+func newTestClient(t *testing.T) *client.Client {
+	t.Helper()
+
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	previous := storage.GetStore()
+	storage.SetStore(store)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: handler.ErrorHandler})
+	router.AddRouterGroup(app)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+
+	t.Cleanup(func() {
+		// open streams would hold up the shutdown
+		events.CloseSubscriptions()
+		app.Shutdown()
+		storage.SetStore(previous)
+		store.Close()
+	})
+	return client.New("http://"+ln.Addr().String(), client.WithAnalyst("alice"))
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := c.CreateDomain(ctx, models.Domain{Name: "example.com", InScope: []string{"*.example.com"}}); err != nil {
+		t.Fatalf("creating the domain failed: %v", err)
+	}
+	if _, err := c.CreateDomain(ctx, models.Domain{Name: "example.com", InScope: []string{"*.example.com"}}); !client.IsConflict(err) {
+		t.Errorf("creating an existing domain returned %v, want a conflict error", err)
+	}
+	added, err := c.AddSubdomains(ctx, "example.com", "www.example.com", "API.example.com.", "evil.com")
+	if err != nil || len(added.Added) != 2 || added.OutOfScope != 1 {
+		t.Fatalf("adding subdomains returned %+v and %v", added, err)
+	}
+	if added, err := c.AddSubdomains(ctx, "example.com", "www.example.com"); err != nil || len(added.Added) != 0 || added.Duplicate != 1 {
+		t.Errorf("adding a known subdomain returned %+v and %v", added, err)
+	}
+
+	domain, err := c.GetDomain(ctx, "example.com", client.DomainFilter{}, "")
+	if err != nil || len(domain.Subdomains) != 2 {
+		t.Errorf("getting the domain returned %v and %v", domain.Subdomains, err)
+	}
+	if _, err := c.GetDomain(ctx, "missing.com", client.DomainFilter{}, ""); !client.IsNotFound(err) {
+		t.Errorf("getting a missing domain returned %v, want a not found error", err)
+	}
+
+	watch := true
+	result, err := c.BulkUpdateSubdomains(ctx, "example.com", client.SubdomainFilter{NamePattern: "www.*"},
+		api.SubdomainUpdate{WatchHTTP: &watch, AddTags: []string{"web"}})
+	if err != nil || result.Matched != 1 || result.Updated != 1 {
+		t.Errorf("the bulk update returned %+v and %v", result, err)
+	}
+	listing, err := c.ListSubdomains(ctx, "example.com", client.SubdomainPage{Filter: client.SubdomainFilter{Tag: "web"}})
+	if err != nil || listing.Count != 1 || listing.Subdomains[0].Name != "www.example.com" || !listing.Subdomains[0].WatchHTTP {
+		t.Errorf("listing tagged subdomains returned %+v and %v", listing, err)
+	}
+
+	target := client.Target{Domain: "example.com", Subdomain: "api.example.com"}
+	annotations, err := c.AddNote(ctx, target, "login panel")
+	if err != nil || len(annotations.Notes) != 1 || annotations.Notes[0].Author != "alice" {
+		t.Fatalf("adding a note returned %+v and %v", annotations, err)
+	}
+	if annotations, err = c.SetTriage(ctx, target, models.TriageInteresting); err != nil || annotations.Triage == nil {
+		t.Errorf("setting the triage state returned %+v and %v", annotations, err)
+	}
+	if annotations, err = c.DeleteNote(ctx, target, annotations.Notes[0].ID); err != nil || len(annotations.Notes) != 0 {
+		t.Errorf("deleting the note returned %+v and %v", annotations, err)
+	}
+
+	results, err := c.Search(ctx, client.SearchOptions{Query: "tag:web"})
+	if err != nil || len(results.Results) != 1 {
+		t.Errorf("searching returned %+v and %v", results, err)
+	}
+
+	out, err := c.ExportDomain(ctx, "example.com", export.Hosts, client.SubdomainFilter{})
+	if err != nil {
+		t.Fatalf("exporting the domain failed: %v", err)
+	}
+	data, _ := io.ReadAll(out)
+	out.Close()
+	if lines := strings.Fields(string(data)); len(lines) != 2 {
+		t.Errorf("the export listed %v", lines)
+	}
+
+	report, err := c.ImportSubdomains(ctx, "example.com", []client.ImportFile{
+		{Name: "subs.txt", Content: strings.NewReader("dev.example.com\nwww.example.com\nother.org\n")},
+	}, client.ImportOptions{})
+	if err != nil || report.Accepted != 1 {
+		t.Errorf("importing returned %+v and %v", report, err)
+	}
+
+	if _, err := c.ArchiveSubdomain(ctx, "example.com", "dev.example.com"); err != nil {
+		t.Errorf("archiving the subdomain failed: %v", err)
+	}
+	if _, err := c.RestoreSubdomain(ctx, "example.com", "dev.example.com"); err != nil {
+		t.Errorf("restoring the subdomain failed: %v", err)
+	}
+	preview, err := c.SetDomainScope(ctx, "example.com", api.ScopeRules{InScope: []string{"*.example.com"}, OutOfScope: []string{"dev.example.com"}}, true)
+	if err != nil || !preview.DryRun || len(preview.Domains) != 1 || len(preview.Domains[0].Leaving) != 1 {
+		t.Errorf("previewing the scope returned %+v and %v", preview, err)
+	}
+
+	discovered, err := c.Events(ctx, client.EventFilter{Domain: "example.com", Types: []models.EventType{models.SubdomainDiscovered}})
+	if err != nil || len(discovered) != 3 {
+		t.Errorf("listing discovery events returned %d events and %v", len(discovered), err)
+	}
+
+	document, err := c.OpenAPI(ctx)
+	if err != nil || document["openapi"] != "3.0.3" {
+		t.Errorf("getting the openapi document returned %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := c.CreateDomain(ctx, models.Domain{Name: "example.com", InScope: []string{"*.example.com"}}); err != nil {
+		t.Fatalf("creating the domain failed: %v", err)
+	}
+	if _, err := c.AddSubdomains(ctx, "example.com", "a.example.com"); err != nil {
+		t.Fatalf("adding a subdomain failed: %v", err)
+	}
+	timeline, err := c.Events(ctx, client.EventFilter{Domain: "example.com"})
+	if err != nil || len(timeline) == 0 {
+		t.Fatalf("listing the events returned %d events and %v", len(timeline), err)
+	}
+
+	// resuming from the latest event gets everything after it, whether it is replayed or live
+	stream := func(after bson.ObjectID, want int) []models.Event {
+		streamCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		received := []models.Event{}
+		err := c.Stream(streamCtx, client.StreamOptions{Domain: "example.com", LastEventID: after}, func(event models.Event) error {
+			if received = append(received, event); len(received) == want {
+				cancel()
+			}
+			return nil
+		})
+		if err != context.Canceled {
+			t.Errorf("the stream ended with %v after %d events", err, len(received))
+		}
+		return received
+	}
+	done := make(chan []models.Event)
+	go func() { done <- stream(timeline[0].ID, 2) }()
+	for _, name := range []string{"b.example.com", "c.example.com"} {
+		if _, err := c.AddSubdomains(ctx, "example.com", name); err != nil {
+			t.Fatalf("adding a subdomain failed: %v", err)
+		}
+	}
+	received := <-done
+	if len(received) != 2 || received[0].Subdomain != "b.example.com" || received[1].Subdomain != "c.example.com" {
+		t.Fatalf("the stream sent %+v", received)
+	}
+
+	if replayed := stream(received[0].ID, 1); len(replayed) != 1 || replayed[0].ID != received[1].ID {
+		t.Errorf("resuming the stream sent %+v", replayed)
+	}
+	if err := c.Stream(ctx, client.StreamOptions{Program: "missing"}, nil); !client.IsNotFound(err) {
+		t.Errorf("streaming a missing program returned %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// Archived tells listings what to do with archived assets
+type Archived string
+
+const (
+	// archived assets are left out, the default
+	ExcludeArchived Archived = "exclude"
+	IncludeArchived Archived = "include"
+	OnlyArchived    Archived = "only"
+)
+
+// DomainFilter filters domain listings
+type DomainFilter struct {
+	Archived Archived
+	Tag      string
+	Triage   models.TriageState
+}
+
+func (f DomainFilter) values() url.Values {
+	query := url.Values{}
+	set(query, "archived", string(f.Archived))
+	set(query, "tag", f.Tag)
+	set(query, "triage", string(f.Triage))
+	return query
+}
+
+// ListDomains returns the names of the domains
+func (c *Client) ListDomains(ctx context.Context, filter DomainFilter) ([]string, error) {
+	list := api.DomainList{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("domains")+"/", filter.values(), nil, &list)
+	return list.Domains, err
+}
+
+// CreateDomain creates a domain, its scope defaults to its subdomains
+func (c *Client) CreateDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	created := models.Domain{}
+	_, err := c.do(ctx, http.MethodPost, apiPath("domains")+"/", nil, domain, &created)
+	return created, err
+}
+
+// GetDomain returns a domain with the seeds it is enumerated from and the names of its subdomains,
+// filtered by the filter and the seed they were found from if it isn't empty
+func (c *Client) GetDomain(ctx context.Context, name string, filter DomainFilter, seed string) (api.DomainResponse, error) {
+	query := filter.values()
+	set(query, "seed", seed)
+	response := api.DomainResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("domains", name), query, nil, &response)
+	return response, err
+}
+
+// UpdateDomain changes the scope and retention policy of a domain, only the given fields are changed
+func (c *Client) UpdateDomain(ctx context.Context, name string, update models.Domain) (models.Domain, error) {
+	updated := models.Domain{}
+	_, err := c.do(ctx, http.MethodPatch, apiPath("domains", name), nil, update, &updated)
+	return updated, err
+}
+
+// SetDomainScope replaces the scope rules of a domain and reports which subdomains move into or out of
+// scope. A dry run only reports it.
+func (c *Client) SetDomainScope(ctx context.Context, name string, rules api.ScopeRules, dryRun bool) (api.ScopeReport, error) {
+	report := api.ScopeReport{}
+	_, err := c.do(ctx, http.MethodPut, apiPath("domains", name, "scope"), dryRunQuery(dryRun), rules, &report)
+	return report, err
+}
+
+// ArchiveDomain archives a domain along with its subdomains
+func (c *Client) ArchiveDomain(ctx context.Context, name string) (api.ArchivedDomain, error) {
+	archived := api.ArchivedDomain{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("domains", name), nil, nil, &archived)
+	return archived, err
+}
+
+// PurgeDomain deletes a domain along with everything recorded about it. Without transactions the
+// records are deleted in the background by the returned job.
+func (c *Client) PurgeDomain(ctx context.Context, name string) (api.Message, error) {
+	message := api.Message{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("domains", name), url.Values{"purge": {"true"}}, nil, &message)
+	return message, err
+}
+
+// RestoreDomain brings back an archived domain along with the subdomains archived with it
+func (c *Client) RestoreDomain(ctx context.Context, name string) (models.Domain, error) {
+	restored := models.Domain{}
+	_, err := c.do(ctx, http.MethodPost, apiPath("domains", name, "restore"), nil, nil, &restored)
+	return restored, err
+}
+
+// set sets a query param unless its value is empty
+func set(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
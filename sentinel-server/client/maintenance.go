@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// Job returns a job, e.g. to follow a purge running in the background
+func (c *Client) Job(ctx context.Context, id bson.ObjectID) (models.Job, error) {
+	job := models.Job{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("jobs", id.Hex()), nil, nil, &job)
+	return job, err
+}
+
+// RetentionPolicy returns the global retention policy
+func (c *Client) RetentionPolicy(ctx context.Context) (api.RetentionPolicyResponse, error) {
+	policy := api.RetentionPolicyResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("retention")+"/", nil, nil, &policy)
+	return policy, err
+}
+
+// RetentionReport reports what the retention policies would delete, of every domain if domain is empty
+func (c *Client) RetentionReport(ctx context.Context, domain string) (api.RetentionReport, error) {
+	return c.retention(ctx, http.MethodGet, apiPath("retention", "report"), domain)
+}
+
+// RunRetention enforces the retention policies right away, of every domain if domain is empty
+func (c *Client) RunRetention(ctx context.Context, domain string) (api.RetentionReport, error) {
+	return c.retention(ctx, http.MethodPost, apiPath("retention", "run"), domain)
+}
+
+func (c *Client) retention(ctx context.Context, method, path, domain string) (api.RetentionReport, error) {
+	query := url.Values{}
+	set(query, "domain", domain)
+	report := api.RetentionReport{}
+	_, err := c.do(ctx, method, path, query, nil, &report)
+	return report, err
+}
+
+// PurgeDomainData deletes every dns and http snapshot of a domain, or only reports them on a dry run
+func (c *Client) PurgeDomainData(ctx context.Context, domain string, dryRun bool) (api.RetentionReport, error) {
+	report := api.RetentionReport{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("retention", domain), dryRunQuery(dryRun), nil, &report)
+	return report, err
+}
+
+// dryRunQuery asks for a dry run
+func dryRunQuery(dryRun bool) url.Values {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	return query
+}
+
+// OrphanReport counts the records whose program, domain or subdomain no longer exists, with deleteDomains
+// the records of the domains whose program no longer exists count as well
+func (c *Client) OrphanReport(ctx context.Context, deleteDomains bool) (api.OrphanReport, error) {
+	report := api.OrphanReport{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("integrity", "report"), deleteDomainsQuery(deleteDomains), nil, &report)
+	return report, err
+}
+
+// RunIntegrity deletes the orphaned records right away, the domains whose program no longer exists only with deleteDomains
+func (c *Client) RunIntegrity(ctx context.Context, deleteDomains bool) (api.OrphanReport, error) {
+	report := api.OrphanReport{}
+	_, err := c.do(ctx, http.MethodPost, apiPath("integrity", "run"), deleteDomainsQuery(deleteDomains), nil, &report)
+	return report, err
+}
+
+// deleteDomainsQuery asks for the domains whose program no longer exists to be deleted
+func deleteDomainsQuery(deleteDomains bool) url.Values {
+	query := url.Values{}
+	if deleteDomains {
+		query.Set("delete_domains", "true")
+	}
+	return query
+}
+
+// Stats returns the statistics of every domain, or of domain if it isn't empty, over the last days.
+// A days of 0 leaves it to the server.
+func (c *Client) Stats(ctx context.Context, domain string, days int) (api.Stats, error) {
+	query := url.Values{}
+	set(query, "domain", domain)
+	if days > 0 {
+		query.Set("days", strconv.Itoa(days))
+	}
+	stats := api.Stats{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("stats"), query, nil, &stats)
+	return stats, err
+}
+
+// Jobs returns up to limit of the latest runs of the jobs of a type, or of every type if jobType is empty.
+// A limit of 0 leaves it to the server.
+func (c *Client) Jobs(ctx context.Context, jobType models.JobType, limit int) ([]models.Job, error) {
+	query := url.Values{}
+	set(query, "type", string(jobType))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	list := api.JobList{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("jobs"), query, nil, &list)
+	return list.Jobs, err
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/export"
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// ListPrograms returns the names of the programs
+func (c *Client) ListPrograms(ctx context.Context) ([]string, error) {
+	list := api.ProgramList{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("programs")+"/", nil, nil, &list)
+	return list.Programs, err
+}
+
+// CreateProgram creates a program and moves the existing domains it names into it
+func (c *Client) CreateProgram(ctx context.Context, program api.ProgramRequest) (models.Program, error) {
+	created := models.Program{}
+	_, err := c.do(ctx, http.MethodPost, apiPath("programs")+"/", nil, program, &created)
+	return created, err
+}
+
+// GetProgram returns a program with the names of its domains
+func (c *Client) GetProgram(ctx context.Context, name string) (api.ProgramResponse, error) {
+	response := api.ProgramResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("programs", name), nil, nil, &response)
+	return response, err
+}
+
+// UpdateProgram changes a program, only the given fields are changed
+func (c *Client) UpdateProgram(ctx context.Context, name string, update models.Program) (models.Program, error) {
+	updated := models.Program{}
+	_, err := c.do(ctx, http.MethodPatch, apiPath("programs", name), nil, update, &updated)
+	return updated, err
+}
+
+// SetProgramScope replaces the scope rules of a program the way SetDomainScope does for a domain
+func (c *Client) SetProgramScope(ctx context.Context, name string, rules api.ScopeRules, dryRun bool) (api.ScopeReport, error) {
+	report := api.ScopeReport{}
+	_, err := c.do(ctx, http.MethodPut, apiPath("programs", name, "scope"), dryRunQuery(dryRun), rules, &report)
+	return report, err
+}
+
+// DeleteProgram deletes a program along with its domains and everything recorded about them
+func (c *Client) DeleteProgram(ctx context.Context, name string) (api.DeletedProgram, error) {
+	deleted := api.DeletedProgram{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("programs", name), nil, nil, &deleted)
+	return deleted, err
+}
+
+// ProgramStats counts the domains of a program and their subdomains by status
+func (c *Client) ProgramStats(ctx context.Context, name string) (api.ProgramStatsResponse, error) {
+	stats := api.ProgramStatsResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("programs", name, "stats"), nil, nil, &stats)
+	return stats, err
+}
+
+// ExportProgram streams the subdomains of every domain of a program matching the filter in the format,
+// the caller closes the export
+func (c *Client) ExportProgram(ctx context.Context, name string, format export.Format, filter SubdomainFilter) (io.ReadCloser, error) {
+	return c.export(ctx, apiPath("programs", name, "export"), format, filter)
+}
+
+// AddProgramDomain moves an existing domain into a program
+func (c *Client) AddProgramDomain(ctx context.Context, program, domain string) (api.ProgramDomains, error) {
+	domains := api.ProgramDomains{}
+	_, err := c.do(ctx, http.MethodPut, apiPath("programs", program, "domains", domain), nil, nil, &domains)
+	return domains, err
+}
+
+// RemoveProgramDomain takes a domain out of a program without deleting it
+func (c *Client) RemoveProgramDomain(ctx context.Context, program, domain string) (api.ProgramDomains, error) {
+	domains := api.ProgramDomains{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("programs", program, "domains", domain), nil, nil, &domains)
+	return domains, err
+}
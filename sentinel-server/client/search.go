@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// SearchOptions asks for a page of search results
+type SearchOptions struct {
+	// Query is made of space separated field:value terms, like tech:nginx -status:404
+	Query    string
+	Domain   string
+	Archived Archived
+	// Limit defaults to 100
+	Limit int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+// Search finds subdomains by themselves and their latest dns and http snapshots
+func (c *Client) Search(ctx context.Context, options SearchOptions) (api.SearchResults, error) {
+	query := url.Values{}
+	set(query, "q", options.Query)
+	set(query, "domain", options.Domain)
+	set(query, "archived", string(options.Archived))
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	set(query, "cursor", options.Cursor)
+
+	results := api.SearchResults{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("search"), query, nil, &results)
+	return results, err
+}
+
+// EventFilter filters the asset timeline
+type EventFilter struct {
+	Domain    string
+	Subdomain string
+	Types     []models.EventType
+	Since     time.Time
+	Until     time.Time
+	// Before is the id of the last event of the previous page
+	Before bson.ObjectID
+	// Limit defaults to 100
+	Limit int
+}
+
+// Events returns the asset timeline, newest first
+func (c *Client) Events(ctx context.Context, filter EventFilter) ([]models.Event, error) {
+	query := url.Values{}
+	set(query, "domain", filter.Domain)
+	set(query, "subdomain", filter.Subdomain)
+	types := make([]string, 0, len(filter.Types))
+	for _, eventType := range filter.Types {
+		types = append(types, string(eventType))
+	}
+	set(query, "type", strings.Join(types, ","))
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if !filter.Before.IsZero() {
+		query.Set("before", filter.Before.Hex())
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	list := api.EventList{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("events"), query, nil, &list)
+	return list.Events, err
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// StreamOptions filters a stream of events
+type StreamOptions struct {
+	Domain  string
+	Program string
+	Types   []models.EventType
+	// LastEventID resumes a stream after this event, the events missed since are sent first
+	LastEventID bson.ObjectID
+}
+
+// Stream calls handle with every event recorded from now on until ctx is done, handle returns an
+// error or the server ends the stream, e.g. because the client fell behind. Passing the id of the
+// last event handled as LastEventID resumes the stream without missing anything.
+func (c *Client) Stream(ctx context.Context, options StreamOptions, handle func(models.Event) error) error {
+	query := url.Values{}
+	set(query, "domain", options.Domain)
+	set(query, "program", options.Program)
+	types := make([]string, 0, len(options.Types))
+	for _, eventType := range options.Types {
+		types = append(types, string(eventType))
+	}
+	set(query, "type", strings.Join(types, ","))
+	if !options.LastEventID.IsZero() {
+		query.Set("last_event_id", options.LastEventID.Hex())
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, apiPath("stream"), query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// server-sent events are separated by blank lines, only their data is needed
+	reader := bufio.NewReader(resp.Body)
+	data := strings.Builder{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		event := models.Event{}
+		if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+			return err
+		}
+		data.Reset()
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
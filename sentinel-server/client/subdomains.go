@@ -0,0 +1,237 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/export"
+	"github.com/0xgwyn/sentinel/importer"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// SubdomainFilter filters the subdomains of listings, bulk updates and exports
+type SubdomainFilter struct {
+	Archived     Archived
+	Tag          string
+	Triage       models.TriageState
+	DNSStatuses  []models.StatusType
+	HTTPStatuses []models.StatusType
+	Provider     string
+	// NamePattern matches the whole name, * matches any run of characters
+	NamePattern  string
+	WatchDNS     *bool
+	WatchHTTP    *bool
+	InScope      *bool
+	CreatedSince time.Time
+	CreatedUntil time.Time
+	UpdatedSince time.Time
+	UpdatedUntil time.Time
+}
+
+func (f SubdomainFilter) values() url.Values {
+	query := DomainFilter{Archived: f.Archived, Tag: f.Tag, Triage: f.Triage}.values()
+	set(query, "dns_status", joinStatuses(f.DNSStatuses))
+	set(query, "http_status", joinStatuses(f.HTTPStatuses))
+	set(query, "provider", f.Provider)
+	set(query, "name", f.NamePattern)
+	for key, flag := range map[string]*bool{"watch_dns": f.WatchDNS, "watch_http": f.WatchHTTP, "in_scope": f.InScope} {
+		if flag != nil {
+			query.Set(key, strconv.FormatBool(*flag))
+		}
+	}
+	for key, bound := range map[string]time.Time{
+		"created_since": f.CreatedSince, "created_until": f.CreatedUntil,
+		"updated_since": f.UpdatedSince, "updated_until": f.UpdatedUntil,
+	} {
+		if !bound.IsZero() {
+			query.Set(key, bound.Format(time.RFC3339))
+		}
+	}
+	return query
+}
+
+// SubdomainPage asks for a page of a subdomain listing
+type SubdomainPage struct {
+	Filter SubdomainFilter
+	// Sort defaults to the name
+	Sort       storage.SubdomainSort
+	Descending bool
+	// Limit defaults to 100
+	Limit int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	// Fields projects the subdomains to the given json fields
+	Fields []string
+}
+
+// ListSubdomains returns a page of the subdomains of a domain
+func (c *Client) ListSubdomains(ctx context.Context, domain string, page SubdomainPage) (api.SubdomainListing, error) {
+	query := page.Filter.values()
+	set(query, "sort", string(page.Sort))
+	if page.Descending {
+		query.Set("order", "desc")
+	}
+	if page.Limit > 0 {
+		query.Set("limit", strconv.Itoa(page.Limit))
+	}
+	set(query, "cursor", page.Cursor)
+	set(query, "fields", strings.Join(page.Fields, ","))
+
+	listing := api.SubdomainListing{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("domains", domain, "subdomains"), query, nil, &listing)
+	return listing, err
+}
+
+// BulkUpdateSubdomains applies an update to every subdomain of a domain matching the filter
+func (c *Client) BulkUpdateSubdomains(ctx context.Context, domain string, filter SubdomainFilter, update api.SubdomainUpdate) (api.BulkUpdate, error) {
+	result := api.BulkUpdate{}
+	_, err := c.do(ctx, http.MethodPatch, apiPath("domains", domain, "subdomains"), filter.values(), update, &result)
+	return result, err
+}
+
+// ExportDomain streams the subdomains of a domain matching the filter in the format, the caller closes the export
+func (c *Client) ExportDomain(ctx context.Context, domain string, format export.Format, filter SubdomainFilter) (io.ReadCloser, error) {
+	return c.export(ctx, apiPath("domains", domain, "export"), format, filter)
+}
+
+func (c *Client) export(ctx context.Context, path string, format export.Format, filter SubdomainFilter) (io.ReadCloser, error) {
+	query := filter.values()
+	set(query, "format", string(format))
+	resp, err := c.send(ctx, http.MethodGet, path, query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// AddSubdomains adds subdomains to a domain by name and reports what happened to every name
+func (c *Client) AddSubdomains(ctx context.Context, domain string, names ...string) (api.AddedSubdomains, error) {
+	added := api.AddedSubdomains{}
+	_, err := c.do(ctx, http.MethodPost, apiPath("domains", domain), nil, names, &added)
+	return added, err
+}
+
+// ImportFile is a file to import
+type ImportFile struct {
+	// Name tells the format of the file by its extension unless the import gives one
+	Name    string
+	Content io.Reader
+}
+
+// ImportOptions are the options of an import
+type ImportOptions struct {
+	// Format of every file, guessed per file if empty
+	Format importer.Format
+	// Provider is given to the names of files that don't tell where they came from, import by default
+	Provider string
+}
+
+// ImportSubdomains imports the subdomains of lists, csv files and tool output into a domain
+func (c *Client) ImportSubdomains(ctx context.Context, domain string, files []ImportFile, options ImportOptions) (api.ImportReport, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for _, file := range files {
+		part, err := form.CreateFormFile("file", file.Name)
+		if err != nil {
+			return api.ImportReport{}, err
+		}
+		if _, err := io.Copy(part, file.Content); err != nil {
+			return api.ImportReport{}, err
+		}
+	}
+	if options.Format != importer.Auto {
+		form.WriteField("format", string(options.Format))
+	}
+	if options.Provider != "" {
+		form.WriteField("provider", options.Provider)
+	}
+	if err := form.Close(); err != nil {
+		return api.ImportReport{}, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, apiPath("domains", domain, "import"), nil, body, form.FormDataContentType())
+	if err != nil {
+		return api.ImportReport{}, err
+	}
+	defer resp.Body.Close()
+
+	report := api.ImportReport{}
+	return report, json.NewDecoder(resp.Body).Decode(&report)
+}
+
+// GetSubdomain returns a subdomain with its latest dns and http snapshots
+func (c *Client) GetSubdomain(ctx context.Context, domain, name string) (api.SubdomainResponse, error) {
+	response := api.SubdomainResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("domains", domain, name), nil, nil, &response)
+	return response, err
+}
+
+// UpdateSubdomain changes the watch flags, tags and triage state of a subdomain
+func (c *Client) UpdateSubdomain(ctx context.Context, domain, name string, update api.SubdomainUpdate) (models.Subdomain, error) {
+	updated := models.Subdomain{}
+	_, err := c.do(ctx, http.MethodPatch, apiPath("domains", domain, name), nil, update, &updated)
+	return updated, err
+}
+
+// ArchiveSubdomain archives a subdomain
+func (c *Client) ArchiveSubdomain(ctx context.Context, domain, name string) (api.ArchivedSubdomain, error) {
+	archived := api.ArchivedSubdomain{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("domains", domain, name), nil, nil, &archived)
+	return archived, err
+}
+
+// PurgeSubdomain deletes a subdomain along with everything recorded about it. Without transactions
+// the records are deleted in the background by the returned job.
+func (c *Client) PurgeSubdomain(ctx context.Context, domain, name string) (api.Message, error) {
+	message := api.Message{}
+	_, err := c.do(ctx, http.MethodDelete, apiPath("domains", domain, name), url.Values{"purge": {"true"}}, nil, &message)
+	return message, err
+}
+
+// RestoreSubdomain brings back an archived subdomain
+func (c *Client) RestoreSubdomain(ctx context.Context, domain, name string) (models.Subdomain, error) {
+	restored := models.Subdomain{}
+	_, err := c.do(ctx, http.MethodPost, apiPath("domains", domain, name, "restore"), nil, nil, &restored)
+	return restored, err
+}
+
+// HTTPHistory returns up to limit http snapshots of a subdomain, newest first, with the changes between
+// them. A limit of 0 leaves it to the server.
+func (c *Client) HTTPHistory(ctx context.Context, domain, name string, limit int) (api.HTTPHistoryResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	history := api.HTTPHistoryResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("domains", domain, name, "http"), query, nil, &history)
+	return history, err
+}
+
+// DNSHistory returns up to limit dns snapshots of a subdomain, newest first. A limit of 0 leaves it to the server.
+func (c *Client) DNSHistory(ctx context.Context, domain, name string, limit int) ([]models.DNS, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	history := api.DNSHistoryResponse{}
+	_, err := c.do(ctx, http.MethodGet, apiPath("domains", domain, name, "dns"), query, nil, &history)
+	return history.Snapshots, err
+}
+
+func joinStatuses(statuses []models.StatusType) string {
+	values := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		values = append(values, string(status))
+	}
+	return strings.Join(values, ",")
+}
@@ -16,6 +16,16 @@ func GetDBCollection(col string) *mongo.Collection {
 	return db.Collection(col)
 }
 
+// GetDB returns the database opened by InitDB
+func GetDB() *mongo.Database {
+	return db
+}
+
+// Connected reports whether InitDB opened the database
+func Connected() bool {
+	return db != nil
+}
+
 func InitDB() error {
 	uri, err := config.LoadEnv("MONGODB_URI")
 	if err != nil {
@@ -42,15 +52,24 @@ func InitIndexes() error {
 	// Subdomains
 	_, err := GetDBCollection("subdomains").Indexes().CreateMany(ctx, []mongo.IndexModel{
 		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
-		{Keys: bson.D{{Key: "status", Value: 1}}},
-		{Keys: bson.D{{Key: "watch", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "triage.state", Value: 1}}},
 	})
 	if err != nil {
 		return err
 	}
 
 	// Domains
-	_, err = GetDBCollection("domains").Indexes().CreateOne(ctx, mongo.IndexModel{
+	_, err = GetDBCollection("domains").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "program", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Programs
+	_, err = GetDBCollection("programs").Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "name", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	})
@@ -74,9 +93,22 @@ func InitIndexes() error {
 		return err
 	}
 
+	// Events
+	_, err = GetDBCollection("events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func CloseDB() error {
+	if db == nil {
+		return nil
+	}
 	return db.Client().Disconnect(context.Background())
 }
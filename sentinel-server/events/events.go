@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SourceAPI is the source of events caused by api requests rather than a job
+const SourceAPI = "api"
+
+// Record stores events in the events collection, notifies the webhooks of their programs and
+// publishes them to the open streams. Events without a timestamp are stamped with the current time.
+func Record(ctx context.Context, events ...models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := bson.NewDateTimeFromTime(time.Now())
+	for i := range events {
+		if events[i].Timestamp == 0 {
+			events[i].Timestamp = now
+		}
+		// streams resume from the id of the last event they sent, so it is known before publishing
+		if events[i].ID.IsZero() {
+			events[i].ID = bson.NewObjectID()
+		}
+	}
+
+	if err := storage.GetStore().Events.Insert(ctx, events...); err != nil {
+		return err
+	}
+
+	programs := programsOf(ctx, events)
+	notify(events, programs)
+	publish(events, programs)
+
+	return nil
+}
+
+// programsOf finds the programs the domains of events belong to, domains without one map to nil
+func programsOf(ctx context.Context, events []models.Event) map[string]*models.Program {
+	programs := make(map[string]*models.Program)
+	for _, event := range events {
+		if _, ok := programs[event.Domain]; ok {
+			continue
+		}
+		program, err := storage.GetStore().DomainProgram(ctx, event.Domain)
+		if err != nil {
+			log.Printf("failed to find the program of %s: %v", event.Domain, err)
+		}
+		programs[event.Domain] = program
+	}
+	return programs
+}
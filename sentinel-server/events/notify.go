@@ -0,0 +1,66 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// notify posts events to the webhooks of the programs their domains belong to
+func notify(events []models.Event, programs map[string]*models.Program) {
+	byDomain := make(map[string][]models.Event)
+	for _, event := range events {
+		byDomain[event.Domain] = append(byDomain[event.Domain], event)
+	}
+
+	for domainName, domainEvents := range byDomain {
+		program := programs[domainName]
+		if program == nil || program.Notifications == nil || len(program.Notifications.Webhooks) == 0 {
+			continue
+		}
+
+		// only send the event types the program asked for
+		selected := make([]models.Event, 0, len(domainEvents))
+		for _, event := range domainEvents {
+			if len(program.Notifications.Events) == 0 || slices.Contains(program.Notifications.Events, event.Type) {
+				selected = append(selected, event)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(map[string]any{
+			"program": program.Name,
+			"events":  selected,
+		})
+		if err != nil {
+			log.Printf("failed to encode events of %s: %v", domainName, err)
+			continue
+		}
+
+		for _, webhook := range program.Notifications.Webhooks {
+			go postWebhook(webhook, payload)
+		}
+	}
+}
+
+func postWebhook(url string, payload []byte) {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("failed to notify webhook %s: %v", url, err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("webhook %s answered with status %d", url, resp.StatusCode)
+	}
+}
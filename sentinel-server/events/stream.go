@@ -0,0 +1,150 @@
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+const (
+	// events a subscriber can fall behind by before it is dropped
+	subscriptionBuffer = 256
+	// most events a stream is caught up with when it resumes
+	maxReplay = 1000
+)
+
+// StreamFilter selects the events of a stream, empty fields match everything
+type StreamFilter struct {
+	Domain  string
+	Program string
+	Types   []models.EventType
+}
+
+// match tells whether the filter selects an event of a domain belonging to program
+func (f StreamFilter) match(event models.Event, program *models.Program) bool {
+	if f.Domain != "" && event.Domain != f.Domain {
+		return false
+	}
+	if f.Program != "" && (program == nil || program.Name != f.Program) {
+		return false
+	}
+	return len(f.Types) == 0 || slices.Contains(f.Types, event.Type)
+}
+
+// Subscription receives the events recorded while it is open. Events is closed when the
+// subscription is closed or when it fell too far behind, the subscriber then resumes from the
+// last event it got with Replay.
+type Subscription struct {
+	Events <-chan models.Event
+
+	filter StreamFilter
+	events chan models.Event
+}
+
+var (
+	subscriptionsMu sync.Mutex
+	subscriptions   = make(map[*Subscription]struct{})
+)
+
+// Subscribe opens a subscription to the events selected by filter
+func Subscribe(filter StreamFilter) *Subscription {
+	events := make(chan models.Event, subscriptionBuffer)
+	subscription := &Subscription{Events: events, filter: filter, events: events}
+
+	subscriptionsMu.Lock()
+	subscriptions[subscription] = struct{}{}
+	subscriptionsMu.Unlock()
+
+	return subscription
+}
+
+// Close closes the subscription, it can be called more than once
+func (s *Subscription) Close() {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+
+	if _, ok := subscriptions[s]; ok {
+		delete(subscriptions, s)
+		close(s.events)
+	}
+}
+
+// CloseSubscriptions closes every open subscription, which ends their streams before a shutdown
+func CloseSubscriptions() {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+
+	for subscription := range subscriptions {
+		delete(subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// publish hands events to the subscriptions selecting them
+func publish(events []models.Event, programs map[string]*models.Program) {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+
+	for subscription := range subscriptions {
+		for _, event := range events {
+			if subscription.filter.match(event, programs[event.Domain]) && !subscription.send(event) {
+				// a slow subscriber must not hold up the jobs recording events
+				delete(subscriptions, subscription)
+				close(subscription.events)
+				break
+			}
+		}
+	}
+}
+
+// send hands an event to the subscription unless its buffer is full
+func (s *Subscription) send(event models.Event) bool {
+	select {
+	case s.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Replay returns the stored events selected by filter that were recorded after the event with
+// the id after, oldest first. Only the most recent ones are returned if there are too many.
+func Replay(ctx context.Context, filter StreamFilter, after bson.ObjectID) ([]models.Event, error) {
+	store := storage.GetStore()
+	eventFilter := storage.EventFilter{Domain: filter.Domain, Types: filter.Types, After: after, Limit: maxReplay}
+
+	// a program selects the events of its domains
+	if filter.Program != "" {
+		program, err := store.Program(ctx, filter.Program)
+		if err != nil {
+			return nil, err
+		}
+		if program == nil {
+			return []models.Event{}, nil
+		}
+		domains, err := store.Domains.List(ctx, storage.DomainFilter{Program: filter.Program, Archived: storage.IncludeArchived})
+		if err != nil {
+			return nil, err
+		}
+		if len(domains) == 0 {
+			return []models.Event{}, nil
+		}
+		for _, domain := range domains {
+			eventFilter.Domains = append(eventFilter.Domains, domain.Name)
+		}
+	}
+
+	replayed, err := store.Events.List(ctx, eventFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	// the store lists the newest first
+	slices.Reverse(replayed)
+	return replayed, nil
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	store.Programs.Create(ctx, models.Program{Name: "acme"})
+	store.Domains.Create(ctx, models.Domain{Name: "acme.com", Program: "acme"})
+	store.Domains.Create(ctx, models.Domain{Name: "other.com"})
+
+	// more events of the program than a replay returns, behind more of another domain
+	var first bson.ObjectID
+	for i := range maxReplay + 10 {
+		store.Events.Insert(ctx, models.Event{Type: models.SubdomainDiscovered, Domain: "acme.com"})
+		if i == 0 {
+			events, _ := store.Events.List(ctx, storage.EventFilter{Limit: 1})
+			first = events[0].ID
+		}
+	}
+	for range maxReplay {
+		store.Events.Insert(ctx, models.Event{Type: models.SubdomainDiscovered, Domain: "other.com"})
+	}
+
+	replayed, err := Replay(ctx, StreamFilter{Program: "acme"}, first)
+	if err != nil || len(replayed) != maxReplay {
+		t.Fatalf("expected the most recent %d events of the program: %v %d", maxReplay, err, len(replayed))
+	}
+	for _, event := range replayed {
+		if event.Domain != "acme.com" {
+			t.Fatalf("expected only the events of the program, got %+v", event)
+		}
+	}
+	if bytes.Compare(replayed[0].ID[:], replayed[len(replayed)-1].ID[:]) > 0 {
+		t.Error("expected the events oldest first")
+	}
+
+	if replayed, err := Replay(ctx, StreamFilter{Program: "missing"}, first); err != nil || len(replayed) != 0 {
+		t.Errorf("expected no events of a missing program: %v %d", err, len(replayed))
+	}
+}
@@ -0,0 +1,312 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/search"
+)
+
+// Format is the format of an export
+type Format string
+
+const (
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+	// Markdown is an asset report with a table of subdomains per domain
+	Markdown Format = "markdown"
+	// Hosts is a plain list of names, for nmap -iL and the like
+	Hosts Format = "hosts"
+	// URLs lists the urls of the http services, for burp and ffuf
+	URLs Format = "urls"
+)
+
+// Formats are the supported export formats
+var Formats = []Format{CSV, JSONL, Markdown, Hosts, URLs}
+
+// Writer writes the results of an export one at a time
+type Writer interface {
+	Write(result search.Result) error
+	// Close writes whatever comes after the last result
+	Close() error
+}
+
+// NewWriter returns a writer of the format, title names what is exported in formats that have a title
+func NewWriter(format Format, w io.Writer, title string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w)
+	case JSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	case Markdown:
+		return newMarkdownWriter(w, title)
+	case Hosts:
+		return &linesWriter{w: w, lines: func(result search.Result) []string { return []string{result.Subdomain.Name} }}, nil
+	case URLs:
+		return &linesWriter{w: w, lines: ServiceURLs}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// ContentType returns the mime type of the format
+func ContentType(format Format) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSONL:
+		return "application/x-ndjson"
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Extension returns the file extension of the format
+func Extension(format Format) string {
+	switch format {
+	case Markdown:
+		return "md"
+	case Hosts, URLs:
+		return "txt"
+	}
+	return string(format)
+}
+
+// ServiceURLs returns the url of the http service of a subdomain, built from the port of its latest
+// http snapshot, followed by where the service redirects to if that is on the same host
+func ServiceURLs(result search.Result) []string {
+	if result.HTTP == nil || result.HTTP.Failed {
+		return nil
+	}
+
+	base := &url.URL{Scheme: "http", Host: result.Subdomain.Name}
+	switch result.HTTP.Port {
+	case "443", "8443", "9443":
+		base.Scheme = "https"
+	}
+	if port := result.HTTP.Port; port != "" && port != "80" && port != "443" {
+		base.Host += ":" + port
+	}
+	urls := []string{base.String()}
+
+	if result.HTTP.Location != "" {
+		location, err := base.Parse(result.HTTP.Location)
+		if err == nil && location.Hostname() == result.Subdomain.Name && location.String() != urls[0] {
+			urls = append(urls, location.String())
+		}
+	}
+
+	return urls
+}
+
+var csvHeader = []string{
+	"domain", "name", "dns_status", "http_status", "providers", "created_at", "updated_at",
+	"a_records", "aaaa_records", "cname_records", "status_code", "title", "technologies", "urls",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	writer := &csvWriter{w: csv.NewWriter(w)}
+	return writer, writer.w.Write(csvHeader)
+}
+
+func (c *csvWriter) Write(result search.Result) error {
+	subdomain := result.Subdomain
+	dns := result.DNS
+	if dns == nil {
+		dns = &models.DNS{}
+	}
+	statusCode, title, technologies := "", "", []string(nil)
+	if result.HTTP != nil {
+		statusCode, title, technologies = strconv.Itoa(result.HTTP.StatusCode), result.HTTP.Title, result.HTTP.Technologies
+	}
+
+	record := []string{
+		subdomain.Domain,
+		subdomain.Name,
+		string(subdomain.DNSStatus),
+		string(subdomain.HTTPStatus),
+		strings.Join(subdomain.Providers, ";"),
+		formatDate(subdomain.CreatedAt.Time()),
+		formatDate(subdomain.UpdatedAt.Time()),
+		strings.Join(dns.ARecords, ";"),
+		strings.Join(dns.AAAARecords, ";"),
+		strings.Join(dns.CnameRecords, ";"),
+		statusCode,
+		title,
+		strings.Join(technologies, ";"),
+		strings.Join(ServiceURLs(result), ";"),
+	}
+	for i, cell := range record {
+		record[i] = escapeFormula(cell)
+	}
+	return c.w.Write(record)
+}
+
+// escapeFormula keeps spreadsheets from running a cell as a formula, scanned titles and
+// records are picked by whoever runs the service, so cells that start like one get a quote
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) Write(result search.Result) error {
+	return j.encoder.Encode(result)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// linesWriter writes the lines of every result, each line only once
+type linesWriter struct {
+	w     io.Writer
+	lines func(search.Result) []string
+	seen  map[string]bool
+}
+
+func (l *linesWriter) Write(result search.Result) error {
+	if l.seen == nil {
+		l.seen = map[string]bool{}
+	}
+	for _, line := range l.lines(result) {
+		if l.seen[line] {
+			continue
+		}
+		l.seen[line] = true
+		if _, err := io.WriteString(l.w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *linesWriter) Close() error {
+	return nil
+}
+
+// markdownWriter writes a table per domain and a summary of the statuses at the end
+type markdownWriter struct {
+	w          io.Writer
+	domain     string
+	total      int
+	dnsStatus  map[string]int
+	httpStatus map[string]int
+}
+
+func newMarkdownWriter(w io.Writer, title string) (*markdownWriter, error) {
+	writer := &markdownWriter{w: w, dnsStatus: map[string]int{}, httpStatus: map[string]int{}}
+	_, err := fmt.Fprintf(w, "# Asset report: %s\n\nGenerated %s\n", title, formatDate(time.Now()))
+	return writer, err
+}
+
+func (m *markdownWriter) Write(result search.Result) error {
+	subdomain := result.Subdomain
+	if subdomain.Domain != m.domain {
+		m.domain = subdomain.Domain
+		_, err := fmt.Fprintf(m.w, "\n## %s\n\n| Subdomain | DNS status | HTTP status | Addresses | Status code | Title | Technologies | URL |\n|---|---|---|---|---|---|---|---|\n",
+			m.domain)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.total++
+	m.dnsStatus[statusKey(subdomain.DNSStatus)]++
+	m.httpStatus[statusKey(subdomain.HTTPStatus)]++
+
+	var addresses []string
+	if result.DNS != nil {
+		addresses = append(slices.Clone(result.DNS.ARecords), result.DNS.AAAARecords...)
+	}
+	statusCode, title, technologies := "", "", []string(nil)
+	if result.HTTP != nil && !result.HTTP.Failed {
+		statusCode, title, technologies = strconv.Itoa(result.HTTP.StatusCode), result.HTTP.Title, result.HTTP.Technologies
+	}
+	urls := ServiceURLs(result)
+	if len(urls) > 1 {
+		urls = urls[:1]
+	}
+
+	cells := []string{
+		subdomain.Name,
+		string(subdomain.DNSStatus),
+		string(subdomain.HTTPStatus),
+		strings.Join(addresses, ", "),
+		statusCode,
+		title,
+		strings.Join(technologies, ", "),
+		strings.Join(urls, ""),
+	}
+	for i, cell := range cells {
+		cells[i] = escapeCell(cell)
+	}
+	_, err := fmt.Fprintf(m.w, "| %s |\n", strings.Join(cells, " | "))
+	return err
+}
+
+func (m *markdownWriter) Close() error {
+	if _, err := fmt.Fprintf(m.w, "\n## Summary\n\n%d subdomains\n", m.total); err != nil {
+		return err
+	}
+	for _, counts := range []struct {
+		title  string
+		counts map[string]int
+	}{{"DNS status", m.dnsStatus}, {"HTTP status", m.httpStatus}} {
+		if len(counts.counts) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(m.w, "\n| %s | Subdomains |\n|---|---|\n", counts.title); err != nil {
+			return err
+		}
+		for _, status := range slices.Sorted(maps.Keys(counts.counts)) {
+			if _, err := fmt.Fprintf(m.w, "| %s | %d |\n", status, counts.counts[status]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// escapeCell keeps a value from breaking out of its table cell
+func escapeCell(value string) string {
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func statusKey(status models.StatusType) string {
+	if status == "" {
+		return "none"
+	}
+	return string(status)
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
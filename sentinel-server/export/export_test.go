@@ -0,0 +1,96 @@
+package export
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/search"
+)
+
+func TestServiceURLs(t *testing.T) {
+	tests := []struct {
+		http     *models.HTTP
+		expected []string
+	}{
+		{nil, nil},
+		{&models.HTTP{Port: "443"}, []string{"https://app.example.com"}},
+		{&models.HTTP{Port: "80", Location: "/login"}, []string{"http://app.example.com", "http://app.example.com/login"}},
+		{&models.HTTP{Port: "8443", Location: "https://sso.example.com/"}, []string{"https://app.example.com:8443"}},
+		{&models.HTTP{Port: "8080", Failed: true}, nil},
+	}
+	for _, test := range tests {
+		result := search.Result{Subdomain: models.Subdomain{Name: "app.example.com"}, HTTP: test.http}
+		if got := ServiceURLs(result); !slices.Equal(got, test.expected) {
+			t.Errorf("ServiceURLs(%+v) = %v, expected %v", test.http, got, test.expected)
+		}
+	}
+}
+
+func TestWriters(t *testing.T) {
+	results := []search.Result{
+		{
+			Subdomain: models.Subdomain{Domain: "example.com", Name: "app.example.com", DNSStatus: models.ResolvedSubdomain, Providers: []string{"crtsh", "manual"}},
+			DNS:       &models.DNS{ARecords: []string{"1.2.3.4"}},
+			HTTP:      &models.HTTP{Port: "443", StatusCode: 200, Title: "Login | App", Technologies: []string{"Nginx"}},
+		},
+		{Subdomain: models.Subdomain{Domain: "example.com", Name: "www.example.com"}},
+	}
+	write := func(format Format) string {
+		t.Helper()
+		out := &bytes.Buffer{}
+		writer, err := NewWriter(format, out, "example.com")
+		if err != nil {
+			t.Fatalf("NewWriter(%s) failed: %v", format, err)
+		}
+		for _, result := range results {
+			if err := writer.Write(result); err != nil {
+				t.Fatalf("Write(%s) failed: %v", format, err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close(%s) failed: %v", format, err)
+		}
+		return out.String()
+	}
+
+	csv := strings.Split(strings.TrimSpace(write(CSV)), "\n")
+	if len(csv) != 3 || !strings.HasPrefix(csv[1], "example.com,app.example.com,resolved_subdomain,,crtsh;manual,") ||
+		!strings.HasSuffix(csv[1], ",1.2.3.4,,,200,Login | App,Nginx,https://app.example.com") {
+		t.Errorf("unexpected csv:\n%s", strings.Join(csv, "\n"))
+	}
+
+	// cells that a spreadsheet would run as a formula are quoted
+	results[1].HTTP = &models.HTTP{StatusCode: 200, Title: "=HYPERLINK(\"https://evil.com\")", Technologies: []string{"@SUM(1)", "-1+1"}}
+	csv = strings.Split(strings.TrimSpace(write(CSV)), "\n")
+	if len(csv) != 3 || !strings.Contains(csv[2], `,200,"'=HYPERLINK(""https://evil.com"")",'@SUM(1);-1+1,`) {
+		t.Errorf("unexpected csv with formulas:\n%s", strings.Join(csv, "\n"))
+	}
+	results[1].HTTP = nil
+
+	if jsonl := strings.Split(strings.TrimSpace(write(JSONL)), "\n"); len(jsonl) != 2 || !strings.Contains(jsonl[0], `"title":"Login | App"`) {
+		t.Errorf("unexpected jsonl: %v", jsonl)
+	}
+
+	if hosts := write(Hosts); hosts != "app.example.com\nwww.example.com\n" {
+		t.Errorf("unexpected hosts: %q", hosts)
+	}
+	if urls := write(URLs); urls != "https://app.example.com\n" {
+		t.Errorf("unexpected urls: %q", urls)
+	}
+
+	markdown := write(Markdown)
+	for _, expected := range []string{
+		"# Asset report: example.com",
+		"## example.com",
+		`| app.example.com | resolved_subdomain |  | 1.2.3.4 | 200 | Login \| App | Nginx | https://app.example.com |`,
+		"2 subdomains",
+		"| resolved_subdomain | 1 |",
+	} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("expected the markdown report to contain %q:\n%s", expected, markdown)
+		}
+	}
+}
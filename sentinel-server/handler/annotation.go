@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// The annotation handlers serve both domains and subdomains, the target is
+// a subdomain when the route has a subdomainName param and a domain otherwise.
+
+var triageStates = []models.TriageState{
+	models.TriageNew,
+	models.TriageReviewed,
+	models.TriageInteresting,
+	models.TriageIgnored,
+	models.TriageReported,
+}
+
+// analyst returns who made the request, taken from the X-Analyst header
+func analyst(c *fiber.Ctx) string {
+	if name := strings.TrimSpace(c.Get("X-Analyst")); name != "" {
+		return name
+	}
+	return "api"
+}
+
+// errNoteNotFound aborts an annotation update on a note the target doesn't have
+var errNoteNotFound = errors.New("note not found")
+
+// updateAnnotations applies change to the annotations of the target and returns them afterwards
+func updateAnnotations(c *fiber.Ctx, change func(*models.Annotations) error) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	subdomainName := strings.ToLower(c.Params("subdomainName"))
+	store := storage.GetStore()
+
+	kind := "domain"
+	annotations := models.Annotations{}
+	var err error
+	if subdomainName != "" {
+		kind = "subdomain"
+		var subdomain models.Subdomain
+		subdomain, err = store.Subdomains.Update(c.Context(), domainName, subdomainName, func(subdomain *models.Subdomain) error {
+			subdomain.UpdatedAt = bson.NewDateTimeFromTime(time.Now())
+			return change(&subdomain.Annotations)
+		})
+		annotations = subdomain.Annotations
+	} else {
+		var domain models.Domain
+		domain, err = store.Domains.Update(c.Context(), domainName, func(domain *models.Domain) error {
+			return change(&domain.Annotations)
+		})
+		annotations = domain.Annotations
+	}
+	if err == storage.ErrNotFound {
+		return notFound(kind + " not found")
+	}
+	if err == errNoteNotFound {
+		return notFound(err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(annotations)
+}
+
+// normalizeTags lowercases, trims and dedupes tags, it reports false if a tag is empty
+func normalizeTags(tags []string) ([]string, bool) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, false
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, true
+}
+
+// SetTags replaces the tags of a domain or subdomain
+func SetTags(c *fiber.Ctx) error {
+	body := api.TagsRequest{}
+	if err := c.BodyParser(&body); err != nil {
+		return invalid(err.Error())
+	}
+
+	tags, ok := normalizeTags(body.Tags)
+	if !ok {
+		return invalid("tags cannot be empty")
+	}
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		annotations.Tags = tags
+		return nil
+	})
+}
+
+// AddTags adds tags to a domain or subdomain, keeping the existing ones
+func AddTags(c *fiber.Ctx) error {
+	body := api.TagsRequest{}
+	if err := c.BodyParser(&body); err != nil {
+		return invalid(err.Error())
+	}
+
+	tags, ok := normalizeTags(body.Tags)
+	if !ok || len(tags) == 0 {
+		return invalid("at least one non empty tag is required")
+	}
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		for _, tag := range tags {
+			if !slices.Contains(annotations.Tags, tag) {
+				annotations.Tags = append(annotations.Tags, tag)
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveTag removes a single tag from a domain or subdomain
+func RemoveTag(c *fiber.Ctx) error {
+	tag := strings.ToLower(c.Params("tag"))
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		annotations.Tags = slices.DeleteFunc(annotations.Tags, func(t string) bool { return t == tag })
+		return nil
+	})
+}
+
+// AddNote attaches a note written by the requesting analyst to a domain or subdomain
+func AddNote(c *fiber.Ctx) error {
+	body := api.NoteRequest{}
+	if err := c.BodyParser(&body); err != nil {
+		return invalid(err.Error())
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		return invalid("note text is required")
+	}
+
+	note := models.Note{
+		ID:        bson.NewObjectID(),
+		Text:      body.Text,
+		Author:    analyst(c),
+		CreatedAt: bson.NewDateTimeFromTime(time.Now()),
+	}
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		annotations.Notes = append(annotations.Notes, note)
+		return nil
+	})
+}
+
+// UpdateNote changes the text of a note
+func UpdateNote(c *fiber.Ctx) error {
+	noteID, err := bson.ObjectIDFromHex(c.Params("noteID"))
+	if err != nil {
+		return invalid("invalid note id")
+	}
+
+	body := api.NoteRequest{}
+	if err := c.BodyParser(&body); err != nil {
+		return invalid(err.Error())
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		return invalid("note text is required")
+	}
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		i := noteIndex(annotations.Notes, noteID)
+		if i < 0 {
+			return errNoteNotFound
+		}
+		annotations.Notes[i].Text = body.Text
+		annotations.Notes[i].UpdatedAt = bson.NewDateTimeFromTime(time.Now())
+		return nil
+	})
+}
+
+// DeleteNote removes a note
+func DeleteNote(c *fiber.Ctx) error {
+	noteID, err := bson.ObjectIDFromHex(c.Params("noteID"))
+	if err != nil {
+		return invalid("invalid note id")
+	}
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		i := noteIndex(annotations.Notes, noteID)
+		if i < 0 {
+			return errNoteNotFound
+		}
+		annotations.Notes = slices.Delete(annotations.Notes, i, i+1)
+		return nil
+	})
+}
+
+// noteIndex returns the index of the note with the given id, or -1 if there is none
+func noteIndex(notes []models.Note, noteID bson.ObjectID) int {
+	return slices.IndexFunc(notes, func(note models.Note) bool { return note.ID == noteID })
+}
+
+// SetTriage changes the triage state of a domain or subdomain and records the change in its triage history
+func SetTriage(c *fiber.Ctx) error {
+	body := api.TriageRequest{}
+	if err := c.BodyParser(&body); err != nil {
+		return invalid(err.Error())
+	}
+	if !slices.Contains(triageStates, body.State) {
+		return invalid("invalid triage state: " + string(body.State))
+	}
+
+	triage := models.Triage{
+		State:     body.State,
+		ChangedBy: analyst(c),
+		ChangedAt: bson.NewDateTimeFromTime(time.Now()),
+	}
+
+	return updateAnnotations(c, func(annotations *models.Annotations) error {
+		annotations.Triage = &triage
+		annotations.TriageHistory = append(annotations.TriageHistory, triage)
+		return nil
+	})
+}
+
+// annotationFilter returns the tag and triage query filters of a listing
+func annotationFilter(c *fiber.Ctx) (string, models.TriageState) {
+	return strings.ToLower(c.Query("tag")), models.TriageState(c.Query("triage"))
+}
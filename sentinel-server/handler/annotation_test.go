@@ -0,0 +1,70 @@
+package handler_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestAnnotations(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com"]`, nil)
+
+	// tags are normalized and added ones are kept
+	var annotations models.Annotations
+	if status := request(t, app, "PUT", "/api/v1/domains/example.com/tags", `{"tags":[" Prod ","prod"]}`, &annotations); status != 200 {
+		t.Fatalf("expected 200 setting the tags, got %d", status)
+	}
+	request(t, app, "POST", "/api/v1/domains/example.com/tags", `{"tags":["cdn"]}`, &annotations)
+	if !slices.Equal(annotations.Tags, []string{"prod", "cdn"}) {
+		t.Errorf("tags = %v, want [prod cdn]", annotations.Tags)
+	}
+	request(t, app, "DELETE", "/api/v1/domains/example.com/tags/PROD", "", &annotations)
+	if !slices.Equal(annotations.Tags, []string{"cdn"}) {
+		t.Errorf("tags = %v, want [cdn]", annotations.Tags)
+	}
+	if status := request(t, app, "POST", "/api/v1/domains/example.com/tags", `{"tags":[]}`, nil); status != 400 {
+		t.Errorf("expected 400 adding no tags, got %d", status)
+	}
+
+	// notes of subdomains are written, edited and deleted by their id
+	request(t, app, "POST", "/api/v1/domains/example.com/www.example.com/notes", `{"text":"login page"}`, &annotations)
+	if len(annotations.Notes) != 1 || annotations.Notes[0].Author != "api" {
+		t.Fatalf("unexpected notes %+v", annotations.Notes)
+	}
+	note := "/api/v1/domains/example.com/www.example.com/notes/" + annotations.Notes[0].ID.Hex()
+	request(t, app, "PATCH", note, `{"text":"admin login page"}`, &annotations)
+	if annotations.Notes[0].Text != "admin login page" || annotations.Notes[0].UpdatedAt == 0 {
+		t.Errorf("expected the note to be edited: %+v", annotations.Notes[0])
+	}
+	if status := request(t, app, "PATCH", note, `{"text":" "}`, nil); status != 400 {
+		t.Errorf("expected 400 for an empty note, got %d", status)
+	}
+	var deleted models.Annotations
+	request(t, app, "DELETE", note, "", &deleted)
+	if len(deleted.Notes) != 0 {
+		t.Errorf("expected the note to be deleted: %+v", deleted.Notes)
+	}
+	if status := request(t, app, "DELETE", note, "", nil); status != 404 {
+		t.Errorf("expected 404 for a deleted note, got %d", status)
+	}
+	if status := request(t, app, "DELETE", "/api/v1/domains/example.com/www.example.com/notes/nope", "", nil); status != 400 {
+		t.Errorf("expected 400 for an invalid note id, got %d", status)
+	}
+
+	// every triage change is kept in the history
+	request(t, app, "PUT", "/api/v1/domains/example.com/www.example.com/triage", `{"state":"reviewed"}`, nil)
+	request(t, app, "PUT", "/api/v1/domains/example.com/www.example.com/triage", `{"state":"interesting"}`, &annotations)
+	if annotations.Triage == nil || annotations.Triage.State != models.TriageInteresting || len(annotations.TriageHistory) != 2 {
+		t.Errorf("unexpected triage %+v %+v", annotations.Triage, annotations.TriageHistory)
+	}
+	if status := request(t, app, "PUT", "/api/v1/domains/example.com/www.example.com/triage", `{"state":"maybe"}`, nil); status != 400 {
+		t.Errorf("expected 400 for an unknown triage state, got %d", status)
+	}
+	if status := request(t, app, "PUT", "/api/v1/domains/example.com/missing.example.com/triage", `{"state":"reviewed"}`, nil); status != 404 {
+		t.Errorf("expected 404 for a missing subdomain, got %d", status)
+	}
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/events"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Deleting a domain or subdomain archives it, archived assets keep their history but are hidden
+// from listings and scans. They can be restored, or purged for real with ?purge=true.
+
+var (
+	errArchived    = errors.New("already archived")
+	errNotArchived = errors.New("not archived")
+)
+
+// archivedFilter returns the archive filter of a listing, given by the archived query param
+// as "exclude" (the default), "include" or "only"
+func archivedFilter(c *fiber.Ctx) (storage.ArchiveFilter, bool) {
+	switch c.Query("archived") {
+	case "", "exclude":
+		return storage.ExcludeArchived, true
+	case "include":
+		return storage.IncludeArchived, true
+	case "only":
+		return storage.OnlyArchived, true
+	}
+	return 0, false
+}
+
+// archiveDomain archives a domain along with its active subdomains
+func archiveDomain(c *fiber.Ctx, domainName string) error {
+	store := storage.GetStore()
+	now := bson.NewDateTimeFromTime(time.Now())
+
+	domain, err := store.Domains.Update(c.Context(), domainName, func(domain *models.Domain) error {
+		if domain.ArchivedAt != 0 {
+			return errArchived
+		}
+		domain.ArchivedAt = now
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err == errArchived {
+		return conflict("domain is already archived")
+	}
+	if err != nil {
+		return err
+	}
+
+	// the subdomains are archived at the same time so that restoring the domain brings back exactly these
+	if _, err := store.Subdomains.SetArchivedAt(c.Context(), domainName, 0, now); err != nil {
+		return err
+	}
+
+	recordArchiveEvent(c, models.DomainArchived, domainName, "")
+
+	return c.Status(200).JSON(api.ArchivedDomain{
+		Message: domainName + " domain and its subdomains have been archived",
+		Domain:  domain,
+	})
+}
+
+// RestoreDomain brings back an archived domain along with the subdomains archived with it
+func RestoreDomain(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	store := storage.GetStore()
+
+	var archivedAt bson.DateTime
+	domain, err := store.Domains.Update(c.Context(), domainName, func(domain *models.Domain) error {
+		if domain.ArchivedAt == 0 {
+			return errNotArchived
+		}
+		archivedAt, domain.ArchivedAt = domain.ArchivedAt, 0
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err == errNotArchived {
+		return conflict("domain is not archived")
+	}
+	if err != nil {
+		return err
+	}
+
+	// subdomains archived on their own before stay archived
+	if _, err := store.Subdomains.SetArchivedAt(c.Context(), domainName, archivedAt, 0); err != nil {
+		return err
+	}
+
+	recordArchiveEvent(c, models.DomainRestored, domainName, "")
+
+	return c.Status(200).JSON(domain)
+}
+
+// archiveSubdomain archives a single subdomain
+func archiveSubdomain(c *fiber.Ctx, domainName, subdomainName string) error {
+	subdomain, err := storage.GetStore().Subdomains.Update(c.Context(), domainName, subdomainName, func(subdomain *models.Subdomain) error {
+		if subdomain.ArchivedAt != 0 {
+			return errArchived
+		}
+		subdomain.ArchivedAt = bson.NewDateTimeFromTime(time.Now())
+		subdomain.UpdatedAt = subdomain.ArchivedAt
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("subdomain not found")
+	}
+	if err == errArchived {
+		return conflict("subdomain is already archived")
+	}
+	if err != nil {
+		return err
+	}
+
+	recordArchiveEvent(c, models.SubdomainArchived, domainName, subdomainName)
+
+	return c.Status(200).JSON(api.ArchivedSubdomain{
+		Message:   subdomainName + " subdomain has been archived",
+		Subdomain: subdomain,
+	})
+}
+
+// RestoreSubdomain brings back an archived subdomain of an active domain
+func RestoreSubdomain(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	subdomainName := strings.ToLower(c.Params("subdomainName"))
+	store := storage.GetStore()
+
+	// Check if the domain is active
+	domain, err := store.Domains.Get(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err != nil {
+		return err
+	}
+	if domain.ArchivedAt != 0 {
+		return conflict("domain is archived, restore it first")
+	}
+
+	subdomain, err := store.Subdomains.Update(c.Context(), domainName, subdomainName, func(subdomain *models.Subdomain) error {
+		if subdomain.ArchivedAt == 0 {
+			return errNotArchived
+		}
+		subdomain.ArchivedAt = 0
+		subdomain.UpdatedAt = bson.NewDateTimeFromTime(time.Now())
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("subdomain not found")
+	}
+	if err == errNotArchived {
+		return conflict("subdomain is not archived")
+	}
+	if err != nil {
+		return err
+	}
+
+	recordArchiveEvent(c, models.SubdomainRestored, domainName, subdomainName)
+
+	return c.Status(200).JSON(subdomain)
+}
+
+func recordArchiveEvent(c *fiber.Ctx, eventType models.EventType, domainName, subdomainName string) {
+	event := models.Event{
+		Type:      eventType,
+		Domain:    domainName,
+		Subdomain: subdomainName,
+		Source:    events.SourceAPI,
+	}
+	if err := events.Record(c.Context(), event); err != nil {
+		log.Printf("failed to record %s of %s: %v", eventType, domainName, err)
+	}
+}
@@ -0,0 +1,79 @@
+package handler_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+)
+
+func TestArchive(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","api.example.com"]`, nil)
+
+	// archive a subdomain, it is hidden but its name stays known
+	if status := request(t, app, "DELETE", "/api/v1/domains/example.com/api.example.com", "", nil); status != 200 {
+		t.Fatalf("archiving the subdomain returned %d", status)
+	}
+	listing := struct {
+		Subdomains []string `json:"subdomains"`
+	}{}
+	request(t, app, "GET", "/api/v1/domains/example.com", "", &listing)
+	if strings.Join(listing.Subdomains, ",") != "www.example.com" {
+		t.Errorf("active subdomains = %v", listing.Subdomains)
+	}
+	request(t, app, "GET", "/api/v1/domains/example.com?archived=only", "", &listing)
+	if strings.Join(listing.Subdomains, ",") != "api.example.com" {
+		t.Errorf("archived subdomains = %v", listing.Subdomains)
+	}
+	added := api.AddedSubdomains{}
+	if request(t, app, "POST", "/api/v1/domains/example.com", `["api.example.com"]`, &added); len(added.Added) != 0 || added.Duplicate != 1 {
+		t.Errorf("re-adding an archived subdomain should add nothing, got %+v", added)
+	}
+
+	// archiving the domain archives the remaining subdomains with it, a restore tells them
+	// apart from the ones archived before by their timestamp which is in milliseconds
+	time.Sleep(2 * time.Millisecond)
+	if status := request(t, app, "DELETE", "/api/v1/domains/example.com", "", nil); status != 200 {
+		t.Fatalf("archiving the domain returned %d", status)
+	}
+	if status := request(t, app, "DELETE", "/api/v1/domains/example.com", "", nil); status != 409 {
+		t.Errorf("archiving the domain twice returned %d, want 409", status)
+	}
+	domains := struct {
+		Domains []string `json:"domains"`
+	}{}
+	request(t, app, "GET", "/api/v1/domains/", "", &domains)
+	if len(domains.Domains) != 0 {
+		t.Errorf("archived domain is still listed: %v", domains.Domains)
+	}
+	if status := request(t, app, "POST", "/api/v1/domains/example.com/api.example.com/restore", "", nil); status != 409 {
+		t.Errorf("restoring a subdomain of an archived domain returned %d, want 409", status)
+	}
+
+	// restoring the domain only brings back the subdomains archived with it
+	if status := request(t, app, "POST", "/api/v1/domains/example.com/restore", "", nil); status != 200 {
+		t.Fatalf("restoring the domain returned %d", status)
+	}
+	request(t, app, "GET", "/api/v1/domains/example.com", "", &listing)
+	if strings.Join(listing.Subdomains, ",") != "www.example.com" {
+		t.Errorf("restored subdomains = %v", listing.Subdomains)
+	}
+	if status := request(t, app, "POST", "/api/v1/domains/example.com/api.example.com/restore", "", nil); status != 200 {
+		t.Errorf("restoring the subdomain returned %d", status)
+	}
+	if status := request(t, app, "POST", "/api/v1/domains/example.com/api.example.com/restore", "", nil); status != 409 {
+		t.Errorf("restoring an active subdomain returned %d, want 409", status)
+	}
+
+	// purging removes it for real
+	if status := request(t, app, "DELETE", "/api/v1/domains/example.com/api.example.com?purge=true", "", nil); status != 200 {
+		t.Fatalf("purging the subdomain returned %d", status)
+	}
+	if status := request(t, app, "GET", "/api/v1/domains/example.com/api.example.com", "", nil); status != 404 {
+		t.Errorf("purged subdomain returned %d, want 404", status)
+	}
+}
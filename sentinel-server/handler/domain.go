@@ -3,24 +3,22 @@ package handler
 import (
 	"strings"
 
-	"github.com/0xgwyn/sentinel/database"
+	"github.com/0xgwyn/sentinel/api"
 	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/scope"
+	"github.com/0xgwyn/sentinel/storage"
 	"github.com/dchest/validator"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 func UpdateDomain(c *fiber.Ctx) error {
 	domainName := strings.ToLower(c.Params("domainName"))
-	coll := database.GetDBCollection("domains")
 
 	// Parse the body
 	domain := models.Domain{}
 	if err := c.BodyParser(&domain); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return invalid(err.Error())
 	}
 
 	// Convert all elements in InScope and OutOfScope to lowercase
@@ -36,142 +34,164 @@ func UpdateDomain(c *fiber.Ctx) error {
 	}
 
 	// Update the scope of the domain if it exists
-	filter := bson.M{"name": domainName}
-	update := bson.M{}
-	if domain.InScope != nil {
-		update["in_scope"] = domain.InScope
-	}
-	if domain.OutOfScope != nil {
-		update["out_of_scope"] = domain.OutOfScope
+	if domain.InScope == nil && domain.OutOfScope == nil && domain.Retention == nil {
+		return invalid("either in_scope, out_of_scope or retention is needed")
 	}
-	if len(update) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "either in_scope or out_of_scope is needed"})
+	if domain.Retention != nil {
+		if msg := validateRetentionPolicy(domain.Retention); msg != "" {
+			return invalid(msg)
+		}
 	}
 
-	update = bson.M{"$set": update}
-	result, err := coll.UpdateOne(c.Context(), filter, update)
+	updated, err := storage.GetStore().Domains.Update(c.Context(), domainName, func(stored *models.Domain) error {
+		if domain.InScope != nil {
+			stored.InScope = domain.InScope
+		}
+		if domain.OutOfScope != nil {
+			stored.OutOfScope = domain.OutOfScope
+		}
+		if domain.Retention != nil {
+			stored.Retention = domain.Retention
+		}
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
+	}
+
+	// subdomains the new scope leaves out stop being scanned, the ones it brings back are queued
+	if domain.InScope != nil || domain.OutOfScope != nil {
+		if err := rescopeDomain(c, updated); err != nil {
+			return err
+		}
 	}
 
-	return c.Status(200).JSON(result)
+	return c.Status(200).JSON(updated)
 }
 
 func GetDomain(c *fiber.Ctx) error {
 	domainName := strings.ToLower(c.Params("domainName"))
-	domainsColl := database.GetDBCollection("domains")
-	subdomainsColl := database.GetDBCollection("subdomains")
+	store := storage.GetStore()
 
 	// find the requested domain
-	domain := models.Domain{}
-	domainFilter := bson.M{"name": domainName}
-	domainProjection := bson.M{"name": 1, "in_scope": 1, "out_of_scope": 1}
-	domainOpts := options.FindOne().SetProjection(domainProjection)
-	if err := domainsColl.FindOne(c.Context(), domainFilter, domainOpts).Decode(&domain); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	domain, err := store.Domains.Get(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
 	}
-
-	// find the subdomains related to the domain
-	subdomainFilter := bson.M{"domain": domain.Name}
-	subdomainProjection := bson.M{"name": 1}
-	subdomainOpts := options.Find().SetProjection(subdomainProjection)
-	cursor, err := subdomainsColl.Find(c.Context(), subdomainFilter, subdomainOpts)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
-	defer cursor.Close(c.Context())
 
-	// iterate over the cursor
-	subdomains := make([]string, 0)
-	for cursor.Next(c.Context()) {
-		subdomain := models.Subdomain{}
-		err := cursor.Decode(&subdomain)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+	// the seeds the scheduler enumerates for the domain, derived from its scope
+	var program *models.Program
+	if domain.Program != "" {
+		if program, err = store.Program(c.Context(), domain.Program); err != nil {
+			return err
 		}
-		// only get the Name field
+	}
+	stored, err := store.DomainNames(c.Context())
+	if err != nil {
+		return err
+	}
+	seeds := scope.Seeds(domain, program, stored)
+
+	// find the subdomains related to the domain, optionally filtered by tag, triage state, seed and archive state
+	filter := storage.SubdomainFilter{Domain: domain.Name, Seed: strings.ToLower(c.Query("seed"))}
+	filter.Tag, filter.Triage = annotationFilter(c)
+	archived, ok := archivedFilter(c)
+	if !ok {
+		return invalid("archived must be exclude, include or only")
+	}
+	filter.Archived = archived
+	found, err := store.Subdomains.List(c.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	// only get the Name field
+	subdomains := make([]string, 0, len(found))
+	for _, subdomain := range found {
 		subdomains = append(subdomains, subdomain.Name)
 	}
 
-	return c.Status(200).JSON(fiber.Map{
-		"domain":     domain,
-		"subdomains": subdomains,
+	return c.Status(200).JSON(api.DomainResponse{
+		Domain:     domain,
+		Seeds:      seeds,
+		Subdomains: subdomains,
 	})
 }
 
 func GetDomains(c *fiber.Ctx) error {
-	coll := database.GetDBCollection("domains")
-
-	// find all domains
-	projection := bson.M{"name": 1}
-	opts := options.Find().SetProjection(projection)
-	cursor, err := coll.Find(c.Context(), bson.M{}, opts)
+	// find all domains, optionally filtered by tag, triage state and archive state
+	archived, ok := archivedFilter(c)
+	if !ok {
+		return invalid("archived must be exclude, include or only")
+	}
+	filter := storage.DomainFilter{Archived: archived}
+	filter.Tag, filter.Triage = annotationFilter(c)
+	found, err := storage.GetStore().Domains.List(c.Context(), filter)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
-	defer cursor.Close(c.Context())
 
-	// iterate over the cursor
-	domains := make([]string, 0)
-	for cursor.Next(c.Context()) {
-		domain := models.Domain{}
-		err := cursor.Decode(&domain)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		}
-		// only get the Name field
+	// only get the Name field
+	domains := make([]string, 0, len(found))
+	for _, domain := range found {
 		domains = append(domains, domain.Name)
 	}
 
-	return c.Status(200).JSON(fiber.Map{
-		"domains": domains,
+	return c.Status(200).JSON(api.DomainList{
+		Domains: domains,
 	})
 }
 
 func CreateDomain(c *fiber.Ctx) error {
-	coll := database.GetDBCollection("domains")
+	store := storage.GetStore()
 
 	// Parse the body
 	domain := models.Domain{}
 	if err := c.BodyParser(&domain); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return invalid(err.Error())
 	}
 
 	// Check if the domain is valid
 	if !validator.IsValidDomain(domain.Name) {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "invalid domain",
-		})
+		return invalid("invalid domain")
 	}
 
 	// Check if either out of scope or in scope is not set (at least one should be set)
 	if len(domain.InScope) == 0 && len(domain.OutOfScope) == 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "in_scope or out_of_scope is required",
-		})
+		return invalid("in_scope or out_of_scope is required")
 	}
 
-	// Check if the domain already exists in the collection
-	filter := bson.M{"name": strings.ToLower(domain.Name)}
-	existingDomain := models.Domain{}
-	if err := coll.FindOne(c.Context(), filter).Decode(&existingDomain); err == nil {
-		return c.Status(409).JSON(fiber.Map{
-			"error": "domain already exists",
-		})
+	// Notes and triage are only set through their own endpoints
+	domain.Notes = nil
+	domain.Triage = nil
+	domain.TriageHistory = nil
+	if tags, ok := normalizeTags(domain.Tags); ok {
+		domain.Tags = tags
+	} else {
+		return invalid("tags cannot be empty")
+	}
+
+	// Check if the program exists if one is given
+	if domain.Program != "" {
+		domain.Program = strings.ToLower(domain.Program)
+		program, err := store.Program(c.Context(), domain.Program)
+		if err != nil {
+			return err
+		}
+		if program == nil {
+			return invalid("program not found: " + domain.Program)
+		}
+	}
+
+	// Check the retention policy if one is given
+	if msg := validateRetentionPolicy(domain.Retention); msg != "" {
+		return invalid(msg)
 	}
 
 	// Convert all elements in InScope and OutOfScope to lowercase
@@ -188,11 +208,16 @@ func CreateDomain(c *fiber.Ctx) error {
 
 	// create the domain also save the domain in lowercase
 	domain.Name = strings.ToLower(domain.Name)
-	_, err := coll.InsertOne(c.Context(), domain)
+	err := store.Domains.Create(c.Context(), domain)
+	if err == storage.ErrExists {
+		msg := "domain already exists"
+		if existing, err := store.Domains.Get(c.Context(), domain.Name); err == nil && existing.ArchivedAt != 0 {
+			msg = "domain is archived, restore it instead"
+		}
+		return conflict(msg)
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
 	return c.Status(201).JSON(domain)
@@ -200,53 +225,30 @@ func CreateDomain(c *fiber.Ctx) error {
 
 func DeleteDomain(c *fiber.Ctx) error {
 	domainName := strings.ToLower(c.Params("domainName"))
-	domainsColl := database.GetDBCollection("domains")
-	subdomainsColl := database.GetDBCollection("subdomains")
-	httpColl := database.GetDBCollection("http")
-	dnsColl := database.GetDBCollection("dns")
-
-	// Delete the requested domain if it exists
-	domainsFilter := bson.M{"name": domainName}
-	result, err := domainsColl.DeleteOne(c.Context(), domainsFilter)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-	if result.DeletedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "domain not found",
-		})
-	}
 
-	// Delete all subdomains of that domain
-	subdomainsFilter := bson.M{"domain": domainName}
-	_, err = subdomainsColl.DeleteMany(c.Context(), subdomainsFilter)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	// Archive the domain unless it should be purged for real
+	if !c.QueryBool("purge", false) {
+		return archiveDomain(c, domainName)
 	}
 
-	// Delete all HTTP records of that domain
-	httpFilter := bson.M{"domain": domainName}
-	_, err = httpColl.DeleteMany(c.Context(), httpFilter)
+	// Delete the requested domain and all its related records if it exists
+	job, err := scheduler.DeleteDomain(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
-	// Delete all DNS records of that domain
-	dnsFilter := bson.M{"domain": domainName}
-	_, err = dnsColl.DeleteMany(c.Context(), dnsFilter)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
+	// Without transactions the related records are deleted by a job
+	if job != nil {
+		return c.Status(202).JSON(api.Message{
+			Message: domainName + " domain has been removed, its related records (subdomains, HTTP, DNS) are being deleted",
+			Job:     job,
 		})
 	}
 
-	return c.Status(200).JSON(fiber.Map{
-		"message": domainName + " domain and all related records (subdomains, HTTP, DNS) have been removed",
+	return c.Status(200).JSON(api.Message{
+		Message: domainName + " domain and all related records (subdomains, HTTP, DNS) have been removed",
 	})
 }
@@ -0,0 +1,66 @@
+package handler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/api"
+)
+
+func TestDomainLifecycle(t *testing.T) {
+	app := newTestApp(t)
+
+	status := request(t, app, "POST", "/api/v1/domains/", `{"name":"Example.com","in_scope":["*.Example.com"]}`, nil)
+	if status != 201 {
+		t.Fatalf("creating the domain returned %d", status)
+	}
+	if status := request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil); status != 409 {
+		t.Errorf("creating the domain twice returned %d, want 409", status)
+	}
+
+	added := api.AddedSubdomains{}
+	if status := request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","api.example.com","www.example.com"]`, &added); status != 200 {
+		t.Fatalf("adding subdomains returned %d", status)
+	}
+	if len(added.Added) != 2 || added.Duplicate != 1 {
+		t.Errorf("added %d subdomains with %d duplicates, want 2 and 1", len(added.Added), added.Duplicate)
+	}
+
+	domain := struct {
+		Domain struct {
+			InScope []string `json:"in_scope"`
+		} `json:"domain"`
+		Subdomains []string `json:"subdomains"`
+	}{}
+	if status := request(t, app, "GET", "/api/v1/domains/example.com", "", &domain); status != 200 {
+		t.Fatalf("getting the domain returned %d", status)
+	}
+	if len(domain.Domain.InScope) != 1 || domain.Domain.InScope[0] != "*.example.com" {
+		t.Errorf("in scope = %v, want it lowercased", domain.Domain.InScope)
+	}
+	if strings.Join(domain.Subdomains, ",") != "api.example.com,www.example.com" {
+		t.Errorf("subdomains = %v", domain.Subdomains)
+	}
+
+	if status := request(t, app, "PUT", "/api/v1/domains/example.com/www.example.com/tags", `{"tags":["Login"]}`, nil); status != 200 {
+		t.Errorf("tagging the subdomain returned %d", status)
+	}
+	tagged := struct {
+		Subdomains []string `json:"subdomains"`
+	}{}
+	request(t, app, "GET", "/api/v1/domains/example.com?tag=login", "", &tagged)
+	if strings.Join(tagged.Subdomains, ",") != "www.example.com" {
+		t.Errorf("subdomains tagged login = %v", tagged.Subdomains)
+	}
+
+	if status := request(t, app, "GET", "/api/v1/domains/example.com/missing.example.com", "", nil); status != 404 {
+		t.Errorf("getting a missing subdomain returned %d, want 404", status)
+	}
+
+	if status := request(t, app, "DELETE", "/api/v1/domains/example.com?purge=true", "", nil); status != 200 {
+		t.Fatalf("purging the domain returned %d", status)
+	}
+	if status := request(t, app, "GET", "/api/v1/domains/example.com/www.example.com", "", nil); status != 404 {
+		t.Errorf("subdomain outlived its domain, got %d", status)
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// errorCodes are the codes of the error statuses, other client and server errors are
+// invalid requests and internal errors
+var errorCodes = map[int]api.ErrorCode{
+	fiber.StatusBadRequest:            api.CodeInvalidRequest,
+	fiber.StatusUnauthorized:          api.CodeUnauthorized,
+	fiber.StatusNotFound:              api.CodeNotFound,
+	fiber.StatusMethodNotAllowed:      api.CodeMethodNotAllowed,
+	fiber.StatusConflict:              api.CodeConflict,
+	fiber.StatusRequestEntityTooLarge: api.CodePayloadTooLarge,
+	fiber.StatusNotImplemented:        api.CodeNotImplemented,
+}
+
+// requestError is an error response, handlers return it for ErrorHandler to write
+type requestError struct {
+	status int
+	body   api.ErrorBody
+}
+
+func newRequestError(status int, message string) *requestError {
+	code, ok := errorCodes[status]
+	switch {
+	case ok:
+	case status >= 500:
+		code = api.CodeInternal
+	default:
+		code = api.CodeInvalidRequest
+	}
+	return &requestError{status: status, body: api.ErrorBody{Code: code, Message: message}}
+}
+
+func (e *requestError) Error() string {
+	return e.body.Message
+}
+
+// with adds the details helping with fixing the request
+func (e *requestError) with(details api.ErrorDetails) *requestError {
+	e.body.Details = &details
+	return e
+}
+
+// invalid is the error of a malformed request or one that failed validation
+func invalid(message string) *requestError {
+	return newRequestError(fiber.StatusBadRequest, message)
+}
+
+// notFound is the error of a request about something that doesn't exist
+func notFound(message string) *requestError {
+	return newRequestError(fiber.StatusNotFound, message)
+}
+
+// conflict is the error of a request that conflicts with the current state
+func conflict(message string) *requestError {
+	return newRequestError(fiber.StatusConflict, message)
+}
+
+// legacyError is the flat error body of the unversioned api
+type legacyError struct {
+	Error string `json:"error"`
+	*api.ErrorDetails
+}
+
+// ErrorHandler writes the errors returned by the handlers and middlewares. Errors the handlers
+// don't expect are logged and answered with a 500 that doesn't tell what went wrong. The versioned
+// api wraps the errors in an api.Error, the unversioned one keeps the flat body it always had.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var reqErr *requestError
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &reqErr):
+	case errors.As(err, &fiberErr):
+		reqErr = newRequestError(fiberErr.Code, strings.ToLower(fiberErr.Message))
+	case errors.Is(err, storage.ErrNotFound):
+		reqErr = notFound("not found")
+	case errors.Is(err, storage.ErrExists):
+		reqErr = conflict("already exists")
+	default:
+		log.Printf("%s %s failed: %v", c.Method(), c.Path(), err)
+		reqErr = newRequestError(fiber.StatusInternalServerError, "internal server error")
+	}
+
+	if !strings.HasPrefix(c.Path(), "/api/v1/") {
+		return c.Status(reqErr.status).JSON(legacyError{Error: reqErr.body.Message, ErrorDetails: reqErr.body.Details})
+	}
+	return c.Status(reqErr.status).JSON(api.Error{Error: reqErr.body})
+}
+
+// stringsOf converts values of a string type for the details of an error
+func stringsOf[T ~string](values []T) []string {
+	converted := make([]string, 0, len(values))
+	for _, value := range values {
+		converted = append(converted, string(value))
+	}
+	return converted
+}
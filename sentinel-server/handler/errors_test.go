@@ -0,0 +1,71 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/0xgwyn/sentinel/api"
+)
+
+func TestErrors(t *testing.T) {
+	app := newTestApp(t)
+	app.Get("/api/v1/failing", func(c *fiber.Ctx) error {
+		return errors.New("connection refused by the database at 10.0.0.1")
+	})
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+
+	// send decodes the error body without checking it against the openapi document, the
+	// unversioned api and the failing route aren't documented
+	send := func(method, path, body string, out any) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(out)
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   api.ErrorCode
+	}{
+		{"GET", "/api/v1/domains/missing.com", "", 404, api.CodeNotFound},
+		{"POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, 409, api.CodeConflict},
+		{"POST", "/api/v1/domains/", `{"name":"not a domain"}`, 400, api.CodeInvalidRequest},
+		{"PATCH", "/api/v1/domains/example.com", `{`, 400, api.CodeInvalidRequest},
+		{"GET", "/api/v1/nothing", "", 404, api.CodeNotFound},
+		{"GET", "/api/v1/failing", "", 500, api.CodeInternal},
+	}
+	for _, c := range cases {
+		body := api.Error{}
+		status := send(c.method, c.path, c.body, &body)
+		if status != c.status || body.Error.Code != c.code || body.Error.Message == "" {
+			t.Errorf("%s %s returned %d %+v, want %d %s", c.method, c.path, status, body.Error, c.status, c.code)
+		}
+		if strings.Contains(body.Error.Message, "database") {
+			t.Errorf("%s %s leaked the error %q", c.method, c.path, body.Error.Message)
+		}
+	}
+
+	// the unversioned api keeps its flat error bodies
+	legacy := map[string]any{}
+	if status := send("GET", "/api/domains/missing.com", "", &legacy); status != 404 || legacy["error"] != "domain not found" {
+		t.Errorf("the unversioned api returned %d %v", status, legacy)
+	}
+	legacy = map[string]any{}
+	if status := send("GET", "/api/search?q=nope:x", "", &legacy); status != 400 || legacy["fields"] == nil {
+		t.Errorf("the unversioned api returned %d %v, want the fields of a query", status, legacy)
+	}
+}
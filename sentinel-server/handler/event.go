@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+// GetEvents returns the asset timeline, newest first. It can be filtered by domain, subdomain,
+// event types (comma separated) and a time range (RFC3339), and paged with the id of the last event seen.
+func GetEvents(c *fiber.Ctx) error {
+	// Parse the limit
+	limit := c.QueryInt("limit", defaultEventsLimit)
+	if limit <= 0 || limit > maxEventsLimit {
+		return invalid("limit must be between 1 and 1000")
+	}
+
+	// Build the filter
+	filter := storage.EventFilter{
+		Domain:    strings.ToLower(c.Query("domain")),
+		Subdomain: strings.ToLower(c.Query("subdomain")),
+		Limit:     limit,
+	}
+	if types := c.Query("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			filter.Types = append(filter.Types, models.EventType(strings.TrimSpace(eventType)))
+		}
+	}
+
+	for param, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return invalid("invalid " + param + " time, expected RFC3339")
+		}
+		*bound = t
+	}
+
+	if before := c.Query("before"); before != "" {
+		id, err := bson.ObjectIDFromHex(before)
+		if err != nil {
+			return invalid("invalid before event id")
+		}
+		filter.Before = id
+	}
+
+	// Find the events, newest first (ids grow with insertion time)
+	timeline, err := storage.GetStore().Events.List(c.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(api.EventList{
+		Events: timeline,
+	})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/export"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportBatchSize is how many subdomains an export reads at a time
+const exportBatchSize = 500
+
+// ExportDomain streams the subdomains of a domain along with their latest dns and http records
+// in the format given by the format query param (csv by default), filtered like GetSubdomains
+func ExportDomain(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return invalid("invalid format").with(api.ErrorDetails{Formats: stringsOf(export.Formats)})
+	}
+	filter, err := subdomainFilter(c, domainName)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// Check if the domain exists
+	if _, err := storage.GetStore().Domains.Get(c.Context(), domainName); err == storage.ErrNotFound {
+		return notFound("domain not found")
+	} else if err != nil {
+		return err
+	}
+
+	return streamExport(c, format, domainName, []storage.SubdomainFilter{filter})
+}
+
+// ExportProgram streams the subdomains of every domain of a program the way ExportDomain does
+func ExportProgram(c *fiber.Ctx) error {
+	programName := strings.ToLower(c.Params("programName"))
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return invalid("invalid format").with(api.ErrorDetails{Formats: stringsOf(export.Formats)})
+	}
+	filter, err := subdomainFilter(c, "")
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// Check if the program exists
+	if err := programExists(c, programName); err != nil {
+		return err
+	}
+	domains, err := programDomains(c, programName)
+	if err != nil {
+		return err
+	}
+
+	// the domains are exported one after the other
+	filters := make([]storage.SubdomainFilter, 0, len(domains))
+	for _, domainName := range domains {
+		filter.Domain = domainName
+		filters = append(filters, filter)
+	}
+
+	return streamExport(c, format, programName, filters)
+}
+
+func exportFormat(c *fiber.Ctx) (export.Format, bool) {
+	format := export.Format(strings.ToLower(c.Query("format", string(export.CSV))))
+	return format, slices.Contains(export.Formats, format)
+}
+
+// streamExport writes the subdomains matching the filters, a batch at a time. The response is already
+// on its way when the subdomains are read, so errors can only cut it short and are logged.
+func streamExport(c *fiber.Ctx, format export.Format, title string, filters []storage.SubdomainFilter) error {
+	store := storage.GetStore()
+
+	c.Attachment(title + "-subdomains." + export.Extension(format))
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx := context.Background()
+
+		writer, err := export.NewWriter(format, w, title)
+		if err != nil {
+			log.Printf("failed to export %s: %v", title, err)
+			return
+		}
+
+		for _, filter := range filters {
+			page := storage.SearchPage{Filter: filter, Limit: exportBatchSize}
+			for {
+				results, err := store.Search.Find(ctx, page)
+				if err != nil {
+					log.Printf("failed to export %s: %v", title, err)
+					return
+				}
+				for _, result := range results {
+					if err := writer.Write(result); err != nil {
+						log.Printf("failed to export %s: %v", title, err)
+						return
+					}
+				}
+				if err := w.Flush(); err != nil {
+					// the client went away
+					return
+				}
+
+				if len(results) < exportBatchSize {
+					break
+				}
+				cursor := storage.CursorOf(storage.SortByName, results[len(results)-1].Subdomain)
+				page.After = &cursor
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			log.Printf("failed to export %s: %v", title, err)
+			return
+		}
+		w.Flush()
+	})
+
+	return nil
+}
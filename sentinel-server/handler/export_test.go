@@ -0,0 +1,47 @@
+package handler_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","api.example.com"]`, nil)
+	request(t, app, "POST", "/api/v1/programs/", `{"name":"acme","domains":["example.com"]}`, nil)
+
+	export := func(path string) (int, string, string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Disposition"), string(data)
+	}
+
+	status, disposition, body := export("/api/v1/domains/example.com/export?format=hosts&name=www.*")
+	if status != 200 || body != "www.example.com\n" {
+		t.Errorf("hosts export returned %d %q", status, body)
+	}
+	if !strings.Contains(disposition, "example.com-subdomains.txt") {
+		t.Errorf("unexpected content disposition %q", disposition)
+	}
+
+	status, _, body = export("/api/v1/programs/acme/export")
+	if lines := strings.Split(strings.TrimSpace(body), "\n"); status != 200 || len(lines) != 3 || !strings.HasPrefix(lines[0], "domain,name,") {
+		t.Errorf("program csv export returned %d %q", status, body)
+	}
+
+	if status, _, _ := export("/api/v1/domains/example.com/export?format=xml"); status != 400 {
+		t.Errorf("exporting an unknown format returned %d, want 400", status)
+	}
+	if status, _, _ := export("/api/v1/domains/missing.com/export"); status != 404 {
+		t.Errorf("exporting a missing domain returned %d, want 404", status)
+	}
+}
@@ -0,0 +1,62 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/0xgwyn/sentinel/handler"
+	"github.com/0xgwyn/sentinel/openapi"
+	"github.com/0xgwyn/sentinel/router"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// newTestApp serves the api from a fresh bolt store
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	previous := storage.GetStore()
+	storage.SetStore(store)
+	t.Cleanup(func() {
+		storage.SetStore(previous)
+		store.Close()
+	})
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: handler.ErrorHandler})
+	router.AddRouterGroup(app)
+	return app
+}
+
+// request sends a request to the app and decodes the json response into out if it isn't nil.
+// Every response is checked against the openapi document.
+func request(t *testing.T, app *fiber.App, method, path, body string, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if err := openapi.ValidateResponse(method, path, resp.StatusCode, data); err != nil {
+		t.Errorf("response does not conform to the openapi document: %v", err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s returned invalid json %q: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+func GetHTTPHistory(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	subdomainName := strings.ToLower(c.Params("subdomainName"))
+
+	// Parse the limit
+	limit := c.QueryInt("limit", defaultHistoryLimit)
+	if limit <= 0 || limit > maxHistoryLimit {
+		return invalid("limit must be between 1 and 500")
+	}
+
+	// find the snapshots of the subdomain, newest first
+	snapshots, err := storage.GetStore().HTTP.History(c.Context(), domainName, subdomainName, limit)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		return notFound("no http records found for " + subdomainName)
+	}
+
+	// compare every snapshot with the one scanned right before it
+	diffs := make([]models.HTTPDiff, 0)
+	for i := 0; i < len(snapshots)-1; i++ {
+		current, previous := snapshots[i], snapshots[i+1]
+		changes := models.DiffHTTP(previous, current)
+		if len(changes) == 0 {
+			continue
+		}
+		diffs = append(diffs, models.HTTPDiff{
+			From:    previous.ScanningDate,
+			To:      current.ScanningDate,
+			Changes: changes,
+		})
+	}
+
+	return c.Status(200).JSON(api.HTTPHistoryResponse{
+		Snapshots: snapshots,
+		Diffs:     diffs,
+	})
+}
+
+// GetDNSHistory returns the dns snapshots of a subdomain, newest first. A snapshot is only stored when
+// the records change, so every snapshot differs from the one before it.
+func GetDNSHistory(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	subdomainName := strings.ToLower(c.Params("subdomainName"))
+
+	// Parse the limit
+	limit := c.QueryInt("limit", defaultHistoryLimit)
+	if limit <= 0 || limit > maxHistoryLimit {
+		return invalid("limit must be between 1 and 500")
+	}
+
+	snapshots, err := storage.GetStore().DNS.History(c.Context(), domainName, subdomainName, limit)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		return notFound("no dns records found for " + subdomainName)
+	}
+
+	return c.Status(200).JSON(api.DNSHistoryResponse{
+		Snapshots: snapshots,
+	})
+}
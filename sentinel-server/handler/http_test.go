@@ -0,0 +1,61 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestDNSHistoryAndJobs(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com"]`, nil)
+
+	resolved := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		storage.GetStore().DNS.Insert(ctx, models.DNS{
+			ResolutionDate: bson.NewDateTimeFromTime(resolved.Add(time.Duration(i) * time.Minute)),
+			Domain:         "example.com",
+			Subdomain:      "www.example.com",
+			ARecords:       []string{ip},
+		})
+	}
+
+	history := api.DNSHistoryResponse{}
+	if status := request(t, app, "GET", "/api/v1/domains/example.com/www.example.com/dns", "", &history); status != 200 {
+		t.Fatalf("getting the dns history returned %d", status)
+	}
+	if len(history.Snapshots) != 2 || history.Snapshots[0].ARecords[0] != "2.2.2.2" {
+		t.Errorf("expected the snapshots newest first, got %+v", history.Snapshots)
+	}
+	if status := request(t, app, "GET", "/api/v1/domains/example.com/api.example.com/dns", "", nil); status != 404 {
+		t.Errorf("getting the dns history of a subdomain without snapshots returned %d, want 404", status)
+	}
+
+	jobs := storage.GetStore().Jobs
+	for _, jobType := range []models.JobType{"dnsx", "httpx", "dnsx"} {
+		jobs.Start(ctx, models.Job{Type: jobType, StartTime: time.Now(), Status: models.JobStatusPending})
+	}
+
+	list := api.JobList{}
+	request(t, app, "GET", "/api/v1/jobs?type=dnsx", "", &list)
+	if len(list.Jobs) != 2 || list.Jobs[0].Type != "dnsx" {
+		t.Errorf("expected the two dnsx jobs, got %+v", list.Jobs)
+	}
+	list = api.JobList{}
+	request(t, app, "GET", "/api/v1/jobs?limit=1", "", &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].Type != "dnsx" {
+		t.Errorf("expected the latest job, got %+v", list.Jobs)
+	}
+	if status := request(t, app, "GET", "/api/v1/jobs?limit=0", "", nil); status != 400 {
+		t.Errorf("listing no jobs returned %d, want 400", status)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/importer"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportSubdomains imports the subdomains of the files uploaded as "file" in a multipart form. The format
+// form value picks the format of all files, otherwise it is guessed per file, and the provider form value
+// is given to the names of files that don't tell where they came from (defaults to "import").
+// It reports what happened to every line.
+func ImportSubdomains(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+
+	// Parse the form
+	form, err := c.MultipartForm()
+	if err != nil {
+		return invalid(err.Error())
+	}
+	if len(form.File["file"]) == 0 {
+		return invalid("no file to import")
+	}
+	format := importer.Format(strings.ToLower(c.FormValue("format")))
+	if format != importer.Auto && !slices.Contains(importer.Formats, format) {
+		return invalid("invalid format").with(api.ErrorDetails{Formats: stringsOf(importer.Formats)})
+	}
+	provider := strings.ToLower(strings.TrimSpace(c.FormValue("provider")))
+	if provider == "" {
+		provider = "import"
+	}
+
+	// Check if the domain exists and isn't archived
+	domain, err := storage.GetStore().Domains.Get(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err != nil {
+		return err
+	}
+	if domain.ArchivedAt != 0 {
+		return conflict("domain is archived, restore it first")
+	}
+
+	// Read the entries of every file
+	files := make([]scheduler.ImportFile, 0, len(form.File["file"]))
+	for _, header := range form.File["file"] {
+		fileFormat := format
+		if fileFormat == importer.Auto {
+			fileFormat = importer.DetectFormat(header.Filename)
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return err
+		}
+		entries, err := importer.Parse(file, fileFormat, provider)
+		file.Close()
+		if err != nil {
+			return invalid(header.Filename + ": " + err.Error())
+		}
+		files = append(files, scheduler.ImportFile{Name: header.Filename, Entries: entries})
+	}
+
+	report, err := scheduler.Import(c.Context(), domain, files)
+	if err != nil {
+		log.Printf("importing into %s failed: %v", domain.Name, err)
+		return newRequestError(500, "import failed").with(api.ErrorDetails{Report: &report})
+	}
+
+	return c.Status(200).JSON(report)
+}
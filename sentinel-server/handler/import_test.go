@@ -0,0 +1,79 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImportSubdomains(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"],"out_of_scope":["internal.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com"]`, nil)
+
+	// a plain list and httpx output of one of its names
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	files := map[string]string{
+		"names.txt":   "www.example.com\napi.example.com\ninternal.example.com\nevil.com\nnot a name\napi.example.com\n",
+		"httpx.jsonl": `{"url":"https://api.example.com","input":"api.example.com","status_code":200,"title":"API","tech":["Nginx"]}`,
+	}
+	for _, name := range []string{"names.txt", "httpx.jsonl"} {
+		part, _ := form.CreateFormFile("file", name)
+		part.Write([]byte(files[name]))
+	}
+	form.WriteField("provider", "amass")
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/v1/domains/example.com/import", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("importing failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("importing returned %d", resp.StatusCode)
+	}
+
+	report := struct {
+		Accepted   int `json:"accepted"`
+		Duplicate  int `json:"duplicate"`
+		Invalid    int `json:"invalid"`
+		OutOfScope int `json:"out_of_scope"`
+		Lines      []struct {
+			File   string `json:"file"`
+			Line   int    `json:"line"`
+			Status string `json:"status"`
+		} `json:"lines"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if report.Accepted != 1 || report.Duplicate != 3 || report.Invalid != 1 || report.OutOfScope != 2 || len(report.Lines) != 7 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.Lines[2].Line != 3 || report.Lines[2].Status != "out_of_scope" {
+		t.Errorf("expected internal.example.com on line 3 to be out of scope, got %+v", report.Lines[2])
+	}
+
+	// the httpx line attached its service to the imported subdomain
+	subdomain := struct {
+		Subdomain struct {
+			Providers  []string `json:"providers"`
+			HTTPStatus string   `json:"http_status"`
+		} `json:"subdomain"`
+		HTTP struct {
+			Title string `json:"title"`
+		} `json:"latest_http"`
+	}{}
+	request(t, app, "GET", "/api/v1/domains/example.com/api.example.com", "", &subdomain)
+	if subdomain.HTTP.Title != "API" || subdomain.Subdomain.HTTPStatus != "fresh_service" ||
+		strings.Join(subdomain.Subdomain.Providers, ",") != "amass" {
+		t.Errorf("imported subdomain = %+v", subdomain)
+	}
+}
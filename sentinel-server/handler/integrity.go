@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	defaultJobsLimit = 100
+	maxJobsLimit     = 1000
+)
+
+// GetOrphanReport is a dry run of the integrity job, it counts the records whose domain or subdomain no longer
+// exists and the domains whose program no longer exists. With delete_domains the records of those domains count as well.
+func GetOrphanReport(c *fiber.Ctx) error {
+	report, err := storage.GetStore().Cascades.DeleteOrphans(c.Context(), true, c.QueryBool("delete_domains", false))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// RunIntegrity deletes the orphaned records right away instead of waiting for the integrity job.
+// The domains whose program no longer exists are only deleted with delete_domains, the job never deletes them.
+func RunIntegrity(c *fiber.Ctx) error {
+	report, err := storage.GetStore().Cascades.DeleteOrphans(c.Context(), false, c.QueryBool("delete_domains", false))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// GetJobs returns the latest runs of the jobs, of every type or of the type given in the query
+func GetJobs(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultJobsLimit)
+	if limit <= 0 || limit > maxJobsLimit {
+		return invalid("limit must be between 1 and 1000")
+	}
+
+	jobs, err := storage.GetStore().Jobs.List(c.Context(), storage.JobFilter{
+		Type:  models.JobType(c.Query("type")),
+		Limit: limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(api.JobList{
+		Jobs: jobs,
+	})
+}
+
+// GetJob returns a job, e.g. to follow a deletion running in the background
+func GetJob(c *fiber.Ctx) error {
+	jobID, err := bson.ObjectIDFromHex(c.Params("jobID"))
+	if err != nil {
+		return invalid("invalid job id")
+	}
+
+	job, err := storage.GetStore().Jobs.Get(c.Context(), jobID)
+	if err == storage.ErrNotFound {
+		return notFound("job not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(job)
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultSubdomainsLimit = 100
+	maxSubdomainsLimit     = 1000
+)
+
+// subdomainFields are the json fields of a subdomain a listing can be projected to
+var subdomainFields = jsonFields(reflect.TypeFor[models.Subdomain]())
+
+// listingCursor is the opaque position a subdomain listing continues from, it remembers
+// the order it was made for so that it can't be used to continue a different one
+type listingCursor struct {
+	Sort       storage.SubdomainSort   `json:"s"`
+	Descending bool                    `json:"o,omitempty"`
+	After      storage.SubdomainCursor `json:"a"`
+}
+
+// GetSubdomains returns a page of the subdomains of a domain. It can be filtered by dns and http
+// statuses (comma separated), provider, watch flags, name pattern (* matches anything) and
+// created or updated time ranges (RFC3339), sorted by name or any timestamp, and projected to
+// the comma separated fields. The next page starts at next_cursor.
+func GetSubdomains(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+
+	// Parse the limit
+	limit := c.QueryInt("limit", defaultSubdomainsLimit)
+	if limit <= 0 || limit > maxSubdomainsLimit {
+		return invalid("limit must be between 1 and 1000")
+	}
+
+	// Build the filter
+	filter, err := subdomainFilter(c, domainName)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// Parse the order
+	page := storage.SubdomainPage{
+		Filter: filter,
+		Sort:   storage.SubdomainSort(c.Query("sort", string(storage.SortByName))),
+		// one more than asked for tells whether there is a next page
+		Limit: limit + 1,
+	}
+	if !slices.Contains(storage.SubdomainSorts, page.Sort) {
+		return invalid("invalid sort field")
+	}
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		page.Descending = true
+	default:
+		return invalid("order must be asc or desc")
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return invalid("invalid cursor")
+		}
+		if cursor.Sort != page.Sort || cursor.Descending != page.Descending {
+			return invalid("cursor belongs to a listing with a different order")
+		}
+		page.After = &cursor.After
+	}
+
+	// Parse the projection
+	var fields []string
+	if value := c.Query("fields"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(subdomainFields, field) {
+				return invalid("unknown field: " + field)
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	// Check if the domain exists
+	if _, err := storage.GetStore().Domains.Get(c.Context(), domainName); err == storage.ErrNotFound {
+		return notFound("domain not found")
+	} else if err != nil {
+		return err
+	}
+
+	found, err := storage.GetStore().Subdomains.Page(c.Context(), page)
+	if err != nil {
+		return err
+	}
+
+	response := api.SubdomainListing{}
+	if len(found) > limit {
+		found = found[:limit]
+		response.NextCursor = encodeCursor(listingCursor{
+			Sort:       page.Sort,
+			Descending: page.Descending,
+			After:      storage.CursorOf(page.Sort, found[limit-1]),
+		})
+	}
+	response.Count = len(found)
+
+	if fields == nil {
+		response.Subdomains = found
+		return c.Status(200).JSON(response)
+	}
+	projected, err := project(found, fields)
+	if err != nil {
+		return err
+	}
+
+	// the projected subdomains take the place of the full ones
+	return c.Status(200).JSON(struct {
+		api.SubdomainListing
+		Subdomains []map[string]any `json:"subdomains"`
+	}{response, projected})
+}
+
+// subdomainFilter builds the filter of a subdomain listing of a domain from its query params, the
+// error tells which param is invalid
+func subdomainFilter(c *fiber.Ctx, domainName string) (storage.SubdomainFilter, error) {
+	archived, ok := archivedFilter(c)
+	if !ok {
+		return storage.SubdomainFilter{}, errors.New("archived must be exclude, include or only")
+	}
+	tag, triage := annotationFilter(c)
+	filter := storage.SubdomainFilter{
+		Archived:     archived,
+		Domain:       domainName,
+		Tag:          tag,
+		Triage:       triage,
+		DNSStatuses:  statusList(c.Query("dns_status")),
+		HTTPStatuses: statusList(c.Query("http_status")),
+		Provider:     strings.ToLower(c.Query("provider")),
+		NamePattern:  strings.ToLower(c.Query("name")),
+	}
+
+	for param, watch := range map[string]**bool{"watch_dns": &filter.WatchDNS, "watch_http": &filter.WatchHTTP, "in_scope": &filter.InScope} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New(param + " must be true or false")
+		}
+		*watch = &flag
+	}
+
+	bounds := map[string]*time.Time{
+		"created_since": &filter.CreatedSince,
+		"created_until": &filter.CreatedUntil,
+		"updated_since": &filter.UpdatedSince,
+		"updated_until": &filter.UpdatedUntil,
+	}
+	for param, bound := range bounds {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errors.New("invalid " + param + " time, expected RFC3339")
+		}
+		*bound = t
+	}
+
+	return filter, nil
+}
+
+// statusList splits a comma separated list of statuses
+func statusList(value string) []models.StatusType {
+	if value == "" {
+		return nil
+	}
+	var statuses []models.StatusType
+	for _, status := range strings.Split(value, ",") {
+		statuses = append(statuses, models.StatusType(strings.TrimSpace(status)))
+	}
+	return statuses
+}
+
+func encodeCursor(cursor listingCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (cursor listingCursor, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	return cursor, json.Unmarshal(data, &cursor)
+}
+
+// project keeps only the given json fields of every item
+func project[T any](items []T, fields []string) ([]map[string]any, error) {
+	projected := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		full := map[string]any{}
+		if err := json.Unmarshal(data, &full); err != nil {
+			return nil, err
+		}
+
+		fieldMap := make(map[string]any, len(fields))
+		for _, field := range fields {
+			if value, ok := full[field]; ok {
+				fieldMap[field] = value
+			}
+		}
+		projected = append(projected, fieldMap)
+	}
+	return projected, nil
+}
+
+// jsonFields returns the names of the json fields of a struct, embedded structs included
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,56 @@
+package handler_test
+
+import (
+	"testing"
+)
+
+func TestListSubdomains(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","api.example.com","dev.example.com"]`, nil)
+	request(t, app, "DELETE", "/api/v1/domains/example.com/dev.example.com", "", nil)
+
+	type listing struct {
+		Subdomains []map[string]any `json:"subdomains"`
+		Count      int              `json:"count"`
+		NextCursor string           `json:"next_cursor"`
+	}
+
+	// walk the active subdomains newest first, one per page
+	names := []string{}
+	path := "/api/v1/domains/example.com/subdomains?limit=1&sort=created_at&order=desc&fields=name"
+	for cursor := ""; ; {
+		page := listing{}
+		if status := request(t, app, "GET", path+"&cursor="+cursor, "", &page); status != 200 {
+			t.Fatalf("listing the subdomains returned %d", status)
+		}
+		for _, subdomain := range page.Subdomains {
+			if len(subdomain) != 1 {
+				t.Errorf("expected only the name field, got %v", subdomain)
+			}
+			names = append(names, subdomain["name"].(string))
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("listed %v, want the two active subdomains", names)
+	}
+
+	page := listing{}
+	request(t, app, "GET", "/api/v1/domains/example.com/subdomains?name=d*&archived=include", "", &page)
+	if page.Count != 1 || page.Subdomains[0]["name"] != "dev.example.com" || page.NextCursor != "" {
+		t.Errorf("name pattern listing = %+v", page)
+	}
+
+	for _, query := range []string{"sort=providers", "order=up", "fields=secret", "watch_dns=maybe", "cursor=nope", "limit=0"} {
+		if status := request(t, app, "GET", "/api/v1/domains/example.com/subdomains?"+query, "", nil); status != 400 {
+			t.Errorf("listing with %s returned %d, want 400", query, status)
+		}
+	}
+	if status := request(t, app, "GET", "/api/v1/domains/missing.com/subdomains", "", nil); status != 404 {
+		t.Errorf("listing a missing domain returned %d, want 404", status)
+	}
+}
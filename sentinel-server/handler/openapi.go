@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"github.com/0xgwyn/sentinel/openapi"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOpenAPI serves the OpenAPI document describing every route of the api
+func GetOpenAPI(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(200).Send(openapi.JSON())
+}
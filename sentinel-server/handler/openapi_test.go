@@ -0,0 +1,44 @@
+package handler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/openapi"
+)
+
+func TestOpenAPIRoutes(t *testing.T) {
+	app := newTestApp(t)
+
+	// every route is documented and every documented operation is routed
+	documented := map[string]bool{}
+	for _, operation := range openapi.Operations {
+		documented[operation.Method+" "+operation.Path] = true
+	}
+	routed := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == "HEAD" {
+			continue
+		}
+		// the unversioned api mirrors the versioned one
+		path := route.Path
+		if !strings.HasPrefix(path, "/api/v1/") {
+			path = "/api/v1" + strings.TrimPrefix(path, "/api")
+		}
+		key := route.Method + " " + path
+		routed[key] = true
+		if !documented[key] {
+			t.Errorf("%s is not in the openapi document", key)
+		}
+	}
+	for key := range documented {
+		if !routed[key] {
+			t.Errorf("%s is documented but not routed", key)
+		}
+	}
+
+	document := map[string]any{}
+	if status := request(t, app, "GET", "/api/v1/openapi.json", "", &document); status != 200 || document["openapi"] != "3.0.3" {
+		t.Errorf("serving the openapi document returned %d", status)
+	}
+}
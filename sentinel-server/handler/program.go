@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"maps"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var programNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+func GetPrograms(c *fiber.Ctx) error {
+	// find all programs
+	found, err := storage.GetStore().Programs.List(c.Context())
+	if err != nil {
+		return err
+	}
+
+	// only get the Name field
+	programs := make([]string, 0, len(found))
+	for _, program := range found {
+		programs = append(programs, program.Name)
+	}
+
+	return c.Status(200).JSON(api.ProgramList{
+		Programs: programs,
+	})
+}
+
+func GetProgram(c *fiber.Ctx) error {
+	programName := strings.ToLower(c.Params("programName"))
+
+	// find the requested program
+	program, err := storage.GetStore().Programs.Get(c.Context(), programName)
+	if err == storage.ErrNotFound {
+		return notFound("program not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// find the domains of the program
+	domains, err := programDomains(c, programName)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(api.ProgramResponse{
+		Program: program,
+		Domains: domains,
+	})
+}
+
+func CreateProgram(c *fiber.Ctx) error {
+	store := storage.GetStore()
+
+	// Parse the body
+	body := api.ProgramRequest{}
+	if err := c.BodyParser(&body); err != nil {
+		return invalid(err.Error())
+	}
+	program := body.Program
+	program.Name = strings.ToLower(program.Name)
+
+	// Check if the program name is valid
+	if !programNameRegex.MatchString(program.Name) {
+		return invalid("invalid program name")
+	}
+
+	// Check if the program already exists
+	if _, err := store.Programs.Get(c.Context(), program.Name); err == nil {
+		return conflict("program already exists")
+	} else if err != storage.ErrNotFound {
+		return err
+	}
+
+	program.InScope = lowercaseAll(program.InScope)
+	program.OutOfScope = lowercaseAll(program.OutOfScope)
+	program.CreatedAt = bson.NewDateTimeFromTime(time.Now())
+
+	// Check that the domains to add exist before creating anything
+	domainNames := lowercaseAll(body.Domains)
+	if msg, err := checkDomainsExist(c, domainNames); err != nil {
+		return err
+	} else if msg != "" {
+		return invalid(msg)
+	}
+
+	// create the program and add the domains to it
+	err := store.Programs.Create(c.Context(), program)
+	if err == storage.ErrExists {
+		return conflict("program already exists")
+	}
+	if err != nil {
+		return err
+	}
+	for _, domainName := range domainNames {
+		domain, err := store.Domains.Update(c.Context(), domainName, func(domain *models.Domain) error {
+			domain.Program = program.Name
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := rescopeDomain(c, domain); err != nil {
+			return err
+		}
+	}
+
+	return c.Status(201).JSON(program)
+}
+
+func UpdateProgram(c *fiber.Ctx) error {
+	programName := strings.ToLower(c.Params("programName"))
+
+	// Parse the body
+	program := models.Program{}
+	if err := c.BodyParser(&program); err != nil {
+		return invalid(err.Error())
+	}
+
+	// Only update the fields that are given
+	if program.Platform == "" && program.URL == "" && program.InScope == nil && program.OutOfScope == nil &&
+		program.Rewards == nil && program.ScanSettings == nil && program.Notifications == nil {
+		return invalid("nothing to update")
+	}
+
+	updated, err := storage.GetStore().Programs.Update(c.Context(), programName, func(stored *models.Program) error {
+		if program.Platform != "" {
+			stored.Platform = program.Platform
+		}
+		if program.URL != "" {
+			stored.URL = program.URL
+		}
+		if program.InScope != nil {
+			stored.InScope = lowercaseAll(program.InScope)
+		}
+		if program.OutOfScope != nil {
+			stored.OutOfScope = lowercaseAll(program.OutOfScope)
+		}
+		if program.Rewards != nil {
+			stored.Rewards = program.Rewards
+		}
+		if program.ScanSettings != nil {
+			stored.ScanSettings = program.ScanSettings
+		}
+		if program.Notifications != nil {
+			stored.Notifications = program.Notifications
+		}
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("program not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// the scope of every domain of the program changed along with it
+	if program.InScope != nil || program.OutOfScope != nil {
+		if err := rescopeProgram(c, updated); err != nil {
+			return err
+		}
+	}
+
+	return c.Status(200).JSON(updated)
+}
+
+// DeleteProgram deletes a program along with all its domains and their related records
+func DeleteProgram(c *fiber.Ctx) error {
+	programName := strings.ToLower(c.Params("programName"))
+
+	// Delete the requested program with every domain of it the way DeleteDomain does, archived ones included
+	domains, err := scheduler.DeleteProgram(c.Context(), programName)
+	if err == storage.ErrNotFound {
+		return notFound("program not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(api.DeletedProgram{
+		Message: programName + " program and all related records (domains, subdomains, HTTP, DNS) have been removed",
+		Domains: domains,
+	})
+}
+
+// AddProgramDomain moves an existing domain into the program
+func AddProgramDomain(c *fiber.Ctx) error {
+	return setDomainProgram(c, strings.ToLower(c.Params("programName")))
+}
+
+// RemoveProgramDomain takes a domain out of the program without deleting it
+func RemoveProgramDomain(c *fiber.Ctx) error {
+	return setDomainProgram(c, "")
+}
+
+func setDomainProgram(c *fiber.Ctx, program string) error {
+	programName := strings.ToLower(c.Params("programName"))
+	domainName := strings.ToLower(c.Params("domainName"))
+
+	// Check if the program exists
+	if err := programExists(c, programName); err != nil {
+		return err
+	}
+
+	// Adding takes the domain from any program, removing only works on domains of this program
+	domain, err := storage.GetStore().Domains.Update(c.Context(), domainName, func(domain *models.Domain) error {
+		if program == "" && domain.Program != programName {
+			return storage.ErrNotFound
+		}
+		domain.Program = program
+		return nil
+	})
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// the domain takes the scope rules of its new program, or loses the ones of its old one
+	if err := rescopeDomain(c, domain); err != nil {
+		return err
+	}
+
+	domains, err := programDomains(c, programName)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(api.ProgramDomains{
+		Program: programName,
+		Domains: domains,
+	})
+}
+
+// GetProgramStats counts the domains of a program and their subdomains by status
+func GetProgramStats(c *fiber.Ctx) error {
+	programName := strings.ToLower(c.Params("programName"))
+
+	// Check if the program exists
+	if err := programExists(c, programName); err != nil {
+		return err
+	}
+
+	domains, err := programDomains(c, programName)
+	if err != nil {
+		return err
+	}
+
+	// count the subdomains of all domains by their statuses in one go,
+	// a program without domains has nothing to count
+	counts := storage.SubdomainStats{}
+	if len(domains) > 0 {
+		if counts, err = storage.GetStore().Subdomains.Stats(c.Context(), domains...); err != nil {
+			return err
+		}
+	}
+
+	stats := api.ProgramStatsResponse{
+		Program:             programName,
+		Domains:             len(domains),
+		Subdomains:          counts.Total,
+		SubdomainsPerDomain: make(map[string]int),
+		DNSStatus:           make(map[string]int),
+		HTTPStatus:          make(map[string]int),
+	}
+	for _, domainName := range domains {
+		stats.SubdomainsPerDomain[domainName] = counts.PerDomain[domainName]
+	}
+	maps.Copy(stats.DNSStatus, counts.DNSStatus)
+	maps.Copy(stats.HTTPStatus, counts.HTTPStatus)
+
+	return c.Status(200).JSON(stats)
+}
+
+// programExists returns the error to respond with if the program can't be found
+func programExists(c *fiber.Ctx, programName string) error {
+	_, err := storage.GetStore().Programs.Get(c.Context(), programName)
+	if err == storage.ErrNotFound {
+		return notFound("program not found")
+	}
+	return err
+}
+
+// programDomains returns the names of the domains of a program
+func programDomains(c *fiber.Ctx, programName string) ([]string, error) {
+	found, err := storage.GetStore().Domains.List(c.Context(), storage.DomainFilter{Program: programName})
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make([]string, 0, len(found))
+	for _, domain := range found {
+		domains = append(domains, domain.Name)
+	}
+
+	return domains, nil
+}
+
+// checkDomainsExist returns an error message naming the first domain that doesn't exist
+func checkDomainsExist(c *fiber.Ctx, domainNames []string) (string, error) {
+	for _, domainName := range domainNames {
+		_, err := storage.GetStore().Domains.Get(c.Context(), domainName)
+		if err == storage.ErrNotFound {
+			return "domain not found: " + domainName, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func lowercaseAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	lowercased := make([]string, 0, len(values))
+	for _, v := range values {
+		lowercased = append(lowercased, strings.ToLower(v))
+	}
+	return lowercased
+}
@@ -0,0 +1,31 @@
+package handler_test
+
+import (
+	"testing"
+)
+
+func TestProgramStats(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com"]`, nil)
+	if status := request(t, app, "POST", "/api/v1/programs/", `{"name":"acme","domains":["example.com"]}`, nil); status != 201 {
+		t.Fatalf("creating the program returned %d", status)
+	}
+
+	stats := struct {
+		Domains             int            `json:"domains"`
+		Subdomains          int            `json:"subdomains"`
+		SubdomainsPerDomain map[string]int `json:"subdomains_per_domain"`
+	}{}
+	if status := request(t, app, "GET", "/api/v1/programs/acme/stats", "", &stats); status != 200 {
+		t.Fatalf("getting the program stats returned %d", status)
+	}
+	if stats.Domains != 1 || stats.Subdomains != 1 || stats.SubdomainsPerDomain["example.com"] != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	if status := request(t, app, "DELETE", "/api/v1/programs/other/domains/example.com", "", nil); status != 404 {
+		t.Errorf("removing a domain from a missing program returned %d, want 404", status)
+	}
+}
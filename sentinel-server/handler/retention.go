@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetRetentionPolicy(c *fiber.Ctx) error {
+	return c.Status(200).JSON(api.RetentionPolicyResponse{
+		Policy:           scheduler.GlobalRetentionPolicy(),
+		JobRetentionDays: scheduler.JobRetentionDays(),
+	})
+}
+
+// GetRetentionReport is a dry run of the retention policies, it reports what would be deleted
+func GetRetentionReport(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Query("domain"))
+
+	report, err := scheduler.ApplyRetention(c.Context(), domainName, true)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// RunRetention enforces the retention policies right away instead of waiting for the retention job
+func RunRetention(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Query("domain"))
+
+	report, err := scheduler.ApplyRetention(c.Context(), domainName, false)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// PurgeDomainData removes every dns and http snapshot of a domain, e.g. when a program ends.
+// Deleting the domain itself purges its subdomains as well.
+func PurgeDomainData(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	dryRun := c.QueryBool("dry_run", false)
+
+	// Check if the domain exists
+	_, err := storage.GetStore().Domains.Get(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := scheduler.PurgeDomainData(c.Context(), domainName, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// validateRetentionPolicy checks a retention policy given in a request body
+func validateRetentionPolicy(policy *models.RetentionPolicy) string {
+	if policy == nil {
+		return ""
+	}
+	if policy.RawDays < 0 {
+		return "retention raw_days cannot be negative"
+	}
+	if policy.RollupDays < 0 {
+		return "retention rollup_days cannot be negative"
+	}
+	if policy.Mode != "" && !scheduler.ValidRetentionMode(policy.Mode) {
+		return "invalid retention mode: " + string(policy.Mode)
+	}
+	return ""
+}
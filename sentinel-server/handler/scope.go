@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// SetDomainScope replaces the scope rules of a domain and reports which of its subdomains move into or
+// out of scope. The ones leaving it stop being scanned and the ones entering it are queued for a scan.
+// With the dry_run query param nothing is changed, the report tells what the rules would do.
+func SetDomainScope(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	dryRun := c.QueryBool("dry_run", false)
+	store := storage.GetStore()
+
+	rules, err := scopeRules(c)
+	if err != nil {
+		return err
+	}
+	if len(rules.InScope) == 0 && len(rules.OutOfScope) == 0 {
+		return invalid("in_scope or out_of_scope is required")
+	}
+
+	domain, err := store.Domains.Get(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err != nil {
+		return err
+	}
+	program, err := store.Program(c.Context(), domain.Program)
+	if err != nil {
+		return err
+	}
+
+	// a dry run checks the rules without storing them
+	if dryRun {
+		domain.InScope, domain.OutOfScope = rules.InScope, rules.OutOfScope
+	} else {
+		domain, err = store.Domains.Update(c.Context(), domainName, func(stored *models.Domain) error {
+			stored.InScope, stored.OutOfScope = rules.InScope, rules.OutOfScope
+			return nil
+		})
+		if err == storage.ErrNotFound {
+			return notFound("domain not found")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := scheduler.ApplyScope(c.Context(), []models.Domain{domain}, program, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// SetProgramScope replaces the scope rules of a program and reports what they do to the subdomains
+// of every domain of the program, the way SetDomainScope does
+func SetProgramScope(c *fiber.Ctx) error {
+	programName := strings.ToLower(c.Params("programName"))
+	dryRun := c.QueryBool("dry_run", false)
+	store := storage.GetStore()
+
+	rules, err := scopeRules(c)
+	if err != nil {
+		return err
+	}
+
+	program, err := store.Programs.Get(c.Context(), programName)
+	if err == storage.ErrNotFound {
+		return notFound("program not found")
+	}
+	if err != nil {
+		return err
+	}
+	domains, err := store.Domains.List(c.Context(), storage.DomainFilter{Program: programName})
+	if err != nil {
+		return err
+	}
+
+	// a dry run checks the rules without storing them
+	if dryRun {
+		program.InScope, program.OutOfScope = rules.InScope, rules.OutOfScope
+	} else {
+		program, err = store.Programs.Update(c.Context(), programName, func(stored *models.Program) error {
+			stored.InScope, stored.OutOfScope = rules.InScope, rules.OutOfScope
+			return nil
+		})
+		if err == storage.ErrNotFound {
+			return notFound("program not found")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := scheduler.ApplyScope(c.Context(), domains, &program, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(200).JSON(report)
+}
+
+// scopeRules parses the scope rules of the body, lowercased
+func scopeRules(c *fiber.Ctx) (api.ScopeRules, error) {
+	rules := api.ScopeRules{}
+	if err := c.BodyParser(&rules); err != nil {
+		return rules, invalid(err.Error())
+	}
+	rules.InScope = lowercaseAll(rules.InScope)
+	rules.OutOfScope = lowercaseAll(rules.OutOfScope)
+	return rules, nil
+}
+
+// rescopeDomain brings the subdomains of a domain in line with its stored scope after it changed
+func rescopeDomain(c *fiber.Ctx, domain models.Domain) error {
+	program, err := storage.GetStore().Program(c.Context(), domain.Program)
+	if err != nil {
+		return err
+	}
+	_, err = scheduler.ApplyScope(c.Context(), []models.Domain{domain}, program, false)
+	return err
+}
+
+// rescopeProgram brings the subdomains of every domain of a program in line with the stored scope
+func rescopeProgram(c *fiber.Ctx, program models.Program) error {
+	domains, err := storage.GetStore().Domains.List(c.Context(), storage.DomainFilter{Program: program.Name})
+	if err != nil {
+		return err
+	}
+	_, err = scheduler.ApplyScope(c.Context(), domains, &program, false)
+	return err
+}
@@ -0,0 +1,113 @@
+package handler_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestScope(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"microsoft.com","in_scope":["*.microsoft.com","*.azure.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/microsoft.com", `["www.microsoft.com","dev.microsoft.com","portal.azure.com"]`, nil)
+
+	outOfScope := func() []string {
+		t.Helper()
+		page := api.SubdomainListing{}
+		request(t, app, "GET", "/api/v1/domains/microsoft.com/subdomains?in_scope=false", "", &page)
+		names := []string{}
+		for _, subdomain := range page.Subdomains {
+			names = append(names, subdomain.Name)
+		}
+		return names
+	}
+
+	// a dry run reports the moves without making them
+	rules := `{"in_scope":["*.Microsoft.com"],"out_of_scope":["dev.microsoft.com"]}`
+	report := api.ScopeReport{}
+	if status := request(t, app, "PUT", "/api/v1/domains/microsoft.com/scope?dry_run=true", rules, &report); status != 200 {
+		t.Fatalf("previewing the scope returned %d", status)
+	}
+	if !report.DryRun || len(report.Domains) != 1 ||
+		!slices.Equal(report.Domains[0].Leaving, []string{"dev.microsoft.com", "portal.azure.com"}) ||
+		report.Domains[0].InScope != 1 || report.Domains[0].OutOfScope != 2 {
+		t.Fatalf("the preview reported %+v", report)
+	}
+	// narrowing the in scope rules leaves the subdomains of the domain they no longer cover
+	request(t, app, "PUT", "/api/v1/domains/microsoft.com/scope?dry_run=true", `{"in_scope":["www.microsoft.com"]}`, &report)
+	if len(report.Domains) != 1 || !slices.Equal(report.Domains[0].Leaving, []string{"dev.microsoft.com", "portal.azure.com"}) {
+		t.Fatalf("the narrowing preview reported %+v", report)
+	}
+	domain := api.DomainResponse{}
+	request(t, app, "GET", "/api/v1/domains/microsoft.com", "", &domain)
+	if len(domain.Domain.InScope) != 2 || len(outOfScope()) != 0 {
+		t.Fatalf("the preview changed the scope to %v", domain.Domain.InScope)
+	}
+
+	// committing it stops scanning the subdomains that left
+	if status := request(t, app, "PUT", "/api/v1/domains/microsoft.com/scope", rules, &report); status != 200 || report.DryRun {
+		t.Fatalf("changing the scope returned %d and %+v", status, report)
+	}
+	if names := outOfScope(); !slices.Equal(names, []string{"dev.microsoft.com", "portal.azure.com"}) {
+		t.Errorf("out of scope subdomains = %v", names)
+	}
+	watched := true
+	scanned, err := storage.GetStore().Subdomains.List(ctx, storage.SubdomainFilter{Domain: "microsoft.com", InScope: &watched})
+	if err != nil || len(scanned) != 1 || scanned[0].Name != "www.microsoft.com" {
+		t.Errorf("the scans would pick %v", scanned)
+	}
+	left := struct {
+		Events []models.Event `json:"events"`
+	}{}
+	request(t, app, "GET", "/api/v1/events?type=subdomain_left_scope", "", &left)
+	if len(left.Events) != 2 {
+		t.Errorf("recorded %d subdomains leaving the scope, want 2", len(left.Events))
+	}
+
+	// the rules of a program move the subdomains of its domains, a committed move queues a dns check
+	_, err = storage.GetStore().Subdomains.Update(ctx, "microsoft.com", "portal.azure.com", func(subdomain *models.Subdomain) error {
+		subdomain.NextDNSCheck = bson.NewDateTimeFromTime(time.Now().Add(time.Hour))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to push the dns check back: %v", err)
+	}
+	request(t, app, "POST", "/api/v1/programs/", `{"name":"msrc","domains":["microsoft.com"]}`, nil)
+	programRules := `{"in_scope":["*.azure.com"]}`
+	if request(t, app, "PUT", "/api/v1/programs/msrc/scope?dry_run=true", programRules, &report); len(report.Domains) != 1 ||
+		!slices.Equal(report.Domains[0].Entering, []string{"portal.azure.com"}) {
+		t.Fatalf("the program preview reported %+v", report)
+	}
+	request(t, app, "PUT", "/api/v1/programs/msrc/scope", programRules, nil)
+	portal := api.SubdomainResponse{}
+	request(t, app, "GET", "/api/v1/domains/microsoft.com/portal.azure.com", "", &portal)
+	if portal.Subdomain.OutOfScopeAt != 0 || portal.Subdomain.NextDNSCheck != 0 {
+		t.Errorf("portal.azure.com came back as %+v", portal.Subdomain)
+	}
+
+	// so do patches of the domain and moves between programs
+	request(t, app, "PATCH", "/api/v1/domains/microsoft.com", `{"out_of_scope":[]}`, nil)
+	if names := outOfScope(); len(names) != 0 {
+		t.Errorf("out of scope subdomains after the patch = %v", names)
+	}
+	request(t, app, "DELETE", "/api/v1/programs/msrc/domains/microsoft.com", "", nil)
+	if names := outOfScope(); !slices.Equal(names, []string{"portal.azure.com"}) {
+		t.Errorf("out of scope subdomains after leaving the program = %v", names)
+	}
+
+	if status := request(t, app, "PUT", "/api/v1/domains/microsoft.com/scope", `{}`, nil); status != 400 {
+		t.Errorf("changing the scope without rules returned %d, want 400", status)
+	}
+	if status := request(t, app, "PUT", "/api/v1/programs/missing/scope", programRules, nil); status != 404 {
+		t.Errorf("changing the scope of a missing program returned %d, want 404", status)
+	}
+}
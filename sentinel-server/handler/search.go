@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/search"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Search finds subdomains by themselves and their latest dns and http snapshots, e.g.
+// q=tech:nginx status:200 title:"login" cname:*.azurewebsites.net dns_status:fresh_resolved.
+// Results are sorted by domain and name, the next page starts at next_cursor.
+func Search(c *fiber.Ctx) error {
+	// Parse the limit
+	limit := c.QueryInt("limit", defaultSubdomainsLimit)
+	if limit <= 0 || limit > maxSubdomainsLimit {
+		return invalid("limit must be between 1 and 1000")
+	}
+
+	// Parse the query
+	query, err := search.Parse(c.Query("q"))
+	if err != nil {
+		return invalid("invalid query: " + err.Error()).with(api.ErrorDetails{Fields: search.Fields()})
+	}
+
+	archived, ok := archivedFilter(c)
+	if !ok {
+		return invalid("archived must be exclude, include or only")
+	}
+	page := storage.SearchPage{
+		Query: query,
+		Filter: storage.SubdomainFilter{
+			Archived: archived,
+			Domain:   strings.ToLower(c.Query("domain")),
+		},
+		// one more than asked for tells whether there is a next page
+		Limit: limit + 1,
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil || cursor.Sort != storage.SortByName || cursor.Descending {
+			return invalid("invalid cursor")
+		}
+		page.After = &cursor.After
+	}
+
+	results, err := storage.GetStore().Search.Find(c.Context(), page)
+	if err != nil {
+		return err
+	}
+
+	response := api.SearchResults{}
+	if len(results) > limit {
+		results = results[:limit]
+		response.NextCursor = encodeCursor(listingCursor{
+			Sort:  storage.SortByName,
+			After: storage.CursorOf(storage.SortByName, results[limit-1].Subdomain),
+		})
+	}
+	response.Count = len(results)
+	response.Results = results
+
+	return c.Status(200).JSON(response)
+}
@@ -0,0 +1,53 @@
+package handler_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","api.example.com","dev.example.com"]`, nil)
+
+	type results struct {
+		Results []struct {
+			Subdomain struct {
+				Name string `json:"name"`
+			} `json:"subdomain"`
+		} `json:"results"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	// page through every subdomain that isn't www
+	names := []string{}
+	path := "/api/v1/search?limit=1&domain=example.com&q=" + url.QueryEscape("-name:www.*")
+	for cursor := ""; ; {
+		page := results{}
+		if status := request(t, app, "GET", path+"&cursor="+cursor, "", &page); status != 200 {
+			t.Fatalf("searching returned %d", status)
+		}
+		for _, result := range page.Results {
+			names = append(names, result.Subdomain.Name)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if strings.Join(names, ",") != "api.example.com,dev.example.com" {
+		t.Errorf("search found %v", names)
+	}
+
+	// nothing was scanned yet
+	page := results{}
+	request(t, app, "GET", "/api/v1/search?q=tech:nginx", "", &page)
+	if len(page.Results) != 0 {
+		t.Errorf("search for a technology found %+v", page.Results)
+	}
+
+	if status := request(t, app, "GET", "/api/v1/search?q=color:red", "", nil); status != 400 {
+		t.Errorf("searching an unknown field returned %d, want 400", status)
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+)
+
+// GetStats returns the statistics of every domain, or of the domain given in the query, over the last
+// days (30 by default): subdomains by status, provider and technology, discoveries per day and week,
+// the runs of the jobs and the daily rollups of the period. Providers and technologies come from the
+// latest rollup, only domains that weren't rolled up yet have them computed on the spot.
+func GetStats(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Query("domain"))
+
+	days := c.QueryInt("days", defaultStatsDays)
+	if days <= 0 || days > maxStatsDays {
+		return invalid("days must be between 1 and 365")
+	}
+
+	store := storage.GetStore()
+	var domains []string
+	if domainName != "" {
+		if _, err := store.Domains.Get(c.Context(), domainName); err == storage.ErrNotFound {
+			return notFound("domain not found")
+		} else if err != nil {
+			return err
+		}
+		domains = []string{domainName}
+	}
+
+	// the period starts at midnight (UTC) so that its first day is whole
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, 1-days)
+
+	counts, err := store.Subdomains.Stats(c.Context(), domains...)
+	if err != nil {
+		return err
+	}
+	discovered, err := store.Subdomains.Discovered(c.Context(), since, domains...)
+	if err != nil {
+		return err
+	}
+	assets, err := store.Rollups.Latest(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		// looking up the technologies of every subdomain is left to the rollups once there is one
+		live, err := store.Subdomains.Assets(c.Context(), since, domains...)
+		if err != nil {
+			return err
+		}
+		assets.Providers, assets.Technologies = live.Providers, live.Technologies
+	} else if err != nil {
+		return err
+	}
+	history, err := store.Rollups.List(c.Context(), storage.RollupFilter{Domain: domainName, Since: since})
+	if err != nil {
+		return err
+	}
+
+	stats := api.Stats{
+		Domain:       domainName,
+		Days:         days,
+		Subdomains:   counts,
+		Providers:    assets.Providers,
+		Technologies: assets.Technologies,
+		NewPerDay:    make([]api.DateCount, 0, days),
+		NewPerWeek:   make([]api.DateCount, 0),
+		History:      history,
+	}
+
+	// fill in the days and weeks nothing was discovered on
+	for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+		count := discovered[day.Format(time.DateOnly)]
+		stats.NewPerDay = append(stats.NewPerDay, api.DateCount{Date: day.Format(time.DateOnly), Count: count})
+
+		week := day.AddDate(0, 0, -(int(day.Weekday())+6)%7).Format(time.DateOnly)
+		if last := len(stats.NewPerWeek) - 1; last >= 0 && stats.NewPerWeek[last].Date == week {
+			stats.NewPerWeek[last].Count += count
+		} else {
+			stats.NewPerWeek = append(stats.NewPerWeek, api.DateCount{Date: week, Count: count})
+		}
+	}
+
+	// jobs aren't tied to a domain
+	if domainName == "" {
+		jobs, err := store.Jobs.List(c.Context(), storage.JobFilter{Since: since})
+		if err != nil {
+			return err
+		}
+		stats.Jobs = jobStats(jobs)
+	}
+
+	return c.Status(200).JSON(stats)
+}
+
+// jobStats sums up the runs of every job type
+func jobStats(jobs []models.Job) map[models.JobType]api.JobStats {
+	stats := make(map[models.JobType]api.JobStats)
+	durations := make(map[models.JobType]time.Duration)
+	for _, job := range jobs {
+		jobStats := stats[job.Type]
+		jobStats.Runs++
+		switch {
+		case job.EndTime.IsZero():
+			jobStats.Running++
+		case job.Status == models.JobStatusFailed:
+			jobStats.Failed++
+		default:
+			jobStats.Succeeded++
+		}
+		if !job.EndTime.IsZero() {
+			durations[job.Type] += job.EndTime.Sub(job.StartTime)
+		}
+		stats[job.Type] = jobStats
+	}
+
+	for jobType, jobStats := range stats {
+		if finished := jobStats.Succeeded + jobStats.Failed; finished > 0 {
+			jobStats.SuccessRate = float64(jobStats.Succeeded) / float64(finished)
+			jobStats.AverageDuration = durations[jobType].Seconds() / float64(finished)
+		}
+		stats[jobType] = jobStats
+	}
+	return stats
+}
@@ -0,0 +1,69 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestStats(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"other.com","in_scope":["*.other.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","api.example.com"]`, nil)
+	request(t, app, "POST", "/api/v1/domains/other.com", `["www.other.com"]`, nil)
+
+	jobs := storage.GetStore().Jobs
+	started := time.Now().Add(-time.Minute)
+	for _, status := range []models.JobStatus{models.JobStatusSuccess, models.JobStatusFailed} {
+		job, _ := jobs.Start(ctx, models.Job{Type: "dnsx", StartTime: started, Status: models.JobStatusPending})
+		jobs.Finish(ctx, models.Job{ID: job.ID, Type: "dnsx", EndTime: started.Add(30 * time.Second), Status: status})
+	}
+	stats := api.Stats{}
+	request(t, app, "GET", "/api/v1/stats", "", &stats)
+	if stats.Providers["manual"] != 3 {
+		t.Errorf("expected the providers to be counted before the first rollup, got %v", stats.Providers)
+	}
+
+	if _, err := scheduler.RollupStats(ctx, time.Now()); err != nil {
+		t.Fatalf("rolling up the stats failed: %v", err)
+	}
+	// the providers are the ones of the rollup from then on
+	request(t, app, "POST", "/api/v1/domains/other.com", `["api.other.com"]`, nil)
+
+	stats = api.Stats{}
+	if status := request(t, app, "GET", "/api/v1/stats?days=14", "", &stats); status != 200 {
+		t.Fatalf("getting the stats returned %d", status)
+	}
+	if stats.Subdomains.Total != 4 || stats.Providers["manual"] != 3 {
+		t.Errorf("unexpected counts %+v, providers %v", stats.Subdomains, stats.Providers)
+	}
+	if len(stats.NewPerDay) != 14 || stats.NewPerDay[13].Count != 4 || stats.NewPerWeek[len(stats.NewPerWeek)-1].Count != 4 {
+		t.Errorf("unexpected discoveries %+v per day, %+v per week", stats.NewPerDay, stats.NewPerWeek)
+	}
+	if dnsx := stats.Jobs["dnsx"]; dnsx.Runs != 2 || dnsx.SuccessRate != 0.5 || dnsx.AverageDuration != 30 {
+		t.Errorf("unexpected dnsx stats %+v", dnsx)
+	}
+	if len(stats.History) != 1 || stats.History[0].Subdomains != 3 || stats.History[0].New != 3 {
+		t.Errorf("unexpected history %+v", stats.History)
+	}
+
+	stats = api.Stats{}
+	request(t, app, "GET", "/api/v1/stats?domain=example.com", "", &stats)
+	if stats.Subdomains.Total != 2 || len(stats.NewPerDay) != 30 || stats.Jobs != nil || len(stats.History) != 1 {
+		t.Errorf("unexpected domain stats %+v", stats)
+	}
+	if status := request(t, app, "GET", "/api/v1/stats?domain=missing.com", "", nil); status != 404 {
+		t.Errorf("getting the stats of a missing domain returned %d, want 404", status)
+	}
+	if status := request(t, app, "GET", "/api/v1/stats?days=0", "", nil); status != 400 {
+		t.Errorf("getting the stats of no days returned %d, want 400", status)
+	}
+}
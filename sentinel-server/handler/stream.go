@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/events"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// streamPing is how often an idle stream is pinged, which is also how a closed stream is noticed
+const streamPing = 15 * time.Second
+
+// Stream sends the events recorded from now on as server-sent events, or as json messages over a
+// websocket when the request asks for an upgrade. The events can be filtered by domain or program
+// and event types (comma separated). A stream resumes after the event of the Last-Event-ID header
+// or the last_event_id query param by first sending the events it missed.
+func Stream(c *fiber.Ctx) error {
+	filter := events.StreamFilter{
+		Domain:  strings.ToLower(c.Query("domain")),
+		Program: strings.ToLower(c.Query("program")),
+	}
+	if types := c.Query("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			filter.Types = append(filter.Types, models.EventType(strings.TrimSpace(eventType)))
+		}
+	}
+
+	// Check that what the stream is filtered by exists
+	if filter.Domain != "" {
+		if _, err := storage.GetStore().Domains.Get(c.Context(), filter.Domain); err == storage.ErrNotFound {
+			return notFound("domain not found")
+		} else if err != nil {
+			return err
+		}
+	}
+	if filter.Program != "" {
+		if _, err := storage.GetStore().Programs.Get(c.Context(), filter.Program); err == storage.ErrNotFound {
+			return notFound("program not found")
+		} else if err != nil {
+			return err
+		}
+	}
+
+	lastEventID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	after := bson.ObjectID{}
+	if lastEventID != "" {
+		id, err := bson.ObjectIDFromHex(lastEventID)
+		if err != nil {
+			return invalid("invalid last event id")
+		}
+		after = id
+	}
+
+	// Subscribe before catching up so that nothing is missed in between
+	subscription := events.Subscribe(filter)
+	missed := []models.Event{}
+	if !after.IsZero() {
+		var err error
+		if missed, err = events.Replay(c.Context(), filter, after); err != nil {
+			subscription.Close()
+			return err
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(c) {
+		err := websocket.New(func(conn *websocket.Conn) {
+			streamWebSocket(conn, subscription, missed)
+		})(c)
+		if err != nil {
+			subscription.Close()
+		}
+		return err
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	// keep proxies from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+	c.Status(200).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamEvents(w, subscription, missed)
+	})
+	return nil
+}
+
+// streamEvents writes events as server-sent events until the stream is closed
+func streamEvents(w *bufio.Writer, subscription *events.Subscription, missed []models.Event) {
+	defer subscription.Close()
+
+	// sends the headers right away, so the client knows it is subscribed
+	if _, err := w.WriteString(": subscribed\n\n"); err != nil || w.Flush() != nil {
+		return
+	}
+
+	send := func(event models.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID.Hex(), event.Type, data)
+		return w.Flush()
+	}
+	ping := func() error {
+		w.WriteString(": ping\n\n")
+		return w.Flush()
+	}
+	relay(subscription, missed, send, ping, nil)
+}
+
+// streamWebSocket writes events as json messages until the websocket is closed
+func streamWebSocket(conn *websocket.Conn, subscription *events.Subscription, missed []models.Event) {
+	defer subscription.Close()
+
+	// the client has nothing to say, reading only notices it closing the websocket
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event models.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(streamPing))
+		return conn.WriteJSON(event)
+	}
+	ping := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamPing))
+	}
+	if relay(subscription, missed, send, ping, closed) {
+		// the client fell behind, it reconnects with the id of the last event it got to catch up
+		message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind, resume from the last event id")
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(streamPing))
+	}
+	conn.Close()
+	<-closed
+}
+
+// relay sends the missed events and then the live ones until sending fails or closed is closed.
+// It reports whether the stream ended because the subscription was dropped for falling behind.
+func relay(subscription *events.Subscription, missed []models.Event, send func(models.Event) error, ping func() error, closed <-chan struct{}) bool {
+	last := bson.ObjectID{}
+	for _, event := range missed {
+		if send(event) != nil {
+			return false
+		}
+		last = event.ID
+	}
+
+	ticker := time.NewTicker(streamPing)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return true
+			}
+			// recorded while catching up, so already sent
+			if bytes.Compare(event.ID[:], last[:]) <= 0 {
+				continue
+			}
+			if send(event) != nil {
+				return false
+			}
+		case <-ticker.C:
+			if ping() != nil {
+				return false
+			}
+		case <-closed:
+			return false
+		}
+	}
+}
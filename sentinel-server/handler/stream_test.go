@@ -0,0 +1,57 @@
+package handler_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+
+	"github.com/0xgwyn/sentinel/events"
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestStreamWebSocket(t *testing.T) {
+	app := newTestApp(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() {
+		events.CloseSubscriptions()
+		app.Shutdown()
+	})
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"other.com","in_scope":["*.other.com"]}`, nil)
+	if status := request(t, app, "GET", "/api/v1/stream?domain=missing.com", "", nil); status != 404 {
+		t.Errorf("streaming a missing domain returned %d, want 404", status)
+	}
+	if status := request(t, app, "GET", "/api/v1/stream?last_event_id=nope", "", nil); status != 400 {
+		t.Errorf("resuming from an invalid event id returned %d, want 400", status)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/api/v1/stream?domain=example.com&type=subdomain_discovered", nil)
+	if err != nil {
+		t.Fatalf("failed to open the websocket: %v", err)
+	}
+	defer conn.Close()
+
+	// only the discoveries of the domain of the stream are sent
+	request(t, app, "POST", "/api/v1/domains/other.com", `["www.other.com"]`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com"]`, nil)
+	request(t, app, "PATCH", "/api/v1/domains/example.com/www.example.com", `{"watch_http":true}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["api.example.com"]`, nil)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"www.example.com", "api.example.com"} {
+		event := models.Event{}
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("failed to read an event: %v", err)
+		}
+		if event.Type != models.SubdomainDiscovered || event.Subdomain != want || event.ID.IsZero() {
+			t.Errorf("got the event %+v, want the discovery of %s", event, want)
+		}
+	}
+}
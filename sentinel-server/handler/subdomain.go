@@ -1,169 +1,202 @@
 package handler
 
 import (
+	"log"
 	"strings"
 	"time"
 
-	"github.com/0xgwyn/sentinel/database"
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/events"
 	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/scope"
+	"github.com/0xgwyn/sentinel/storage"
 	"github.com/dchest/validator"
 	"github.com/gofiber/fiber/v2"
-	sliceutil "github.com/projectdiscovery/utils/slice"
 	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 func DeleteSubdomain(c *fiber.Ctx) error {
 	domainName := strings.ToLower(c.Params("domainName"))
 	subdomainName := strings.ToLower(c.Params("subdomainName"))
-	subdomainsColl := database.GetDBCollection("subdomains")
-	httpColl := database.GetDBCollection("http")
-	dnsColl := database.GetDBCollection("dns")
-
-	// Delete the requested subdomain
-	subFilter := bson.M{"domain": domainName, "name": subdomainName}
-	subResult, err := subdomainsColl.DeleteOne(c.Context(), subFilter)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-	if subResult.DeletedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "subdomain not found",
-		})
+	// Archive the subdomain unless it should be purged for real
+	if !c.QueryBool("purge", false) {
+		return archiveSubdomain(c, domainName, subdomainName)
 	}
 
-	// Delete related HTTP records
-	httpFilter := bson.M{"domain": domainName, "subdomain": subdomainName}
-	_, err = httpColl.DeleteMany(c.Context(), httpFilter)
+	// Delete the requested subdomain and its related records
+	job, err := scheduler.DeleteSubdomain(c.Context(), domainName, subdomainName)
+	if err == storage.ErrNotFound {
+		return notFound("subdomain not found")
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
-	// Delete related DNS records
-	dnsFilter := bson.M{"domain": domainName, "subdomain": subdomainName}
-	_, err = dnsColl.DeleteMany(c.Context(), dnsFilter)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
+	// Without transactions the related records are deleted by a job
+	if job != nil {
+		return c.Status(202).JSON(api.Message{
+			Message: subdomainName + " subdomain deleted, its related records are being deleted",
+			Job:     job,
 		})
 	}
 
-	return c.Status(200).JSON(fiber.Map{
-		"message": subdomainName + " subdomain and related records deleted successfully",
+	return c.Status(200).JSON(api.Message{
+		Message: subdomainName + " subdomain and related records deleted successfully",
 	})
 }
 
+// AddSubdomains adds the subdomains named in the body to a domain. The names are normalized and
+// have to belong to the domain or to one of the apexes its scope covers, the ones that are invalid,
+// out of scope or already known are reported rather than added.
 func AddSubdomains(c *fiber.Ctx) error {
 	domainName := strings.ToLower(c.Params("domainName"))
-	coll := database.GetDBCollection("subdomains")
+	store := storage.GetStore()
 
 	// Parse the body
-	newSubdomains := []string{}
-	if err := c.BodyParser(&newSubdomains); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	names := []string{}
+	if err := c.BodyParser(&names); err != nil {
+		return invalid(err.Error())
+	}
+	if len(names) == 0 {
+		return invalid("no subdomains given")
 	}
 
-	// Check if the subdomains are valid
-	for _, subdomain := range newSubdomains {
-		if !validator.IsValidDomain(subdomain) {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid subdomain: " + subdomain,
-			})
-		}
+	// Check that the domain exists and is active
+	domain, err := store.Domains.Get(c.Context(), domainName)
+	if err == storage.ErrNotFound {
+		return notFound("domain not found")
+	}
+	if err != nil {
+		return err
+	}
+	if domain.ArchivedAt != 0 {
+		return conflict("domain is archived")
 	}
 
-	// Remove duplicates from the new subdomains
-	newUniqueSubdomains := sliceutil.Dedupe(newSubdomains)
+	// New subdomains start with the watch flags of the domain's program
+	program, err := store.Program(c.Context(), domain.Program)
+	if err != nil {
+		return err
+	}
+	var scanSettings *models.ScanSettings
+	if program != nil {
+		scanSettings = program.ScanSettings
+	}
+	watchDNS, watchHTTP := scanSettings.WatchFlags()
 
-	// Prepare a list of subdomains to be added
-	subsToBeAdded := []models.Subdomain{}
-	for _, name := range newUniqueSubdomains {
-		// Check if the subdomain already exists in the database
-		filter := bson.M{"domain": domainName, "name": name}
-		count, err := coll.CountDocuments(c.Context(), filter)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+	// Sort the names out, the ones accepted here are checked against the known subdomains below
+	stored, err := store.DomainNames(c.Context())
+	if err != nil {
+		return err
+	}
+	seeds := scope.Seeds(domain, program, stored)
+	inScope, outOfScope := scope.Effective(domain, program)
+	report := api.AddedSubdomains{Added: []models.Subdomain{}, Results: make([]api.AddedName, 0, len(names))}
+	accepted, seen := []string{}, map[string]bool{}
+	for _, input := range names {
+		result := api.AddedName{Input: input}
+		name, err := scope.Normalize(input)
+		switch {
+		case err != nil || !validator.IsValidDomain(name):
+			result.Status, result.Reason = scheduler.ImportInvalid, "invalid subdomain"
+		case !scope.InScope(name, inScope, outOfScope):
+			result.Name, result.Status, result.Reason = name, scheduler.ImportOutOfScope, outOfScopeReason(name, seeds, outOfScope)
+		case seen[name]:
+			result.Name, result.Status, result.Reason = name, scheduler.ImportDuplicate, "given more than once"
+		default:
+			result.Name, result.Status = name, scheduler.ImportAccepted
+			accepted, seen[name] = append(accepted, name), true
 		}
+		report.Results = append(report.Results, result)
+	}
 
-		// If the subdomain does not exist, add it to the list
-		if count == 0 {
-			subdomain := models.Subdomain{
-				Domain:    strings.ToLower(domainName),
-				Name:      strings.ToLower(name),
-				CreatedAt: bson.NewDateTimeFromTime(time.Now()),
-				UpdatedAt: bson.NewDateTimeFromTime(time.Now()),
-				Providers: []string{"manual"},
-				DNSStatus: models.FreshSubdomain,
-				WatchDNS:  true,
-				WatchHTTP: true,
-			}
-			subsToBeAdded = append(subsToBeAdded, subdomain)
+	// Check which of the accepted names are known in one go
+	existing, err := store.Subdomains.Existing(c.Context(), domainName, accepted)
+	if err != nil {
+		return err
+	}
+	now := bson.NewDateTimeFromTime(time.Now())
+	for i, result := range report.Results {
+		if result.Status != scheduler.ImportAccepted {
+			continue
+		}
+		if existing[result.Name] {
+			report.Results[i].Status, report.Results[i].Reason = scheduler.ImportDuplicate, "already known"
+			continue
 		}
+		report.Added = append(report.Added, models.Subdomain{
+			Domain:    domainName,
+			Name:      result.Name,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Providers: []string{"manual"},
+			DNSStatus: models.FreshSubdomain,
+			WatchDNS:  watchDNS,
+			WatchHTTP: watchHTTP,
+		})
 	}
 
-	// If no new subdomains are found, return a message
-	if len(subsToBeAdded) == 0 {
-		return c.Status(200).JSON(fiber.Map{
-			"info": "no new subdomain was found",
-		})
+	for _, result := range report.Results {
+		switch result.Status {
+		case scheduler.ImportAccepted:
+			report.Accepted++
+		case scheduler.ImportDuplicate:
+			report.Duplicate++
+		case scheduler.ImportInvalid:
+			report.Invalid++
+		case scheduler.ImportOutOfScope:
+			report.OutOfScope++
+		}
+	}
+	if len(report.Added) == 0 {
+		return c.Status(200).JSON(report)
 	}
 
 	// Insert the new subdomains into the database
-	_, err := coll.InsertMany(c.Context(), subsToBeAdded)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
+	if err := store.Subdomains.Create(c.Context(), report.Added...); err != nil {
+		return err
+	}
+
+	// Record the discovery of the new subdomains in the timeline
+	discovered := make([]models.Event, 0, len(report.Added))
+	for _, subdomain := range report.Added {
+		discovered = append(discovered, models.Event{
+			Type:      models.SubdomainDiscovered,
+			Domain:    subdomain.Domain,
+			Subdomain: subdomain.Name,
+			After:     subdomain.Providers,
+			Source:    events.SourceAPI,
+			Timestamp: subdomain.CreatedAt,
 		})
 	}
+	if err := events.Record(c.Context(), discovered...); err != nil {
+		log.Printf("failed to record discovered subdomains of %s: %v", domainName, err)
+	}
 
-	// Return the newly added subdomains
-	return c.Status(200).JSON(subsToBeAdded)
+	return c.Status(200).JSON(report)
 }
 
 func GetSubdomain(c *fiber.Ctx) error {
 	domainName := strings.ToLower(c.Params("domainName"))
 	subdomainName := strings.ToLower(c.Params("subdomainName"))
-	subdomainsColl := database.GetDBCollection("subdomains")
-	httpColl := database.GetDBCollection("http")
-	dnsColl := database.GetDBCollection("dns")
+	store := storage.GetStore()
 
 	// find the requested subdomain
-	subdomain := models.Subdomain{}
-	filter := bson.M{"domain": domainName, "name": subdomainName}
-	projection := bson.M{"_id": 0}
-	opts := options.FindOne().SetProjection(projection)
-	if err := subdomainsColl.FindOne(c.Context(), filter, opts).Decode(&subdomain); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	subdomain, err := store.Subdomains.Get(c.Context(), domainName, subdomainName)
+	if err == storage.ErrNotFound {
+		return notFound("subdomain not found")
+	}
+	if err != nil {
+		return err
 	}
 
-	// Get the latest HTTP record
-	httpRecord := models.HTTP{}
-	httpFilter := bson.M{"domain": domainName, "subdomain": subdomainName}
-	httpOpts := options.FindOne().
-		SetProjection(bson.M{"_id": 0}).
-		SetSort(bson.M{"scanning_date": -1})
-	_ = httpColl.FindOne(c.Context(), httpFilter, httpOpts).Decode(&httpRecord)
-
-	// Get the latest DNS record
-	dnsRecord := models.DNS{}
-	dnsFilter := bson.M{"domain": domainName, "subdomain": subdomainName}
-	dnsOpts := options.FindOne().
-		SetProjection(bson.M{"_id": 0}).
-		SetSort(bson.M{"resolution_date": -1})
-	_ = dnsColl.FindOne(c.Context(), dnsFilter, dnsOpts).Decode(&dnsRecord)
+	// Get the latest HTTP and DNS records
+	httpRecord, _ := store.HTTP.Latest(c.Context(), domainName, subdomainName)
+	dnsRecord, _ := store.DNS.Latest(c.Context(), domainName, subdomainName)
 
 	// Combine all data in the desired order
-	response := SubdomainResponse{
+	response := api.SubdomainResponse{
 		Subdomain: subdomain,
 		DNS:       dnsRecord,
 		HTTP:      httpRecord,
@@ -172,8 +205,14 @@ func GetSubdomain(c *fiber.Ctx) error {
 	return c.Status(200).JSON(response)
 }
 
-type SubdomainResponse struct {
-	Subdomain models.Subdomain `json:"subdomain"`
-	DNS       models.DNS       `json:"latest_dns"`
-	HTTP      models.HTTP      `json:"latest_http"`
+// outOfScopeReason tells why a name isn't in the scope of a domain with the given seeds
+func outOfScopeReason(name string, seeds, outOfScope []string) string {
+	switch {
+	case !scope.Owns(seeds, name):
+		return "not a subdomain of " + strings.Join(seeds, ", ")
+	case scope.MatchAny(outOfScope, name):
+		return "excluded by the out of scope rules"
+	default:
+		return "not covered by the in scope rules"
+	}
 }
@@ -0,0 +1,55 @@
+package handler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/scheduler"
+)
+
+func TestAddSubdomains(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"microsoft.com","in_scope":["*.microsoft.com","*.api.azure.com"],"out_of_scope":["internal.microsoft.com"]}`, nil)
+
+	// evil.azure.com is under the derived azure.com apex but outside the *.api.azure.com wildcard
+	added := api.AddedSubdomains{}
+	body := `["WWW.Microsoft.com.","portal.api.azure.com","evil.com","internal.microsoft.com","not a name","bücher.microsoft.com","www.microsoft.com","evil.azure.com"]`
+	if status := request(t, app, "POST", "/api/v1/domains/microsoft.com", body, &added); status != 200 {
+		t.Fatalf("adding subdomains returned %d", status)
+	}
+	expected := []scheduler.ImportStatus{
+		scheduler.ImportAccepted, scheduler.ImportAccepted, scheduler.ImportOutOfScope, scheduler.ImportOutOfScope,
+		scheduler.ImportInvalid, scheduler.ImportAccepted, scheduler.ImportDuplicate, scheduler.ImportOutOfScope,
+	}
+	for i, result := range added.Results {
+		if result.Status != expected[i] {
+			t.Errorf("%s was %s (%s), want %s", result.Input, result.Status, result.Reason, expected[i])
+		}
+	}
+	names := []string{}
+	for _, subdomain := range added.Added {
+		names = append(names, subdomain.Name)
+	}
+	if strings.Join(names, ",") != "www.microsoft.com,portal.api.azure.com,xn--bcher-kva.microsoft.com" {
+		t.Errorf("added %v", names)
+	}
+	if reason := added.Results[7].Reason; reason != "not covered by the in scope rules" {
+		t.Errorf("evil.azure.com was refused because %q", reason)
+	}
+	if added.Accepted != 3 || added.Duplicate != 1 || added.Invalid != 1 || added.OutOfScope != 3 {
+		t.Errorf("unexpected counts %+v", added)
+	}
+
+	if status := request(t, app, "POST", "/api/v1/domains/missing.com", `["www.missing.com"]`, nil); status != 404 {
+		t.Errorf("adding subdomains to a missing domain returned %d, want 404", status)
+	}
+	if status := request(t, app, "POST", "/api/v1/domains/microsoft.com", `[]`, nil); status != 400 {
+		t.Errorf("adding no subdomains returned %d, want 400", status)
+	}
+	request(t, app, "DELETE", "/api/v1/domains/microsoft.com", "", nil)
+	if status := request(t, app, "POST", "/api/v1/domains/microsoft.com", `["new.microsoft.com"]`, nil); status != 409 {
+		t.Errorf("adding subdomains to an archived domain returned %d, want 409", status)
+	}
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/events"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// watchFlags are the watch flags of a subdomain before and after an update
+type watchFlags struct {
+	WatchDNS  bool `json:"watch_dns" bson:"watch_dns"`
+	WatchHTTP bool `json:"watch_http" bson:"watch_http"`
+}
+
+// errUnchanged aborts the update of a subdomain that already is the way the update asks for
+var errUnchanged = errors.New("unchanged")
+
+// parseSubdomainUpdate parses and normalizes the body of a subdomain update
+func parseSubdomainUpdate(c *fiber.Ctx) (api.SubdomainUpdate, error) {
+	update := api.SubdomainUpdate{}
+	if err := c.BodyParser(&update); err != nil {
+		return update, err
+	}
+
+	if update.WatchDNS == nil && update.WatchHTTP == nil && update.Tags == nil && update.AddTags == nil &&
+		update.RemoveTags == nil && update.Triage == "" {
+		return update, errors.New("either watch_dns, watch_http, tags, add_tags, remove_tags or triage is needed")
+	}
+	if update.Tags != nil && (update.AddTags != nil || update.RemoveTags != nil) {
+		return update, errors.New("tags cannot be combined with add_tags or remove_tags")
+	}
+
+	for _, tags := range []*[]string{update.Tags, &update.AddTags, &update.RemoveTags} {
+		if tags == nil || *tags == nil {
+			continue
+		}
+		normalized, ok := normalizeTags(*tags)
+		if !ok {
+			return update, errors.New("tags cannot be empty")
+		}
+		*tags = normalized
+	}
+
+	if update.Triage != "" && !slices.Contains(triageStates, update.Triage) {
+		return update, errors.New("invalid triage state: " + string(update.Triage))
+	}
+
+	return update, nil
+}
+
+// subdomainChanges turns an update into the changes the repositories apply
+func subdomainChanges(u api.SubdomainUpdate, changedBy string, now time.Time) storage.SubdomainChanges {
+	changes := storage.SubdomainChanges{
+		WatchDNS:   u.WatchDNS,
+		WatchHTTP:  u.WatchHTTP,
+		Tags:       u.Tags,
+		AddTags:    u.AddTags,
+		RemoveTags: u.RemoveTags,
+		Now:        bson.NewDateTimeFromTime(now),
+	}
+	if u.Triage != "" {
+		changes.Triage = &models.Triage{
+			State:     u.Triage,
+			ChangedBy: changedBy,
+			ChangedAt: changes.Now,
+		}
+	}
+	return changes
+}
+
+// watchEvent returns the event recording a change of the watch flags of a subdomain, if they changed
+func watchEvent(before, after models.Subdomain) (models.Event, bool) {
+	if before.WatchDNS == after.WatchDNS && before.WatchHTTP == after.WatchHTTP {
+		return models.Event{}, false
+	}
+	return models.Event{
+		Type:      models.WatchFlagsChanged,
+		Domain:    after.Domain,
+		Subdomain: after.Name,
+		Before:    watchFlags{WatchDNS: before.WatchDNS, WatchHTTP: before.WatchHTTP},
+		After:     watchFlags{WatchDNS: after.WatchDNS, WatchHTTP: after.WatchHTTP},
+		Source:    events.SourceAPI,
+	}, true
+}
+
+// UpdateSubdomain changes the watch flags, tags and triage state of a subdomain
+func UpdateSubdomain(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	subdomainName := strings.ToLower(c.Params("subdomainName"))
+
+	// Parse the body
+	update, err := parseSubdomainUpdate(c)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	var before models.Subdomain
+	changes := subdomainChanges(update, analyst(c), time.Now())
+	subdomain, err := storage.GetStore().Subdomains.Update(c.Context(), domainName, subdomainName, func(subdomain *models.Subdomain) error {
+		before = *subdomain
+		if !changes.Apply(subdomain) {
+			return errUnchanged
+		}
+		return nil
+	})
+	if err == errUnchanged {
+		return c.Status(200).JSON(before)
+	}
+	if err == storage.ErrNotFound {
+		return notFound("subdomain not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if event, ok := watchEvent(before, subdomain); ok {
+		if err := events.Record(c.Context(), event); err != nil {
+			log.Printf("failed to record %s of %s: %v", event.Type, subdomainName, err)
+		}
+	}
+
+	return c.Status(200).JSON(subdomain)
+}
+
+// BulkUpdateSubdomains applies an update to every subdomain of a domain matching the filter of the
+// query params, the same ones the subdomain listing takes. It reports how many subdomains matched and
+// how many of them actually changed.
+func BulkUpdateSubdomains(c *fiber.Ctx) error {
+	domainName := strings.ToLower(c.Params("domainName"))
+	store := storage.GetStore()
+
+	// Build the filter
+	filter, err := subdomainFilter(c, domainName)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// Parse the body
+	update, err := parseSubdomainUpdate(c)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// Check if the domain exists
+	if _, err := store.Domains.Get(c.Context(), domainName); err == storage.ErrNotFound {
+		return notFound("domain not found")
+	} else if err != nil {
+		return err
+	}
+
+	changes := subdomainChanges(update, analyst(c), time.Now())
+	result, err := store.Subdomains.UpdateMany(c.Context(), filter, changes)
+	if err != nil {
+		return err
+	}
+
+	watchEvents := []models.Event{}
+	for _, before := range result.WatchChanged {
+		after := before
+		changes.Apply(&after)
+		if event, ok := watchEvent(before, after); ok {
+			watchEvents = append(watchEvents, event)
+		}
+	}
+
+	if err := events.Record(c.Context(), watchEvents...); err != nil {
+		log.Printf("failed to record the watch flag changes of %s: %v", domainName, err)
+	}
+
+	return c.Status(200).JSON(api.BulkUpdate{
+		Matched: int(result.Matched),
+		Updated: int(result.Updated),
+	})
+}
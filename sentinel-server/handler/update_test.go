@@ -0,0 +1,71 @@
+package handler_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestUpdateSubdomains(t *testing.T) {
+	app := newTestApp(t)
+
+	request(t, app, "POST", "/api/v1/domains/", `{"name":"example.com","in_scope":["*.example.com"]}`, nil)
+	request(t, app, "POST", "/api/v1/domains/example.com", `["www.example.com","cdn1.example.com","cdn2.example.com"]`, nil)
+
+	subdomain := models.Subdomain{}
+	status := request(t, app, "PATCH", "/api/v1/domains/example.com/www.example.com",
+		`{"watch_http":false,"add_tags":["Prod"],"triage":"interesting"}`, &subdomain)
+	if status != 200 || subdomain.WatchHTTP || !subdomain.WatchDNS || !slices.Equal(subdomain.Tags, []string{"prod"}) ||
+		subdomain.Triage == nil || subdomain.Triage.State != models.TriageInteresting {
+		t.Errorf("updating a subdomain returned %d %+v", status, subdomain)
+	}
+
+	// the same triage state again doesn't add to the history
+	request(t, app, "PATCH", "/api/v1/domains/example.com/www.example.com", `{"triage":"interesting"}`, &subdomain)
+	if len(subdomain.TriageHistory) != 1 {
+		t.Errorf("triage history = %+v, want a single entry", subdomain.TriageHistory)
+	}
+
+	// turn off monitoring of the cdn hosts in one go
+	result := struct {
+		Matched int `json:"matched"`
+		Updated int `json:"updated"`
+	}{}
+	status = request(t, app, "PATCH", "/api/v1/domains/example.com/subdomains?name=cdn*", `{"watch_dns":false,"watch_http":false,"tags":["cdn"]}`, &result)
+	if status != 200 || result.Matched != 2 || result.Updated != 2 {
+		t.Errorf("bulk update returned %d %+v", status, result)
+	}
+	request(t, app, "PATCH", "/api/v1/domains/example.com/subdomains?name=cdn*", `{"watch_dns":false}`, &result)
+	if result.Matched != 2 || result.Updated != 0 {
+		t.Errorf("repeated bulk update = %+v, want nothing updated", result)
+	}
+
+	page := struct {
+		Subdomains []models.Subdomain `json:"subdomains"`
+	}{}
+	request(t, app, "GET", "/api/v1/domains/example.com/subdomains?watch_dns=false&tag=cdn", "", &page)
+	if len(page.Subdomains) != 2 {
+		t.Errorf("unwatched cdn hosts = %+v", page.Subdomains)
+	}
+
+	changes := struct {
+		Events []models.Event `json:"events"`
+	}{}
+	request(t, app, "GET", "/api/v1/events?type=watch_flags_changed", "", &changes)
+	if len(changes.Events) != 3 {
+		t.Errorf("recorded %d watch flag changes, want 3", len(changes.Events))
+	}
+
+	for _, body := range []string{`{}`, `{"triage":"maybe"}`, `{"tags":["a"],"add_tags":["b"]}`, `{"add_tags":[" "]}`} {
+		if status := request(t, app, "PATCH", "/api/v1/domains/example.com/www.example.com", body, nil); status != 400 {
+			t.Errorf("updating with %s returned %d, want 400", body, status)
+		}
+	}
+	if status := request(t, app, "PATCH", "/api/v1/domains/example.com/missing.example.com", `{"watch_dns":true}`, nil); status != 404 {
+		t.Errorf("updating a missing subdomain returned %d, want 404", status)
+	}
+	if status := request(t, app, "PATCH", "/api/v1/domains/missing.com/subdomains", `{"watch_dns":true}`, nil); status != 404 {
+		t.Errorf("bulk updating a missing domain returned %d, want 404", status)
+	}
+}
@@ -0,0 +1,369 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// Format is the format of an imported file
+type Format string
+
+const (
+	// Auto reads json lines if the file starts with one, plain text otherwise
+	Auto Format = ""
+	// Text is a list of names, one per line, lines starting with # are comments
+	Text Format = "text"
+	// CSV has a name column (name, host, subdomain or domain) and optionally a source column (source, sources,
+	// provider or providers). Without a header the first column holds the names.
+	CSV Format = "csv"
+	// JSONL is json lines output of subfinder, amass, httpx or dnsx, the tool is detected per line
+	JSONL     Format = "jsonl"
+	Subfinder Format = "subfinder"
+	Amass     Format = "amass"
+	Httpx     Format = "httpx"
+	Dnsx      Format = "dnsx"
+)
+
+// Formats are the formats that can be asked for explicitly
+var Formats = []Format{Text, CSV, JSONL, Subfinder, Amass, Httpx, Dnsx}
+
+// maxLineSize is the longest json line read, httpx lines carry response headers and hashes
+const maxLineSize = 4 << 20
+
+// Entry is a subdomain read from one line of an imported file along with the records the tool found for it
+type Entry struct {
+	// line of the file the entry was read from, starting at 1
+	Line      int
+	Name      string
+	Providers []string
+	DNS       *models.DNS
+	HTTP      *models.HTTP
+	// why the line couldn't be read
+	Error string
+}
+
+// DetectFormat guesses the format of a file from its name
+func DetectFormat(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CSV
+	case ".jsonl", ".json", ".ndjson":
+		return JSONL
+	}
+	return Auto
+}
+
+// Parse reads the entries of a file. Entries of tools that don't report where a name came from,
+// and of plain lists, get the default provider. Lines that can't be read are returned as entries
+// with an error, only an unreadable file fails the whole parse.
+func Parse(r io.Reader, format Format, provider string) ([]Entry, error) {
+	reader := bufio.NewReader(r)
+	if format == Auto {
+		format = sniff(reader)
+	}
+
+	switch format {
+	case Text:
+		return parseText(reader, provider)
+	case CSV:
+		return parseCSV(reader, provider)
+	case JSONL, Subfinder, Amass, Httpx, Dnsx:
+		return parseJSONL(reader, format, provider)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// sniff reads json lines if the first non blank character opens an object
+func sniff(reader *bufio.Reader) Format {
+	peeked, _ := reader.Peek(512)
+	peeked = bytes.TrimLeft(bytes.TrimPrefix(peeked, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(peeked) > 0 && peeked[0] == '{' {
+		return JSONL
+	}
+	return Text
+}
+
+func parseText(r io.Reader, provider string) ([]Entry, error) {
+	entries := []Entry{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entries = append(entries, Entry{Line: line, Name: normalizeName(text), Providers: []string{provider}})
+	}
+
+	return entries, scanner.Err()
+}
+
+func parseCSV(r io.Reader, provider string) ([]Entry, error) {
+	entries := []Entry{}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	nameColumn, sourceColumn := 0, -1
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			entries = append(entries, Entry{Line: parseErr.Line, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		// a header names the columns
+		if row == 0 {
+			header := make([]string, 0, len(record))
+			for _, cell := range record {
+				header = append(header, strings.ToLower(strings.TrimSpace(cell)))
+			}
+			if column := slices.IndexFunc(header, isOneOf("name", "host", "subdomain", "domain")); column >= 0 {
+				nameColumn = column
+				sourceColumn = slices.IndexFunc(header, isOneOf("source", "sources", "provider", "providers"))
+				continue
+			}
+		}
+
+		entry := Entry{Line: line, Providers: []string{provider}}
+		if nameColumn >= len(record) || strings.TrimSpace(record[nameColumn]) == "" {
+			entry.Error = "missing name"
+			entries = append(entries, entry)
+			continue
+		}
+		entry.Name = normalizeName(record[nameColumn])
+		if sourceColumn >= 0 && sourceColumn < len(record) {
+			if sources := splitSources(record[sourceColumn]); len(sources) > 0 {
+				entry.Providers = sources
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// toolOutput holds the fields of the json lines of all supported tools
+type toolOutput struct {
+	// subfinder
+	Host    string   `json:"host"`
+	Source  string   `json:"source"`
+	Input   string   `json:"input"`
+	Sources []string `json:"sources"`
+
+	// amass
+	Name      string `json:"name"`
+	Addresses []struct {
+		IP string `json:"ip"`
+	} `json:"addresses"`
+
+	// httpx
+	URL           string         `json:"url"`
+	StatusCode    any            `json:"status_code"`
+	Title         string         `json:"title"`
+	CDNName       string         `json:"cdn_name"`
+	CDNType       string         `json:"cdn_type"`
+	Tech          []string       `json:"tech"`
+	Words         int            `json:"words"`
+	Lines         int            `json:"lines"`
+	Port          string         `json:"port"`
+	Location      string         `json:"location"`
+	ContentLength int            `json:"content_length"`
+	Failed        bool           `json:"failed"`
+	Hash          map[string]any `json:"hash"`
+	Header        map[string]any `json:"header"`
+
+	// dnsx
+	Resolver []string `json:"resolver"`
+	A        []string `json:"a"`
+	AAAA     []string `json:"aaaa"`
+	CNAME    []string `json:"cname"`
+	NS       []string `json:"ns"`
+	MX       []string `json:"mx"`
+	PTR      []string `json:"ptr"`
+	TXT      []string `json:"txt"`
+}
+
+func parseJSONL(r io.Reader, format Format, provider string) ([]Entry, error) {
+	entries := []Entry{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		output := toolOutput{}
+		if err := json.Unmarshal(data, &output); err != nil {
+			entries = append(entries, Entry{Line: line, Error: "invalid json: " + err.Error()})
+			continue
+		}
+
+		tool := format
+		if tool == JSONL {
+			tool = detectTool(output)
+		}
+		entry := toolEntry(output, tool, provider)
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// detectTool tells the tool of a json line by the fields only it writes
+func detectTool(output toolOutput) Format {
+	switch {
+	case output.URL != "":
+		return Httpx
+	case output.Resolver != nil || output.A != nil || output.AAAA != nil || output.CNAME != nil:
+		return Dnsx
+	case output.Name != "":
+		return Amass
+	case output.Host != "":
+		return Subfinder
+	}
+	return ""
+}
+
+func toolEntry(output toolOutput, tool Format, provider string) Entry {
+	entry := Entry{Providers: []string{provider}}
+
+	switch tool {
+	case Subfinder:
+		entry.Name = output.Host
+		if sources := append(splitSources(output.Source), lowercaseAll(output.Sources)...); len(sources) > 0 {
+			entry.Providers = sources
+		}
+
+	case Amass:
+		entry.Name = output.Name
+		if sources := lowercaseAll(output.Sources); len(sources) > 0 {
+			entry.Providers = sources
+		}
+		if len(output.Addresses) > 0 {
+			entry.DNS = &models.DNS{}
+			for _, address := range output.Addresses {
+				ip := net.ParseIP(address.IP)
+				if ip == nil {
+					continue
+				}
+				if ip.To4() != nil {
+					entry.DNS.ARecords = append(entry.DNS.ARecords, address.IP)
+				} else {
+					entry.DNS.AAAARecords = append(entry.DNS.AAAARecords, address.IP)
+				}
+			}
+		}
+
+	case Httpx:
+		// the input is the name httpx was given, the url the one it ended up requesting
+		entry.Name = hostname(output.Input)
+		if entry.Name == "" {
+			entry.Name = hostname(output.URL)
+		}
+		statusCode, _ := output.StatusCode.(float64)
+		entry.HTTP = &models.HTTP{
+			StatusCode:      int(statusCode),
+			Title:           output.Title,
+			CDNName:         output.CDNName,
+			CDNType:         output.CDNType,
+			Technologies:    output.Tech,
+			Hashes:          output.Hash,
+			Words:           output.Words,
+			Lines:           output.Lines,
+			Failed:          output.Failed,
+			Port:            output.Port,
+			Location:        output.Location,
+			ResponseHeaders: output.Header,
+			ContentLength:   output.ContentLength,
+		}
+
+	case Dnsx:
+		entry.Name = output.Host
+		entry.DNS = &models.DNS{
+			ARecords:     output.A,
+			AAAARecords:  output.AAAA,
+			CnameRecords: output.CNAME,
+			NSRecords:    output.NS,
+			MXRecords:    output.MX,
+			PTRRecords:   output.PTR,
+			TXTRecords:   output.TXT,
+		}
+
+	default:
+		entry.Error = "unrecognized json line"
+		return entry
+	}
+
+	entry.Name = normalizeName(entry.Name)
+	if entry.Name == "" {
+		entry.Error = "missing name"
+	}
+	return entry
+}
+
+// normalizeName lowercases a name and trims the spaces and trailing dot around it
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// hostname returns the host of a url or host:port, without its port
+func hostname(value string) string {
+	if value == "" {
+		return ""
+	}
+	if !strings.Contains(value, "://") {
+		value = "//" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// splitSources splits a cell or field listing sources by commas, semicolons or pipes
+func splitSources(value string) []string {
+	return lowercaseAll(strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|'
+	}))
+}
+
+func lowercaseAll(values []string) []string {
+	lowercased := []string{}
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" && !slices.Contains(lowercased, value) {
+			lowercased = append(lowercased, value)
+		}
+	}
+	return lowercased
+}
+
+func isOneOf(values ...string) func(string) bool {
+	return func(value string) bool {
+		return slices.Contains(values, value)
+	}
+}
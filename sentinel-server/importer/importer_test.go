@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseText(t *testing.T) {
+	input := "# subdomains\nWWW.example.com.\n\n  api.example.com  \n"
+
+	entries, err := Parse(strings.NewReader(input), Auto, "manual")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "www.example.com" || entries[0].Line != 2 || entries[1].Line != 4 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if !slices.Equal(entries[1].Providers, []string{"manual"}) {
+		t.Errorf("expected the default provider, got %v", entries[1].Providers)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := "id,host,source\n1,www.example.com,crtsh;Anubis\n2,,crtsh\n3,api.example.com\n"
+
+	entries, err := Parse(strings.NewReader(input), CSV, "import")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected three entries, got %+v", entries)
+	}
+	if entries[0].Name != "www.example.com" || entries[0].Line != 2 || !slices.Equal(entries[0].Providers, []string{"crtsh", "anubis"}) {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Error == "" {
+		t.Errorf("expected a row without a name to be invalid: %+v", entries[1])
+	}
+	if !slices.Equal(entries[2].Providers, []string{"import"}) {
+		t.Errorf("expected a row without a source to get the default provider: %+v", entries[2])
+	}
+
+	// without a header the first column holds the names
+	entries, _ = Parse(strings.NewReader("dev.example.com,x\n"), CSV, "import")
+	if len(entries) != 1 || entries[0].Name != "dev.example.com" {
+		t.Errorf("unexpected entries without a header: %+v", entries)
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	input := strings.Join([]string{
+		`{"host":"www.example.com","input":"example.com","source":"crtsh"}`,
+		`{"name":"api.example.com","domain":"example.com","addresses":[{"ip":"1.2.3.4"},{"ip":"::1"}],"sources":["Crtsh","DNSDumpster"]}`,
+		`{"url":"https://app.example.com:443","input":"app.example.com","status_code":200,"title":"Login","tech":["Nginx:1.25"],"port":"443"}`,
+		`{"host":"mail.example.com","resolver":["1.1.1.1:53"],"a":["5.6.7.8"],"cname":["mail.provider.net"],"status_code":"NOERROR"}`,
+		`{"unknown":true}`,
+		`not json`,
+	}, "\n")
+
+	entries, err := Parse(strings.NewReader(input), Auto, "import")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("expected six entries, got %+v", entries)
+	}
+
+	if subfinder := entries[0]; subfinder.Name != "www.example.com" || !slices.Equal(subfinder.Providers, []string{"crtsh"}) {
+		t.Errorf("unexpected subfinder entry: %+v", subfinder)
+	}
+	amass := entries[1]
+	if amass.Name != "api.example.com" || !slices.Equal(amass.Providers, []string{"crtsh", "dnsdumpster"}) ||
+		amass.DNS == nil || !slices.Equal(amass.DNS.ARecords, []string{"1.2.3.4"}) || !slices.Equal(amass.DNS.AAAARecords, []string{"::1"}) {
+		t.Errorf("unexpected amass entry: %+v", amass)
+	}
+	httpx := entries[2]
+	if httpx.Name != "app.example.com" || httpx.HTTP == nil || httpx.HTTP.StatusCode != 200 || httpx.HTTP.Title != "Login" {
+		t.Errorf("unexpected httpx entry: %+v", httpx)
+	}
+	dnsx := entries[3]
+	if dnsx.Name != "mail.example.com" || dnsx.DNS == nil || !slices.Equal(dnsx.DNS.CnameRecords, []string{"mail.provider.net"}) {
+		t.Errorf("unexpected dnsx entry: %+v", dnsx)
+	}
+	if entries[4].Error == "" || entries[5].Error == "" || entries[5].Line != 6 {
+		t.Errorf("expected unrecognized and invalid lines to be reported: %+v %+v", entries[4], entries[5])
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,8 +11,13 @@ import (
 
 	"github.com/0xgwyn/sentinel/config"
 	"github.com/0xgwyn/sentinel/database"
+	"github.com/0xgwyn/sentinel/handler"
 	"github.com/0xgwyn/sentinel/middleware"
+	"github.com/0xgwyn/sentinel/migrations"
 	"github.com/0xgwyn/sentinel/router"
+	"github.com/0xgwyn/sentinel/scheduler"
+	"github.com/0xgwyn/sentinel/storage"
+	"github.com/0xgwyn/sentinel/ui"
 )
 
 func main() {
@@ -22,33 +28,72 @@ func main() {
 }
 
 func run() error {
-	// init db
-	err := database.InitDB()
-	if err != nil {
-		return err
-	}
+	// the mongo backend needs its database, indexes and schema migrations before the store opens
+	if storage.Selected() == storage.MongoBackend {
+		// init db
+		err := database.InitDB()
+		if err != nil {
+			return err
+		}
 
-	// defer closing db
-	defer database.CloseDB()
+		// defer closing db
+		defer database.CloseDB()
 
-	// Initialize indexes unless explicitly skipped
-	if skip, _ := config.LoadEnv("SKIP_INDEXES"); skip != "true" {
-		if err := database.InitIndexes(); err != nil {
+		// Initialize indexes unless explicitly skipped
+		if skip, _ := config.LoadEnv("SKIP_INDEXES"); skip != "true" {
+			if err := database.InitIndexes(); err != nil {
+				return err
+			}
+			log.Println("Indexes initialized successfully")
+		}
+
+		// Check the schema version and handle pending migrations, defaults to applying them
+		mode, _ := config.LoadEnv("MIGRATIONS")
+		if mode == "" {
+			mode = string(migrations.ModeUp)
+		}
+		if err := migrations.Run(context.Background(), migrations.Mode(mode)); err != nil {
 			return err
 		}
-		log.Println("Indexes initialized successfully")
+		if migrations.Mode(mode) == migrations.ModeDryRun {
+			// a dry run only reports the pending migrations
+			return nil
+		}
 	}
 
+	// open the storage backend
+	if err := storage.InitStore(); err != nil {
+		return err
+	}
+
+	// defer closing the store
+	defer storage.CloseStore()
+
 	// Insert mock data if enabled
 	if insert, _ := config.LoadEnv("INSERT_MOCK_DATA"); insert == "true" {
-		if err := database.InsertMockData(); err != nil {
+		if err := storage.InsertMockData(context.Background(), storage.GetStore()); err != nil {
 			return err
 		}
 		log.Println("Mock data inserted successfully")
 	}
 
-	// create app
-	app := fiber.New()
+	// start the scheduled jobs
+	jobs, err := scheduler.NewScheduler(scheduler.NewDefaultConfig())
+	if err != nil {
+		return err
+	}
+	if err := jobs.Start(); err != nil {
+		return err
+	}
+
+	// defer stopping the scheduled jobs
+	defer jobs.Stop()
+
+	// create app, imports upload whole recon outputs so the body limit is raised from 4MB
+	app := fiber.New(fiber.Config{
+		BodyLimit:    64 * 1024 * 1024,
+		ErrorHandler: handler.ErrorHandler,
+	})
 
 	// add middlewares
 	app.Use(middleware.NewAuthMiddleware())
@@ -59,6 +104,9 @@ func run() error {
 	// add routes
 	router.AddRouterGroup(app)
 
+	// add the web dashboard
+	ui.Register(app)
+
 	// start server
 	var port string
 	if port, _ = config.LoadEnv("PORT"); port == "" {
@@ -3,6 +3,7 @@ package middleware
 import (
 	"crypto/sha256"
 	"crypto/subtle"
+	"strings"
 
 	"github.com/0xgwyn/sentinel/config"
 	"github.com/gofiber/fiber/v2"
@@ -25,16 +26,32 @@ func ValidateAPIKey(c *fiber.Ctx, key string) (bool, error) {
 }
 
 func NewAuthMiddleware() fiber.Handler {
-	return keyauth.New(keyauth.Config{
+	headerAuth := keyauth.New(keyauth.Config{
 		KeyLookup:    "header:X-API-Key",
 		Validator:    ValidateAPIKey,
 		ErrorHandler: handleAuthError,
 	})
+	// browsers can't set headers on EventSource and WebSocket connections, so streams
+	// can pass the key in the query instead
+	queryAuth := keyauth.New(keyauth.Config{
+		KeyLookup:    "query:api_key",
+		Validator:    ValidateAPIKey,
+		ErrorHandler: handleAuthError,
+	})
+
+	return func(c *fiber.Ctx) error {
+		// the dashboard's files are public, it signs in to the api with the user's key
+		if !strings.HasPrefix(c.Path(), "/api") {
+			return c.Next()
+		}
+		if (c.Path() == "/api/v1/stream" || c.Path() == "/api/stream") && c.Get("X-API-Key") == "" && c.Query("api_key") != "" {
+			return queryAuth(c)
+		}
+		return headerAuth(c)
+	}
 }
 
+// handleAuthError leaves writing the error to the error handler of the app
 func handleAuthError(c *fiber.Ctx, err error) error {
-	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		"error":   "Unauthorized",
-		"message": "Invalid or missing API key",
-	})
+	return fiber.NewError(fiber.StatusUnauthorized, "invalid or missing api key")
 }
@@ -0,0 +1,192 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/0xgwyn/sentinel/database"
+)
+
+// Mode decides what happens to pending migrations on startup
+type Mode string
+
+const (
+	// ModeUp applies the pending migrations
+	ModeUp Mode = "up"
+	// ModeDryRun reports what the pending migrations would change without changing anything
+	ModeDryRun Mode = "dry-run"
+	// ModeSkip leaves the schema as it is
+	ModeSkip Mode = "skip"
+)
+
+// Migration is a single versioned change of the schema.
+// Up applies the change, or only reports what it would change when dryRun is set.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, dryRun bool) ([]string, error)
+}
+
+// Record is the document stored in the schema_migrations collection for every applied migration
+type Record struct {
+	Version   int           `json:"version" bson:"version"`
+	Name      string        `json:"name" bson:"name"`
+	AppliedAt bson.DateTime `json:"applied_at" bson:"applied_at"`
+	Changes   []string      `json:"changes,omitempty" bson:"changes,omitempty"`
+}
+
+// Result describes what running a migration changed, or would change in a dry run
+type Result struct {
+	Version int      `json:"version"`
+	Name    string   `json:"name"`
+	Changes []string `json:"changes"`
+}
+
+const collectionName = "schema_migrations"
+
+// Latest returns the schema version this build expects
+func Latest() int {
+	if len(registry) == 0 {
+		return 0
+	}
+	return registry[len(registry)-1].Version
+}
+
+// CurrentVersion returns the highest version recorded in the database, 0 if none was applied yet
+func CurrentVersion(ctx context.Context) (int, error) {
+	record := Record{}
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := database.GetDBCollection(collectionName).FindOne(ctx, bson.M{}, opts).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return record.Version, nil
+}
+
+// Check refuses a schema version this build doesn't know about, which happens
+// when the database was migrated by a newer build
+func Check(ctx context.Context) error {
+	current, err := CurrentVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	return checkVersion(current, Latest())
+}
+
+func checkVersion(current, latest int) error {
+	if current > latest {
+		return fmt.Errorf("unknown schema version %d, this build only knows up to version %d", current, latest)
+	}
+	return nil
+}
+
+// Pending returns the migrations that are newer than the current version, in order
+func Pending(ctx context.Context) ([]Migration, error) {
+	current, err := CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(current, Latest()); err != nil {
+		return nil, err
+	}
+
+	return pendingAfter(current), nil
+}
+
+func pendingAfter(version int) []Migration {
+	pending := make([]Migration, 0)
+	for _, migration := range registry {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// Up runs the pending migrations in order and records each one that was applied.
+// It stops at the first failing migration, the ones before it stay applied.
+func Up(ctx context.Context, dryRun bool) ([]Result, error) {
+	pending, err := Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun && len(pending) > 0 {
+		// The unique version keeps two instances from recording the same migration
+		_, err := database.GetDBCollection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]Result, 0, len(pending))
+	for _, migration := range pending {
+		changes, err := migration.Up(ctx, dryRun)
+		if err != nil {
+			return results, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		results = append(results, Result{Version: migration.Version, Name: migration.Name, Changes: changes})
+
+		if dryRun {
+			continue
+		}
+
+		record := Record{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: bson.NewDateTimeFromTime(time.Now()),
+			Changes:   changes,
+		}
+		if _, err := database.GetDBCollection(collectionName).InsertOne(ctx, record); err != nil {
+			return results, fmt.Errorf("failed to record migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return results, nil
+}
+
+// Run checks the schema version and handles the pending migrations according to the mode
+func Run(ctx context.Context, mode Mode) error {
+	switch mode {
+	case ModeSkip:
+		return Check(ctx)
+	case ModeUp, ModeDryRun:
+	default:
+		return fmt.Errorf("invalid migrations mode: %s", mode)
+	}
+
+	dryRun := mode == ModeDryRun
+	results, err := Up(ctx, dryRun)
+	for _, result := range results {
+		verb := "applied"
+		if dryRun {
+			verb = "would apply"
+		}
+		log.Printf("migration %d (%s) %s", result.Version, result.Name, verb)
+		for _, change := range result.Changes {
+			log.Printf("  %s", change)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		log.Printf("schema is up to date at version %d", Latest())
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRegistryOrder(t *testing.T) {
+	for i, migration := range registry {
+		if migration.Version != i+1 {
+			t.Errorf("migration %q has version %d, expected %d", migration.Name, migration.Version, i+1)
+		}
+		if migration.Name == "" || migration.Up == nil {
+			t.Errorf("migration %d is missing a name or an up function", migration.Version)
+		}
+	}
+
+	if Latest() != len(registry) {
+		t.Errorf("Latest() = %d, expected %d", Latest(), len(registry))
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	if err := checkVersion(0, 3); err != nil {
+		t.Errorf("expected a fresh database to be accepted: %v", err)
+	}
+	if err := checkVersion(3, 3); err != nil {
+		t.Errorf("expected the latest version to be accepted: %v", err)
+	}
+	if err := checkVersion(4, 3); err == nil {
+		t.Error("expected an unknown version to be refused")
+	}
+}
+
+func TestPendingAfter(t *testing.T) {
+	if pending := pendingAfter(0); len(pending) != len(registry) {
+		t.Errorf("expected every migration to be pending on a fresh database, got %d", len(pending))
+	}
+	if pending := pendingAfter(Latest()); len(pending) != 0 {
+		t.Errorf("expected no pending migration at the latest version, got %d", len(pending))
+	}
+	if pending := pendingAfter(1); len(pending) > 0 && pending[0].Version != 2 {
+		t.Errorf("expected pending migrations to start after the current version, got %d", pending[0].Version)
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	keys := bson.D{{Key: "domain", Value: 1}, {Key: "resolution_date", Value: -1}}
+	if name := indexName(keys); name != "domain_1_resolution_date_-1" {
+		t.Errorf("indexName() = %q", name)
+	}
+}
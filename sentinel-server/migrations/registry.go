@@ -0,0 +1,234 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/0xgwyn/sentinel/database"
+)
+
+// registry holds every migration in version order, new migrations are appended with the next version.
+// A migration must never be changed or removed once it was released.
+var registry = []Migration{
+	{
+		Version: 1,
+		Name:    "fix subdomain status and watch indexes",
+		Up: func(ctx context.Context, dryRun bool) ([]string, error) {
+			changes, err := dropIndexes(ctx, dryRun, "subdomains", "status_1", "watch_1")
+			if err != nil {
+				return changes, err
+			}
+
+			created, err := createIndexes(ctx, dryRun, "subdomains",
+				bson.D{{Key: "dns_status", Value: 1}},
+				bson.D{{Key: "http_status", Value: 1}},
+				bson.D{{Key: "watch_dns", Value: 1}},
+				bson.D{{Key: "watch_http", Value: 1}},
+			)
+			return append(changes, created...), err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "backfill snapshot seen counters",
+		Up: func(ctx context.Context, dryRun bool) ([]string, error) {
+			missing := bson.M{"seen_count": bson.M{"$exists": false}}
+
+			changes, err := backfill(ctx, dryRun, "dns", missing, bson.M{"seen_count": 1, "last_seen": "$resolution_date"})
+			if err != nil {
+				return changes, err
+			}
+
+			backfilled, err := backfill(ctx, dryRun, "http", missing, bson.M{"seen_count": 1, "last_seen": "$scanning_date"})
+			return append(changes, backfilled...), err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "backfill subdomain status change dates",
+		Up: func(ctx context.Context, dryRun bool) ([]string, error) {
+			// Without a recorded change the status is as old as the subdomain
+			changes, err := backfill(ctx, dryRun, "subdomains",
+				bson.M{"dns_status": bson.M{"$nin": bson.A{"", nil}}, "dns_status_changed_at": bson.M{"$exists": false}},
+				bson.M{"dns_status_changed_at": "$created_at"},
+			)
+			if err != nil {
+				return changes, err
+			}
+
+			backfilled, err := backfill(ctx, dryRun, "subdomains",
+				bson.M{"http_status": bson.M{"$nin": bson.A{"", nil}}, "http_status_changed_at": bson.M{"$exists": false}},
+				bson.M{"http_status_changed_at": "$created_at"},
+			)
+			return append(changes, backfilled...), err
+		},
+	},
+	{
+		Version: 4,
+		Name:    "backfill subdomain seeds",
+		Up: func(ctx context.Context, dryRun bool) ([]string, error) {
+			// Subdomains found before seeds were recorded were enumerated from their own domain
+			return backfill(ctx, dryRun, "subdomains", bson.M{"seed": bson.M{"$exists": false}}, bson.M{"seed": "$domain"})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "index daily stats rollups",
+		Up: func(ctx context.Context, dryRun bool) ([]string, error) {
+			return createIndexes(ctx, dryRun, "rollups", bson.D{{Key: "domain", Value: 1}, {Key: "date", Value: 1}})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "index subdomain listing sorts",
+		Up: func(ctx context.Context, dryRun bool) ([]string, error) {
+			// The unique (domain, name) index already serves the sort by name
+			sorted := func(field string) bson.D {
+				return bson.D{{Key: "domain", Value: 1}, {Key: field, Value: 1}, {Key: "name", Value: 1}}
+			}
+			return createIndexes(ctx, dryRun, "subdomains",
+				sorted("created_at"),
+				sorted("updated_at"),
+				sorted("dns_status_changed_at"),
+				sorted("http_status_changed_at"),
+				sorted("next_dns_check"),
+				sorted("archived_at"),
+			)
+		},
+	},
+}
+
+// dropIndexes drops the named indexes of a collection that exist
+func dropIndexes(ctx context.Context, dryRun bool, collName string, names ...string) ([]string, error) {
+	coll := database.GetDBCollection(collName)
+
+	existing, err := indexNames(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]string, 0)
+	for _, name := range names {
+		if !slices.Contains(existing, name) {
+			continue
+		}
+		if !dryRun {
+			if err := coll.Indexes().DropOne(ctx, name); err != nil {
+				return changes, err
+			}
+		}
+		changes = append(changes, fmt.Sprintf("drop index %s on %s", name, collName))
+	}
+
+	return changes, nil
+}
+
+// createIndexes creates the indexes of a collection that don't exist yet
+func createIndexes(ctx context.Context, dryRun bool, collName string, keys ...bson.D) ([]string, error) {
+	coll := database.GetDBCollection(collName)
+
+	existing, err := indexNames(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	indexModels := make([]mongo.IndexModel, 0)
+	changes := make([]string, 0)
+	for _, key := range keys {
+		name := indexName(key)
+		if slices.Contains(existing, name) {
+			continue
+		}
+		indexModels = append(indexModels, mongo.IndexModel{Keys: key})
+		changes = append(changes, fmt.Sprintf("create index %s on %s", name, collName))
+	}
+
+	if !dryRun && len(indexModels) > 0 {
+		if _, err := coll.Indexes().CreateMany(ctx, indexModels); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// backfill sets the fields of the documents that match the filter, values may refer to other fields of the document
+func backfill(ctx context.Context, dryRun bool, collName string, filter bson.M, fields bson.M) ([]string, error) {
+	coll := database.GetDBCollection(collName)
+
+	var count int64
+	if dryRun {
+		var err error
+		if count, err = coll.CountDocuments(ctx, filter); err != nil {
+			return nil, err
+		}
+	} else {
+		// An update pipeline lets the new values refer to the fields of each document
+		result, err := coll.UpdateMany(ctx, filter, mongo.Pipeline{{{Key: "$set", Value: fields}}})
+		if err != nil {
+			return nil, err
+		}
+		count = result.ModifiedCount
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("backfill %s of %d documents in %s", sortedKeys(fields), count, collName)}, nil
+}
+
+// namespaceNotFound is the error code mongodb returns for a collection that doesn't exist
+const namespaceNotFound = 26
+
+// indexNames returns the names of the indexes of a collection
+func indexNames(ctx context.Context, coll *mongo.Collection) ([]string, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+		// a collection that doesn't exist yet has no indexes
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	names := make([]string, 0)
+	for cursor.Next(ctx) {
+		index := struct {
+			Name string `bson:"name"`
+		}{}
+		if err := cursor.Decode(&index); err != nil {
+			return nil, err
+		}
+		names = append(names, index.Name)
+	}
+
+	return names, cursor.Err()
+}
+
+// indexName returns the default name mongodb gives to an index with the given keys
+func indexName(keys bson.D) string {
+	name := ""
+	for i, key := range keys {
+		if i > 0 {
+			name += "_"
+		}
+		name += fmt.Sprintf("%s_%v", key.Key, key.Value)
+	}
+	return name
+}
+
+func sortedKeys(fields bson.M) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
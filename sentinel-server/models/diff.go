@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// FieldChange describes a single field that differs between two scans
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+// HTTPDiff holds the changes between two consecutive HTTP snapshots of a subdomain
+type HTTPDiff struct {
+	From    bson.DateTime `json:"from"`
+	To      bson.DateTime `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// DiffHTTP compares two HTTP snapshots and returns the fields that changed from previous to current.
+// Technologies are compared regardless of order, response headers are compared per header name.
+func DiffHTTP(previous, current HTTP) []FieldChange {
+	changes := make([]FieldChange, 0)
+
+	if previous.StatusCode != current.StatusCode {
+		changes = append(changes, FieldChange{Field: "status_code", Old: previous.StatusCode, New: current.StatusCode})
+	}
+	if previous.Title != current.Title {
+		changes = append(changes, FieldChange{Field: "title", Old: previous.Title, New: current.Title})
+	}
+	if previous.ContentLength != current.ContentLength {
+		changes = append(changes, FieldChange{Field: "content_length", Old: previous.ContentLength, New: current.ContentLength})
+	}
+
+	// compare technologies as sets
+	oldTech := sortedCopy(previous.Technologies)
+	newTech := sortedCopy(current.Technologies)
+	if !slices.Equal(oldTech, newTech) {
+		changes = append(changes, FieldChange{Field: "technologies", Old: oldTech, New: newTech})
+	}
+
+	// hashes are compared per algorithm
+	changes = append(changes, diffMap("hashes", previous.Hashes, current.Hashes)...)
+
+	// response headers are compared per header
+	changes = append(changes, diffMap("response_headers", previous.ResponseHeaders, current.ResponseHeaders)...)
+
+	return changes
+}
+
+// diffMap reports every key that was added, removed or modified as "<prefix>.<key>"
+func diffMap(prefix string, previous, current map[string]any) []FieldChange {
+	keys := make([]string, 0, len(previous)+len(current))
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	changes := make([]FieldChange, 0)
+	for _, key := range keys {
+		// values decoded from bson (bson.A) and plain go slices print the same way
+		oldValue, oldOk := previous[key]
+		newValue, newOk := current[key]
+		if oldOk && newOk && fmt.Sprint(oldValue) == fmt.Sprint(newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: prefix + "." + key, Old: oldValue, New: newValue})
+	}
+
+	return changes
+}
+
+func sortedCopy(values []string) []string {
+	result := slices.Clone(values)
+	slices.Sort(result)
+	return result
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestDiffHTTP(t *testing.T) {
+	previous := HTTP{
+		StatusCode:      200,
+		Title:           "Login",
+		Technologies:    []string{"nginx", "React"},
+		ContentLength:   100,
+		Hashes:          map[string]any{"sha256": "aaa"},
+		ResponseHeaders: map[string]any{"server": "nginx", "x-frame-options": "DENY", "vary": bson.A{"a", "b"}},
+	}
+	current := HTTP{
+		StatusCode:      302,
+		Title:           "Login",
+		Technologies:    []string{"React", "nginx"},
+		ContentLength:   120,
+		Hashes:          map[string]any{"sha256": "bbb"},
+		ResponseHeaders: map[string]any{"server": "nginx", "location": "/sso", "vary": []string{"a", "b"}},
+	}
+
+	changes := DiffHTTP(previous, current)
+
+	expected := []string{"status_code", "content_length", "hashes.sha256", "response_headers.location", "response_headers.x-frame-options"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, field := range expected {
+		if changes[i].Field != field {
+			t.Fatalf("expected change %d to be %s, got %s", i, field, changes[i].Field)
+		}
+	}
+
+	if len(DiffHTTP(current, current)) != 0 {
+		t.Fatalf("expected no changes between identical snapshots")
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "go.mongodb.org/mongo-driver/v2/bson"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
 
 type StatusType string
 
@@ -30,10 +34,136 @@ const (
 	LastService StatusType = "last_service"
 )
 
+type RetentionMode string
+
+const (
+	// snapshots past the raw and rollup windows are deleted
+	RetentionDelete RetentionMode = "delete"
+	// snapshots past the raw and rollup windows are rolled up to the last snapshot of each day
+	RetentionDailyRollup RetentionMode = "daily_rollup"
+	// snapshots past the raw and rollup windows are only kept if they differ from the previous snapshot
+	RetentionKeepChanges RetentionMode = "keep_changes"
+)
+
+// RetentionPolicy defines how long dns and http snapshots are kept as they are and what happens to them
+// afterwards. Snapshots last seen within RawDays are kept as they are, the ones last seen within RollupDays
+// more days are rolled up to the last snapshot of each day and older ones are handled by Mode.
+// The fields a domain policy leaves unset (0 or empty) come from the global policy, a global RawDays of 0
+// keeps snapshots forever. The latest snapshot of a subdomain is always kept.
+type RetentionPolicy struct {
+	RawDays    int           `json:"raw_days,omitempty" bson:"raw_days,omitempty"`
+	RollupDays int           `json:"rollup_days,omitempty" bson:"rollup_days,omitempty"`
+	Mode       RetentionMode `json:"mode,omitempty" bson:"mode,omitempty"`
+}
+
+type TriageState string
+
+const (
+	// nobody looked at the asset yet, assets without a triage are new as well
+	TriageNew TriageState = "new"
+	// an analyst looked at the asset
+	TriageReviewed TriageState = "reviewed"
+	// the asset is worth a closer look
+	TriageInteresting TriageState = "interesting"
+	// the asset is not worth looking at
+	TriageIgnored TriageState = "ignored"
+	// a finding on the asset was reported
+	TriageReported TriageState = "reported"
+)
+
+// Triage is the triage state of an asset along with who set it and when
+type Triage struct {
+	State     TriageState   `json:"state" bson:"state"`
+	ChangedBy string        `json:"changed_by" bson:"changed_by"`
+	ChangedAt bson.DateTime `json:"changed_at" bson:"changed_at"`
+}
+
+// Note is a free-form note an analyst attached to an asset
+type Note struct {
+	ID        bson.ObjectID `json:"id" bson:"_id"`
+	Text      string        `json:"text" bson:"text"`
+	Author    string        `json:"author" bson:"author"`
+	CreatedAt bson.DateTime `json:"created_at" bson:"created_at"`
+	UpdatedAt bson.DateTime `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+// Annotations are what analysts attach to domains and subdomains
+type Annotations struct {
+	Tags          []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	Notes         []Note   `json:"notes,omitempty" bson:"notes,omitempty"`
+	Triage        *Triage  `json:"triage,omitempty" bson:"triage,omitempty"`
+	TriageHistory []Triage `json:"triage_history,omitempty" bson:"triage_history,omitempty"`
+}
+
+// Rewards describes what a program pays for findings
+type Rewards struct {
+	Bounty   bool    `json:"bounty" bson:"bounty"`
+	Currency string  `json:"currency,omitempty" bson:"currency,omitempty"`
+	Min      float64 `json:"min,omitempty" bson:"min,omitempty"`
+	Max      float64 `json:"max,omitempty" bson:"max,omitempty"`
+	Notes    string  `json:"notes,omitempty" bson:"notes,omitempty"`
+}
+
+// ScanSettings are shared by the domains of a program, unset fields keep the defaults
+type ScanSettings struct {
+	WatchDNS  *bool `json:"watch_dns,omitempty" bson:"watch_dns,omitempty"`
+	WatchHTTP *bool `json:"watch_http,omitempty" bson:"watch_http,omitempty"`
+}
+
+// WatchFlags returns the watch flags new subdomains start with, both are on unless the settings turn them off
+func (s *ScanSettings) WatchFlags() (watchDNS bool, watchHTTP bool) {
+	watchDNS, watchHTTP = true, true
+	if s == nil {
+		return
+	}
+	if s.WatchDNS != nil {
+		watchDNS = *s.WatchDNS
+	}
+	if s.WatchHTTP != nil {
+		watchHTTP = *s.WatchHTTP
+	}
+	return
+}
+
+// Notifications are sent for the events of every domain of a program
+type Notifications struct {
+	// urls the events are posted to as json
+	Webhooks []string `json:"webhooks,omitempty" bson:"webhooks,omitempty"`
+	// event types to notify about, all of them if empty
+	Events []EventType `json:"events,omitempty" bson:"events,omitempty"`
+}
+
+// Program groups the root domains of a bug bounty program or workspace
+type Program struct {
+	Name     string `json:"name,omitempty" bson:"name"`
+	Platform string `json:"platform,omitempty" bson:"platform,omitempty"`
+	URL      string `json:"url,omitempty" bson:"url,omitempty"`
+
+	// Scope rules shared by every domain of the program
+	InScope    []string `json:"in_scope,omitempty" bson:"in_scope,omitempty"`
+	OutOfScope []string `json:"out_of_scope,omitempty" bson:"out_of_scope,omitempty"`
+
+	Rewards       *Rewards       `json:"rewards,omitempty" bson:"rewards,omitempty"`
+	ScanSettings  *ScanSettings  `json:"scan_settings,omitempty" bson:"scan_settings,omitempty"`
+	Notifications *Notifications `json:"notifications,omitempty" bson:"notifications,omitempty"`
+	CreatedAt     bson.DateTime  `json:"created_at,omitempty" bson:"created_at"`
+}
+
 type Domain struct {
 	Name       string   `json:"name,omitempty" bson:"name"`
 	InScope    []string `json:"in_scope,omitempty" bson:"in_scope"`
 	OutOfScope []string `json:"out_of_scope,omitempty" bson:"out_of_scope"`
+
+	// Name of the program the domain belongs to
+	Program string `json:"program,omitempty" bson:"program,omitempty"`
+
+	// Overrides the global retention policy for the domain
+	Retention *RetentionPolicy `json:"retention,omitempty" bson:"retention,omitempty"`
+
+	// Set while the domain is archived, archived domains are hidden from listings and scans
+	ArchivedAt bson.DateTime `json:"archived_at,omitempty" bson:"archived_at,omitempty"`
+
+	Annotations `bson:",inline"`
 }
 
 type Subdomain struct {
@@ -42,12 +172,35 @@ type Subdomain struct {
 	CreatedAt bson.DateTime `json:"created_at,omitempty" bson:"created_at"`
 	UpdatedAt bson.DateTime `json:"updated_at,omitempty" bson:"updated_at"`
 	Providers []string      `json:"providers,omitempty" bson:"providers"`
-	WatchHTTP bool          `json:"watch_http,omitempty" bson:"watch_http"`
-	WatchDNS  bool          `json:"watch_dns,omitempty" bson:"watch_dns"`
+	// Apex domain whose enumeration found the subdomain, either the domain itself or one derived from its scope
+	Seed      string `json:"seed,omitempty" bson:"seed,omitempty"`
+	WatchHTTP bool   `json:"watch_http,omitempty" bson:"watch_http"`
+	WatchDNS  bool   `json:"watch_dns,omitempty" bson:"watch_dns"`
 
 	// Status types of a subdomain
 	DNSStatus  StatusType `json:"dns_status,omitempty" bson:"dns_status"`
 	HTTPStatus StatusType `json:"http_status,omitempty" bson:"http_status"`
+
+	// When and why the statuses last changed, used to age fresh statuses
+	DNSStatusChangedAt  bson.DateTime `json:"dns_status_changed_at,omitempty" bson:"dns_status_changed_at,omitempty"`
+	DNSStatusReason     string        `json:"dns_status_reason,omitempty" bson:"dns_status_reason,omitempty"`
+	HTTPStatusChangedAt bson.DateTime `json:"http_status_changed_at,omitempty" bson:"http_status_changed_at,omitempty"`
+	HTTPStatusReason    string        `json:"http_status_reason,omitempty" bson:"http_status_reason,omitempty"`
+
+	// Adaptive dns scheduling, every failed resolution in a row pushes the next check further away
+	DNSMisses        int           `json:"dns_misses,omitempty" bson:"dns_misses,omitempty"`
+	DNSCheckInterval int           `json:"dns_check_interval,omitempty" bson:"dns_check_interval,omitempty"` // hours
+	NextDNSCheck     bson.DateTime `json:"next_dns_check,omitempty" bson:"next_dns_check,omitempty"`
+	// set when dns watching was turned off because of too many failed resolutions
+	DNSAutoUnwatched bool `json:"dns_auto_unwatched,omitempty" bson:"dns_auto_unwatched,omitempty"`
+
+	// Set while the subdomain is archived, archived subdomains are hidden from listings and scans
+	// but keep their name known so that enumeration doesn't report them as new again
+	ArchivedAt bson.DateTime `json:"archived_at,omitempty" bson:"archived_at,omitempty"`
+	// Set while a scope change leaves the subdomain out of the scope of its domain, such subdomains aren't scanned
+	OutOfScopeAt bson.DateTime `json:"out_of_scope_at,omitempty" bson:"out_of_scope_at,omitempty"`
+
+	Annotations `bson:",inline"`
 }
 
 type HTTP struct {
@@ -67,6 +220,10 @@ type HTTP struct {
 	Port            string         `json:"port,omitempty" bson:"port"`
 	ResponseHeaders map[string]any `json:"response_headers,omitempty" bson:"response_headers"`
 	ContentLength   int            `json:"content_length,omitempty" bson:"content_length"`
+
+	// A snapshot is only stored when the service changes, these track the unchanged scans since
+	LastSeen  bson.DateTime `json:"last_seen,omitempty" bson:"last_seen"`
+	SeenCount int           `json:"seen_count,omitempty" bson:"seen_count"`
 }
 
 type DNS struct {
@@ -80,4 +237,92 @@ type DNS struct {
 	PTRRecords     []string      `json:"ptr_records,omitempty" bson:"ptr_records"`
 	MXRecords      []string      `json:"mx_records,omitempty" bson:"mx_records"`
 	TXTRecords     []string      `json:"txt_records,omitempty" bson:"txt_records"`
+
+	// A snapshot is only stored when the record set changes, these track the unchanged resolutions since
+	LastSeen  bson.DateTime `json:"last_seen,omitempty" bson:"last_seen"`
+	SeenCount int           `json:"seen_count,omitempty" bson:"seen_count"`
+}
+
+type EventType string
+
+const (
+	// a subdomain was added to the database
+	SubdomainDiscovered EventType = "subdomain_discovered"
+	// a subdomain resolved to an ip address
+	SubdomainResolved EventType = "subdomain_resolved"
+	// a subdomain no longer resolves to any ip address
+	SubdomainUnresolved EventType = "subdomain_unresolved"
+	// dns watching of a subdomain was turned off after too many failed resolutions
+	SubdomainUnwatched EventType = "subdomain_unwatched"
+	// the watch flags of a subdomain were changed through the api
+	WatchFlagsChanged EventType = "watch_flags_changed"
+	// a domain or subdomain was archived, or restored from the archive
+	DomainArchived    EventType = "domain_archived"
+	DomainRestored    EventType = "domain_restored"
+	SubdomainArchived EventType = "subdomain_archived"
+	SubdomainRestored EventType = "subdomain_restored"
+	// a scope change left a subdomain out of the scope of its domain, or brought it back in
+	SubdomainLeftScope    EventType = "subdomain_left_scope"
+	SubdomainEnteredScope EventType = "subdomain_entered_scope"
+	// a provider reported an already known subdomain for the first time
+	ProviderAdded EventType = "provider_added"
+	// the dns status of a subdomain changed without a change in resolution (e.g. aging)
+	DNSStatusChanged EventType = "dns_status_changed"
+	// the dns records of a subdomain changed
+	DNSRecordsChanged EventType = "dns_records_changed"
+	// the http status of a subdomain changed
+	HTTPStatusChanged EventType = "http_status_changed"
+	// the http service behind a subdomain changed (status code, title, technologies, ...)
+	HTTPServiceChanged EventType = "http_service_changed"
+)
+
+// Event is an entry of the asset timeline, recording a single meaningful change
+type Event struct {
+	ID        bson.ObjectID `json:"id,omitzero" bson:"_id,omitempty"`
+	Type      EventType     `json:"type" bson:"type"`
+	Domain    string        `json:"domain" bson:"domain"`
+	Subdomain string        `json:"subdomain,omitempty" bson:"subdomain,omitempty"`
+	Before    any           `json:"before,omitempty" bson:"before,omitempty"`
+	After     any           `json:"after,omitempty" bson:"after,omitempty"`
+	Reason    string        `json:"reason,omitempty" bson:"reason,omitempty"`
+	// job type (subfinder, dnsx, ...) or "api" for changes made through the api
+	Source    string        `json:"source" bson:"source"`
+	JobID     bson.ObjectID `json:"job_id,omitzero" bson:"job_id,omitempty"`
+	Timestamp bson.DateTime `json:"timestamp" bson:"timestamp"`
+}
+
+type JobType string
+
+type JobStatus string
+
+const (
+	JobStatusPending JobStatus = "pending"
+	JobStatusSuccess JobStatus = "success"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// Job is a single run of a scheduled job
+type Job struct {
+	ID        bson.ObjectID `json:"id,omitzero" bson:"_id,omitempty"`
+	Type      JobType       `json:"type" bson:"type"`
+	Target    string        `json:"target,omitempty" bson:"target,omitempty"`
+	StartTime time.Time     `json:"start_time" bson:"start_time"`
+	EndTime   time.Time     `json:"end_time,omitzero" bson:"end_time,omitempty"`
+	Status    JobStatus     `json:"status" bson:"status"`
+	Error     string        `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// StatsRollup is a daily snapshot of the statistics of a domain, or of every domain if Domain is empty
+type StatsRollup struct {
+	// midnight (UTC) of the day
+	Date   bson.DateTime `json:"date" bson:"date"`
+	Domain string        `json:"domain,omitempty" bson:"domain"`
+	// active subdomains at the time of the rollup
+	Subdomains int `json:"subdomains" bson:"subdomains"`
+	// subdomains discovered during the day
+	New          int            `json:"new" bson:"new"`
+	DNSStatus    map[string]int `json:"dns_status" bson:"dns_status"`
+	HTTPStatus   map[string]int `json:"http_status" bson:"http_status"`
+	Providers    map[string]int `json:"providers" bson:"providers"`
+	Technologies map[string]int `json:"technologies" bson:"technologies"`
 }
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Transition is a change of a dns or http status along with the reason it happened.
+// From and To are equal when the status stays the same.
+type Transition struct {
+	From   StatusType `json:"from"`
+	To     StatusType `json:"to"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+func (t Transition) Changed() bool {
+	return t.From != t.To
+}
+
+func stay(status StatusType) Transition {
+	return Transition{From: status, To: status}
+}
+
+// FreshnessWindows define how long a subdomain keeps a fresh (or changed) status before it ages
+type FreshnessWindows struct {
+	// FreshSubdomain ages into UnresolvedSubdomain, since resolving it would have made it FreshResolved
+	FreshSubdomain time.Duration
+	// FreshResolved ages into ResolvedSubdomain
+	FreshResolved time.Duration
+	// FreshService and ChangedService age into NormalService
+	FreshService time.Duration
+}
+
+// NextDNSStatus returns the transition of a dns status after the subdomain was resolved,
+// resolved tells whether it resolved to at least one ip address (A or AAAA record).
+//
+//	fresh_subdomain, unresolved_subdomain   -> resolved: fresh_resolved,  unresolved: unresolved_subdomain
+//	fresh_resolved, resolved_subdomain      -> resolved: unchanged,       unresolved: last_resolved
+//	last_resolved                           -> resolved: fresh_resolved,  unresolved: unchanged
+func NextDNSStatus(current StatusType, resolved bool) Transition {
+	switch current {
+	case FreshResolved, ResolvedSubdomain:
+		if !resolved {
+			return Transition{From: current, To: LastResolved, Reason: "no longer resolves to an ip address"}
+		}
+	case LastResolved:
+		if resolved {
+			return Transition{From: current, To: FreshResolved, Reason: "resolves to an ip address again"}
+		}
+	case UnresolvedSubdomain:
+		if resolved {
+			return Transition{From: current, To: FreshResolved, Reason: "resolved to an ip address for the first time"}
+		}
+	default:
+		// fresh_subdomain or a subdomain without a dns status yet
+		if resolved {
+			return Transition{From: current, To: FreshResolved, Reason: "resolved to an ip address for the first time"}
+		}
+		return Transition{From: current, To: UnresolvedSubdomain, Reason: "did not resolve to any ip address"}
+	}
+
+	return stay(current)
+}
+
+// NextHTTPStatus returns the transition of an http status after the subdomain was probed.
+// available tells whether an http service answered, previousStatusCode is the status code
+// of the last stored snapshot (0 if unknown) and statusCode the one just observed.
+//
+//	none, last_service                          -> available: fresh_service, unavailable: unchanged
+//	fresh_service, normal_service, changed_service -> same code: unchanged, other code: changed_service, unavailable: last_service
+func NextHTTPStatus(current StatusType, previousStatusCode int, statusCode int, available bool) Transition {
+	switch current {
+	case FreshService, NormalService, ChangedService:
+		if !available {
+			return Transition{From: current, To: LastService, Reason: "http service is no longer available"}
+		}
+		if previousStatusCode != 0 && previousStatusCode != statusCode {
+			return Transition{
+				From:   current,
+				To:     ChangedService,
+				Reason: fmt.Sprintf("status code changed from %d to %d", previousStatusCode, statusCode),
+			}
+		}
+	case LastService:
+		if available {
+			return Transition{From: current, To: FreshService, Reason: "http service is available again"}
+		}
+	default:
+		// no http service seen yet
+		if available {
+			return Transition{From: current, To: FreshService, Reason: "http service found"}
+		}
+	}
+
+	return stay(current)
+}
+
+// AgeStatus returns the transition of a fresh or changed status whose freshness window elapsed.
+// since is the time the subdomain got its current status. A zero window disables aging of that status.
+func AgeStatus(current StatusType, since, now time.Time, windows FreshnessWindows) Transition {
+	elapsed := func(window time.Duration) bool {
+		return window > 0 && !now.Before(since.Add(window))
+	}
+
+	switch current {
+	case FreshSubdomain:
+		if elapsed(windows.FreshSubdomain) {
+			return Transition{From: current, To: UnresolvedSubdomain, Reason: "not resolved within the freshness window"}
+		}
+	case FreshResolved:
+		if elapsed(windows.FreshResolved) {
+			return Transition{From: current, To: ResolvedSubdomain, Reason: "freshness window elapsed"}
+		}
+	case FreshService, ChangedService:
+		if elapsed(windows.FreshService) {
+			return Transition{From: current, To: NormalService, Reason: "freshness window elapsed"}
+		}
+	}
+
+	return stay(current)
+}
+
+// AgingStatuses are the statuses AgeStatus can move away from
+var AgingStatuses = []StatusType{FreshSubdomain, FreshResolved, FreshService, ChangedService}
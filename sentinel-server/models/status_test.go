@@ -0,0 +1,114 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDNSStatus(t *testing.T) {
+	tests := []struct {
+		current  StatusType
+		resolved bool
+		expected StatusType
+	}{
+		{"", true, FreshResolved},
+		{"", false, UnresolvedSubdomain},
+		{FreshSubdomain, true, FreshResolved},
+		{FreshSubdomain, false, UnresolvedSubdomain},
+		{UnresolvedSubdomain, true, FreshResolved},
+		{UnresolvedSubdomain, false, UnresolvedSubdomain},
+		{FreshResolved, true, FreshResolved},
+		{FreshResolved, false, LastResolved},
+		{ResolvedSubdomain, true, ResolvedSubdomain},
+		{ResolvedSubdomain, false, LastResolved},
+		{LastResolved, true, FreshResolved},
+		{LastResolved, false, LastResolved},
+	}
+
+	for _, test := range tests {
+		transition := NextDNSStatus(test.current, test.resolved)
+		if transition.From != test.current || transition.To != test.expected {
+			t.Errorf("NextDNSStatus(%q, %v) = %q, expected %q", test.current, test.resolved, transition.To, test.expected)
+		}
+		if transition.Changed() && transition.Reason == "" {
+			t.Errorf("NextDNSStatus(%q, %v) changed the status without a reason", test.current, test.resolved)
+		}
+	}
+}
+
+func TestNextHTTPStatus(t *testing.T) {
+	tests := []struct {
+		current            StatusType
+		previousStatusCode int
+		statusCode         int
+		available          bool
+		expected           StatusType
+	}{
+		{"", 0, 200, true, FreshService},
+		{"", 0, 0, false, ""},
+		{FreshService, 200, 200, true, FreshService},
+		{FreshService, 200, 403, true, ChangedService},
+		{FreshService, 0, 403, true, FreshService},
+		{FreshService, 200, 0, false, LastService},
+		{NormalService, 200, 200, true, NormalService},
+		{NormalService, 200, 302, true, ChangedService},
+		{NormalService, 200, 0, false, LastService},
+		{ChangedService, 302, 302, true, ChangedService},
+		{ChangedService, 302, 200, true, ChangedService},
+		{ChangedService, 302, 0, false, LastService},
+		{LastService, 200, 200, true, FreshService},
+		{LastService, 200, 0, false, LastService},
+	}
+
+	for _, test := range tests {
+		transition := NextHTTPStatus(test.current, test.previousStatusCode, test.statusCode, test.available)
+		if transition.From != test.current || transition.To != test.expected {
+			t.Errorf("NextHTTPStatus(%q, %d, %d, %v) = %q, expected %q",
+				test.current, test.previousStatusCode, test.statusCode, test.available, transition.To, test.expected)
+		}
+		if transition.Changed() && transition.Reason == "" {
+			t.Errorf("NextHTTPStatus(%q, %d, %d, %v) changed the status without a reason",
+				test.current, test.previousStatusCode, test.statusCode, test.available)
+		}
+	}
+}
+
+func TestAgeStatus(t *testing.T) {
+	now := time.Now()
+	windows := FreshnessWindows{
+		FreshSubdomain: 24 * time.Hour,
+		FreshResolved:  72 * time.Hour,
+		FreshService:   72 * time.Hour,
+	}
+
+	tests := []struct {
+		current  StatusType
+		age      time.Duration
+		expected StatusType
+	}{
+		{FreshSubdomain, 23 * time.Hour, FreshSubdomain},
+		{FreshSubdomain, 24 * time.Hour, UnresolvedSubdomain},
+		{FreshResolved, 71 * time.Hour, FreshResolved},
+		{FreshResolved, 72 * time.Hour, ResolvedSubdomain},
+		{FreshService, 71 * time.Hour, FreshService},
+		{FreshService, 73 * time.Hour, NormalService},
+		{ChangedService, 73 * time.Hour, NormalService},
+		{ResolvedSubdomain, 1000 * time.Hour, ResolvedSubdomain},
+		{UnresolvedSubdomain, 1000 * time.Hour, UnresolvedSubdomain},
+		{LastResolved, 1000 * time.Hour, LastResolved},
+		{NormalService, 1000 * time.Hour, NormalService},
+		{LastService, 1000 * time.Hour, LastService},
+	}
+
+	for _, test := range tests {
+		transition := AgeStatus(test.current, now.Add(-test.age), now, windows)
+		if transition.To != test.expected {
+			t.Errorf("AgeStatus(%q, %v) = %q, expected %q", test.current, test.age, transition.To, test.expected)
+		}
+	}
+
+	// a zero window disables aging
+	if transition := AgeStatus(FreshResolved, now.Add(-1000*time.Hour), now, FreshnessWindows{}); transition.Changed() {
+		t.Errorf("expected a zero window to disable aging, got %q", transition.To)
+	}
+}
@@ -0,0 +1,395 @@
+// Package openapi describes the api as an OpenAPI 3 document. The operations are listed next to
+// the router in operations.go and the schemas are derived from the go types of their bodies, so the
+// document can't drift from what the handlers encode.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scheduler"
+)
+
+// Version is the version of the api the document describes
+const Version = "1.0.0"
+
+// Param is a query param or a multipart form field of an operation
+type Param struct {
+	Name string
+	// string, integer, boolean or file (form fields only)
+	Type        string
+	Description string
+	// values the param can take, if it can't take anything else
+	Enum []string
+	// a file field that can be given more than once
+	Multiple bool
+}
+
+// Operation is a route of the api
+type Operation struct {
+	Method string
+	// Path in the syntax of the router, :name marks a path param
+	Path    string
+	ID      string
+	Tag     string
+	Summary string
+	Query   []Param
+	// Body is a value of the type of the json request body, nil if the operation takes none
+	Body any
+	// Form are the fields of a multipart request body
+	Form []Param
+	// Responses are values of the types of the successful response bodies by status
+	Responses map[int]any
+}
+
+// OneOf is a response body that is one of several types
+type OneOf []any
+
+// Stream is a response body that isn't json, in one of the content types
+type Stream []string
+
+// PathParams returns the names of the path params of the operation
+func (o Operation) PathParams() []string {
+	var params []string
+	for _, segment := range strings.Split(o.Path, "/") {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			params = append(params, name)
+		}
+	}
+	return params
+}
+
+// OpenAPIPath returns the path of the operation in the syntax of OpenAPI, {name} marks a path param
+func (o Operation) OpenAPIPath() string {
+	segments := strings.Split(o.Path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+var (
+	specOnce sync.Once
+	spec     map[string]any
+	specJSON []byte
+)
+
+// Document returns the OpenAPI document of the api
+func Document() map[string]any {
+	build()
+	return spec
+}
+
+// JSON returns the OpenAPI document of the api encoded as json
+func JSON() []byte {
+	build()
+	return specJSON
+}
+
+func build() {
+	specOnce.Do(func() {
+		var err error
+		spec = newDocument(Operations)
+		if specJSON, err = json.Marshal(spec); err != nil {
+			panic(fmt.Sprintf("failed to encode the openapi document: %v", err))
+		}
+	})
+}
+
+func newDocument(operations []Operation) map[string]any {
+	schemas := newSchemas()
+	errorSchema := schemas.of(reflect.TypeFor[api.Error]())
+
+	paths := map[string]any{}
+	for _, operation := range operations {
+		item, _ := paths[operation.OpenAPIPath()].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[operation.OpenAPIPath()] = item
+		}
+
+		parameters := []any{}
+		for _, name := range operation.PathParams() {
+			parameters = append(parameters, map[string]any{
+				"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, param := range operation.Query {
+			parameter := map[string]any{"name": param.Name, "in": "query", "schema": paramSchema(param)}
+			if param.Description != "" {
+				parameter["description"] = param.Description
+			}
+			parameters = append(parameters, parameter)
+		}
+
+		responses := map[string]any{
+			"default": map[string]any{
+				"description": "error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+			},
+		}
+		for status, body := range operation.Responses {
+			responses[fmt.Sprint(status)] = schemas.response(body)
+		}
+
+		op := map[string]any{
+			"operationId": operation.ID,
+			"tags":        []string{operation.Tag},
+			"summary":     operation.Summary,
+			"parameters":  parameters,
+			"responses":   responses,
+		}
+		if operation.Body != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{"application/json": map[string]any{
+					"schema": schemas.of(reflect.TypeOf(operation.Body)),
+				}},
+			}
+		}
+		if operation.Form != nil {
+			properties := map[string]any{}
+			for _, field := range operation.Form {
+				properties[field.Name] = paramSchema(field)
+			}
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{"multipart/form-data": map[string]any{
+					"schema": map[string]any{"type": "object", "properties": properties},
+				}},
+			}
+		}
+		item[strings.ToLower(operation.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "sentinel",
+			"description": "Subdomain monitoring for bug bounty programs",
+			"version":     Version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []any{map[string]any{"apiKey": []string{}}},
+	}
+}
+
+func paramSchema(param Param) map[string]any {
+	switch param.Type {
+	case "file":
+		file := map[string]any{"type": "string", "format": "binary"}
+		if param.Multiple {
+			return map[string]any{"type": "array", "items": file}
+		}
+		return file
+	case "":
+		param.Type = "string"
+	}
+	schema := map[string]any{"type": param.Type}
+	if param.Enum != nil {
+		schema["enum"] = param.Enum
+	}
+	return schema
+}
+
+// enums are the values of the string types that only take a known set of them
+var enums = map[reflect.Type][]string{
+	reflect.TypeFor[api.ErrorCode](): {
+		string(api.CodeInvalidRequest), string(api.CodeUnauthorized), string(api.CodeNotFound),
+		string(api.CodeMethodNotAllowed), string(api.CodeConflict), string(api.CodePayloadTooLarge),
+		string(api.CodeInternal), string(api.CodeNotImplemented),
+	},
+	reflect.TypeFor[models.StatusType](): {
+		string(models.FreshSubdomain), string(models.FreshResolved), string(models.LastResolved),
+		string(models.ResolvedSubdomain), string(models.UnresolvedSubdomain), string(models.FreshService),
+		string(models.NormalService), string(models.ChangedService), string(models.LastService),
+	},
+	reflect.TypeFor[models.TriageState](): {
+		string(models.TriageNew), string(models.TriageReviewed), string(models.TriageInteresting),
+		string(models.TriageIgnored), string(models.TriageReported),
+	},
+	reflect.TypeFor[models.RetentionMode](): {
+		string(models.RetentionDelete), string(models.RetentionDailyRollup), string(models.RetentionKeepChanges),
+	},
+	reflect.TypeFor[models.JobStatus](): {
+		string(models.JobStatusPending), string(models.JobStatusSuccess), string(models.JobStatusFailed),
+	},
+	reflect.TypeFor[scheduler.ImportStatus](): {
+		string(scheduler.ImportAccepted), string(scheduler.ImportDuplicate), string(scheduler.ImportInvalid),
+		string(scheduler.ImportOutOfScope),
+	},
+}
+
+// schemas derives json schemas from go types, named structs become components referenced by name
+type schemas struct {
+	components map[string]any
+	types      map[string]reflect.Type
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]any{}, types: map[string]reflect.Type{}}
+}
+
+// response returns the response object of a response body
+func (s *schemas) response(body any) map[string]any {
+	var schema map[string]any
+	switch body := body.(type) {
+	case Stream:
+		if len(body) == 0 {
+			// no body, e.g. switching protocols
+			return map[string]any{"description": "success"}
+		}
+		content := map[string]any{}
+		for _, contentType := range body {
+			content[contentType] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+		}
+		return map[string]any{"description": "success", "content": content}
+	case OneOf:
+		options := []any{}
+		for _, option := range body {
+			options = append(options, s.of(reflect.TypeOf(option)))
+		}
+		schema = map[string]any{"oneOf": options}
+	case nil:
+		// a json document of any shape
+		schema = map[string]any{"type": "object"}
+	default:
+		schema = s.of(reflect.TypeOf(body))
+	}
+	return map[string]any{
+		"description": "success",
+		"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+	}
+}
+
+// of returns the schema of a type
+func (s *schemas) of(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[bson.DateTime](), reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[bson.ObjectID]():
+		return map[string]any{"type": "string", "pattern": "^[0-9a-f]{24}$"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		schema := map[string]any{"type": "string"}
+		if values, ok := enums[t]; ok {
+			schema["enum"] = values
+		}
+		return schema
+	case reflect.Pointer:
+		return nullable(s.of(t.Elem()))
+	case reflect.Slice, reflect.Array:
+		return nullable(map[string]any{"type": "array", "items": s.of(t.Elem())})
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())})
+	case reflect.Interface:
+		// any json value
+		return map[string]any{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		s.component(t)
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	panic(fmt.Sprintf("openapi: no schema for %s", t))
+}
+
+// component adds the schema of a named struct to the components, once
+func (s *schemas) component(t reflect.Type) {
+	if known, ok := s.types[t.Name()]; ok {
+		if known != t {
+			panic(fmt.Sprintf("openapi: %s and %s share the schema name %s", known, t, t.Name()))
+		}
+		return
+	}
+	s.types[t.Name()] = t
+	s.components[t.Name()] = s.object(t)
+}
+
+// object returns the schema of a struct, the fields of embedded structs are its own
+func (s *schemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	s.fields(t, properties, &required)
+
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		slices.Sort(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *schemas) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			s.fields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.of(field.Type)
+		optional := slices.Contains(strings.Split(options, ","), "omitempty") ||
+			slices.Contains(strings.Split(options, ","), "omitzero")
+		if optional {
+			// omitted fields are left out rather than null
+			schema = notNullable(schema)
+		} else {
+			*required = append(*required, name)
+		}
+		properties[name] = schema
+	}
+}
+
+// nullable marks a schema as allowing null, references have to be wrapped for that in OpenAPI 3.0
+func nullable(schema map[string]any) map[string]any {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]any{"nullable": true, "allOf": []any{schema}}
+	}
+	schema["nullable"] = true
+	return schema
+}
+
+func notNullable(schema map[string]any) map[string]any {
+	if allOf, ok := schema["allOf"].([]any); ok && schema["nullable"] == true && len(allOf) == 1 {
+		return allOf[0].(map[string]any)
+	}
+	delete(schema, "nullable")
+	return schema
+}
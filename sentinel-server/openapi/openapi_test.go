@@ -0,0 +1,93 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	ids := map[string]bool{}
+	for _, operation := range Operations {
+		if ids[operation.ID] {
+			t.Errorf("operation id %s is used twice", operation.ID)
+		}
+		ids[operation.ID] = true
+		if len(operation.Responses) == 0 {
+			t.Errorf("%s has no successful response", operation.ID)
+		}
+	}
+
+	document := map[string]any{}
+	if err := json.Unmarshal(JSON(), &document); err != nil {
+		t.Fatalf("the document is not valid json: %v", err)
+	}
+	schemas := document["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, name := range []string{"Subdomain", "Domain", "Event", "Result", "ImportReport"} {
+		if schemas[name] == nil {
+			t.Errorf("the document has no %s schema", name)
+		}
+	}
+
+	// embedded structs are flattened, annotations are fields of the subdomain
+	subdomain := schemas["Subdomain"].(map[string]any)["properties"].(map[string]any)
+	if subdomain["tags"] == nil || subdomain["Annotations"] != nil {
+		t.Errorf("subdomain properties = %v", subdomain)
+	}
+}
+
+func TestFind(t *testing.T) {
+	cases := map[string]string{
+		"GET /api/v1/domains/":                                 "listDomains",
+		"GET /api/v1/domains":                                  "listDomains",
+		"GET /api/v1/domains/example.com/subdomains?limit=1":   "listSubdomains",
+		"GET /api/v1/domains/example.com/www.example.com":      "getSubdomain",
+		"PATCH /api/v1/domains/example.com/subdomains":         "bulkUpdateSubdomains",
+		"PUT /api/v1/domains/example.com/tags":                 "setDomainTags",
+		"PUT /api/v1/domains/example.com/www.example.com/tags": "setSubdomainTags",
+	}
+	for request, id := range cases {
+		method, path, _ := strings.Cut(request, " ")
+		operation, ok := Find(method, path)
+		if !ok || operation.ID != id {
+			t.Errorf("%s found %s, want %s", request, operation.ID, id)
+		}
+	}
+	if _, ok := Find("GET", "/api/v1/nothing"); ok {
+		t.Error("found an operation for an unknown path")
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	cases := []struct {
+		path   string
+		status int
+		body   string
+		valid  bool
+	}{
+		{"/api/v1/domains/example.com/www.example.com/http", 200, `{"snapshots":[{"status_code":200,"scanning_date":"2024-01-01T00:00:00Z"}],"diffs":[]}`, true},
+		{"/api/v1/domains/example.com/www.example.com/http", 200, `{"snapshots":[],"diffs":null}`, true},
+		// a required field is missing
+		{"/api/v1/domains/example.com/www.example.com/http", 200, `{"snapshots":[]}`, false},
+		// a field is of the wrong type
+		{"/api/v1/domains/example.com/www.example.com/http", 200, `{"snapshots":[{"status_code":"200"}],"diffs":[]}`, false},
+		// a field isn't documented
+		{"/api/v1/domains/example.com/www.example.com/http", 200, `{"snapshots":[],"diffs":[],"extra":1}`, false},
+		// dates are RFC3339
+		{"/api/v1/domains/example.com/www.example.com/http", 200, `{"snapshots":[{"scanning_date":"yesterday"}],"diffs":[]}`, false},
+		// errors have their own schema
+		{"/api/v1/domains/example.com/www.example.com/http", 404, `{"error":{"code":"not_found","message":"no http records found"}}`, true},
+		{"/api/v1/domains/example.com/www.example.com/http", 404, `{"error":"no http records found"}`, false},
+		// statuses the operation doesn't have
+		{"/api/v1/domains/example.com/www.example.com/http", 201, `{}`, false},
+		// enums
+		{"/api/v1/jobs/000000000000000000000000", 200, `{"type":"import","start_time":"2024-01-01T00:00:00Z","status":"pending"}`, true},
+		{"/api/v1/jobs/000000000000000000000000", 200, `{"type":"import","start_time":"2024-01-01T00:00:00Z","status":"running"}`, false},
+	}
+	for _, c := range cases {
+		err := ValidateResponse("GET", c.path, c.status, []byte(c.body))
+		if (err == nil) != c.valid {
+			t.Errorf("validating %d %s = %v, want valid %v", c.status, c.body, err, c.valid)
+		}
+	}
+}
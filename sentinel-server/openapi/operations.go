@@ -0,0 +1,250 @@
+package openapi
+
+import (
+	"github.com/0xgwyn/sentinel/api"
+	"github.com/0xgwyn/sentinel/export"
+	"github.com/0xgwyn/sentinel/importer"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// the params shared by several operations
+var (
+	archivedParam = Param{Name: "archived", Enum: []string{"exclude", "include", "only"},
+		Description: "whether archived assets are left out (the default), included or the only ones"}
+	tagParam           = Param{Name: "tag", Description: "only assets with the tag"}
+	triageParam        = Param{Name: "triage", Description: "only assets in the triage state"}
+	purgeParam         = Param{Name: "purge", Type: "boolean", Description: "delete for real instead of archiving"}
+	limitParam         = Param{Name: "limit", Type: "integer", Description: "maximum number of items, 1 to 1000"}
+	cursorParam        = Param{Name: "cursor", Description: "next_cursor of the previous page"}
+	domainParam        = Param{Name: "domain", Description: "only the given domain"}
+	dryRunParam        = Param{Name: "dry_run", Type: "boolean", Description: "only report what would change"}
+	deleteDomainsParam = Param{Name: "delete_domains", Type: "boolean",
+		Description: "delete the domains whose program no longer exists along with their records instead of only counting them"}
+	exportFormats = Param{Name: "format", Enum: values(export.Formats), Description: "format of the export, csv by default"}
+)
+
+// subdomainFilterParams filter the subdomains of listings, bulk updates and exports
+var subdomainFilterParams = []Param{
+	archivedParam,
+	tagParam,
+	triageParam,
+	{Name: "dns_status", Description: "comma separated dns statuses"},
+	{Name: "http_status", Description: "comma separated http statuses"},
+	{Name: "provider", Description: "only subdomains reported by the provider"},
+	{Name: "name", Description: "name pattern, * matches anything"},
+	{Name: "watch_dns", Type: "boolean"},
+	{Name: "watch_http", Type: "boolean"},
+	{Name: "in_scope", Type: "boolean", Description: "only subdomains in, or left out of, the scope of their domain"},
+	{Name: "created_since", Description: "RFC3339 time"},
+	{Name: "created_until", Description: "RFC3339 time"},
+	{Name: "updated_since", Description: "RFC3339 time"},
+	{Name: "updated_until", Description: "RFC3339 time"},
+}
+
+var exportContent = Stream{"text/csv", "application/x-ndjson", "text/markdown", "text/plain"}
+
+// Operations are every route the router serves
+var Operations = concat(
+	[]Operation{
+		{Method: "GET", Path: "/api/v1/domains/", ID: "listDomains", Tag: "domains", Summary: "List the names of the domains",
+			Query: []Param{archivedParam, tagParam, triageParam}, Responses: map[int]any{200: api.DomainList{}}},
+		{Method: "POST", Path: "/api/v1/domains/", ID: "createDomain", Tag: "domains", Summary: "Create a domain",
+			Body: models.Domain{}, Responses: map[int]any{201: models.Domain{}}},
+		{Method: "GET", Path: "/api/v1/domains/:domainName", ID: "getDomain", Tag: "domains",
+			Summary:   "Get a domain with its seeds and the names of its subdomains",
+			Query:     []Param{{Name: "seed", Description: "only subdomains found from the seed"}, archivedParam, tagParam, triageParam},
+			Responses: map[int]any{200: api.DomainResponse{}}},
+		{Method: "PATCH", Path: "/api/v1/domains/:domainName", ID: "updateDomain", Tag: "domains",
+			Summary: "Change the scope or retention policy of a domain", Body: models.Domain{},
+			Responses: map[int]any{200: models.Domain{}}},
+		{Method: "DELETE", Path: "/api/v1/domains/:domainName", ID: "deleteDomain", Tag: "domains",
+			Summary:   "Archive a domain with its subdomains, or purge it with everything recorded about it",
+			Query:     []Param{purgeParam},
+			Responses: map[int]any{200: OneOf{api.ArchivedDomain{}, api.Message{}}, 202: api.Message{}}},
+		{Method: "POST", Path: "/api/v1/domains/:domainName/restore", ID: "restoreDomain", Tag: "domains",
+			Summary: "Restore an archived domain with the subdomains archived with it", Responses: map[int]any{200: models.Domain{}}},
+		{Method: "PUT", Path: "/api/v1/domains/:domainName/scope", ID: "setDomainScope", Tag: "domains",
+			Summary: "Replace the scope rules of a domain, reporting which subdomains move into or out of scope",
+			Query:   []Param{dryRunParam}, Body: api.ScopeRules{}, Responses: map[int]any{200: api.ScopeReport{}}},
+
+		{Method: "GET", Path: "/api/v1/domains/:domainName/subdomains", ID: "listSubdomains", Tag: "subdomains",
+			Summary: "List a page of the subdomains of a domain",
+			Query: append([]Param{
+				limitParam,
+				{Name: "sort", Enum: values(storage.SubdomainSorts)},
+				{Name: "order", Enum: []string{"asc", "desc"}},
+				cursorParam,
+				{Name: "fields", Description: "comma separated json fields to project the subdomains to"},
+			}, subdomainFilterParams...),
+			Responses: map[int]any{200: api.SubdomainListing{}}},
+		{Method: "PATCH", Path: "/api/v1/domains/:domainName/subdomains", ID: "bulkUpdateSubdomains", Tag: "subdomains",
+			Summary: "Update every subdomain of a domain matching the filter", Query: subdomainFilterParams,
+			Body: api.SubdomainUpdate{}, Responses: map[int]any{200: api.BulkUpdate{}}},
+		{Method: "GET", Path: "/api/v1/domains/:domainName/export", ID: "exportDomain", Tag: "subdomains",
+			Summary: "Export the subdomains of a domain with their latest dns and http records",
+			Query:   append([]Param{exportFormats}, subdomainFilterParams...), Responses: map[int]any{200: exportContent}},
+		{Method: "POST", Path: "/api/v1/domains/:domainName", ID: "addSubdomains", Tag: "subdomains",
+			Summary: "Add subdomains to a domain by name, reporting what happened to every name", Body: []string{},
+			Responses: map[int]any{200: api.AddedSubdomains{}}},
+		{Method: "POST", Path: "/api/v1/domains/:domainName/import", ID: "importSubdomains", Tag: "subdomains",
+			Summary: "Import subdomains from lists, csv files and tool output",
+			Form: []Param{
+				{Name: "file", Type: "file", Multiple: true},
+				{Name: "format", Enum: values(importer.Formats), Description: "format of every file, guessed per file if not given"},
+				{Name: "provider", Description: "provider of names whose file doesn't tell, import by default"},
+			},
+			Responses: map[int]any{200: api.ImportReport{}}},
+		{Method: "GET", Path: "/api/v1/domains/:domainName/:subdomainName", ID: "getSubdomain", Tag: "subdomains",
+			Summary: "Get a subdomain with its latest dns and http records", Responses: map[int]any{200: api.SubdomainResponse{}}},
+		{Method: "PATCH", Path: "/api/v1/domains/:domainName/:subdomainName", ID: "updateSubdomain", Tag: "subdomains",
+			Summary: "Change the watch flags, tags and triage state of a subdomain", Body: api.SubdomainUpdate{},
+			Responses: map[int]any{200: models.Subdomain{}}},
+		{Method: "DELETE", Path: "/api/v1/domains/:domainName/:subdomainName", ID: "deleteSubdomain", Tag: "subdomains",
+			Summary: "Archive a subdomain, or purge it with everything recorded about it", Query: []Param{purgeParam},
+			Responses: map[int]any{200: OneOf{api.ArchivedSubdomain{}, api.Message{}}, 202: api.Message{}}},
+		{Method: "POST", Path: "/api/v1/domains/:domainName/:subdomainName/restore", ID: "restoreSubdomain", Tag: "subdomains",
+			Summary: "Restore an archived subdomain", Responses: map[int]any{200: models.Subdomain{}}},
+		{Method: "GET", Path: "/api/v1/domains/:domainName/:subdomainName/http", ID: "getHTTPHistory", Tag: "subdomains",
+			Summary:   "Get the http snapshots of a subdomain and the changes between them",
+			Query:     []Param{{Name: "limit", Type: "integer", Description: "maximum number of snapshots, 1 to 500"}},
+			Responses: map[int]any{200: api.HTTPHistoryResponse{}}},
+		{Method: "GET", Path: "/api/v1/domains/:domainName/:subdomainName/dns", ID: "getDNSHistory", Tag: "subdomains",
+			Summary:   "Get the dns snapshots of a subdomain",
+			Query:     []Param{{Name: "limit", Type: "integer", Description: "maximum number of snapshots, 1 to 500"}},
+			Responses: map[int]any{200: api.DNSHistoryResponse{}}},
+	},
+	annotationOperations("/api/v1/domains/:domainName", "Domain", "domain"),
+	annotationOperations("/api/v1/domains/:domainName/:subdomainName", "Subdomain", "subdomain"),
+	[]Operation{
+		{Method: "GET", Path: "/api/v1/retention/", ID: "getRetentionPolicy", Tag: "retention",
+			Summary: "Get the global retention policy", Responses: map[int]any{200: api.RetentionPolicyResponse{}}},
+		{Method: "GET", Path: "/api/v1/retention/report", ID: "getRetentionReport", Tag: "retention",
+			Summary: "Report what the retention policies would delete", Query: []Param{domainParam},
+			Responses: map[int]any{200: api.RetentionReport{}}},
+		{Method: "POST", Path: "/api/v1/retention/run", ID: "runRetention", Tag: "retention",
+			Summary: "Enforce the retention policies right away", Query: []Param{domainParam},
+			Responses: map[int]any{200: api.RetentionReport{}}},
+		{Method: "DELETE", Path: "/api/v1/retention/:domainName", ID: "purgeDomainData", Tag: "retention",
+			Summary: "Delete every dns and http snapshot of a domain", Query: []Param{{Name: "dry_run", Type: "boolean"}},
+			Responses: map[int]any{200: api.RetentionReport{}}},
+
+		{Method: "GET", Path: "/api/v1/integrity/report", ID: "getOrphanReport", Tag: "integrity",
+			Summary: "Count the records whose program, domain or subdomain no longer exists", Query: []Param{deleteDomainsParam},
+			Responses: map[int]any{200: api.OrphanReport{}}},
+		{Method: "POST", Path: "/api/v1/integrity/run", ID: "runIntegrity", Tag: "integrity",
+			Summary: "Delete the orphaned records right away", Query: []Param{deleteDomainsParam},
+			Responses: map[int]any{200: api.OrphanReport{}}},
+
+		{Method: "GET", Path: "/api/v1/jobs", ID: "listJobs", Tag: "jobs", Summary: "List the latest runs of the jobs",
+			Query: []Param{
+				{Name: "type", Description: "only jobs of the given type"},
+				{Name: "limit", Type: "integer", Description: "maximum number of jobs, 1 to 1000"},
+			},
+			Responses: map[int]any{200: api.JobList{}}},
+		{Method: "GET", Path: "/api/v1/jobs/:jobID", ID: "getJob", Tag: "jobs", Summary: "Get a job",
+			Responses: map[int]any{200: models.Job{}}},
+
+		{Method: "GET", Path: "/api/v1/search", ID: "search", Tag: "search",
+			Summary: "Search subdomains by themselves and their latest dns and http records",
+			Query: []Param{
+				{Name: "q", Description: "space separated field:value terms, like tech:nginx -status:404"},
+				domainParam, archivedParam, limitParam, cursorParam,
+			},
+			Responses: map[int]any{200: api.SearchResults{}}},
+
+		{Method: "GET", Path: "/api/v1/stats", ID: "getStats", Tag: "stats",
+			Summary: "Get the statistics of every domain, or of one, with their daily rollups",
+			Query: []Param{
+				domainParam,
+				{Name: "days", Type: "integer", Description: "length of the period, 30 days by default"},
+			},
+			Responses: map[int]any{200: api.Stats{}}},
+
+		{Method: "GET", Path: "/api/v1/events", ID: "getEvents", Tag: "events", Summary: "Get the asset timeline, newest first",
+			Query: []Param{
+				limitParam, domainParam,
+				{Name: "subdomain", Description: "only the given subdomain"},
+				{Name: "type", Description: "comma separated event types"},
+				{Name: "since", Description: "RFC3339 time"},
+				{Name: "until", Description: "RFC3339 time"},
+				{Name: "before", Description: "id of the last event of the previous page"},
+			},
+			Responses: map[int]any{200: api.EventList{}}},
+		{Method: "GET", Path: "/api/v1/stream", ID: "stream", Tag: "events",
+			Summary: "Stream the events recorded from now on as server-sent events, or as json messages over a websocket",
+			Query: []Param{
+				domainParam,
+				{Name: "program", Description: "only the domains of the given program"},
+				{Name: "type", Description: "comma separated event types"},
+				{Name: "last_event_id", Description: "resume after this event, like the Last-Event-ID header"},
+				{Name: "api_key", Description: "the api key, for clients that can't set the X-API-Key header"},
+			},
+			Responses: map[int]any{200: Stream{"text/event-stream"}, 101: Stream{}}},
+
+		{Method: "GET", Path: "/api/v1/programs/", ID: "listPrograms", Tag: "programs", Summary: "List the names of the programs",
+			Responses: map[int]any{200: api.ProgramList{}}},
+		{Method: "POST", Path: "/api/v1/programs/", ID: "createProgram", Tag: "programs", Summary: "Create a program",
+			Body: api.ProgramRequest{}, Responses: map[int]any{201: models.Program{}}},
+		{Method: "GET", Path: "/api/v1/programs/:programName", ID: "getProgram", Tag: "programs",
+			Summary: "Get a program with the names of its domains", Responses: map[int]any{200: api.ProgramResponse{}}},
+		{Method: "PATCH", Path: "/api/v1/programs/:programName", ID: "updateProgram", Tag: "programs", Summary: "Update a program",
+			Body: models.Program{}, Responses: map[int]any{200: models.Program{}}},
+		{Method: "PUT", Path: "/api/v1/programs/:programName/scope", ID: "setProgramScope", Tag: "programs",
+			Summary: "Replace the scope rules of a program, reporting which subdomains of its domains move into or out of scope",
+			Query:   []Param{dryRunParam}, Body: api.ScopeRules{}, Responses: map[int]any{200: api.ScopeReport{}}},
+		{Method: "DELETE", Path: "/api/v1/programs/:programName", ID: "deleteProgram", Tag: "programs",
+			Summary:   "Delete a program with its domains and everything recorded about them",
+			Responses: map[int]any{200: api.DeletedProgram{}}},
+		{Method: "GET", Path: "/api/v1/programs/:programName/stats", ID: "getProgramStats", Tag: "programs",
+			Summary:   "Count the domains of a program and their subdomains by status",
+			Responses: map[int]any{200: api.ProgramStatsResponse{}}},
+		{Method: "GET", Path: "/api/v1/programs/:programName/export", ID: "exportProgram", Tag: "programs",
+			Summary: "Export the subdomains of every domain of a program",
+			Query:   append([]Param{exportFormats}, subdomainFilterParams...), Responses: map[int]any{200: exportContent}},
+		{Method: "PUT", Path: "/api/v1/programs/:programName/domains/:domainName", ID: "addProgramDomain", Tag: "programs",
+			Summary: "Move a domain into the program", Responses: map[int]any{200: api.ProgramDomains{}}},
+		{Method: "DELETE", Path: "/api/v1/programs/:programName/domains/:domainName", ID: "removeProgramDomain", Tag: "programs",
+			Summary: "Take a domain out of the program", Responses: map[int]any{200: api.ProgramDomains{}}},
+
+		{Method: "GET", Path: "/api/v1/openapi.json", ID: "getOpenAPI", Tag: "meta", Summary: "Get this document",
+			Responses: map[int]any{200: nil}},
+	},
+)
+
+// annotationOperations are the tag, note and triage routes of domains or subdomains
+func annotationOperations(path, name, tag string) []Operation {
+	annotations := map[int]any{200: models.Annotations{}}
+	return []Operation{
+		{Method: "PUT", Path: path + "/tags", ID: "set" + name + "Tags", Tag: tag, Summary: "Replace the tags of a " + tag,
+			Body: api.TagsRequest{}, Responses: annotations},
+		{Method: "POST", Path: path + "/tags", ID: "add" + name + "Tags", Tag: tag, Summary: "Add tags to a " + tag,
+			Body: api.TagsRequest{}, Responses: annotations},
+		{Method: "DELETE", Path: path + "/tags/:tag", ID: "remove" + name + "Tag", Tag: tag, Summary: "Remove a tag from a " + tag,
+			Responses: annotations},
+		{Method: "POST", Path: path + "/notes", ID: "add" + name + "Note", Tag: tag, Summary: "Add a note to a " + tag,
+			Body: api.NoteRequest{}, Responses: annotations},
+		{Method: "PATCH", Path: path + "/notes/:noteID", ID: "update" + name + "Note", Tag: tag, Summary: "Change the text of a note",
+			Body: api.NoteRequest{}, Responses: annotations},
+		{Method: "DELETE", Path: path + "/notes/:noteID", ID: "delete" + name + "Note", Tag: tag, Summary: "Delete a note",
+			Responses: annotations},
+		{Method: "PUT", Path: path + "/triage", ID: "set" + name + "Triage", Tag: tag, Summary: "Change the triage state of a " + tag,
+			Body: api.TriageRequest{}, Responses: annotations},
+	}
+}
+
+func concat(groups ...[]Operation) []Operation {
+	var operations []Operation
+	for _, group := range groups {
+		operations = append(operations, group...)
+	}
+	return operations
+}
+
+func values[T ~string](typed []T) []string {
+	strs := make([]string, 0, len(typed))
+	for _, value := range typed {
+		strs = append(strs, string(value))
+	}
+	return strs
+}
@@ -0,0 +1,187 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Find returns the operation serving a request, routes with more fixed segments win the way
+// they are registered first in the router
+func Find(method, path string) (Operation, bool) {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+
+	found, fixed := Operation{}, -1
+	for _, operation := range Operations {
+		if operation.Method != method {
+			continue
+		}
+		patterns := strings.Split(operation.Path, "/")
+		// the router ignores trailing slashes
+		if len(patterns) != len(segments) && strings.TrimSuffix(operation.Path, "/") != strings.TrimSuffix(path, "/") {
+			continue
+		}
+
+		matched, matchedFixed := true, 0
+		for i := range min(len(patterns), len(segments)) {
+			if strings.HasPrefix(patterns[i], ":") {
+				matched = matched && segments[i] != ""
+				continue
+			}
+			if patterns[i] != segments[i] {
+				matched = false
+				break
+			}
+			matchedFixed++
+		}
+		if matched && matchedFixed > fixed {
+			found, fixed = operation, matchedFixed
+		}
+	}
+	return found, fixed >= 0
+}
+
+// ValidateResponse checks a json response body against the schema the document gives for the
+// operation serving the request and the status of the response
+func ValidateResponse(method, path string, status int, body []byte) error {
+	operation, ok := Find(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+
+	document := Document()
+	item := document["paths"].(map[string]any)[operation.OpenAPIPath()].(map[string]any)
+	responses := item[strings.ToLower(method)].(map[string]any)["responses"].(map[string]any)
+
+	response, ok := responses[fmt.Sprint(status)].(map[string]any)
+	if !ok {
+		if status < 400 {
+			return fmt.Errorf("%s %s: status %d is not documented", method, operation.Path, status)
+		}
+		response = responses["default"].(map[string]any)
+	}
+	content, _ := response["content"].(map[string]any)
+	media, ok := content["application/json"].(map[string]any)
+	if !ok {
+		// not a json response, or no body at all
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s %s: invalid json: %v", method, operation.Path, err)
+	}
+	v := validator{schemas: document["components"].(map[string]any)["schemas"].(map[string]any)}
+	if err := v.validate(media["schema"].(map[string]any), value, "$"); err != nil {
+		return fmt.Errorf("%s %s (%d): %v", method, operation.Path, status, err)
+	}
+	return nil
+}
+
+// validator checks json values against the subset of json schema the document uses
+type validator struct {
+	schemas map[string]any
+}
+
+func (v validator) validate(schema map[string]any, value any, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		return v.validate(v.schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any), value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return nil
+		}
+		return fmt.Errorf("%s is null", at)
+	}
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, option := range allOf {
+			if err := v.validate(option.(map[string]any), value, at); err != nil {
+				return err
+			}
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		var errs []string
+		for _, option := range oneOf {
+			err := v.validate(option.(map[string]any), value, at)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s matches none of its schemas: %s", at, strings.Join(errs, "; "))
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is not an object", at)
+		}
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s misses %s", at, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, field := range object {
+			if property, ok := properties[name]; ok {
+				if err := v.validate(property.(map[string]any), field, at+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s has the undocumented field %s", at, name)
+				}
+			case map[string]any:
+				if err := v.validate(additional, field, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s is not an array", at)
+		}
+		for i, item := range array {
+			if err := v.validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string", at)
+		}
+		if enum, ok := schema["enum"].([]string); ok && !slices.Contains(enum, text) {
+			return fmt.Errorf("%s is %q, not one of %v", at, text, enum)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				return fmt.Errorf("%s is not a date-time: %q", at, text)
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s is not an integer", at)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s is not a number", at)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", at)
+		}
+	}
+	return nil
+}
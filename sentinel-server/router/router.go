@@ -7,7 +7,18 @@ import (
 )
 
 func AddRouterGroup(app *fiber.App) {
-	routerGroup := app.Group("/api/domains")
+	addRoutes(app.Group("/api/v1"))
+
+	// the unversioned api is kept for the clients written before /api/v1, handler.ErrorHandler
+	// gives it the flat error bodies it always had
+	addRoutes(app.Group("/api"))
+}
+
+func addRoutes(apiGroup fiber.Router) {
+	// the openapi document, router changes have to be listed in openapi.Operations as well
+	apiGroup.Get("/openapi.json", handler.GetOpenAPI)
+
+	routerGroup := apiGroup.Group("/domains")
 
 	// domain routes
 	routerGroup.Get("/", handler.GetDomains)
@@ -15,9 +26,78 @@ func AddRouterGroup(app *fiber.App) {
 	routerGroup.Get("/:domainName", handler.GetDomain)
 	routerGroup.Post("/", handler.CreateDomain)
 	routerGroup.Patch("/:domainName", handler.UpdateDomain)
+	routerGroup.Post("/:domainName/restore", handler.RestoreDomain)
+	routerGroup.Put("/:domainName/scope", handler.SetDomainScope)
 
-	// subdomain routes
+	// subdomain routes, the listing, bulk update and export go first so that they aren't taken for a subdomain
+	routerGroup.Get("/:domainName/subdomains", handler.GetSubdomains)
+	routerGroup.Patch("/:domainName/subdomains", handler.BulkUpdateSubdomains)
+	routerGroup.Get("/:domainName/export", handler.ExportDomain)
 	routerGroup.Get("/:domainName/:subdomainName", handler.GetSubdomain)
 	routerGroup.Post("/:domainName", handler.AddSubdomains)
+	routerGroup.Post("/:domainName/import", handler.ImportSubdomains)
+	routerGroup.Patch("/:domainName/:subdomainName", handler.UpdateSubdomain)
 	routerGroup.Delete("/:domainName/:subdomainName", handler.DeleteSubdomain)
+	routerGroup.Post("/:domainName/:subdomainName/restore", handler.RestoreSubdomain)
+
+	// history routes
+	routerGroup.Get("/:domainName/:subdomainName/http", handler.GetHTTPHistory)
+	routerGroup.Get("/:domainName/:subdomainName/dns", handler.GetDNSHistory)
+
+	// domain annotation routes
+	routerGroup.Put("/:domainName/tags", handler.SetTags)
+	routerGroup.Post("/:domainName/tags", handler.AddTags)
+	routerGroup.Delete("/:domainName/tags/:tag", handler.RemoveTag)
+	routerGroup.Post("/:domainName/notes", handler.AddNote)
+	routerGroup.Patch("/:domainName/notes/:noteID", handler.UpdateNote)
+	routerGroup.Delete("/:domainName/notes/:noteID", handler.DeleteNote)
+	routerGroup.Put("/:domainName/triage", handler.SetTriage)
+
+	// subdomain annotation routes
+	routerGroup.Put("/:domainName/:subdomainName/tags", handler.SetTags)
+	routerGroup.Post("/:domainName/:subdomainName/tags", handler.AddTags)
+	routerGroup.Delete("/:domainName/:subdomainName/tags/:tag", handler.RemoveTag)
+	routerGroup.Post("/:domainName/:subdomainName/notes", handler.AddNote)
+	routerGroup.Patch("/:domainName/:subdomainName/notes/:noteID", handler.UpdateNote)
+	routerGroup.Delete("/:domainName/:subdomainName/notes/:noteID", handler.DeleteNote)
+	routerGroup.Put("/:domainName/:subdomainName/triage", handler.SetTriage)
+
+	// retention routes
+	retentionGroup := apiGroup.Group("/retention")
+	retentionGroup.Get("/", handler.GetRetentionPolicy)
+	retentionGroup.Get("/report", handler.GetRetentionReport)
+	retentionGroup.Post("/run", handler.RunRetention)
+	retentionGroup.Delete("/:domainName", handler.PurgeDomainData)
+
+	// integrity routes
+	integrityGroup := apiGroup.Group("/integrity")
+	integrityGroup.Get("/report", handler.GetOrphanReport)
+	integrityGroup.Post("/run", handler.RunIntegrity)
+
+	// job routes
+	apiGroup.Get("/jobs", handler.GetJobs)
+	apiGroup.Get("/jobs/:jobID", handler.GetJob)
+
+	// stats routes
+	apiGroup.Get("/stats", handler.GetStats)
+
+	// search routes
+	apiGroup.Get("/search", handler.Search)
+
+	// event routes
+	apiGroup.Get("/events", handler.GetEvents)
+	apiGroup.Get("/stream", handler.Stream)
+
+	// program routes
+	programGroup := apiGroup.Group("/programs")
+	programGroup.Get("/", handler.GetPrograms)
+	programGroup.Post("/", handler.CreateProgram)
+	programGroup.Get("/:programName", handler.GetProgram)
+	programGroup.Patch("/:programName", handler.UpdateProgram)
+	programGroup.Put("/:programName/scope", handler.SetProgramScope)
+	programGroup.Delete("/:programName", handler.DeleteProgram)
+	programGroup.Get("/:programName/stats", handler.GetProgramStats)
+	programGroup.Get("/:programName/export", handler.ExportProgram)
+	programGroup.Put("/:programName/domains/:domainName", handler.AddProgramDomain)
+	programGroup.Delete("/:programName/domains/:domainName", handler.RemoveProgramDomain)
 }
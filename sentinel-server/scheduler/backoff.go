@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// dnsBackoff returns how long to wait before resolving a subdomain again after misses failed resolutions in a row.
+// The wait doubles with every miss starting from the base interval and is capped at the max interval.
+func dnsBackoff(misses int, config Config) time.Duration {
+	base := time.Duration(config.DNSBackoffBase) * time.Hour
+	limit := time.Duration(config.DNSBackoffMax) * time.Hour
+	if misses <= 0 || base <= 0 {
+		return 0
+	}
+
+	backoff := base
+	for i := 1; i < misses && backoff < limit; i++ {
+		backoff *= 2
+	}
+	return min(backoff, limit)
+}
+
+// dnsScheduleChanged reports whether a resolution changes the adaptive dns schedule of a subdomain,
+// a subdomain that always resolved has nothing to reset
+func dnsScheduleChanged(sub models.Subdomain, resolved bool) bool {
+	return !resolved || sub.DNSMisses != 0 || sub.NextDNSCheck != 0
+}
+
+// applyDNSSchedule updates the adaptive dns schedule of a subdomain after it was resolved
+// and reports whether dns watching was turned off because the subdomain missed too many times
+func applyDNSSchedule(sub *models.Subdomain, resolved bool, config Config, now time.Time) bool {
+	// A successful resolution resets the schedule, the subdomain is checked every run again
+	if resolved {
+		sub.DNSMisses = 0
+		sub.DNSCheckInterval = 0
+		sub.NextDNSCheck = 0
+		return false
+	}
+
+	sub.DNSMisses++
+
+	// Stop watching subdomains that missed too many times
+	if config.DNSMaxMisses > 0 && sub.DNSMisses >= config.DNSMaxMisses {
+		sub.WatchDNS = false
+		sub.DNSAutoUnwatched = true
+		sub.DNSCheckInterval = 0
+		sub.NextDNSCheck = 0
+		return true
+	}
+
+	if backoff := dnsBackoff(sub.DNSMisses, config); backoff > 0 {
+		sub.DNSCheckInterval = int(backoff / time.Hour)
+		sub.NextDNSCheck = bson.NewDateTimeFromTime(now.Add(backoff))
+	}
+
+	return false
+}
+
+func unwatchReason(misses int) string {
+	return fmt.Sprintf("did not resolve %d times in a row", misses)
+}
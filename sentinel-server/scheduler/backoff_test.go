@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestDNSBackoff(t *testing.T) {
+	config := Config{DNSBackoffBase: 6, DNSBackoffMax: 48}
+
+	expected := map[int]time.Duration{
+		0: 0,
+		1: 6 * time.Hour,
+		2: 12 * time.Hour,
+		3: 24 * time.Hour,
+		4: 48 * time.Hour,
+		5: 48 * time.Hour,
+	}
+	for misses, backoff := range expected {
+		if got := dnsBackoff(misses, config); got != backoff {
+			t.Errorf("dnsBackoff(%d) = %v, expected %v", misses, got, backoff)
+		}
+	}
+}
+
+func TestApplyDNSSchedule(t *testing.T) {
+	config := Config{DNSBackoffBase: 6, DNSBackoffMax: 48, DNSMaxMisses: 3}
+	now := time.Now()
+
+	// a miss pushes the next check away
+	sub := models.Subdomain{DNSMisses: 1, WatchDNS: true}
+	unwatched := applyDNSSchedule(&sub, false, config, now)
+	if unwatched || sub.DNSMisses != 2 || sub.DNSCheckInterval != 12 || sub.NextDNSCheck.Time().Sub(now) < 11*time.Hour {
+		t.Fatalf("unexpected schedule after a miss: %+v", sub)
+	}
+
+	// too many misses turn watching off
+	sub = models.Subdomain{DNSMisses: 2, WatchDNS: true}
+	if unwatched = applyDNSSchedule(&sub, false, config, now); !unwatched || sub.WatchDNS || !sub.DNSAutoUnwatched {
+		t.Fatalf("expected dns watching to be turned off: %+v", sub)
+	}
+
+	// a resolution resets the schedule
+	sub = models.Subdomain{DNSMisses: 2, DNSCheckInterval: 12, NextDNSCheck: bson.NewDateTimeFromTime(now)}
+	if !dnsScheduleChanged(sub, true) {
+		t.Fatalf("expected the schedule to change")
+	}
+	if applyDNSSchedule(&sub, true, config, now); sub.DNSMisses != 0 || sub.DNSCheckInterval != 0 || sub.NextDNSCheck != 0 {
+		t.Fatalf("expected the schedule to be reset: %+v", sub)
+	}
+
+	// nothing to reset for a subdomain that always resolved
+	if dnsScheduleChanged(models.Subdomain{}, true) {
+		t.Fatalf("expected no schedule change")
+	}
+}
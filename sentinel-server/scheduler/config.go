@@ -1,15 +1,56 @@
 package scheduler
 
+import (
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
 type Config struct {
-    SubfinderInterval int // hours
-    HttpxInterval     int // hours
-    DnsxInterval      int // hours
+	SubfinderInterval   int // hours
+	HttpxInterval       int // hours
+	DnsxInterval        int // hours
+	RetentionInterval   int // hours
+	StatusAgingInterval int // hours
+	IntegrityInterval   int // hours
+	RollupInterval      int // hours
+
+	// Freshness windows of the statuses, 0 disables aging of that status
+	FreshSubdomainWindow int // hours
+	FreshResolvedWindow  int // hours
+	FreshServiceWindow   int // hours
+
+	// Adaptive dns scheduling of subdomains that fail to resolve
+	DNSBackoffBase int // hours, wait after the first miss, doubled with every miss
+	DNSBackoffMax  int // hours, cap of the wait
+	DNSMaxMisses   int // misses in a row before dns watching is turned off, 0 never turns it off
 }
 
 func NewDefaultConfig() Config {
-    return Config{
-        SubfinderInterval: 24, // run every 24 hours
-        HttpxInterval:     12, // run every 12 hours
-        DnsxInterval:      6,  // run every 6 hours
-    }
-}
\ No newline at end of file
+	return Config{
+		SubfinderInterval:   24, // run every 24 hours
+		HttpxInterval:       12, // run every 12 hours
+		DnsxInterval:        6,  // run every 6 hours
+		RetentionInterval:   24, // run every 24 hours
+		StatusAgingInterval: 1,  // run every hour
+		IntegrityInterval:   24, // run every 24 hours
+		RollupInterval:      24, // run every 24 hours
+
+		FreshSubdomainWindow: 24, // a day to resolve before being considered unresolved
+		FreshResolvedWindow:  72, // fresh for three days after resolving
+		FreshServiceWindow:   72, // fresh or changed for three days
+
+		DNSBackoffBase: 6,   // wait 6 hours after the first miss
+		DNSBackoffMax:  168, // never wait more than a week
+		DNSMaxMisses:   30,  // give up after 30 misses in a row
+	}
+}
+
+// FreshnessWindows converts the freshness windows of the config to durations
+func (c Config) FreshnessWindows() models.FreshnessWindows {
+	return models.FreshnessWindows{
+		FreshSubdomain: time.Duration(c.FreshSubdomainWindow) * time.Hour,
+		FreshResolved:  time.Duration(c.FreshResolvedWindow) * time.Hour,
+		FreshService:   time.Duration(c.FreshServiceWindow) * time.Hour,
+	}
+}
@@ -2,64 +2,48 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"time"
 
-	"github.com/0xgwyn/sentinel/database"
 	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
-)
-
-type JobType string
 
-const (
-	SubfinderJob JobType = "subfinder"
-	HttpxJob     JobType = "httpx"
-	DnsxJob      JobType = "dnsx"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
 )
 
-type JobStatus string
+type JobType = models.JobType
 
 const (
-	JobStatusPending JobStatus = "pending"
-	JobStatusSuccess JobStatus = "success"
-	JobStatusFailed  JobStatus = "failed"
+	SubfinderJob   JobType = "subfinder"
+	HttpxJob       JobType = "httpx"
+	DnsxJob        JobType = "dnsx"
+	RetentionJob   JobType = "retention"
+	StatusAgingJob JobType = "status_aging"
+	IntegrityJob   JobType = "integrity"
+	RollupJob      JobType = "stats_rollup"
+	// DeletionJob isn't scheduled, deletions run as one when the storage can't run transactions
+	DeletionJob JobType = "deletion"
+	// ImportJob isn't scheduled, every bulk import is recorded as one
+	ImportJob JobType = "import"
 )
 
-type Job struct {
-	Type      JobType   `bson:"type"`
-	StartTime time.Time `bson:"start_time"`
-	EndTime   time.Time `bson:"end_time,omitempty"`
-	Status    JobStatus `bson:"status"`
-	Error     string    `bson:"error,omitempty"`
-}
+// errInterrupted finishes the jobs that were still running when the server stopped
+var errInterrupted = errors.New("interrupted by a restart")
 
 type Coordinator struct {
-	collection *mongo.Collection
+	jobs storage.Jobs
 }
 
 func NewCoordinator() *Coordinator {
 	return &Coordinator{
-		collection: database.GetDBCollection("jobs"),
+		jobs: storage.GetStore().Jobs,
 	}
 }
 
 func (c *Coordinator) CanRun(jobType JobType) bool {
-	ctx := context.Background()
-
 	// Look for the most recent job of this type
-	result := c.collection.FindOne(
-		ctx,
-		bson.M{"type": jobType},
-		options.FindOne().SetSort(bson.M{"start_time": -1}),
-	)
-
-	if result.Err() == mongo.ErrNoDocuments {
-		return true
-	}
-
-	var lastJob Job
-	if err := result.Decode(&lastJob); err != nil {
+	lastJob, err := c.jobs.Latest(context.Background(), jobType)
+	if err != nil {
 		return true
 	}
 
@@ -68,35 +52,37 @@ func (c *Coordinator) CanRun(jobType JobType) bool {
 }
 
 func (c *Coordinator) StartJob(jobType JobType) error {
-	job := Job{
+	job := models.Job{
 		Type:      jobType,
 		StartTime: time.Now(),
-		Status:    JobStatusPending,
+		Status:    models.JobStatusPending,
 	}
 
-	_, err := c.collection.InsertOne(context.Background(), job)
+	_, err := c.jobs.Start(context.Background(), job)
 	return err
 }
 
 func (c *Coordinator) EndJob(jobType JobType, err error) error {
-	status := JobStatusSuccess
-	job := Job{
+	job := models.Job{
+		Type:    jobType,
 		EndTime: time.Now(),
-		Status:  status,
+		Status:  models.JobStatusSuccess,
 	}
 
 	if err != nil {
-		job.Status = JobStatusFailed
+		job.Status = models.JobStatusFailed
 		job.Error = err.Error()
 	}
 
-	_, updateErr := c.collection.UpdateOne(
-		context.Background(),
-		bson.M{
-			"type":     jobType,
-			"end_time": bson.M{"$exists": false},
-		},
-		bson.M{"$set": job},
-	)
-	return updateErr
+	return c.jobs.Finish(context.Background(), job)
+}
+
+// runningJobID returns the id of the unfinished job of the given type, if there is one
+func runningJobID(jobType JobType) bson.ObjectID {
+	job, err := storage.GetStore().Jobs.Running(context.Background(), jobType)
+	if err != nil {
+		return bson.ObjectID{}
+	}
+
+	return job.ID
 }
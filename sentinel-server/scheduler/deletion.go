@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// DeleteDomain deletes a domain along with its subdomains, HTTP, DNS, event and rollup records in one transaction.
+// When the storage can't run transactions the domain is deleted right away and its records by a deletion
+// job in the background, which is returned. Whatever a failed deletion job leaves behind is removed by the
+// integrity job.
+func DeleteDomain(ctx context.Context, domainName string) (*models.Job, error) {
+	store := storage.GetStore()
+
+	err := store.Cascades.DeleteDomain(ctx, domainName)
+	if err != storage.ErrNoTransactions {
+		return nil, err
+	}
+
+	// the domain goes first so that it disappears at once
+	if err := store.Domains.Delete(ctx, domainName); err != nil {
+		return nil, err
+	}
+
+	return startDeletion(ctx, domainName, func(ctx context.Context) error {
+		if err := store.Subdomains.DeleteAll(ctx, domainName); err != nil {
+			return err
+		}
+		if err := store.HTTP.Delete(ctx, domainName, ""); err != nil {
+			return err
+		}
+		if err := store.DNS.Delete(ctx, domainName, ""); err != nil {
+			return err
+		}
+		if err := store.Rollups.DeleteAll(ctx, domainName); err != nil {
+			return err
+		}
+		return store.Events.DeleteAll(ctx, domainName)
+	})
+}
+
+// DeleteProgram deletes a program along with its domains and everything DeleteDomain deletes with them in one
+// transaction and returns the names of the domains. When the storage can't run transactions the domains are
+// deleted first, the way DeleteDomain does, so that a failure never leaves domains of a deleted program behind.
+func DeleteProgram(ctx context.Context, programName string) ([]string, error) {
+	store := storage.GetStore()
+
+	domains, err := store.Cascades.DeleteProgram(ctx, programName)
+	if err != storage.ErrNoTransactions {
+		return domains, err
+	}
+
+	if _, err := store.Programs.Get(ctx, programName); err != nil {
+		return nil, err
+	}
+	found, err := store.Domains.List(ctx, storage.DomainFilter{Program: programName, Archived: storage.IncludeArchived})
+	if err != nil {
+		return nil, err
+	}
+	domains = make([]string, 0, len(found))
+	for _, domain := range found {
+		domains = append(domains, domain.Name)
+		if _, err := DeleteDomain(ctx, domain.Name); err != nil && err != storage.ErrNotFound {
+			return domains, err
+		}
+	}
+
+	return domains, store.Programs.Delete(ctx, programName)
+}
+
+// DeleteSubdomain deletes a subdomain along with its HTTP and DNS records the way DeleteDomain does
+func DeleteSubdomain(ctx context.Context, domainName, subdomainName string) (*models.Job, error) {
+	store := storage.GetStore()
+
+	err := store.Cascades.DeleteSubdomain(ctx, domainName, subdomainName)
+	if err != storage.ErrNoTransactions {
+		return nil, err
+	}
+
+	// the subdomain goes first so that it disappears at once
+	if err := store.Subdomains.Delete(ctx, domainName, subdomainName); err != nil {
+		return nil, err
+	}
+
+	return startDeletion(ctx, subdomainName, func(ctx context.Context) error {
+		if err := store.HTTP.Delete(ctx, domainName, subdomainName); err != nil {
+			return err
+		}
+		return store.DNS.Delete(ctx, domainName, subdomainName)
+	})
+}
+
+// startDeletion records a deletion job for target and runs deleteRecords in the background
+func startDeletion(ctx context.Context, target string, deleteRecords func(ctx context.Context) error) (*models.Job, error) {
+	jobs := storage.GetStore().Jobs
+
+	job, err := jobs.Start(ctx, models.Job{
+		Type:      DeletionJob,
+		Target:    target,
+		StartTime: time.Now(),
+		Status:    models.JobStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ctx := context.Background()
+
+		err := deleteRecords(ctx)
+		finished := models.Job{
+			ID:      job.ID,
+			Type:    DeletionJob,
+			EndTime: time.Now(),
+			Status:  models.JobStatusSuccess,
+		}
+		if err != nil {
+			log.Printf("failed to delete the records of %s: %v", target, err)
+			finished.Status = models.JobStatusFailed
+			finished.Error = err.Error()
+		}
+
+		if err := jobs.Finish(ctx, finished); err != nil {
+			log.Printf("failed to finish the deletion job of %s: %v", target, err)
+		}
+	}()
+
+	return &job, nil
+}
+
+// integrityTask removes the subdomains, HTTP, DNS, event and rollup records whose domain or subdomain
+// no longer exists. Domains whose program no longer exists are only reported, deleting them is left to a user.
+func integrityTask() error {
+	log.Println("Running integrity task")
+
+	report, err := storage.GetStore().Cascades.DeleteOrphans(context.Background(), false, false)
+	if err != nil {
+		return err
+	}
+
+	if report.Subdomains+report.DNS+report.HTTP+report.Events+report.Rollups > 0 {
+		log.Printf("integrity deleted %d subdomains, %d dns, %d http, %d event and %d rollup orphans",
+			report.Subdomains, report.DNS, report.HTTP, report.Events, report.Rollups)
+	}
+	if report.Domains > 0 {
+		log.Printf("integrity found %d domains whose program no longer exists", report.Domains)
+	}
+
+	return nil
+}
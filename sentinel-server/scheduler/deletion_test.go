@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// withoutTransactions makes a store behave like a mongodb without replica set
+type withoutTransactions struct {
+	storage.Cascades
+}
+
+func (withoutTransactions) DeleteDomain(context.Context, string) error {
+	return storage.ErrNoTransactions
+}
+
+func (withoutTransactions) DeleteSubdomain(context.Context, string, string) error {
+	return storage.ErrNoTransactions
+}
+
+func TestDeleteDomainWithoutTransactions(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+	store.Cascades = withoutTransactions{store.Cascades}
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	store.Domains.Create(ctx, models.Domain{Name: "example.com"})
+	store.Subdomains.Create(ctx, models.Subdomain{Domain: "example.com", Name: "www.example.com"})
+	store.DNS.Insert(ctx, models.DNS{Domain: "example.com", Subdomain: "www.example.com"})
+
+	job, err := DeleteDomain(ctx, "example.com")
+	if err != nil || job == nil {
+		t.Fatalf("expected a deletion job: %v %+v", err, job)
+	}
+	if job.Type != DeletionJob || job.Target != "example.com" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if _, err := store.Domains.Get(ctx, "example.com"); err != storage.ErrNotFound {
+		t.Fatalf("expected the domain to be deleted right away, got %v", err)
+	}
+
+	// wait for the job to finish in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		finished, err := store.Jobs.Get(ctx, job.ID)
+		if err == nil && !finished.EndTime.IsZero() {
+			if finished.Status != models.JobStatusSuccess {
+				t.Fatalf("expected the job to succeed: %+v", finished)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deletion job didn't finish: %v %+v", err, finished)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := store.Subdomains.Get(ctx, "example.com", "www.example.com"); err != storage.ErrNotFound {
+		t.Fatalf("expected the subdomains to be deleted, got %v", err)
+	}
+	if _, err := store.DNS.Latest(ctx, "example.com", "www.example.com"); err != storage.ErrNotFound {
+		t.Fatalf("expected the dns records to be deleted, got %v", err)
+	}
+
+	if _, err := DeleteDomain(ctx, "example.com"); err != storage.ErrNotFound {
+		t.Fatalf("expected ErrNotFound deleting the domain again, got %v", err)
+	}
+}
@@ -0,0 +1,385 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/dchest/validator"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/importer"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scope"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+type ImportStatus string
+
+const (
+	// the subdomain was added
+	ImportAccepted ImportStatus = "accepted"
+	// the subdomain is already known, or was imported by an earlier line. Its new providers and records are kept.
+	ImportDuplicate ImportStatus = "duplicate"
+	// the line couldn't be read or doesn't hold a valid name
+	ImportInvalid ImportStatus = "invalid"
+	// the name isn't covered by the scope of the domain
+	ImportOutOfScope ImportStatus = "out_of_scope"
+)
+
+// ImportFile is an imported file with the entries read from it
+type ImportFile struct {
+	Name    string
+	Entries []importer.Entry
+}
+
+// ImportLine reports what happened to one line of an imported file
+type ImportLine struct {
+	File   string       `json:"file,omitempty"`
+	Line   int          `json:"line"`
+	Name   string       `json:"name,omitempty"`
+	Status ImportStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+type ImportReport struct {
+	Job        models.Job   `json:"job"`
+	Accepted   int          `json:"accepted"`
+	Duplicate  int          `json:"duplicate"`
+	Invalid    int          `json:"invalid"`
+	OutOfScope int          `json:"out_of_scope"`
+	Lines      []ImportLine `json:"lines"`
+}
+
+// imported is a subdomain of the import with everything its lines found about it
+type imported struct {
+	providers []string
+	dns       *models.DNS
+	http      *models.HTTP
+	// the line that reported the subdomain first
+	line int
+}
+
+// Import adds the subdomains of imported files to a domain as an import job. Names outside the scope of the
+// domain (and its program) are left out, records of the same name are merged so that a subfinder list and
+// httpx output of it can be imported together. DNS and HTTP records are stored as snapshots and move the
+// statuses of their subdomains the way a scan would.
+func Import(ctx context.Context, domain models.Domain, files []ImportFile) (ImportReport, error) {
+	store := storage.GetStore()
+	report := ImportReport{Lines: []ImportLine{}}
+	now := time.Now()
+
+	program, err := store.Program(ctx, domain.Program)
+	if err != nil {
+		return report, err
+	}
+	var scanSettings *models.ScanSettings
+	if program != nil {
+		scanSettings = program.ScanSettings
+	}
+	watchDNS, watchHTTP := scanSettings.WatchFlags()
+
+	inScope, outOfScope := scope.Effective(domain, program)
+
+	// Sort the lines out and merge the ones reporting the same name
+	found := map[string]*imported{}
+	var names []string
+	for _, file := range files {
+		for _, entry := range file.Entries {
+			line := ImportLine{File: file.Name, Line: entry.Line, Name: entry.Name}
+			switch {
+			case entry.Error != "":
+				line.Status, line.Reason = ImportInvalid, entry.Error
+			case !validator.IsValidDomain(entry.Name):
+				line.Status, line.Reason = ImportInvalid, "invalid subdomain"
+			case !scope.InScope(entry.Name, inScope, outOfScope):
+				line.Status = ImportOutOfScope
+			case found[entry.Name] != nil:
+				line.Status, line.Reason = ImportDuplicate, "already imported"
+				found[entry.Name].merge(entry)
+			default:
+				// accepted for now, the ones that exist already are turned into duplicates below
+				line.Status = ImportAccepted
+				found[entry.Name] = &imported{line: len(report.Lines)}
+				found[entry.Name].merge(entry)
+				names = append(names, entry.Name)
+			}
+			report.Lines = append(report.Lines, line)
+		}
+	}
+
+	job, err := store.Jobs.Start(ctx, models.Job{
+		Type:      ImportJob,
+		Target:    domain.Name,
+		StartTime: now,
+		Status:    models.JobStatusPending,
+	})
+	if err != nil {
+		return report, err
+	}
+	err = importSubdomains(ctx, domain.Name, job.ID, names, found, &report, watchDNS, watchHTTP, now)
+
+	// Finish the job with the outcome of the import
+	job.EndTime = time.Now()
+	job.Status = models.JobStatusSuccess
+	if err != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	}
+	if err := store.Jobs.Finish(ctx, job); err != nil {
+		log.Printf("failed to finish the import job of %s: %v", domain.Name, err)
+	}
+	report.Job = job
+
+	for _, line := range report.Lines {
+		switch line.Status {
+		case ImportAccepted:
+			report.Accepted++
+		case ImportDuplicate:
+			report.Duplicate++
+		case ImportInvalid:
+			report.Invalid++
+		case ImportOutOfScope:
+			report.OutOfScope++
+		}
+	}
+
+	return report, err
+}
+
+func importSubdomains(ctx context.Context, domainName string, jobID bson.ObjectID, names []string, found map[string]*imported,
+	report *ImportReport, watchDNS, watchHTTP bool, now time.Time) error {
+	store := storage.GetStore()
+
+	// Check which subdomains are known in one go, archived ones included
+	known, err := store.Subdomains.List(ctx, storage.SubdomainFilter{Domain: domainName, Archived: storage.IncludeArchived})
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]models.Subdomain, len(known))
+	for _, subdomain := range known {
+		existing[subdomain.Name] = subdomain
+	}
+
+	// Add the new subdomains and the new providers of the known ones
+	newSubdomains := []models.Subdomain{}
+	subdomains := make([]models.Subdomain, 0, len(names))
+	for _, name := range names {
+		entry := found[name]
+		subdomain, exists := existing[name]
+		if !exists {
+			subdomain = models.Subdomain{
+				Domain:    domainName,
+				Name:      name,
+				CreatedAt: bson.NewDateTimeFromTime(now),
+				UpdatedAt: bson.NewDateTimeFromTime(now),
+				Providers: entry.providers,
+				WatchHTTP: watchHTTP,
+				WatchDNS:  watchDNS,
+				DNSStatus: models.FreshSubdomain,
+			}
+			newSubdomains = append(newSubdomains, subdomain)
+			subdomains = append(subdomains, subdomain)
+			continue
+		}
+
+		line := &report.Lines[entry.line]
+		line.Status, line.Reason = ImportDuplicate, "already known"
+		if subdomain.ArchivedAt != 0 {
+			// Archived subdomains stay archived and quiet until they are restored
+			line.Reason = "archived"
+			continue
+		}
+
+		added := []string{}
+		for _, provider := range entry.providers {
+			if !slices.Contains(subdomain.Providers, provider) {
+				added = append(added, provider)
+			}
+		}
+		if len(added) > 0 {
+			subdomain, err = store.Subdomains.Update(ctx, domainName, name, func(sub *models.Subdomain) error {
+				sub.Providers = appendMissing(sub.Providers, added)
+				sub.UpdatedAt = bson.NewDateTimeFromTime(now)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			recordEvent(models.Event{
+				Type:      models.ProviderAdded,
+				Domain:    domainName,
+				Subdomain: name,
+				Before:    existing[name].Providers,
+				After:     subdomain.Providers,
+				Source:    string(ImportJob),
+				JobID:     jobID,
+				Timestamp: bson.NewDateTimeFromTime(now),
+			})
+		}
+		subdomains = append(subdomains, subdomain)
+	}
+
+	if err := store.Subdomains.Create(ctx, newSubdomains...); err != nil {
+		return err
+	}
+	for _, subdomain := range newSubdomains {
+		recordEvent(models.Event{
+			Type:      models.SubdomainDiscovered,
+			Domain:    domainName,
+			Subdomain: subdomain.Name,
+			After:     subdomain.Providers,
+			Source:    string(ImportJob),
+			JobID:     jobID,
+			Timestamp: bson.NewDateTimeFromTime(now),
+		})
+	}
+
+	// Store the records as snapshots the way the scans do
+	for _, subdomain := range subdomains {
+		entry := found[subdomain.Name]
+		if entry.dns != nil {
+			if err := importDNS(ctx, subdomain, *entry.dns, jobID, now); err != nil {
+				return err
+			}
+		}
+		if entry.http != nil && !entry.http.Failed {
+			if err := importHTTP(ctx, subdomain, *entry.http, jobID, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func importDNS(ctx context.Context, subdomain models.Subdomain, records models.DNS, jobID bson.ObjectID, now time.Time) error {
+	store := storage.GetStore()
+
+	record := models.DNS{
+		ResolutionDate: bson.NewDateTimeFromTime(now),
+		Domain:         subdomain.Domain,
+		Subdomain:      subdomain.Name,
+		CnameRecords:   records.CnameRecords,
+		ARecords:       records.ARecords,
+		AAAARecords:    records.AAAARecords,
+		NSRecords:      records.NSRecords,
+		PTRRecords:     records.PTRRecords,
+		MXRecords:      records.MXRecords,
+		TXTRecords:     records.TXTRecords,
+	}
+	if sameDNSRecords(record, models.DNS{}) {
+		return nil
+	}
+
+	var lastRecord *models.DNS
+	if last, err := store.DNS.Latest(ctx, subdomain.Domain, subdomain.Name); err == nil {
+		lastRecord = &last
+		record = mergeDNSRecords(last, record)
+	} else if err != storage.ErrNotFound {
+		return err
+	}
+	resolved := len(record.ARecords) > 0 || len(record.AAAARecords) > 0
+
+	transition := models.NextDNSStatus(subdomain.DNSStatus, resolved)
+	if err := applyDNSTransition(ctx, subdomain, transition, ImportJob, jobID, now); err != nil {
+		return err
+	}
+
+	inserted, err := saveDNSSnapshot(ctx, store.DNS, lastRecord, record, now)
+	if err != nil {
+		return err
+	}
+	if inserted && lastRecord != nil {
+		recordEvent(models.Event{
+			Type:      models.DNSRecordsChanged,
+			Domain:    subdomain.Domain,
+			Subdomain: subdomain.Name,
+			Before:    lastRecord,
+			After:     record,
+			Source:    string(ImportJob),
+			JobID:     jobID,
+			Timestamp: bson.NewDateTimeFromTime(now),
+		})
+	}
+
+	return nil
+}
+
+// mergeDNSRecords fills the record types an imported line didn't report with the ones of the last snapshot,
+// tools like dnsx only query some types and the missing ones aren't gone
+func mergeDNSRecords(last, imported models.DNS) models.DNS {
+	merged := imported
+	for _, records := range []struct {
+		merged *[]string
+		last   []string
+	}{
+		{&merged.CnameRecords, last.CnameRecords},
+		{&merged.ARecords, last.ARecords},
+		{&merged.AAAARecords, last.AAAARecords},
+		{&merged.NSRecords, last.NSRecords},
+		{&merged.PTRRecords, last.PTRRecords},
+		{&merged.MXRecords, last.MXRecords},
+		{&merged.TXTRecords, last.TXTRecords},
+	} {
+		if len(*records.merged) == 0 {
+			*records.merged = records.last
+		}
+	}
+	return merged
+}
+
+func importHTTP(ctx context.Context, subdomain models.Subdomain, record models.HTTP, jobID bson.ObjectID, now time.Time) error {
+	store := storage.GetStore()
+
+	record.ScanningDate = bson.NewDateTimeFromTime(now)
+	record.Domain = subdomain.Domain
+	record.Subdomain = subdomain.Name
+
+	var lastRecord *models.HTTP
+	last, err := store.HTTP.Latest(ctx, subdomain.Domain, subdomain.Name)
+	if err == nil {
+		lastRecord = &last
+	} else if err != storage.ErrNotFound {
+		return err
+	}
+
+	transition := models.NextHTTPStatus(subdomain.HTTPStatus, last.StatusCode, record.StatusCode, true)
+	if err := applyHTTPTransition(ctx, subdomain, transition, ImportJob, jobID, now); err != nil {
+		return err
+	}
+
+	inserted, err := saveHTTPSnapshot(ctx, store.HTTP, lastRecord, record, now)
+	if err != nil {
+		return err
+	}
+	if inserted && lastRecord != nil {
+		recordEvent(models.Event{
+			Type:      models.HTTPServiceChanged,
+			Domain:    subdomain.Domain,
+			Subdomain: subdomain.Name,
+			After:     models.DiffHTTP(*lastRecord, record),
+			Source:    string(ImportJob),
+			JobID:     jobID,
+			Timestamp: bson.NewDateTimeFromTime(now),
+		})
+	}
+
+	return nil
+}
+
+// merge adds the providers and records of another line reporting the subdomain, later records win
+func (i *imported) merge(entry importer.Entry) {
+	for _, provider := range entry.Providers {
+		if !slices.Contains(i.providers, provider) {
+			i.providers = append(i.providers, provider)
+		}
+	}
+	if entry.DNS != nil {
+		i.dns = entry.DNS
+	}
+	if entry.HTTP != nil {
+		i.http = entry.HTTP
+	}
+}
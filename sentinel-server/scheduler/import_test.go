@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestImportPartialDNS(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	now := time.Now()
+	subdomain := models.Subdomain{Domain: "example.com", Name: "www.example.com", DNSStatus: models.ResolvedSubdomain}
+	store.Domains.Create(ctx, models.Domain{Name: "example.com"})
+	store.Subdomains.Create(ctx, subdomain)
+	store.DNS.Insert(ctx, models.DNS{
+		Domain:         "example.com",
+		Subdomain:      "www.example.com",
+		ResolutionDate: bson.NewDateTimeFromTime(now.Add(-time.Hour)),
+		ARecords:       []string{"1.2.3.4"},
+		CnameRecords:   []string{"www.example.net"},
+		TXTRecords:     []string{"v=spf1 -all"},
+	})
+
+	// a line with only the a records it queried is no change
+	if err := importDNS(ctx, subdomain, models.DNS{ARecords: []string{"1.2.3.4"}}, bson.NilObjectID, now); err != nil {
+		t.Fatalf("importDNS failed: %v", err)
+	}
+	history, _ := store.DNS.History(ctx, "example.com", "www.example.com", 0)
+	if len(history) != 1 || history[0].SeenCount != 1 {
+		t.Fatalf("expected the snapshot to be seen again: %+v", history)
+	}
+
+	// a changed type replaces only that type
+	if err := importDNS(ctx, subdomain, models.DNS{CnameRecords: []string{"www.example.org"}}, bson.NilObjectID, now); err != nil {
+		t.Fatalf("importDNS failed: %v", err)
+	}
+	history, _ = store.DNS.History(ctx, "example.com", "www.example.com", 0)
+	if len(history) != 2 || !slices.Equal(history[0].CnameRecords, []string{"www.example.org"}) ||
+		!slices.Equal(history[0].ARecords, []string{"1.2.3.4"}) || !slices.Equal(history[0].TXTRecords, []string{"v=spf1 -all"}) {
+		t.Fatalf("expected the cname to change on top of the other records: %+v", history)
+	}
+}
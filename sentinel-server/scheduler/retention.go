@@ -0,0 +1,343 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/config"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+const (
+	defaultRetentionRawDays    = 90
+	defaultRetentionRollupDays = 275
+	defaultJobRetentionDays    = 30
+	defaultRetentionMode       = models.RetentionKeepChanges
+)
+
+// RetentionResult is the outcome of applying a policy to one collection of one domain
+type RetentionResult struct {
+	Collection string                 `json:"collection"`
+	Domain     string                 `json:"domain,omitempty"`
+	Policy     models.RetentionPolicy `json:"policy"`
+	Deleted    int64                  `json:"deleted"`
+}
+
+// RetentionReport lists what was deleted, or what would be deleted in a dry run
+type RetentionReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Results []RetentionResult `json:"results"`
+}
+
+// snapshotRepository is what retention needs of the dns and http repositories
+type snapshotRepository[T any] interface {
+	Latest(ctx context.Context, domain, subdomain string) (T, error)
+	Expired(ctx context.Context, domain string, before time.Time) ([]T, error)
+	Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error)
+	Count(ctx context.Context, domain string) (int64, error)
+	Delete(ctx context.Context, domain, subdomain string) error
+}
+
+// snapshotKind tells retention how to read and compare the snapshots of one repository
+type snapshotKind[T any] struct {
+	collection string
+	subdomain  func(T) string
+	date       func(T) bson.DateTime
+	lastSeen   func(T) bson.DateTime
+	same       func(a, b T) bool
+}
+
+var dnsSnapshots = snapshotKind[models.DNS]{
+	collection: "dns",
+	subdomain:  func(record models.DNS) string { return record.Subdomain },
+	date:       func(record models.DNS) bson.DateTime { return record.ResolutionDate },
+	lastSeen:   func(record models.DNS) bson.DateTime { return record.LastSeen },
+	same:       sameDNSRecords,
+}
+
+var httpSnapshots = snapshotKind[models.HTTP]{
+	collection: "http",
+	subdomain:  func(record models.HTTP) string { return record.Subdomain },
+	date:       func(record models.HTTP) bson.DateTime { return record.ScanningDate },
+	lastSeen:   func(record models.HTTP) bson.DateTime { return record.LastSeen },
+	same:       sameHTTPService,
+}
+
+// GlobalRetentionPolicy returns the retention policy of domains without their own policy.
+// It is configured with RETENTION_RAW_DAYS, RETENTION_ROLLUP_DAYS and RETENTION_MODE.
+func GlobalRetentionPolicy() models.RetentionPolicy {
+	policy := models.RetentionPolicy{
+		RawDays:    defaultRetentionRawDays,
+		RollupDays: defaultRetentionRollupDays,
+		Mode:       defaultRetentionMode,
+	}
+
+	if value, _ := config.LoadEnv("RETENTION_RAW_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+			policy.RawDays = days
+		}
+	}
+	if value, _ := config.LoadEnv("RETENTION_ROLLUP_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+			policy.RollupDays = days
+		}
+	}
+	if value, _ := config.LoadEnv("RETENTION_MODE"); value != "" && ValidRetentionMode(models.RetentionMode(value)) {
+		policy.Mode = models.RetentionMode(value)
+	}
+
+	return policy
+}
+
+// JobRetentionDays returns how many days finished jobs are kept, configured with RETENTION_JOB_DAYS.
+// A value of 0 keeps jobs forever.
+func JobRetentionDays() int {
+	if value, _ := config.LoadEnv("RETENTION_JOB_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+			return days
+		}
+	}
+	return defaultJobRetentionDays
+}
+
+func ValidRetentionMode(mode models.RetentionMode) bool {
+	return mode == models.RetentionDelete || mode == models.RetentionDailyRollup || mode == models.RetentionKeepChanges
+}
+
+// EffectivePolicy fills the unset fields of a domain policy with the global policy
+func EffectivePolicy(domain models.Domain, global models.RetentionPolicy) models.RetentionPolicy {
+	if domain.Retention == nil {
+		return global
+	}
+
+	policy := *domain.Retention
+	if policy.RawDays == 0 {
+		policy.RawDays = global.RawDays
+	}
+	if policy.RollupDays == 0 {
+		policy.RollupDays = global.RollupDays
+	}
+	if policy.Mode == "" {
+		policy.Mode = global.Mode
+	}
+	return policy
+}
+
+// ApplyRetention enforces the retention policies of every domain (or only domainName if set)
+// and the job retention. With dryRun nothing is deleted and the report holds what would be.
+func ApplyRetention(ctx context.Context, domainName string, dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun, Results: make([]RetentionResult, 0)}
+	store := storage.GetStore()
+	global := GlobalRetentionPolicy()
+	now := time.Now()
+
+	// Find the domains
+	var domains []models.Domain
+	if domainName != "" {
+		domain, err := store.Domains.Get(ctx, domainName)
+		if err != nil && err != storage.ErrNotFound {
+			return report, fmt.Errorf("failed to fetch domain %s: %v", domainName, err)
+		}
+		if err == nil {
+			domains = append(domains, domain)
+		}
+	} else {
+		var err error
+		domains, err = store.Domains.List(ctx, storage.DomainFilter{Archived: storage.IncludeArchived})
+		if err != nil {
+			return report, fmt.Errorf("failed to fetch domains: %v", err)
+		}
+	}
+
+	// Apply the policy of each domain to its snapshots
+	for _, domain := range domains {
+		policy := EffectivePolicy(domain, global)
+		if policy.RawDays == 0 {
+			continue
+		}
+
+		deleted, err := retainSnapshots(ctx, store.DNS, dnsSnapshots, domain.Name, policy, now, dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, RetentionResult{Collection: dnsSnapshots.collection, Domain: domain.Name, Policy: policy, Deleted: deleted})
+
+		deleted, err = retainSnapshots(ctx, store.HTTP, httpSnapshots, domain.Name, policy, now, dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, RetentionResult{Collection: httpSnapshots.collection, Domain: domain.Name, Policy: policy, Deleted: deleted})
+	}
+
+	// Jobs are not tied to a domain, so only the global job retention applies to them
+	if jobDays := JobRetentionDays(); domainName == "" && jobDays > 0 {
+		deleted, err := store.Jobs.DeleteFinished(ctx, now.AddDate(0, 0, -jobDays), dryRun)
+		if err != nil {
+			return report, fmt.Errorf("failed to apply job retention: %v", err)
+		}
+
+		report.Results = append(report.Results, RetentionResult{
+			Collection: "jobs",
+			Policy:     models.RetentionPolicy{RawDays: jobDays, Mode: models.RetentionDelete},
+			Deleted:    deleted,
+		})
+	}
+
+	return report, nil
+}
+
+// retainSnapshots applies a policy to the dns or http snapshots of a domain and returns how many it deleted,
+// or would delete in a dry run
+func retainSnapshots[T any](ctx context.Context, repository snapshotRepository[T], kind snapshotKind[T], domainName string, policy models.RetentionPolicy, now time.Time, dryRun bool) (int64, error) {
+	rawCutoff := now.AddDate(0, 0, -policy.RawDays)
+	rollupCutoff := bson.NewDateTimeFromTime(rawCutoff.AddDate(0, 0, -policy.RollupDays))
+
+	expired, err := repository.Expired(ctx, domainName, rawCutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired %s snapshots of %s: %v", kind.collection, domainName, err)
+	}
+
+	var deleted int64
+	for len(expired) > 0 {
+		// the snapshots are sorted by subdomain, take the ones of the next subdomain
+		subdomain := kind.subdomain(expired[0])
+		end := 1
+		for end < len(expired) && kind.subdomain(expired[end]) == subdomain {
+			end++
+		}
+		history := expired[:end]
+		expired = expired[end:]
+
+		// the latest snapshot is the current state of the subdomain, it is kept however old it is
+		latest, err := repository.Latest(ctx, domainName, subdomain)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to find the latest %s snapshot of %s: %v", kind.collection, subdomain, err)
+		}
+		if last := history[len(history)-1]; kind.date(last) == kind.date(latest) {
+			history = history[:len(history)-1]
+		}
+
+		dates := expiredSnapshots(history, kind, policy.Mode, rollupCutoff)
+		if len(dates) == 0 {
+			continue
+		}
+		if dryRun {
+			deleted += int64(len(dates))
+			continue
+		}
+		pruned, err := repository.Prune(ctx, domainName, subdomain, dates)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired %s snapshots of %s: %v", kind.collection, subdomain, err)
+		}
+		deleted += pruned
+	}
+
+	return deleted, nil
+}
+
+// expiredSnapshots returns the dates of the snapshots of one subdomain, sorted oldest first, that the policy drops.
+// The snapshots last seen after rollupCutoff are rolled up to the last snapshot of each day, older ones are
+// handled by the retention mode.
+func expiredSnapshots[T any](history []T, kind snapshotKind[T], mode models.RetentionMode, rollupCutoff bson.DateTime) []bson.DateTime {
+	dates := make([]bson.DateTime, 0)
+	var kept *T
+	for i, current := range history {
+		tierMode := mode
+		if max(kind.date(current), kind.lastSeen(current)) >= rollupCutoff {
+			tierMode = models.RetentionDailyRollup
+		}
+
+		switch tierMode {
+		case models.RetentionDelete:
+			dates = append(dates, kind.date(current))
+			continue
+
+		case models.RetentionDailyRollup:
+			// only the last snapshot of a day is kept
+			if i+1 < len(history) && snapshotDay(kind.date(history[i+1])) == snapshotDay(kind.date(current)) {
+				dates = append(dates, kind.date(current))
+				continue
+			}
+
+		case models.RetentionKeepChanges:
+			// the first snapshot and every snapshot that differs from the kept one are kept
+			if kept != nil && kind.same(*kept, current) {
+				dates = append(dates, kind.date(current))
+				continue
+			}
+		}
+		kept = &history[i]
+	}
+
+	return dates
+}
+
+func snapshotDay(date bson.DateTime) string {
+	return date.Time().UTC().Format(time.DateOnly)
+}
+
+// PurgeDomainData deletes every dns and http snapshot of a domain while keeping the domain and its subdomains.
+// With dryRun nothing is deleted and the report holds what would be.
+func PurgeDomainData(ctx context.Context, domainName string, dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun, Results: make([]RetentionResult, 0)}
+	store := storage.GetStore()
+
+	deleted, err := purgeSnapshots(ctx, store.DNS, dnsSnapshots.collection, domainName, dryRun)
+	if err != nil {
+		return report, err
+	}
+	report.Results = append(report.Results, RetentionResult{
+		Collection: dnsSnapshots.collection,
+		Domain:     domainName,
+		Policy:     models.RetentionPolicy{Mode: models.RetentionDelete},
+		Deleted:    deleted,
+	})
+
+	deleted, err = purgeSnapshots(ctx, store.HTTP, httpSnapshots.collection, domainName, dryRun)
+	if err != nil {
+		return report, err
+	}
+	report.Results = append(report.Results, RetentionResult{
+		Collection: httpSnapshots.collection,
+		Domain:     domainName,
+		Policy:     models.RetentionPolicy{Mode: models.RetentionDelete},
+		Deleted:    deleted,
+	})
+
+	return report, nil
+}
+
+// purgeSnapshots deletes the snapshots of a domain and returns how many there were, a dry run only counts them
+func purgeSnapshots[T any](ctx context.Context, repository snapshotRepository[T], collection, domainName string, dryRun bool) (int64, error) {
+	count, err := repository.Count(ctx, domainName)
+	if err == nil && !dryRun {
+		err = repository.Delete(ctx, domainName, "")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s snapshots of %s: %v", collection, domainName, err)
+	}
+	return count, nil
+}
+
+func retentionTask() error {
+	log.Println("Running retention task")
+
+	report, err := ApplyRetention(context.Background(), "", false)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range report.Results {
+		if result.Deleted > 0 {
+			log.Printf("retention deleted %d %s documents of %q", result.Deleted, result.Collection, result.Domain)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestEffectivePolicy(t *testing.T) {
+	global := models.RetentionPolicy{RawDays: 90, RollupDays: 275, Mode: models.RetentionKeepChanges}
+	tests := []struct {
+		domain   *models.RetentionPolicy
+		expected models.RetentionPolicy
+	}{
+		{nil, global},
+		{&models.RetentionPolicy{Mode: models.RetentionDelete}, models.RetentionPolicy{RawDays: 90, RollupDays: 275, Mode: models.RetentionDelete}},
+		{&models.RetentionPolicy{RawDays: 30}, models.RetentionPolicy{RawDays: 30, RollupDays: 275, Mode: models.RetentionKeepChanges}},
+		{&models.RetentionPolicy{RawDays: 7, RollupDays: 7, Mode: models.RetentionDailyRollup}, models.RetentionPolicy{RawDays: 7, RollupDays: 7, Mode: models.RetentionDailyRollup}},
+	}
+	for _, test := range tests {
+		if policy := EffectivePolicy(models.Domain{Name: "example.com", Retention: test.domain}, global); policy != test.expected {
+			t.Errorf("EffectivePolicy(%+v) = %+v, expected %+v", test.domain, policy, test.expected)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	now := time.Now()
+	daysAgo := func(days int) bson.DateTime { return bson.NewDateTimeFromTime(now.AddDate(0, 0, -days)) }
+	// two hours of the same day, 100 days ago
+	rollupDay := now.AddDate(0, 0, -100).UTC().Truncate(24 * time.Hour)
+	dns := func(domain, subdomain string, date, lastSeen bson.DateTime, a string) {
+		t.Helper()
+		record := models.DNS{Domain: domain, Subdomain: subdomain, ResolutionDate: date, LastSeen: lastSeen, ARecords: []string{a}}
+		if err := store.DNS.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	store.Domains.Create(ctx, models.Domain{Name: "tiers.com", Retention: &models.RetentionPolicy{RawDays: 90, RollupDays: 30, Mode: models.RetentionKeepChanges}})
+	// unchanged for over a year, the only snapshot is still the current one
+	dns("tiers.com", "stable.tiers.com", daysAgo(400), daysAgo(0), "10.0.0.1")
+	// gone for over a year, the latest snapshot is kept however old it is
+	dns("tiers.com", "gone.tiers.com", daysAgo(400), daysAgo(399), "10.0.0.1")
+	// rolled up to the last snapshot of the day
+	dns("tiers.com", "rolled.tiers.com", bson.NewDateTimeFromTime(rollupDay.Add(time.Hour)), 0, "10.0.0.1")
+	dns("tiers.com", "rolled.tiers.com", bson.NewDateTimeFromTime(rollupDay.Add(2*time.Hour)), 0, "10.0.0.2")
+	dns("tiers.com", "rolled.tiers.com", daysAgo(0), 0, "10.0.0.3")
+	// past the rollup window only changes are kept
+	dns("tiers.com", "changed.tiers.com", daysAgo(300), 0, "10.0.0.1")
+	dns("tiers.com", "changed.tiers.com", daysAgo(299), 0, "10.0.0.1")
+	dns("tiers.com", "changed.tiers.com", daysAgo(298), 0, "10.0.0.2")
+	dns("tiers.com", "changed.tiers.com", daysAgo(0), 0, "10.0.0.3")
+
+	store.Domains.Create(ctx, models.Domain{Name: "delete.com", Retention: &models.RetentionPolicy{RawDays: 90, RollupDays: 1, Mode: models.RetentionDelete}})
+	dns("delete.com", "stable.delete.com", daysAgo(400), daysAgo(0), "10.0.0.1")
+	dns("delete.com", "changed.delete.com", daysAgo(200), daysAgo(150), "10.0.0.1")
+	dns("delete.com", "changed.delete.com", daysAgo(150), daysAgo(0), "10.0.0.2")
+
+	// a policy with only a mode takes its windows from the global policy (90 and 275 days)
+	store.Domains.Create(ctx, models.Domain{Name: "mode.com", Retention: &models.RetentionPolicy{Mode: models.RetentionDelete}})
+	dns("mode.com", "changed.mode.com", daysAgo(500), daysAgo(400), "10.0.0.1")
+	dns("mode.com", "changed.mode.com", daysAgo(400), daysAgo(0), "10.0.0.2")
+
+	deleted := func(report RetentionReport, domain string) int64 {
+		for _, result := range report.Results {
+			if result.Domain == domain && result.Collection == "dns" {
+				return result.Deleted
+			}
+		}
+		t.Fatalf("no dns result for %s in %+v", domain, report)
+		return 0
+	}
+	snapshots := func(domain, subdomain string) int {
+		history, err := store.DNS.History(ctx, domain, subdomain, 0)
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		return len(history)
+	}
+
+	report, err := ApplyRetention(ctx, "tiers.com", true)
+	if err != nil || deleted(report, "tiers.com") != 2 {
+		t.Fatalf("expected a dry run to report 2 snapshots: %v %+v", err, report)
+	}
+	if snapshots("tiers.com", "rolled.tiers.com") != 3 || snapshots("tiers.com", "changed.tiers.com") != 4 {
+		t.Fatal("expected a dry run to keep every snapshot")
+	}
+
+	if report, err = ApplyRetention(ctx, "tiers.com", false); err != nil || deleted(report, "tiers.com") != 2 {
+		t.Fatalf("expected 2 deleted snapshots: %v %+v", err, report)
+	}
+	if snapshots("tiers.com", "stable.tiers.com") != 1 || snapshots("tiers.com", "gone.tiers.com") != 1 {
+		t.Fatal("expected the latest snapshots to be kept")
+	}
+	if history, _ := store.DNS.History(ctx, "tiers.com", "rolled.tiers.com", 0); len(history) != 2 || history[1].ARecords[0] != "10.0.0.2" {
+		t.Fatalf("expected the last snapshot of the day to be kept: %+v", history)
+	}
+	if history, _ := store.DNS.History(ctx, "tiers.com", "changed.tiers.com", 0); len(history) != 3 || history[1].ARecords[0] != "10.0.0.2" || history[2].ARecords[0] != "10.0.0.1" {
+		t.Fatalf("expected the unchanged snapshot to be dropped: %+v", history)
+	}
+
+	if report, err = ApplyRetention(ctx, "delete.com", false); err != nil || deleted(report, "delete.com") != 1 {
+		t.Fatalf("expected 1 deleted snapshot: %v %+v", err, report)
+	}
+	if snapshots("delete.com", "stable.delete.com") != 1 || snapshots("delete.com", "changed.delete.com") != 1 {
+		t.Fatal("expected the snapshots seen within the raw window to be kept")
+	}
+
+	if report, err = ApplyRetention(ctx, "mode.com", false); err != nil || deleted(report, "mode.com") != 1 {
+		t.Fatalf("expected the global windows to apply to a policy with only a mode: %v %+v", err, report)
+	}
+}
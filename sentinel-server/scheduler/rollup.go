@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// RollupStats stores the statistics of every domain, and of all of them, as the rollups of the day of now.
+// Running it again the same day replaces them, so the rollup of a day is its last run.
+func RollupStats(ctx context.Context, now time.Time) ([]models.StatsRollup, error) {
+	store := storage.GetStore()
+
+	domains, err := store.Domains.List(ctx, storage.DomainFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	// the global rollup has no domain
+	names := []string{""}
+	for _, domain := range domains {
+		names = append(names, domain.Name)
+	}
+
+	rollups := make([]models.StatsRollup, 0, len(names))
+	for _, name := range names {
+		rollup, err := rollupOf(ctx, day, name)
+		if err != nil {
+			return rollups, err
+		}
+		if err := store.Rollups.Put(ctx, rollup); err != nil {
+			return rollups, err
+		}
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups, nil
+}
+
+// rollupOf computes the rollup of a domain, or of every domain if domainName is empty, for day
+func rollupOf(ctx context.Context, day time.Time, domainName string) (models.StatsRollup, error) {
+	var domains []string
+	if domainName != "" {
+		domains = []string{domainName}
+	}
+
+	stats, err := storage.GetStore().Subdomains.Stats(ctx, domains...)
+	if err != nil {
+		return models.StatsRollup{}, err
+	}
+	assets, err := storage.GetStore().Subdomains.Assets(ctx, day, domains...)
+	if err != nil {
+		return models.StatsRollup{}, err
+	}
+
+	return models.StatsRollup{
+		Date:         bson.NewDateTimeFromTime(day),
+		Domain:       domainName,
+		Subdomains:   stats.Total,
+		New:          assets.Discovered[day.Format(time.DateOnly)],
+		DNSStatus:    stats.DNSStatus,
+		HTTPStatus:   stats.HTTPStatus,
+		Providers:    assets.Providers,
+		Technologies: assets.Technologies,
+	}, nil
+}
+
+// rollupTask stores the daily rollups of the statistics
+func rollupTask() error {
+	log.Println("Running stats rollup task")
+
+	rollups, err := RollupStats(context.Background(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("stats rollup stored %d rollups", len(rollups))
+	return nil
+}
@@ -4,15 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 
-	"github.com/0xgwyn/sentinel/database"
+	"github.com/0xgwyn/sentinel/events"
 	"github.com/0xgwyn/sentinel/models"
 	"github.com/0xgwyn/sentinel/modules"
+	"github.com/0xgwyn/sentinel/scope"
+	"github.com/0xgwyn/sentinel/storage"
 	"github.com/go-co-op/gocron/v2"
 	"github.com/google/uuid"
 )
@@ -36,10 +37,23 @@ func NewScheduler(config Config) (*Scheduler, error) {
 	}, nil
 }
 
+// scheduledJobs are the job types the scheduler runs
+var scheduledJobs = []JobType{SubfinderJob, DnsxJob, HttpxJob, RetentionJob, StatusAgingJob, IntegrityJob, RollupJob}
+
 func (s *Scheduler) Start() error {
-	for _, jobType := range []JobType{SubfinderJob, DnsxJob, HttpxJob} {
+	for _, jobType := range scheduledJobs {
+		// a job left unfinished by an earlier run of the server isn't running anymore and would block its type
+		if !s.coordinator.CanRun(jobType) {
+			if err := s.coordinator.EndJob(jobType, errInterrupted); err != nil {
+				return fmt.Errorf("failed to finish the interrupted %s job: %v", jobType, err)
+			}
+		}
+	}
+
+	for _, jobType := range scheduledJobs {
 		var jobDuration int
 		var taskLogic any
+		var taskParams []any
 
 		if jobType == SubfinderJob {
 			jobDuration = s.config.SubfinderInterval
@@ -47,30 +61,42 @@ func (s *Scheduler) Start() error {
 		} else if jobType == DnsxJob {
 			jobDuration = s.config.DnsxInterval
 			taskLogic = dnsxTask
+			taskParams = []any{s.config}
 		} else if jobType == HttpxJob {
 			jobDuration = s.config.HttpxInterval
 			taskLogic = httpxTask
+		} else if jobType == RetentionJob {
+			jobDuration = s.config.RetentionInterval
+			taskLogic = retentionTask
+		} else if jobType == StatusAgingJob {
+			jobDuration = s.config.StatusAgingInterval
+			taskLogic = statusAgingTask
+			taskParams = []any{s.config}
+		} else if jobType == IntegrityJob {
+			jobDuration = s.config.IntegrityInterval
+			taskLogic = integrityTask
+		} else if jobType == RollupJob {
+			jobDuration = s.config.RollupInterval
+			taskLogic = rollupTask
 		}
 
 		_, err := s.scheduler.NewJob(
 			gocron.DurationJob(
-				time.Duration(jobDuration)*time.Minute,
+				time.Duration(jobDuration)*time.Hour,
 			),
 			gocron.NewTask(
 				taskLogic,
+				taskParams...,
 			),
 			gocron.WithName(string(jobType)+"-job"),
 			gocron.WithEventListeners(
 				gocron.BeforeJobRunsSkipIfBeforeFuncErrors(func(jobID uuid.UUID, jobName string) error {
-					if s.coordinator.CanRun(jobType) {
-						err := s.coordinator.StartJob(jobType)
-						if err != nil {
-							// Skip job if StartJob fails
-							return err
-						}
+					if !s.coordinator.CanRun(jobType) {
+						// Skip job
+						return fmt.Errorf("cannot run job(%s) - previous job still running", jobType)
 					}
-					// Skip job
-					return fmt.Errorf("cannot run job(%s) - previous job still running", jobType)
+					// Skip job if StartJob fails
+					return s.coordinator.StartJob(jobType)
 				}),
 				gocron.AfterJobRuns(func(jobID uuid.UUID, jobName string) {
 					s.coordinator.EndJob(jobType, nil)
@@ -102,101 +128,134 @@ func (s *Scheduler) Stop() error {
 func subfinderTask() error {
 	log.Println("Running subfinder task")
 
-	// Get domains collection
-	domainsColl := database.GetDBCollection("domains")
-	subdomainsColl := database.GetDBCollection("subdomains")
+	ctx := context.Background()
+	store := storage.GetStore()
+	jobID := runningJobID(SubfinderJob)
 
 	// Find all domains
-	cursor, err := domainsColl.Find(context.Background(), bson.M{})
+	domains, err := store.Domains.List(ctx, storage.DomainFilter{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch domains: %v", err)
+	}
+	// apexes that are domains of their own are enumerated for them
+	stored, err := store.DomainNames(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch domains: %v", err)
 	}
-	defer cursor.Close(context.Background())
 
 	// Iterate over domains
-	for cursor.Next(context.Background()) {
-		var domain models.Domain
-		if err := cursor.Decode(&domain); err != nil {
-			log.Printf("failed to decode domain: %v", err)
-			continue
+	for _, domain := range domains {
+		// The program of the domain shares its scope rules and scan settings
+		var program *models.Program
+		if domain.Program != "" {
+			found, err := store.Programs.Get(ctx, domain.Program)
+			if err == nil {
+				program = &found
+			} else if err != storage.ErrNotFound {
+				log.Printf("failed to fetch program %s: %v", domain.Program, err)
+			}
 		}
-
-		// Run subfinder for each domain
-		results, err := modules.RunSubfinder(domain.Name)
-		if err != nil {
-			log.Printf("subfinder failed for domain %s: %v", domain.Name, err)
-			continue
+		var scanSettings *models.ScanSettings
+		if program != nil {
+			scanSettings = program.ScanSettings
 		}
+		watchDNS, watchHTTP := scanSettings.WatchFlags()
+		inScope, outOfScope := scope.Effective(domain, program)
 
-		// Process each subdomain found by subfinder
-		for _, result := range results {
-
-			// Prepare filter for checking existing subdomain
-			filter := bson.M{
-				"domain": domain.Name,
-				"name":   result.Subdomain,
+		// Run subfinder for the domain and every apex derived from its in scope patterns
+		for _, seed := range scope.Seeds(domain, program, stored) {
+			results, err := modules.RunSubfinder(seed)
+			if err != nil {
+				log.Printf("subfinder failed for seed %s of domain %s: %v", seed, domain.Name, err)
+				continue
 			}
 
-			// Try to find existing subdomain
-			var existingSubdomain models.Subdomain
-			err := subdomainsColl.FindOne(context.Background(), filter).Decode(&existingSubdomain)
-
-			now := time.Now()
-
-			if err == mongo.ErrNoDocuments {
-				// Subdomain doesn't exist, create new one
-				newSubdomain := models.Subdomain{
-					Domain:    domain.Name,
-					Name:      result.Subdomain,
-					CreatedAt: bson.NewDateTimeFromTime(now),
-					UpdatedAt: bson.NewDateTimeFromTime(now),
-					Providers: result.Provider,
-					WatchHTTP: true,
-					WatchDNS:  true,
-					DNSStatus: models.FreshSubdomain,
+			// Process each subdomain found by subfinder
+			for _, result := range results {
+				// Results are only kept if they are in scope, derived seeds find names outside of it
+				if !scope.InScope(result.Subdomain, inScope, outOfScope) {
+					continue
 				}
 
-				_, err = subdomainsColl.InsertOne(context.Background(), newSubdomain)
-				if err != nil {
-					log.Printf("failed to insert new subdomain %s: %v", result.Subdomain, err)
-				}
-			} else if err == nil {
-				// Subdomain exists, check for new providers
-				newProviders := make([]string, 0)
-				existingProviders := make(map[string]bool)
-
-				// Create map of existing providers
-				for _, provider := range existingSubdomain.Providers {
-					existingProviders[provider] = true
-				}
+				// Try to find existing subdomain
+				existingSubdomain, err := store.Subdomains.Get(ctx, domain.Name, result.Subdomain)
+
+				now := time.Now()
+
+				if err == storage.ErrNotFound {
+					// Subdomain doesn't exist, create new one
+					newSubdomain := models.Subdomain{
+						Domain:    domain.Name,
+						Name:      result.Subdomain,
+						CreatedAt: bson.NewDateTimeFromTime(now),
+						UpdatedAt: bson.NewDateTimeFromTime(now),
+						Providers: result.Provider,
+						Seed:      seed,
+						WatchHTTP: watchHTTP,
+						WatchDNS:  watchDNS,
+						DNSStatus: models.FreshSubdomain,
+					}
 
-				// Check for new providers
-				for _, provider := range result.Provider {
-					if !existingProviders[provider] {
-						newProviders = append(newProviders, provider)
+					if err := store.Subdomains.Create(ctx, newSubdomain); err != nil {
+						log.Printf("failed to insert new subdomain %s: %v", result.Subdomain, err)
+						continue
 					}
-				}
 
-				// If new providers found, update the subdomain
-				if len(newProviders) > 0 {
-					update := bson.M{
-						"$set": bson.M{
-							"updated_at": bson.NewDateTimeFromTime(now),
-						},
-						"$push": bson.M{
-							"providers": bson.M{
-								"$each": newProviders,
-							},
-						},
+					recordEvent(models.Event{
+						Type:      models.SubdomainDiscovered,
+						Domain:    domain.Name,
+						Subdomain: result.Subdomain,
+						After:     result.Provider,
+						Source:    string(SubfinderJob),
+						JobID:     jobID,
+						Timestamp: bson.NewDateTimeFromTime(now),
+					})
+				} else if err == nil && existingSubdomain.ArchivedAt != 0 {
+					// Archived subdomains stay archived and quiet until they are restored
+					continue
+				} else if err == nil {
+					// Subdomain exists, check for new providers
+					newProviders := make([]string, 0)
+					existingProviders := make(map[string]bool)
+
+					// Create map of existing providers
+					for _, provider := range existingSubdomain.Providers {
+						existingProviders[provider] = true
 					}
 
-					_, err = subdomainsColl.UpdateOne(context.Background(), filter, update)
-					if err != nil {
-						log.Printf("failed to update subdomain %s providers: %v", result.Subdomain, err)
+					// Check for new providers
+					for _, provider := range result.Provider {
+						if !existingProviders[provider] {
+							newProviders = append(newProviders, provider)
+						}
 					}
+
+					// If new providers found, update the subdomain
+					if len(newProviders) > 0 {
+						_, err := store.Subdomains.Update(ctx, domain.Name, result.Subdomain, func(sub *models.Subdomain) error {
+							sub.Providers = appendMissing(sub.Providers, newProviders)
+							sub.UpdatedAt = bson.NewDateTimeFromTime(now)
+							return nil
+						})
+						if err != nil {
+							log.Printf("failed to update subdomain %s providers: %v", result.Subdomain, err)
+							continue
+						}
+
+						recordEvent(models.Event{
+							Type:      models.ProviderAdded,
+							Domain:    domain.Name,
+							Subdomain: result.Subdomain,
+							Before:    existingSubdomain.Providers,
+							After:     append(existingSubdomain.Providers, newProviders...),
+							Source:    string(SubfinderJob),
+							JobID:     jobID,
+							Timestamp: bson.NewDateTimeFromTime(now),
+						})
+					}
+				} else {
+					log.Printf("error checking subdomain %s: %v", result.Subdomain, err)
 				}
-			} else {
-				log.Printf("error checking subdomain %s: %v", result.Subdomain, err)
 			}
 		}
 	}
@@ -204,26 +263,19 @@ func subfinderTask() error {
 	return nil
 }
 
-func dnsxTask() error {
+func dnsxTask(config Config) error {
 	log.Println("Running dnsx task")
 
-	// Get collections
-	subdomainsColl := database.GetDBCollection("subdomains")
-	dnsColl := database.GetDBCollection("dns")
+	ctx := context.Background()
+	store := storage.GetStore()
+	jobID := runningJobID(DnsxJob)
 
-	// Find all subdomains with WatchDNS true
-	filter := bson.M{"watch_dns": true}
-	cursor, err := subdomainsColl.Find(context.Background(), filter)
+	// Find all subdomains in scope with WatchDNS true that are due for a check
+	watched := true
+	subdomains, err := store.Subdomains.List(ctx, storage.SubdomainFilter{WatchDNS: &watched, InScope: &watched, DNSCheckDue: time.Now()})
 	if err != nil {
 		return fmt.Errorf("failed to fetch subdomains: %v", err)
 	}
-	defer cursor.Close(context.Background())
-
-	// Collect all subdomain names to process
-	var subdomains []models.Subdomain
-	if err = cursor.All(context.Background(), &subdomains); err != nil {
-		return fmt.Errorf("failed to decode subdomains: %v", err)
-	}
 
 	if len(subdomains) == 0 {
 		return nil
@@ -259,12 +311,8 @@ func dnsxTask() error {
 		}
 
 		// Check if there's any previous DNS record
-		dnsFilter := bson.M{
-			"subdomain": result.Domain,
-			"domain":    currentSubdomain.Domain,
-		}
-		var lastDNSRecord models.DNS
-		err := dnsColl.FindOne(context.Background(), dnsFilter, options.FindOne().SetSort(bson.M{"resolution_date": -1})).Decode(&lastDNSRecord)
+		lastDNSRecord, err := store.DNS.Latest(ctx, currentSubdomain.Domain, result.Domain)
+		hasPreviousRecord := err == nil
 
 		// Prepare new DNS record
 		newDNSRecord := models.DNS{
@@ -292,43 +340,54 @@ func dnsxTask() error {
 			}
 		}
 
-		var newStatus models.StatusType
-		if err == mongo.ErrNoDocuments {
-			// No previous DNS data
-			if hasIPRecords {
-				newStatus = models.FreshResolved
-			} else {
-				newStatus = models.UnresolvedSubdomain
-			}
-		} else {
-			// Has previous DNS data
-			if !hasIPRecords {
-				newStatus = models.LastResolved
-			} else if currentSubdomain.DNSStatus == models.LastResolved {
-				newStatus = models.FreshResolved
-			}
+		// Move the dns status along the state machine
+		transition := models.NextDNSStatus(currentSubdomain.DNSStatus, hasIPRecords)
+		if err := applyDNSTransition(ctx, currentSubdomain, transition, DnsxJob, jobID, now); err != nil {
+			log.Printf("failed to update subdomain status for %s: %v", currentSubdomain.Name, err)
 		}
 
-		// Update subdomain status if needed
-		if newStatus != "" {
-			_, err = subdomainsColl.UpdateOne(
-				context.Background(),
-				bson.M{"domain": currentSubdomain.Domain, "name": currentSubdomain.Name},
-				bson.M{"$set": bson.M{
-					"dns_status": newStatus,
-					"updated_at": bson.NewDateTimeFromTime(now),
-				}},
-			)
+		// Back off from subdomains that keep failing to resolve
+		if dnsScheduleChanged(currentSubdomain, hasIPRecords) {
+			var unwatched bool
+			_, err = store.Subdomains.Update(ctx, currentSubdomain.Domain, currentSubdomain.Name, func(sub *models.Subdomain) error {
+				unwatched = applyDNSSchedule(sub, hasIPRecords, config, now)
+				return nil
+			})
 			if err != nil {
-				log.Printf("failed to update subdomain status for %s: %v", currentSubdomain.Name, err)
+				log.Printf("failed to update dns schedule of %s: %v", currentSubdomain.Name, err)
+			} else if unwatched {
+				recordEvent(models.Event{
+					Type:      models.SubdomainUnwatched,
+					Domain:    currentSubdomain.Domain,
+					Subdomain: currentSubdomain.Name,
+					Reason:    unwatchReason(currentSubdomain.DNSMisses + 1),
+					Source:    string(DnsxJob),
+					JobID:     jobID,
+					Timestamp: bson.NewDateTimeFromTime(now),
+				})
 			}
 		}
 
-		// Insert new DNS record if we have any records
+		// Store the DNS record if we have any records, only as a new snapshot if the record set changed
 		if hasAnyRecords {
-			_, err = dnsColl.InsertOne(context.Background(), newDNSRecord)
+			var lastRecord *models.DNS
+			if hasPreviousRecord {
+				lastRecord = &lastDNSRecord
+			}
+			inserted, err := saveDNSSnapshot(ctx, store.DNS, lastRecord, newDNSRecord, now)
 			if err != nil {
-				log.Printf("failed to insert DNS record for %s: %v", currentSubdomain.Name, err)
+				log.Printf("failed to store DNS record for %s: %v", currentSubdomain.Name, err)
+			} else if inserted && lastRecord != nil {
+				recordEvent(models.Event{
+					Type:      models.DNSRecordsChanged,
+					Domain:    currentSubdomain.Domain,
+					Subdomain: currentSubdomain.Name,
+					Before:    lastRecord,
+					After:     newDNSRecord,
+					Source:    string(DnsxJob),
+					JobID:     jobID,
+					Timestamp: bson.NewDateTimeFromTime(now),
+				})
 			}
 		}
 	}
@@ -338,7 +397,116 @@ func dnsxTask() error {
 
 func httpxTask() error {
 	log.Println("Running httpx task")
-	// Httpx job
+
+	ctx := context.Background()
+	store := storage.GetStore()
+	jobID := runningJobID(HttpxJob)
+
+	// Find all subdomains in scope with WatchHTTP true
+	watched := true
+	subdomains, err := store.Subdomains.List(ctx, storage.SubdomainFilter{WatchHTTP: &watched, InScope: &watched})
+	if err != nil {
+		return fmt.Errorf("failed to fetch subdomains: %v", err)
+	}
+
+	if len(subdomains) == 0 {
+		return nil
+	}
+
+	// Extract subdomain names for httpx
+	var subdomainNames []string
+	for _, sub := range subdomains {
+		subdomainNames = append(subdomainNames, sub.Name)
+	}
+
+	// Run httpx
+	httpResults, err := modules.RunHttpx(subdomainNames, 50)
+	if err != nil {
+		return fmt.Errorf("failed to run httpx: %v", err)
+	}
+
+	now := time.Now()
+
+	// Map results to their input so subdomains without a live service can be detected
+	resultMap := make(map[string]models.HTTP)
+	for _, result := range httpResults {
+		if result.Failed {
+			continue
+		}
+		resultMap[result.Input] = models.HTTP{
+			ScanningDate:    bson.NewDateTimeFromTime(now),
+			Subdomain:       result.Input,
+			Location:        result.Location,
+			StatusCode:      result.StatusCode,
+			Title:           result.Title,
+			CDNName:         result.CDNName,
+			CDNType:         result.CDNType,
+			Technologies:    result.Technologies,
+			Hashes:          result.Hashes,
+			Words:           result.Words,
+			Lines:           result.Lines,
+			Failed:          result.Failed,
+			Port:            result.Port,
+			ResponseHeaders: result.ResponseHeaders,
+			ContentLength:   result.ContentLength,
+		}
+	}
+
+	// Process each watched subdomain
+	for _, currentSubdomain := range subdomains {
+		newHTTPRecord, hasService := resultMap[currentSubdomain.Name]
+
+		// Check if there's any previous HTTP record
+		lastHTTPRecord, err := store.HTTP.Latest(ctx, currentSubdomain.Domain, currentSubdomain.Name)
+		hasPreviousRecord := err == nil
+
+		// Move the http status along the state machine
+		transition := models.NextHTTPStatus(currentSubdomain.HTTPStatus, lastHTTPRecord.StatusCode, newHTTPRecord.StatusCode, hasService)
+		if err := applyHTTPTransition(ctx, currentSubdomain, transition, HttpxJob, jobID, now); err != nil {
+			log.Printf("failed to update subdomain http status for %s: %v", currentSubdomain.Name, err)
+		}
+
+		// Store the HTTP record, only as a new snapshot if the service changed
+		if hasService {
+			newHTTPRecord.Domain = currentSubdomain.Domain
+			var lastRecord *models.HTTP
+			if hasPreviousRecord {
+				lastRecord = &lastHTTPRecord
+			}
+			inserted, err := saveHTTPSnapshot(ctx, store.HTTP, lastRecord, newHTTPRecord, now)
+			if err != nil {
+				log.Printf("failed to store HTTP record for %s: %v", currentSubdomain.Name, err)
+			} else if inserted && lastRecord != nil {
+				recordEvent(models.Event{
+					Type:      models.HTTPServiceChanged,
+					Domain:    currentSubdomain.Domain,
+					Subdomain: currentSubdomain.Name,
+					After:     models.DiffHTTP(*lastRecord, newHTTPRecord),
+					Source:    string(HttpxJob),
+					JobID:     jobID,
+					Timestamp: bson.NewDateTimeFromTime(now),
+				})
+			}
+		}
+	}
 
 	return nil
 }
+
+// appendMissing appends the values the list doesn't have yet, the stored list may have
+// changed since the values were picked
+func appendMissing(list, values []string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// recordEvent stores a timeline event, failures are only logged so they never stop a task
+func recordEvent(event models.Event) {
+	if err := events.Record(context.Background(), event); err != nil {
+		log.Printf("failed to record %s event for %s: %v", event.Type, event.Subdomain, err)
+	}
+}
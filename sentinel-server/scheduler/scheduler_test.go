@@ -1,20 +1,32 @@
 package scheduler
 
 import (
+	"context"
 	"log"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
 )
 
 func TestScheduler(t *testing.T) {
 	log.Println("Test started")
 
-	// Create test config with short intervals
-	config := Config{
-		SubfinderInterval: 5,
-		HttpxInterval:     5,
-		DnsxInterval:      100,
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
 	}
+	defer store.Close()
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	// Create test config with short intervals
+	config := NewDefaultConfig()
+	config.SubfinderInterval = 5
+	config.HttpxInterval = 5
+	config.DnsxInterval = 100
 
 	// Create new scheduler
 	s, err := NewScheduler(config)
@@ -35,3 +47,34 @@ func TestScheduler(t *testing.T) {
 		t.Fatalf("Failed to stop scheduler: %v", err)
 	}
 }
+
+func TestStartFinishesInterruptedJobs(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	// a job still running when the server stopped
+	store.Jobs.Start(ctx, models.Job{Type: RetentionJob, StartTime: time.Now().Add(-time.Hour), Status: models.JobStatusPending})
+
+	s, err := NewScheduler(NewDefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	defer s.Stop()
+
+	job, err := store.Jobs.Latest(ctx, RetentionJob)
+	if err != nil || job.EndTime.IsZero() || job.Status != models.JobStatusFailed {
+		t.Fatalf("expected the interrupted job to be finished as failed: %v %+v", err, job)
+	}
+	if !s.coordinator.CanRun(RetentionJob) {
+		t.Error("expected the job to be able to run again")
+	}
+}
@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/events"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/scope"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// ScopeImpact tells which subdomains of a domain a scope change moves into or out of its scope.
+// Archived subdomains are left out, they aren't scanned either way.
+type ScopeImpact struct {
+	Domain string `json:"domain"`
+	// subdomains that are scanned again, their next dns check is due right away and they are watched
+	// for what the program watches new subdomains for, dns watching that was turned off after too
+	// many misses is turned back on
+	Entering []string `json:"entering"`
+	// subdomains that stop being scanned, they are kept with their records
+	Leaving []string `json:"leaving"`
+	// active subdomains in and out of scope after the change
+	InScope    int `json:"in_scope"`
+	OutOfScope int `json:"out_of_scope"`
+}
+
+type ScopeReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Domains []ScopeImpact `json:"domains"`
+}
+
+// ApplyScope checks the subdomains of the domains against their scope and the scope of their program.
+// The domains and the program hold the scope to check, which doesn't need to be stored yet when it is
+// a dry run. Otherwise the subdomains leaving the scope are marked out of scope so that the scans skip
+// them, and the ones coming back are watched again and queued for a dns check, with an event for every move.
+func ApplyScope(ctx context.Context, domains []models.Domain, program *models.Program, dryRun bool) (ScopeReport, error) {
+	report := ScopeReport{DryRun: dryRun, Domains: make([]ScopeImpact, 0, len(domains))}
+	for _, domain := range domains {
+		impact, err := applyDomainScope(ctx, domain, program, dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Domains = append(report.Domains, impact)
+	}
+	return report, nil
+}
+
+func applyDomainScope(ctx context.Context, domain models.Domain, program *models.Program, dryRun bool) (ScopeImpact, error) {
+	store := storage.GetStore()
+	impact := ScopeImpact{Domain: domain.Name, Entering: []string{}, Leaving: []string{}}
+
+	subdomains, err := store.Subdomains.List(ctx, storage.SubdomainFilter{Domain: domain.Name})
+	if err != nil {
+		return impact, err
+	}
+
+	inScope, outOfScope := scope.Effective(domain, program)
+	for _, subdomain := range subdomains {
+		covered := scope.InScope(subdomain.Name, inScope, outOfScope)
+		switch {
+		case covered && subdomain.OutOfScopeAt != 0:
+			impact.Entering = append(impact.Entering, subdomain.Name)
+		case !covered && subdomain.OutOfScopeAt == 0:
+			impact.Leaving = append(impact.Leaving, subdomain.Name)
+		}
+		if covered {
+			impact.InScope++
+		} else {
+			impact.OutOfScope++
+		}
+	}
+	if dryRun {
+		return impact, nil
+	}
+
+	now := bson.NewDateTimeFromTime(time.Now())
+	scopeEvents := make([]models.Event, 0, len(impact.Leaving)+len(impact.Entering))
+	if len(impact.Leaving) > 0 {
+		filter := storage.SubdomainFilter{Domain: domain.Name, Names: impact.Leaving}
+		if _, err := store.Subdomains.UpdateMany(ctx, filter, storage.SubdomainChanges{OutOfScopeAt: &now, Now: now}); err != nil {
+			return impact, err
+		}
+
+		for _, name := range impact.Leaving {
+			reason := "not covered by the in scope rules"
+			if scope.MatchAny(outOfScope, name) {
+				reason = "excluded by the out of scope rules"
+			}
+			scopeEvents = append(scopeEvents, models.Event{
+				Type:      models.SubdomainLeftScope,
+				Domain:    domain.Name,
+				Subdomain: name,
+				Reason:    reason,
+				Source:    events.SourceAPI,
+				Timestamp: now,
+			})
+		}
+	}
+	if len(impact.Entering) > 0 {
+		// subdomains coming back are scanned again the way new ones of the program are
+		var inScopeAt bson.DateTime
+		changes := storage.SubdomainChanges{OutOfScopeAt: &inScopeAt, Rescan: true, Now: now}
+		var scanSettings *models.ScanSettings
+		if program != nil {
+			scanSettings = program.ScanSettings
+		}
+		// flags the program turns off are left as they are
+		watchDNS, watchHTTP := scanSettings.WatchFlags()
+		if watchDNS {
+			changes.WatchDNS = &watchDNS
+		}
+		if watchHTTP {
+			changes.WatchHTTP = &watchHTTP
+		}
+		filter := storage.SubdomainFilter{Domain: domain.Name, Names: impact.Entering}
+		if _, err := store.Subdomains.UpdateMany(ctx, filter, changes); err != nil {
+			return impact, err
+		}
+
+		for _, name := range impact.Entering {
+			scopeEvents = append(scopeEvents, models.Event{
+				Type:      models.SubdomainEnteredScope,
+				Domain:    domain.Name,
+				Subdomain: name,
+				Source:    events.SourceAPI,
+				Timestamp: now,
+			})
+		}
+	}
+
+	if err := events.Record(ctx, scopeEvents...); err != nil {
+		log.Printf("failed to record the scope changes of %s: %v", domain.Name, err)
+	}
+
+	return impact, nil
+}
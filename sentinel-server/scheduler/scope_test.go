@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+func TestApplyScope(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+	storage.SetStore(store)
+	defer storage.SetStore(nil)
+
+	outOfScopeAt := bson.NewDateTimeFromTime(time.Now().Add(-time.Hour))
+	noHTTP := false
+	program := &models.Program{Name: "acme", ScanSettings: &models.ScanSettings{WatchHTTP: &noHTTP}}
+	domain := models.Domain{Name: "example.com", Program: "acme", InScope: []string{"*.example.com"}, OutOfScope: []string{"dev.example.com"}}
+	store.Subdomains.Create(ctx,
+		models.Subdomain{Domain: "example.com", Name: "www.example.com", WatchDNS: true, WatchHTTP: true},
+		models.Subdomain{Domain: "example.com", Name: "dev.example.com", WatchDNS: true},
+		// missed too many times before it left the scope
+		models.Subdomain{Domain: "example.com", Name: "api.example.com", OutOfScopeAt: outOfScopeAt,
+			DNSAutoUnwatched: true, DNSMisses: 5},
+		models.Subdomain{Domain: "example.com", Name: "mail.example.com", OutOfScopeAt: outOfScopeAt,
+			NextDNSCheck: bson.NewDateTimeFromTime(time.Now().Add(time.Hour))},
+	)
+
+	report, err := ApplyScope(ctx, []models.Domain{domain}, program, false)
+	if err != nil || len(report.Domains) != 1 {
+		t.Fatalf("ApplyScope failed: %v %+v", err, report)
+	}
+	impact := report.Domains[0]
+	if len(impact.Leaving) != 1 || impact.Leaving[0] != "dev.example.com" || len(impact.Entering) != 2 ||
+		impact.InScope != 3 || impact.OutOfScope != 1 {
+		t.Fatalf("unexpected impact %+v", impact)
+	}
+
+	dev, _ := store.Subdomains.Get(ctx, "example.com", "dev.example.com")
+	if dev.OutOfScopeAt == 0 || !dev.WatchDNS {
+		t.Errorf("expected the subdomain to leave the scope with its flags: %+v", dev)
+	}
+	// the program watches dns on new subdomains but not http
+	api, _ := store.Subdomains.Get(ctx, "example.com", "api.example.com")
+	if api.OutOfScopeAt != 0 || !api.WatchDNS || api.WatchHTTP || api.DNSAutoUnwatched || api.DNSMisses != 0 {
+		t.Errorf("expected the subdomain to be watched again: %+v", api)
+	}
+	mail, _ := store.Subdomains.Get(ctx, "example.com", "mail.example.com")
+	if mail.OutOfScopeAt != 0 || !mail.WatchDNS || mail.NextDNSCheck != 0 {
+		t.Errorf("expected the dns check to be due right away: %+v", mail)
+	}
+
+	recorded, err := store.Events.List(ctx, storage.EventFilter{Domain: "example.com"})
+	if err != nil || len(recorded) != 3 {
+		t.Errorf("expected an event for every move: %v %+v", err, recorded)
+	}
+
+	// nothing moves twice
+	report, err = ApplyScope(ctx, []models.Domain{domain}, program, false)
+	if err != nil || len(report.Domains[0].Entering) != 0 || len(report.Domains[0].Leaving) != 0 {
+		t.Errorf("expected no moves the second time: %v %+v", err, report)
+	}
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// normalizeRecords lowercases, trims the trailing dot, dedupes and sorts records
+// so that resolver ordering or casing is not considered a change. Snapshots keep the records as resolved,
+// this is only for comparing them.
+func normalizeRecords(records []string) []string {
+	return normalizeValues(records, func(record string) string { return strings.TrimSuffix(strings.ToLower(record), ".") })
+}
+
+// normalizeTXTRecords dedupes and sorts txt records, their values are case sensitive (dkim keys,
+// verification tokens) and are compared as they are
+func normalizeTXTRecords(records []string) []string {
+	return normalizeValues(records, func(record string) string { return record })
+}
+
+// normalizeValues trims, normalizes, dedupes and sorts values, dropping the empty ones
+func normalizeValues(records []string, normalize func(string) string) []string {
+	if len(records) == 0 {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(records))
+	for _, record := range records {
+		record = normalize(strings.TrimSpace(record))
+		if record != "" {
+			normalized = append(normalized, record)
+		}
+	}
+	slices.Sort(normalized)
+
+	return slices.Compact(normalized)
+}
+
+// sameDNSRecords reports whether two DNS snapshots hold the same record set once normalized
+func sameDNSRecords(a, b models.DNS) bool {
+	return slices.Equal(normalizeRecords(a.ARecords), normalizeRecords(b.ARecords)) &&
+		slices.Equal(normalizeRecords(a.AAAARecords), normalizeRecords(b.AAAARecords)) &&
+		slices.Equal(normalizeRecords(a.CnameRecords), normalizeRecords(b.CnameRecords)) &&
+		slices.Equal(normalizeRecords(a.NSRecords), normalizeRecords(b.NSRecords)) &&
+		slices.Equal(normalizeRecords(a.PTRRecords), normalizeRecords(b.PTRRecords)) &&
+		slices.Equal(normalizeRecords(a.MXRecords), normalizeRecords(b.MXRecords)) &&
+		slices.Equal(normalizeTXTRecords(a.TXTRecords), normalizeTXTRecords(b.TXTRecords))
+}
+
+// volatileHeaders change from one response to the next without the service changing
+var volatileHeaders = []string{
+	"date", "expires", "age", "last-modified", "etag",
+	"x-request-id", "x-correlation-id", "x-trace-id", "traceparent", "x-amzn-requestid", "x-amzn-trace-id",
+	"x-amz-request-id", "x-amz-cf-id", "x-azure-ref", "x-fb-debug", "cf-ray", "x-runtime", "x-served-by", "x-timer",
+}
+
+// stableHeaders returns the response headers worth comparing: header names are lowercased with dashes, the way
+// httpx writes them varies, volatile headers are left out and cookies are only compared by name since their
+// values are session ids.
+func stableHeaders(headers map[string]any) map[string]any {
+	stable := make(map[string]any, len(headers))
+	for name, value := range headers {
+		name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+		switch {
+		case slices.Contains(volatileHeaders, name):
+		case name == "set-cookie":
+			stable[name] = cookieNames(value)
+		default:
+			stable[name] = value
+		}
+	}
+	return stable
+}
+
+// cookieNames returns the sorted names of the cookies of a set-cookie header with one or more values
+func cookieNames(value any) []string {
+	var cookies []string
+	switch value := value.(type) {
+	case string:
+		cookies = []string{value}
+	case []string:
+		cookies = value
+	case []any:
+		for _, cookie := range value {
+			cookies = append(cookies, fmt.Sprint(cookie))
+		}
+	case bson.A:
+		for _, cookie := range value {
+			cookies = append(cookies, fmt.Sprint(cookie))
+		}
+	default:
+		cookies = []string{fmt.Sprint(value)}
+	}
+
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		name, _, _ := strings.Cut(cookie, "=")
+		names = append(names, strings.TrimSpace(name))
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// sameHTTPService reports whether two HTTP snapshots describe the same service.
+// Response headers are compared without the volatile ones, see stableHeaders.
+func sameHTTPService(a, b models.HTTP) bool {
+	if a.Location != b.Location || a.Port != b.Port || a.CDNName != b.CDNName || a.Failed != b.Failed {
+		return false
+	}
+
+	a.ResponseHeaders, b.ResponseHeaders = stableHeaders(a.ResponseHeaders), stableHeaders(b.ResponseHeaders)
+	return len(models.DiffHTTP(a, b)) == 0
+}
+
+// saveDNSSnapshot inserts the record as a new snapshot if it differs from the last one,
+// otherwise it only bumps last_seen and seen_count of the last snapshot.
+// It reports whether a new snapshot was inserted.
+func saveDNSSnapshot(ctx context.Context, records storage.DNSRecords, last *models.DNS, record models.DNS, now time.Time) (bool, error) {
+	if last != nil && sameDNSRecords(*last, record) {
+		seen := *last
+		seen.LastSeen = bson.NewDateTimeFromTime(now)
+		seen.SeenCount++
+		return false, records.Replace(ctx, seen)
+	}
+
+	record.LastSeen = bson.NewDateTimeFromTime(now)
+	record.SeenCount = 1
+	err := records.Insert(ctx, record)
+	return err == nil, err
+}
+
+// saveHTTPSnapshot inserts the record as a new snapshot if the service changed since the last one,
+// otherwise it only bumps last_seen and seen_count of the last snapshot.
+// It reports whether a new snapshot was inserted.
+func saveHTTPSnapshot(ctx context.Context, records storage.HTTPRecords, last *models.HTTP, record models.HTTP, now time.Time) (bool, error) {
+	if last != nil && sameHTTPService(*last, record) {
+		seen := *last
+		seen.LastSeen = bson.NewDateTimeFromTime(now)
+		seen.SeenCount++
+		return false, records.Replace(ctx, seen)
+	}
+
+	record.LastSeen = bson.NewDateTimeFromTime(now)
+	record.SeenCount = 1
+	err := records.Insert(ctx, record)
+	return err == nil, err
+}
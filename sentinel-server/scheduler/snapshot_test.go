@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestSameDNSRecords(t *testing.T) {
+	previous := models.DNS{
+		ARecords:     []string{"1.1.1.1", "2.2.2.2"},
+		CnameRecords: []string{"Edge.Example.NET."},
+	}
+	current := models.DNS{
+		ARecords:     []string{"2.2.2.2", "1.1.1.1", "2.2.2.2"},
+		CnameRecords: []string{"edge.example.net"},
+	}
+	if !sameDNSRecords(previous, current) {
+		t.Fatalf("expected reordered and differently cased records to be the same")
+	}
+
+	// txt values are case sensitive
+	previous.TXTRecords = []string{"v=DKIM1; p=MIGfMA0G", "google-site-verification=AbC"}
+	current.TXTRecords = []string{"google-site-verification=AbC", "v=DKIM1; p=MIGfMA0G"}
+	if !sameDNSRecords(previous, current) {
+		t.Fatalf("expected reordered txt records to be the same")
+	}
+	current.TXTRecords = []string{"google-site-verification=abc", "v=DKIM1; p=MIGfMA0G"}
+	if sameDNSRecords(previous, current) {
+		t.Fatalf("expected a txt record changing case to be a change")
+	}
+	current.TXTRecords = previous.TXTRecords
+
+	current.AAAARecords = []string{"::1"}
+	if sameDNSRecords(previous, current) {
+		t.Fatalf("expected a new AAAA record to be a change")
+	}
+}
+
+func TestSameHTTPService(t *testing.T) {
+	previous := models.HTTP{
+		StatusCode:      200,
+		Title:           "Home",
+		Port:            "443",
+		ResponseHeaders: map[string]any{"date": "Mon, 01 Jan 2024 00:00:00 GMT"},
+	}
+	previous.ResponseHeaders["server"] = "nginx"
+	previous.ResponseHeaders["set_cookie"] = bson.A{"session=abc; HttpOnly"}
+	current := previous
+	current.ResponseHeaders = map[string]any{
+		"Date":         "Tue, 02 Jan 2024 00:00:00 GMT",
+		"X-Request-Id": "42",
+		"server":       "nginx",
+		"set-cookie":   "session=def; HttpOnly",
+	}
+	if !sameHTTPService(previous, current) {
+		t.Fatalf("expected volatile header changes to be ignored")
+	}
+
+	current.ResponseHeaders["server"] = "Apache"
+	if sameHTTPService(previous, current) {
+		t.Fatalf("expected a new server header to be a change")
+	}
+	current.ResponseHeaders["server"] = "nginx"
+	current.ResponseHeaders["set-cookie"] = []string{"session=def", "admin=1"}
+	if sameHTTPService(previous, current) {
+		t.Fatalf("expected a new cookie to be a change")
+	}
+	current.ResponseHeaders["set-cookie"] = "session=def"
+
+	current.StatusCode = 403
+	if sameHTTPService(previous, current) {
+		t.Fatalf("expected a status code change to be a change")
+	}
+}
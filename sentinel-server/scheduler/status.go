@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/storage"
+)
+
+// applyDNSTransition stores a changed dns status of a subdomain and records it in the timeline
+func applyDNSTransition(ctx context.Context, sub models.Subdomain, transition models.Transition, source JobType, jobID bson.ObjectID, now time.Time) error {
+	if !transition.Changed() {
+		return nil
+	}
+
+	_, err := storage.GetStore().Subdomains.Update(ctx, sub.Domain, sub.Name, func(stored *models.Subdomain) error {
+		stored.DNSStatus = transition.To
+		stored.DNSStatusReason = transition.Reason
+		stored.DNSStatusChangedAt = bson.NewDateTimeFromTime(now)
+		stored.UpdatedAt = bson.NewDateTimeFromTime(now)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	eventType := models.DNSStatusChanged
+	switch transition.To {
+	case models.FreshResolved:
+		eventType = models.SubdomainResolved
+	case models.LastResolved:
+		eventType = models.SubdomainUnresolved
+	case models.UnresolvedSubdomain:
+		if source == DnsxJob {
+			eventType = models.SubdomainUnresolved
+		}
+	}
+
+	recordEvent(models.Event{
+		Type:      eventType,
+		Domain:    sub.Domain,
+		Subdomain: sub.Name,
+		Before:    transition.From,
+		After:     transition.To,
+		Reason:    transition.Reason,
+		Source:    string(source),
+		JobID:     jobID,
+		Timestamp: bson.NewDateTimeFromTime(now),
+	})
+
+	return nil
+}
+
+// applyHTTPTransition stores a changed http status of a subdomain and records it in the timeline
+func applyHTTPTransition(ctx context.Context, sub models.Subdomain, transition models.Transition, source JobType, jobID bson.ObjectID, now time.Time) error {
+	if !transition.Changed() {
+		return nil
+	}
+
+	_, err := storage.GetStore().Subdomains.Update(ctx, sub.Domain, sub.Name, func(stored *models.Subdomain) error {
+		stored.HTTPStatus = transition.To
+		stored.HTTPStatusReason = transition.Reason
+		stored.HTTPStatusChangedAt = bson.NewDateTimeFromTime(now)
+		stored.UpdatedAt = bson.NewDateTimeFromTime(now)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordEvent(models.Event{
+		Type:      models.HTTPStatusChanged,
+		Domain:    sub.Domain,
+		Subdomain: sub.Name,
+		Before:    transition.From,
+		After:     transition.To,
+		Reason:    transition.Reason,
+		Source:    string(source),
+		JobID:     jobID,
+		Timestamp: bson.NewDateTimeFromTime(now),
+	})
+
+	return nil
+}
+
+// statusChangedAt returns when a status was set, falling back to the creation
+// of the subdomain for documents written before status changes were tracked
+func statusChangedAt(changedAt, createdAt bson.DateTime) time.Time {
+	if changedAt != 0 {
+		return changedAt.Time()
+	}
+	return createdAt.Time()
+}
+
+// statusAgingTask moves fresh and changed statuses whose freshness window elapsed to their aged status
+func statusAgingTask(config Config) error {
+	log.Println("Running status aging task")
+
+	ctx := context.Background()
+	windows := config.FreshnessWindows()
+	jobID := runningJobID(StatusAgingJob)
+	now := time.Now()
+
+	// Find all subdomains with a status that can age
+	subdomains, err := storage.GetStore().Subdomains.List(ctx, storage.SubdomainFilter{Statuses: models.AgingStatuses})
+	if err != nil {
+		return fmt.Errorf("failed to fetch subdomains: %v", err)
+	}
+
+	for _, sub := range subdomains {
+		dnsTransition := models.AgeStatus(sub.DNSStatus, statusChangedAt(sub.DNSStatusChangedAt, sub.CreatedAt), now, windows)
+		if err := applyDNSTransition(ctx, sub, dnsTransition, StatusAgingJob, jobID, now); err != nil {
+			log.Printf("failed to age dns status of %s: %v", sub.Name, err)
+		}
+
+		httpTransition := models.AgeStatus(sub.HTTPStatus, statusChangedAt(sub.HTTPStatusChangedAt, sub.CreatedAt), now, windows)
+		if err := applyHTTPTransition(ctx, sub, httpTransition, StatusAgingJob, jobID, now); err != nil {
+			log.Printf("failed to age http status of %s: %v", sub.Name, err)
+		}
+	}
+
+	return nil
+}
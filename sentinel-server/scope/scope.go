@@ -0,0 +1,117 @@
+package scope
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// Match reports whether a name is covered by a scope pattern.
+// A wildcard pattern like "*.example.com" covers example.com and all its subdomains,
+// any other pattern only covers the exact name.
+func Match(pattern, name string) bool {
+	pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if pattern == "" || name == "" {
+		return false
+	}
+
+	if base, ok := strings.CutPrefix(pattern, "*."); ok {
+		return name == base || strings.HasSuffix(name, "."+base)
+	}
+	return name == pattern
+}
+
+// hostnames maps names the way lookups do, e.g. it lowercases them, and encodes their unicode labels
+// with punycode. Empty and overlong labels are rejected, underscores are allowed since records like
+// _dmarc.example.com are common.
+var hostnames = idna.New(idna.MapForLookup(), idna.Transitional(false), idna.StrictDomainName(false), idna.VerifyDNSLength(true))
+
+// Normalize returns a name the way it is stored: trimmed, without the trailing dot of a fully
+// qualified name, lowercase and with its unicode labels in punycode, e.g. "Bücher.Example.com."
+// -> "xn--bcher-kva.example.com". It fails for names that can't be encoded.
+func Normalize(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	return hostnames.ToASCII(name)
+}
+
+// Owns reports whether a name is one of the seeds of a domain or a subdomain of one of them
+func Owns(seeds []string, name string) bool {
+	return slices.ContainsFunc(seeds, func(seed string) bool {
+		return Match("*."+seed, name)
+	})
+}
+
+// MatchAny reports whether any of the patterns covers the name
+func MatchAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return Match(pattern, name)
+	})
+}
+
+// Rules returns the in scope and out of scope patterns of a domain,
+// including the rules it shares with the other domains of its program
+func Rules(domain models.Domain, program *models.Program) (inScope []string, outOfScope []string) {
+	inScope = slices.Clone(domain.InScope)
+	outOfScope = slices.Clone(domain.OutOfScope)
+	if program != nil {
+		inScope = append(inScope, program.InScope...)
+		outOfScope = append(outOfScope, program.OutOfScope...)
+	}
+	return inScope, outOfScope
+}
+
+// Effective returns the rules that decide which subdomains a domain keeps: the rules of the domain
+// and its program. A domain without in scope rules, its own or its program's, covers all its subdomains.
+func Effective(domain models.Domain, program *models.Program) (inScope []string, outOfScope []string) {
+	inScope, outOfScope = Rules(domain, program)
+	if len(inScope) == 0 {
+		inScope = []string{"*." + domain.Name}
+	}
+	return inScope, outOfScope
+}
+
+// InScope reports whether a name is covered by the in scope patterns and not excluded by the out of scope ones
+func InScope(name string, inScope, outOfScope []string) bool {
+	return MatchAny(inScope, name) && !MatchAny(outOfScope, name)
+}
+
+// Apex returns the registrable domain (eTLD+1) of a name or scope pattern using the public suffix list,
+// e.g. "*.api.azure.com" -> "azure.com". It returns false for names that don't have one.
+func Apex(pattern string) (string, bool) {
+	name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || strings.Contains(name, "*") {
+		return "", false
+	}
+
+	apex, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return "", false
+	}
+	return apex, true
+}
+
+// Seeds returns the apex domains to enumerate for a domain: the domain itself followed by every distinct
+// registrable apex derived from its wildcard in scope patterns (and its program's). Exact names don't
+// derive a seed, and apexes that are domains of their own, one of stored, are left to them.
+func Seeds(domain models.Domain, program *models.Program, stored []string) []string {
+	seeds := []string{domain.Name}
+
+	inScope, _ := Rules(domain, program)
+	for _, pattern := range inScope {
+		if !strings.HasPrefix(strings.TrimSpace(pattern), "*.") {
+			continue
+		}
+		apex, ok := Apex(pattern)
+		if ok && !slices.Contains(seeds, apex) && !slices.Contains(stored, apex) {
+			seeds = append(seeds, apex)
+		}
+	}
+
+	return seeds
+}
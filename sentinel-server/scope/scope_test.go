@@ -0,0 +1,121 @@
+package scope
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.microsoft.com", "www.microsoft.com", true},
+		{"*.microsoft.com", "a.b.microsoft.com", true},
+		{"*.microsoft.com", "microsoft.com", true},
+		{"*.microsoft.com", "evilmicrosoft.com", false},
+		{"internal.microsoft.com", "internal.microsoft.com.", true},
+		{"internal.microsoft.com", "www.internal.microsoft.com", false},
+		{"*.Azure.com", "portal.azure.COM", true},
+	}
+
+	for _, test := range tests {
+		if got := Match(test.pattern, test.name); got != test.expected {
+			t.Errorf("Match(%q, %q) = %v, expected %v", test.pattern, test.name, got, test.expected)
+		}
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	domain := models.Domain{
+		Name:    "microsoft.com",
+		InScope: []string{"*.microsoft.com", "*.azure.com", "*.api.azure.com", "*.contoso.co.uk", "login.live.com", "*"},
+	}
+	program := &models.Program{InScope: []string{"*.xbox.com", "*.github.com"}}
+
+	// github.com is a domain of its own, its subdomains are enumerated for it
+	expected := []string{"microsoft.com", "azure.com", "contoso.co.uk", "xbox.com"}
+	if seeds := Seeds(domain, program, []string{"microsoft.com", "github.com"}); !slices.Equal(seeds, expected) {
+		t.Fatalf("Seeds() = %v, expected %v", seeds, expected)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	domain := models.Domain{Name: "example.com", InScope: []string{"*.example.org"}, OutOfScope: []string{"admin.example.com"}}
+	program := &models.Program{OutOfScope: []string{"*.corp.example.com"}}
+
+	inScope, outOfScope := Effective(domain, program)
+	tests := map[string]bool{
+		"www.example.com":      false,
+		"www.example.org":      true,
+		"admin.example.com":    false,
+		"vpn.corp.example.com": false,
+		"example.net":          false,
+	}
+	for name, expected := range tests {
+		if got := InScope(name, inScope, outOfScope); got != expected {
+			t.Errorf("InScope(%q) = %v, expected %v", name, got, expected)
+		}
+	}
+
+	// without in scope rules the domain covers its subdomains, the out of scope rules still apply
+	domain.InScope = nil
+	inScope, outOfScope = Effective(domain, program)
+	tests = map[string]bool{
+		"www.example.com":      true,
+		"www.example.org":      false,
+		"admin.example.com":    false,
+		"vpn.corp.example.com": false,
+	}
+	for name, expected := range tests {
+		if got := InScope(name, inScope, outOfScope); got != expected {
+			t.Errorf("InScope(%q) without in scope rules = %v, expected %v", name, got, expected)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		valid    bool
+	}{
+		{"WWW.Example.COM", "www.example.com", true},
+		{" api.example.com. ", "api.example.com", true},
+		{"Bücher.example.com", "xn--bcher-kva.example.com", true},
+		{"xn--bcher-kva.example.com", "xn--bcher-kva.example.com", true},
+		{"_dmarc.example.com", "_dmarc.example.com", true},
+		{"a..example.com", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := Normalize(test.name)
+		if (err == nil) != test.valid || (test.valid && got != test.expected) {
+			t.Errorf("Normalize(%q) = %q, %v, expected %q", test.name, got, err, test.expected)
+		}
+	}
+}
+
+func TestOwns(t *testing.T) {
+	seeds := []string{"microsoft.com", "azure.com"}
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"microsoft.com", true},
+		{"www.microsoft.com", true},
+		{"portal.azure.com", true},
+		{"evil.com", false},
+		{"evilmicrosoft.com", false},
+		{"microsoft.com.evil.com", false},
+	}
+
+	for _, test := range tests {
+		if got := Owns(seeds, test.name); got != test.expected {
+			t.Errorf("Owns(%v, %q) = %v, expected %v", seeds, test.name, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Filter compiles the terms reading from the sources into a mongo query. It runs on documents
+// shaped like a subdomain with its latest snapshots joined in as dns and http.
+func (q Query) Filter(sources ...Source) bson.M {
+	and := bson.A{}
+	for _, term := range q.Terms {
+		for _, source := range sources {
+			if term.field.source == source {
+				and = append(and, term.filter())
+			}
+		}
+	}
+	if len(and) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": and}
+}
+
+// filter compiles a term, array fields match if any of their values does
+func (t Term) filter() bson.M {
+	var condition any
+	switch t.field.kind {
+	case exactKind:
+		condition = t.Value
+		if t.Negated {
+			return bson.M{t.field.path: bson.M{"$ne": condition}}
+		}
+	case numberKind:
+		condition = t.number
+		if op, ok := map[string]string{">": "$gt", ">=": "$gte", "<": "$lt", "<=": "$lte"}[t.op]; ok {
+			condition = bson.M{op: t.number}
+		} else if t.Negated {
+			return bson.M{t.field.path: bson.M{"$ne": condition}}
+		}
+	default:
+		condition = bson.Regex{Pattern: t.pattern, Options: "i"}
+	}
+
+	if t.Negated {
+		condition = bson.M{"$not": condition}
+	}
+	return bson.M{t.field.path: condition}
+}
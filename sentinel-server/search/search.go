@@ -0,0 +1,274 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// Source is the record a search field is read from
+type Source int
+
+const (
+	SubdomainSource Source = iota
+	// the latest dns snapshot of the subdomain
+	DNSSource
+	// the latest http snapshot of the subdomain
+	HTTPSource
+)
+
+// Result is a subdomain along with its latest dns and http snapshots, if it has any
+type Result struct {
+	Subdomain models.Subdomain `json:"subdomain" bson:"subdomain"`
+	DNS       *models.DNS      `json:"dns,omitempty" bson:"dns,omitempty"`
+	HTTP      *models.HTTP     `json:"http,omitempty" bson:"http,omitempty"`
+}
+
+type kind int
+
+const (
+	// the whole value, * matches any run of characters
+	globKind kind = iota
+	// a part of the value, or the whole value if the pattern has a *
+	containsKind
+	// a technology name, the version detected with it is optional
+	techKind
+	// the exact value
+	exactKind
+	// a number, optionally compared with >, >=, < or <=
+	numberKind
+)
+
+// field is a field a query can search, path is where mongo finds it in a result
+type field struct {
+	source Source
+	path   string
+	kind   kind
+	values func(Result) []string
+}
+
+var fields = map[string]field{
+	"name":        {SubdomainSource, "name", globKind, func(r Result) []string { return []string{r.Subdomain.Name} }},
+	"domain":      {SubdomainSource, "domain", globKind, func(r Result) []string { return []string{r.Subdomain.Domain} }},
+	"seed":        {SubdomainSource, "seed", globKind, func(r Result) []string { return nonEmpty(r.Subdomain.Seed) }},
+	"provider":    {SubdomainSource, "providers", exactKind, func(r Result) []string { return r.Subdomain.Providers }},
+	"tag":         {SubdomainSource, "tags", exactKind, func(r Result) []string { return r.Subdomain.Tags }},
+	"dns_status":  {SubdomainSource, "dns_status", exactKind, func(r Result) []string { return nonEmpty(string(r.Subdomain.DNSStatus)) }},
+	"http_status": {SubdomainSource, "http_status", exactKind, func(r Result) []string { return nonEmpty(string(r.Subdomain.HTTPStatus)) }},
+
+	"a":     {DNSSource, "dns.a_records", globKind, dnsValues(func(d *models.DNS) []string { return d.ARecords })},
+	"aaaa":  {DNSSource, "dns.aaaa_records", globKind, dnsValues(func(d *models.DNS) []string { return d.AAAARecords })},
+	"cname": {DNSSource, "dns.cname_records", globKind, dnsValues(func(d *models.DNS) []string { return d.CnameRecords })},
+	"ns":    {DNSSource, "dns.ns_records", globKind, dnsValues(func(d *models.DNS) []string { return d.NSRecords })},
+	"mx":    {DNSSource, "dns.mx_records", globKind, dnsValues(func(d *models.DNS) []string { return d.MXRecords })},
+	"ptr":   {DNSSource, "dns.ptr_records", globKind, dnsValues(func(d *models.DNS) []string { return d.PTRRecords })},
+	"txt":   {DNSSource, "dns.txt_records", containsKind, dnsValues(func(d *models.DNS) []string { return d.TXTRecords })},
+
+	"status":   {HTTPSource, "http.status_code", numberKind, httpValues(func(h *models.HTTP) []string { return []string{strconv.Itoa(h.StatusCode)} })},
+	"title":    {HTTPSource, "http.title", containsKind, httpValues(func(h *models.HTTP) []string { return nonEmpty(h.Title) })},
+	"tech":     {HTTPSource, "http.technologies", techKind, httpValues(func(h *models.HTTP) []string { return h.Technologies })},
+	"cdn":      {HTTPSource, "http.cdn_name", globKind, httpValues(func(h *models.HTTP) []string { return nonEmpty(h.CDNName) })},
+	"port":     {HTTPSource, "http.port", exactKind, httpValues(func(h *models.HTTP) []string { return nonEmpty(h.Port) })},
+	"location": {HTTPSource, "http.location", containsKind, httpValues(func(h *models.HTTP) []string { return nonEmpty(h.Location) })},
+}
+
+// Fields returns the names of the fields a query can search, sorted
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Term is a single condition of a query, like tech:nginx or -status:200
+type Term struct {
+	Field   string
+	Value   string
+	Negated bool
+
+	field field
+	// the regex glob, contains and tech terms match with, case insensitive
+	pattern string
+	regex   *regexp.Regexp
+	// the comparison and number of number terms
+	op     string
+	number int
+}
+
+// Query is a parsed search query, a result has to match all of its terms
+type Query struct {
+	Terms []Term
+}
+
+// Parse parses a query made of space separated field:value terms. Values with spaces are quoted,
+// a leading - negates a term and a bare word searches the subdomain names.
+func Parse(input string) (Query, error) {
+	query := Query{}
+
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		negated := false
+		if strings.HasPrefix(rest, "-") {
+			negated, rest = true, rest[1:]
+		}
+
+		// a term is an optional field followed by a value, which might be quoted
+		name := ""
+		if i := strings.IndexAny(rest, ": \""); i > 0 && rest[i] == ':' {
+			name, rest = strings.ToLower(rest[:i]), rest[i+1:]
+		}
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return query, errors.New("unterminated quote")
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		term, err := newTerm(name, value, negated)
+		if err != nil {
+			return query, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+
+	return query, nil
+}
+
+func newTerm(name, value string, negated bool) (Term, error) {
+	// bare words search the subdomain names
+	bare := name == ""
+	if bare {
+		name = "name"
+	}
+
+	f, ok := fields[name]
+	if !ok {
+		return Term{}, fmt.Errorf("unknown field %q", name)
+	}
+	if value == "" {
+		return Term{}, fmt.Errorf("missing value for %s", name)
+	}
+	if bare {
+		f.kind = containsKind
+	}
+
+	term := Term{Field: name, Value: value, Negated: negated, field: f}
+	switch f.kind {
+	case globKind:
+		term.pattern = "^" + globRegex(value) + "$"
+	case containsKind:
+		term.pattern = regexp.QuoteMeta(value)
+		if strings.Contains(value, "*") {
+			term.pattern = "^" + globRegex(value) + "$"
+		}
+	case techKind:
+		term.pattern = "^" + globRegex(value) + "(:.*)?$"
+	case numberKind:
+		digits := strings.TrimLeft(value, "<>=")
+		number, err := strconv.Atoi(digits)
+		if err != nil {
+			return Term{}, fmt.Errorf("%s must be a number, optionally prefixed with >, >=, < or <=", name)
+		}
+		term.op, term.number = value[:len(value)-len(digits)], number
+		if !slices.Contains([]string{"", ">", ">=", "<", "<="}, term.op) {
+			return Term{}, fmt.Errorf("invalid comparison %q for %s", term.op, name)
+		}
+	}
+	if term.pattern != "" {
+		term.regex = regexp.MustCompile("(?i)" + term.pattern)
+	}
+
+	return term, nil
+}
+
+// Needs reports whether any term reads from the source
+func (q Query) Needs(source Source) bool {
+	return slices.ContainsFunc(q.Terms, func(term Term) bool {
+		return term.field.source == source
+	})
+}
+
+// Match reports whether the result matches all terms of the query
+func (q Query) Match(result Result) bool {
+	for _, term := range q.Terms {
+		if term.Match(result) == term.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether any value of the field matches the term, ignoring its negation
+func (t Term) Match(result Result) bool {
+	return slices.ContainsFunc(t.field.values(result), t.matchValue)
+}
+
+func (t Term) matchValue(value string) bool {
+	switch t.field.kind {
+	case exactKind:
+		return value == t.Value
+	case numberKind:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return false
+		}
+		switch t.op {
+		case ">":
+			return number > t.number
+		case ">=":
+			return number >= t.number
+		case "<":
+			return number < t.number
+		case "<=":
+			return number <= t.number
+		}
+		return number == t.number
+	}
+	return t.regex.MatchString(value)
+}
+
+// globRegex quotes a glob pattern for a regex, keeping * as a wildcard
+func globRegex(pattern string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func dnsValues(values func(*models.DNS) []string) func(Result) []string {
+	return func(r Result) []string {
+		if r.DNS == nil {
+			return nil
+		}
+		return values(r.DNS)
+	}
+}
+
+func httpValues(values func(*models.HTTP) []string) func(Result) []string {
+	return func(r Result) []string {
+		if r.HTTP == nil {
+			return nil
+		}
+		return values(r.HTTP)
+	}
+}
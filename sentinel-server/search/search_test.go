@@ -0,0 +1,103 @@
+package search
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+func TestParse(t *testing.T) {
+	query, err := Parse(`tech:nginx -status:>=400 title:"admin login" api`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := []Term{
+		{Field: "tech", Value: "nginx"},
+		{Field: "status", Value: ">=400", Negated: true},
+		{Field: "title", Value: "admin login"},
+		{Field: "name", Value: "api"},
+	}
+	if len(query.Terms) != len(expected) {
+		t.Fatalf("parsed %d terms, expected %d", len(query.Terms), len(expected))
+	}
+	for i, term := range query.Terms {
+		if term.Field != expected[i].Field || term.Value != expected[i].Value || term.Negated != expected[i].Negated {
+			t.Errorf("term %d = %+v, expected %+v", i, term, expected[i])
+		}
+	}
+
+	for _, input := range []string{"color:red", `title:"login`, "status:ok", "status:=>200", "tech:"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	result := Result{
+		Subdomain: models.Subdomain{Name: "api.example.com", DNSStatus: models.FreshResolved},
+		DNS:       &models.DNS{CnameRecords: []string{"api.azurewebsites.net"}},
+		HTTP:      &models.HTTP{StatusCode: 200, Title: "Admin Login", Technologies: []string{"Nginx:1.25", "PHP"}},
+	}
+
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{`tech:nginx status:200 title:"login" cname:*.azurewebsites.net dns_status:fresh_resolved`, true},
+		{"tech:ngin", false},
+		{"tech:nginx:1.*", true},
+		{"status:<300 -status:201", true},
+		{"-title:admin", false},
+		{"api.example", true},
+		{"name:api.example", false},
+		{"a:10.*", false},
+		{"-a:10.*", true},
+	}
+	for _, test := range tests {
+		query, err := Parse(test.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", test.query, err)
+		}
+		if got := query.Match(result); got != test.expected {
+			t.Errorf("Match(%q) = %v, expected %v", test.query, got, test.expected)
+		}
+	}
+
+	// without snapshots only negated terms on them match
+	query, _ := Parse("-status:200 -tech:nginx")
+	if !query.Match(Result{}) {
+		t.Errorf("expected negated terms to match a result without snapshots")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	query, err := Parse("dns_status:fresh_resolved -status:200 tech:nginx")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	subdomain := query.Filter(SubdomainSource)
+	expected := bson.M{"$and": bson.A{bson.M{"dns_status": "fresh_resolved"}}}
+	if !equal(subdomain, expected) {
+		t.Errorf("subdomain filter = %v, expected %v", subdomain, expected)
+	}
+
+	joined := query.Filter(DNSSource, HTTPSource)
+	expected = bson.M{"$and": bson.A{
+		bson.M{"http.status_code": bson.M{"$ne": 200}},
+		bson.M{"http.technologies": bson.Regex{Pattern: `^nginx(:.*)?$`, Options: "i"}},
+	}}
+	if !equal(joined, expected) {
+		t.Errorf("joined filter = %v, expected %v", joined, expected)
+	}
+}
+
+func equal(a, b bson.M) bool {
+	x, _ := bson.MarshalExtJSON(a, true, false)
+	y, _ := bson.MarshalExtJSON(b, true, false)
+	return string(x) == string(y)
+}
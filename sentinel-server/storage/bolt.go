@@ -0,0 +1,1187 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/search"
+)
+
+// The bolt backend keeps every collection in a bucket of documents encoded as bson.
+// Keys are built from the natural keys of the documents so that related documents
+// are next to each other and can be found with a prefix scan:
+//
+//	domains, programs   name
+//	subdomains          domain \x00 name
+//	dns, http           domain \x00 subdomain \x00 date \x00 sequence
+//	jobs, events        object id
+//	rollups             domain \x00 date, the global rollups have an empty domain
+//
+// Change functions given to Update run inside a write transaction and must not use the store.
+
+var (
+	domainsBucket    = []byte("domains")
+	subdomainsBucket = []byte("subdomains")
+	dnsBucket        = []byte("dns")
+	httpBucket       = []byte("http")
+	jobsBucket       = []byte("jobs")
+	eventsBucket     = []byte("events")
+	programsBucket   = []byte("programs")
+	rollupsBucket    = []byte("rollups")
+)
+
+// OpenBoltStore opens, or creates, the bolt file at path and returns a store keeping its data in it
+func OpenBoltStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{domainsBucket, subdomainsBucket, dnsBucket, httpBucket, jobsBucket, eventsBucket, programsBucket, rollupsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{
+		Backend:    BoltBackend,
+		Domains:    &boltDomains{db: db},
+		Subdomains: &boltSubdomains{db: db},
+		DNS:        &boltDNS{db: db},
+		HTTP:       &boltHTTP{db: db},
+		Jobs:       &boltJobs{db: db},
+		Events:     &boltEvents{db: db},
+		Rollups:    &boltRollups{db: db},
+		Programs:   &boltPrograms{db: db},
+		Cascades:   &boltCascades{db: db},
+		Search:     &boltSearcher{db: db},
+		close:      db.Close,
+	}, nil
+}
+
+// key joins the parts of a key with a separator that can't appear in names
+func key(parts ...string) []byte {
+	return []byte(strings.Join(parts, "\x00"))
+}
+
+// prefix returns the key prefix of every document under the given parts
+func prefix(parts ...string) []byte {
+	return append(key(parts...), 0)
+}
+
+// dateKey encodes a date so that its bytes sort like the date
+func dateKey(date bson.DateTime) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, uint64(date)^(1<<63))
+	return encoded
+}
+
+func boltGet[T any](bucket *bolt.Bucket, k []byte) (T, error) {
+	var document T
+	value := bucket.Get(k)
+	if value == nil {
+		return document, ErrNotFound
+	}
+	return document, bson.Unmarshal(value, &document)
+}
+
+func boltPut(bucket *bolt.Bucket, k []byte, document any) error {
+	value, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(k, value)
+}
+
+// boltScan decodes the documents under a prefix in key order, or in reverse order if reverse is set,
+// until visit returns false
+func boltScan[T any](bucket *bolt.Bucket, p []byte, reverse bool, visit func(k []byte, document T) bool) error {
+	cursor := bucket.Cursor()
+
+	var k, v []byte
+	next := cursor.Next
+	if reverse {
+		next = cursor.Prev
+		// position the cursor on the last key under the prefix
+		if end := prefixEnd(p); end == nil {
+			k, v = cursor.Last()
+		} else if k, v = cursor.Seek(end); k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+	} else {
+		k, v = cursor.Seek(p)
+	}
+
+	for ; k != nil && bytes.HasPrefix(k, p); k, v = next() {
+		var document T
+		if err := bson.Unmarshal(v, &document); err != nil {
+			return err
+		}
+		if !visit(k, document) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// prefixEnd returns the first key after every key under the prefix, nil if there is none
+func prefixEnd(p []byte) []byte {
+	end := slices.Clone(p)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// boltDeleteMatching deletes the documents match returns true for and returns how many there were,
+// a dry run only counts them
+func boltDeleteMatching[T any](bucket *bolt.Bucket, dryRun bool, match func(document T) bool) (int64, error) {
+	keys := make([][]byte, 0)
+	err := boltScan(bucket, nil, false, func(k []byte, document T) bool {
+		if match(document) {
+			keys = append(keys, slices.Clone(k))
+		}
+		return true
+	})
+	if err != nil || dryRun {
+		return int64(len(keys)), err
+	}
+
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+// boltDeletePrefix deletes every key under a prefix
+func boltDeletePrefix(bucket *bolt.Bucket, p []byte) error {
+	keys := make([][]byte, 0)
+	cursor := bucket.Cursor()
+	for k, _ := cursor.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = cursor.Next() {
+		keys = append(keys, slices.Clone(k))
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type boltDomains struct {
+	db *bolt.DB
+}
+
+func (r *boltDomains) Get(ctx context.Context, name string) (domain models.Domain, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		domain, err = boltGet[models.Domain](tx.Bucket(domainsBucket), key(name))
+		return err
+	})
+	return domain, err
+}
+
+func (r *boltDomains) List(ctx context.Context, filter DomainFilter) ([]models.Domain, error) {
+	domains := make([]models.Domain, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(domainsBucket), nil, false, func(_ []byte, domain models.Domain) bool {
+			if matchDomain(filter, domain) {
+				domains = append(domains, domain)
+			}
+			return true
+		})
+	})
+	return domains, err
+}
+
+func (r *boltDomains) Create(ctx context.Context, domain models.Domain) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(domainsBucket)
+		if bucket.Get(key(domain.Name)) != nil {
+			return ErrExists
+		}
+		return boltPut(bucket, key(domain.Name), domain)
+	})
+}
+
+func (r *boltDomains) Update(ctx context.Context, name string, change func(*models.Domain) error) (domain models.Domain, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(domainsBucket)
+		if domain, err = boltGet[models.Domain](bucket, key(name)); err != nil {
+			return err
+		}
+		if err := change(&domain); err != nil {
+			return err
+		}
+		domain.Name = name
+		return boltPut(bucket, key(name), domain)
+	})
+	return domain, err
+}
+
+func (r *boltDomains) Delete(ctx context.Context, name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(domainsBucket)
+		if bucket.Get(key(name)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete(key(name))
+	})
+}
+
+type boltSubdomains struct {
+	db *bolt.DB
+}
+
+func (r *boltSubdomains) Get(ctx context.Context, domain, name string) (subdomain models.Subdomain, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		subdomain, err = boltGet[models.Subdomain](tx.Bucket(subdomainsBucket), key(domain, name))
+		return err
+	})
+	return subdomain, err
+}
+
+func (r *boltSubdomains) Existing(ctx context.Context, domain string, names []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subdomainsBucket)
+		for _, name := range names {
+			if bucket.Get(key(domain, name)) != nil {
+				existing[name] = true
+			}
+		}
+		return nil
+	})
+	return existing, err
+}
+
+func (r *boltSubdomains) List(ctx context.Context, filter SubdomainFilter) ([]models.Subdomain, error) {
+	var p []byte
+	if filter.Domain != "" {
+		p = prefix(filter.Domain)
+	}
+
+	subdomains := make([]models.Subdomain, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(subdomainsBucket), p, false, func(_ []byte, subdomain models.Subdomain) bool {
+			if matchSubdomain(filter, subdomain) {
+				subdomains = append(subdomains, subdomain)
+			}
+			return true
+		})
+	})
+	return subdomains, err
+}
+
+func (r *boltSubdomains) Page(ctx context.Context, page SubdomainPage) ([]models.Subdomain, error) {
+	subdomains, err := r.List(ctx, page.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// sort by the value, domain and name and keep what comes after the cursor
+	compare := func(a, b SubdomainCursor) int {
+		if page.Descending {
+			return compareCursors(b, a)
+		}
+		return compareCursors(a, b)
+	}
+	slices.SortFunc(subdomains, func(a, b models.Subdomain) int {
+		return compare(CursorOf(page.Sort, a), CursorOf(page.Sort, b))
+	})
+	if page.After != nil {
+		start, _ := slices.BinarySearchFunc(subdomains, *page.After, func(subdomain models.Subdomain, after SubdomainCursor) int {
+			if compare(CursorOf(page.Sort, subdomain), after) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		subdomains = subdomains[start:]
+	}
+	if page.Limit > 0 && len(subdomains) > page.Limit {
+		subdomains = subdomains[:page.Limit]
+	}
+	return subdomains, nil
+}
+
+func (r *boltSubdomains) Create(ctx context.Context, subdomains ...models.Subdomain) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subdomainsBucket)
+		for _, subdomain := range subdomains {
+			if bucket.Get(key(subdomain.Domain, subdomain.Name)) != nil {
+				return ErrExists
+			}
+			if err := boltPut(bucket, key(subdomain.Domain, subdomain.Name), subdomain); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *boltSubdomains) Update(ctx context.Context, domain, name string, change func(*models.Subdomain) error) (subdomain models.Subdomain, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subdomainsBucket)
+		if subdomain, err = boltGet[models.Subdomain](bucket, key(domain, name)); err != nil {
+			return err
+		}
+		if err := change(&subdomain); err != nil {
+			return err
+		}
+		subdomain.Domain, subdomain.Name = domain, name
+		return boltPut(bucket, key(domain, name), subdomain)
+	})
+	return subdomain, err
+}
+
+func (r *boltSubdomains) Delete(ctx context.Context, domain, name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subdomainsBucket)
+		if bucket.Get(key(domain, name)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete(key(domain, name))
+	})
+}
+
+func (r *boltSubdomains) DeleteAll(ctx context.Context, domain string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return boltDeletePrefix(tx.Bucket(subdomainsBucket), prefix(domain))
+	})
+}
+
+func (r *boltSubdomains) UpdateMany(ctx context.Context, filter SubdomainFilter, changes SubdomainChanges) (BulkUpdate, error) {
+	var p []byte
+	if filter.Domain != "" {
+		p = prefix(filter.Domain)
+	}
+
+	result := BulkUpdate{WatchChanged: make([]models.Subdomain, 0)}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subdomainsBucket)
+
+		changed := make([]models.Subdomain, 0)
+		err := boltScan(bucket, p, false, func(_ []byte, subdomain models.Subdomain) bool {
+			if !matchSubdomain(filter, subdomain) {
+				return true
+			}
+			result.Matched++
+			before := subdomain
+			if changes.Apply(&subdomain) {
+				changed = append(changed, subdomain)
+				if before.WatchDNS != subdomain.WatchDNS || before.WatchHTTP != subdomain.WatchHTTP {
+					result.WatchChanged = append(result.WatchChanged, before)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, subdomain := range changed {
+			if err := boltPut(bucket, key(subdomain.Domain, subdomain.Name), subdomain); err != nil {
+				return err
+			}
+		}
+		result.Updated = int64(len(changed))
+		return nil
+	})
+	return result, err
+}
+
+func (r *boltSubdomains) SetArchivedAt(ctx context.Context, domain string, from, to bson.DateTime) (updated int64, err error) {
+	now := bson.NewDateTimeFromTime(time.Now())
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subdomainsBucket)
+
+		moved := make([]models.Subdomain, 0)
+		err := boltScan(bucket, prefix(domain), false, func(_ []byte, subdomain models.Subdomain) bool {
+			if subdomain.ArchivedAt == from {
+				moved = append(moved, subdomain)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, subdomain := range moved {
+			subdomain.ArchivedAt, subdomain.UpdatedAt = to, now
+			if err := boltPut(bucket, key(domain, subdomain.Name), subdomain); err != nil {
+				return err
+			}
+		}
+		updated = int64(len(moved))
+		return nil
+	})
+	return updated, err
+}
+
+func (r *boltSubdomains) Stats(ctx context.Context, domains ...string) (SubdomainStats, error) {
+	stats := newSubdomainStats()
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(subdomainsBucket), nil, false, func(_ []byte, subdomain models.Subdomain) bool {
+			if subdomain.ArchivedAt != 0 || len(domains) > 0 && !slices.Contains(domains, subdomain.Domain) {
+				return true
+			}
+			stats.Total++
+			stats.PerDomain[subdomain.Domain]++
+			stats.DNSStatus[statusKey(subdomain.DNSStatus)]++
+			stats.HTTPStatus[statusKey(subdomain.HTTPStatus)]++
+			return true
+		})
+	})
+	return stats, err
+}
+
+func (r *boltSubdomains) Assets(ctx context.Context, since time.Time, domains ...string) (AssetStats, error) {
+	stats := newAssetStats()
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var scanErr error
+		err := boltScan(tx.Bucket(subdomainsBucket), nil, false, func(_ []byte, subdomain models.Subdomain) bool {
+			if subdomain.ArchivedAt != 0 || len(domains) > 0 && !slices.Contains(domains, subdomain.Domain) {
+				return true
+			}
+			for _, provider := range subdomain.Providers {
+				stats.Providers[provider]++
+			}
+			if !subdomain.CreatedAt.Time().Before(since) {
+				stats.Discovered[dayKey(subdomain.CreatedAt)]++
+			}
+
+			var latest *models.HTTP
+			if latest, scanErr = boltLatest[models.HTTP](tx.Bucket(httpBucket), subdomain.Domain, subdomain.Name); scanErr != nil {
+				return false
+			}
+			if latest != nil {
+				for _, technology := range latest.Technologies {
+					stats.Technologies[technology]++
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return scanErr
+	})
+	return stats, err
+}
+
+func (r *boltSubdomains) Discovered(ctx context.Context, since time.Time, domains ...string) (map[string]int, error) {
+	discovered := make(map[string]int)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(subdomainsBucket), nil, false, func(_ []byte, subdomain models.Subdomain) bool {
+			if subdomain.ArchivedAt != 0 || len(domains) > 0 && !slices.Contains(domains, subdomain.Domain) {
+				return true
+			}
+			if !subdomain.CreatedAt.Time().Before(since) {
+				discovered[dayKey(subdomain.CreatedAt)]++
+			}
+			return true
+		})
+	})
+	return discovered, err
+}
+
+// boltSnapshots implements the dns and http repositories, date returns the date a snapshot is ordered by
+// and lastSeen the date it was last seen on
+type boltSnapshots[T any] struct {
+	db       *bolt.DB
+	bucket   []byte
+	names    func(T) (domain string, subdomain string)
+	date     func(T) bson.DateTime
+	lastSeen func(T) bson.DateTime
+}
+
+func (r *boltSnapshots[T]) Latest(ctx context.Context, domain, subdomain string) (T, error) {
+	history, err := r.History(ctx, domain, subdomain, 1)
+	if err != nil || len(history) == 0 {
+		var zero T
+		if err == nil {
+			err = ErrNotFound
+		}
+		return zero, err
+	}
+	return history[0], nil
+}
+
+func (r *boltSnapshots[T]) History(ctx context.Context, domain, subdomain string, limit int) ([]T, error) {
+	history := make([]T, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(r.bucket), prefix(domain, subdomain), true, func(_ []byte, record T) bool {
+			history = append(history, record)
+			return limit <= 0 || len(history) < limit
+		})
+	})
+	return history, err
+}
+
+func (r *boltSnapshots[T]) Insert(ctx context.Context, record T) error {
+	domain, subdomain := r.names(record)
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(r.bucket)
+
+		// the sequence keeps snapshots with the same date apart
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		k := append(prefix(domain, subdomain), dateKey(r.date(record))...)
+		k = binary.BigEndian.AppendUint64(append(k, 0), sequence)
+
+		return boltPut(bucket, k, record)
+	})
+}
+
+func (r *boltSnapshots[T]) Replace(ctx context.Context, record T) error {
+	domain, subdomain := r.names(record)
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(r.bucket)
+
+		var found []byte
+		p := append(prefix(domain, subdomain), dateKey(r.date(record))...)
+		err := boltScan(bucket, append(p, 0), false, func(k []byte, _ T) bool {
+			found = slices.Clone(k)
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			return ErrNotFound
+		}
+
+		return boltPut(bucket, found, record)
+	})
+}
+
+func (r *boltSnapshots[T]) Delete(ctx context.Context, domain, subdomain string) error {
+	p := prefix(domain)
+	if subdomain != "" {
+		p = prefix(domain, subdomain)
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return boltDeletePrefix(tx.Bucket(r.bucket), p)
+	})
+}
+
+func (r *boltSnapshots[T]) Expired(ctx context.Context, domain string, before time.Time) ([]T, error) {
+	cutoff := bson.NewDateTimeFromTime(before)
+	expired := make([]T, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(r.bucket), prefix(domain), false, func(_ []byte, record T) bool {
+			if r.date(record) < cutoff && r.lastSeen(record) < cutoff {
+				expired = append(expired, record)
+			}
+			return true
+		})
+	})
+	return expired, err
+}
+
+func (r *boltSnapshots[T]) Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (pruned int64, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(r.bucket)
+
+		keys := make([][]byte, 0)
+		err := boltScan(bucket, prefix(domain, subdomain), false, func(k []byte, record T) bool {
+			if slices.Contains(dates, r.date(record)) {
+				keys = append(keys, slices.Clone(k))
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = int64(len(keys))
+		return nil
+	})
+	return pruned, err
+}
+
+func (r *boltSnapshots[T]) Count(ctx context.Context, domain string) (count int64, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(r.bucket).Cursor()
+		p := prefix(domain)
+		for k, _ := cursor.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = cursor.Next() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+type boltDNS struct {
+	db *bolt.DB
+}
+
+func (r *boltDNS) snapshots() *boltSnapshots[models.DNS] {
+	return &boltSnapshots[models.DNS]{
+		db:       r.db,
+		bucket:   dnsBucket,
+		names:    func(record models.DNS) (string, string) { return record.Domain, record.Subdomain },
+		date:     func(record models.DNS) bson.DateTime { return record.ResolutionDate },
+		lastSeen: func(record models.DNS) bson.DateTime { return record.LastSeen },
+	}
+}
+
+func (r *boltDNS) Latest(ctx context.Context, domain, subdomain string) (models.DNS, error) {
+	return r.snapshots().Latest(ctx, domain, subdomain)
+}
+
+func (r *boltDNS) History(ctx context.Context, domain, subdomain string, limit int) ([]models.DNS, error) {
+	return r.snapshots().History(ctx, domain, subdomain, limit)
+}
+
+func (r *boltDNS) Insert(ctx context.Context, record models.DNS) error {
+	return r.snapshots().Insert(ctx, record)
+}
+
+func (r *boltDNS) Replace(ctx context.Context, record models.DNS) error {
+	return r.snapshots().Replace(ctx, record)
+}
+
+func (r *boltDNS) Delete(ctx context.Context, domain, subdomain string) error {
+	return r.snapshots().Delete(ctx, domain, subdomain)
+}
+
+func (r *boltDNS) Expired(ctx context.Context, domain string, before time.Time) ([]models.DNS, error) {
+	return r.snapshots().Expired(ctx, domain, before)
+}
+
+func (r *boltDNS) Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error) {
+	return r.snapshots().Prune(ctx, domain, subdomain, dates)
+}
+
+func (r *boltDNS) Count(ctx context.Context, domain string) (int64, error) {
+	return r.snapshots().Count(ctx, domain)
+}
+
+type boltHTTP struct {
+	db *bolt.DB
+}
+
+func (r *boltHTTP) snapshots() *boltSnapshots[models.HTTP] {
+	return &boltSnapshots[models.HTTP]{
+		db:       r.db,
+		bucket:   httpBucket,
+		names:    func(record models.HTTP) (string, string) { return record.Domain, record.Subdomain },
+		date:     func(record models.HTTP) bson.DateTime { return record.ScanningDate },
+		lastSeen: func(record models.HTTP) bson.DateTime { return record.LastSeen },
+	}
+}
+
+func (r *boltHTTP) Latest(ctx context.Context, domain, subdomain string) (models.HTTP, error) {
+	return r.snapshots().Latest(ctx, domain, subdomain)
+}
+
+func (r *boltHTTP) History(ctx context.Context, domain, subdomain string, limit int) ([]models.HTTP, error) {
+	return r.snapshots().History(ctx, domain, subdomain, limit)
+}
+
+func (r *boltHTTP) Insert(ctx context.Context, record models.HTTP) error {
+	return r.snapshots().Insert(ctx, record)
+}
+
+func (r *boltHTTP) Replace(ctx context.Context, record models.HTTP) error {
+	return r.snapshots().Replace(ctx, record)
+}
+
+func (r *boltHTTP) Delete(ctx context.Context, domain, subdomain string) error {
+	return r.snapshots().Delete(ctx, domain, subdomain)
+}
+
+func (r *boltHTTP) Expired(ctx context.Context, domain string, before time.Time) ([]models.HTTP, error) {
+	return r.snapshots().Expired(ctx, domain, before)
+}
+
+func (r *boltHTTP) Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error) {
+	return r.snapshots().Prune(ctx, domain, subdomain, dates)
+}
+
+func (r *boltHTTP) Count(ctx context.Context, domain string) (int64, error) {
+	return r.snapshots().Count(ctx, domain)
+}
+
+type boltJobs struct {
+	db *bolt.DB
+}
+
+// find returns the newest job of a type that matches, ErrNotFound if none does
+func (r *boltJobs) find(jobType models.JobType, match func(models.Job) bool) (job models.Job, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		found := false
+		err := boltScan(tx.Bucket(jobsBucket), nil, true, func(_ []byte, candidate models.Job) bool {
+			if candidate.Type == jobType && match(candidate) {
+				job, found = candidate, true
+			}
+			return !found
+		})
+		if err == nil && !found {
+			err = ErrNotFound
+		}
+		return err
+	})
+	return job, err
+}
+
+func (r *boltJobs) Latest(ctx context.Context, jobType models.JobType) (models.Job, error) {
+	return r.find(jobType, func(models.Job) bool { return true })
+}
+
+func (r *boltJobs) Running(ctx context.Context, jobType models.JobType) (models.Job, error) {
+	return r.find(jobType, func(job models.Job) bool { return job.EndTime.IsZero() })
+}
+
+func (r *boltJobs) Start(ctx context.Context, job models.Job) (models.Job, error) {
+	if job.ID.IsZero() {
+		job.ID = bson.NewObjectID()
+	}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(jobsBucket), job.ID[:], job)
+	})
+	return job, err
+}
+
+func (r *boltJobs) Get(ctx context.Context, id bson.ObjectID) (job models.Job, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		job, err = boltGet[models.Job](tx.Bucket(jobsBucket), id[:])
+		return err
+	})
+	return job, err
+}
+
+func (r *boltJobs) List(ctx context.Context, filter JobFilter) ([]models.Job, error) {
+	jobs := make([]models.Job, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		// latest first, ids grow with the start time
+		return boltScan(tx.Bucket(jobsBucket), nil, true, func(_ []byte, job models.Job) bool {
+			if matchJob(filter, job) {
+				jobs = append(jobs, job)
+			}
+			return filter.Limit <= 0 || len(jobs) < filter.Limit
+		})
+	})
+	return jobs, err
+}
+
+func (r *boltJobs) DeleteFinished(ctx context.Context, before time.Time, dryRun bool) (deleted int64, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		deleted, err = boltDeleteMatching(tx.Bucket(jobsBucket), dryRun, func(job models.Job) bool {
+			return !job.EndTime.IsZero() && job.EndTime.Before(before)
+		})
+		return err
+	})
+	return deleted, err
+}
+
+func (r *boltJobs) Finish(ctx context.Context, job models.Job) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+
+		running := make([]models.Job, 0)
+		err := boltScan(bucket, nil, false, func(_ []byte, candidate models.Job) bool {
+			if job.ID.IsZero() && candidate.Type == job.Type && candidate.EndTime.IsZero() {
+				running = append(running, candidate)
+			} else if !job.ID.IsZero() && candidate.ID == job.ID {
+				running = append(running, candidate)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, candidate := range running {
+			candidate.EndTime = job.EndTime
+			candidate.Status = job.Status
+			if job.Error != "" {
+				candidate.Error = job.Error
+			}
+			if err := boltPut(bucket, candidate.ID[:], candidate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type boltEvents struct {
+	db *bolt.DB
+}
+
+func (r *boltEvents) Insert(ctx context.Context, events ...models.Event) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		for _, event := range events {
+			if event.ID.IsZero() {
+				event.ID = bson.NewObjectID()
+			}
+			if err := boltPut(bucket, event.ID[:], event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *boltEvents) List(ctx context.Context, filter EventFilter) ([]models.Event, error) {
+	events := make([]models.Event, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		// newest first, ids grow with insertion time
+		return boltScan(tx.Bucket(eventsBucket), nil, true, func(_ []byte, event models.Event) bool {
+			if matchEvent(filter, event) {
+				events = append(events, event)
+			}
+			return filter.Limit <= 0 || len(events) < filter.Limit
+		})
+	})
+	return events, err
+}
+
+func (r *boltEvents) DeleteAll(ctx context.Context, domain string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := boltDeleteMatching(tx.Bucket(eventsBucket), false, func(event models.Event) bool {
+			return event.Domain == domain
+		})
+		return err
+	})
+}
+
+type boltRollups struct {
+	db *bolt.DB
+}
+
+func (r *boltRollups) Put(ctx context.Context, rollup models.StatsRollup) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(rollupsBucket), append(prefix(rollup.Domain), dateKey(rollup.Date)...), rollup)
+	})
+}
+
+func (r *boltRollups) List(ctx context.Context, filter RollupFilter) ([]models.StatsRollup, error) {
+	rollups := make([]models.StatsRollup, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(rollupsBucket), prefix(filter.Domain), false, func(_ []byte, rollup models.StatsRollup) bool {
+			if matchRollup(filter, rollup) {
+				rollups = append(rollups, rollup)
+			}
+			return true
+		})
+	})
+	return rollups, err
+}
+
+func (r *boltRollups) Latest(ctx context.Context, domain string) (latest models.StatsRollup, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		err := ErrNotFound
+		scanErr := boltScan(tx.Bucket(rollupsBucket), prefix(domain), true, func(_ []byte, rollup models.StatsRollup) bool {
+			latest, err = rollup, nil
+			return false
+		})
+		if scanErr != nil {
+			return scanErr
+		}
+		return err
+	})
+	return latest, err
+}
+
+func (r *boltRollups) DeleteAll(ctx context.Context, domain string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return boltDeletePrefix(tx.Bucket(rollupsBucket), prefix(domain))
+	})
+}
+
+type boltPrograms struct {
+	db *bolt.DB
+}
+
+func (r *boltPrograms) Get(ctx context.Context, name string) (program models.Program, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		program, err = boltGet[models.Program](tx.Bucket(programsBucket), key(name))
+		return err
+	})
+	return program, err
+}
+
+func (r *boltPrograms) List(ctx context.Context) ([]models.Program, error) {
+	programs := make([]models.Program, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx.Bucket(programsBucket), nil, false, func(_ []byte, program models.Program) bool {
+			programs = append(programs, program)
+			return true
+		})
+	})
+	return programs, err
+}
+
+func (r *boltPrograms) Create(ctx context.Context, program models.Program) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(programsBucket)
+		if bucket.Get(key(program.Name)) != nil {
+			return ErrExists
+		}
+		return boltPut(bucket, key(program.Name), program)
+	})
+}
+
+func (r *boltPrograms) Update(ctx context.Context, name string, change func(*models.Program) error) (program models.Program, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(programsBucket)
+		if program, err = boltGet[models.Program](bucket, key(name)); err != nil {
+			return err
+		}
+		if err := change(&program); err != nil {
+			return err
+		}
+		program.Name = name
+		return boltPut(bucket, key(name), program)
+	})
+	return program, err
+}
+
+func (r *boltPrograms) Delete(ctx context.Context, name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(programsBucket)
+		if bucket.Get(key(name)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete(key(name))
+	})
+}
+
+// boltCascades deletes in a single write transaction, which is atomic
+type boltCascades struct {
+	db *bolt.DB
+}
+
+func (r *boltCascades) DeleteDomain(ctx context.Context, name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return boltDeleteDomain(tx, name)
+	})
+}
+
+func (r *boltCascades) DeleteProgram(ctx context.Context, name string) (domains []string, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		programs := tx.Bucket(programsBucket)
+		if programs.Get(key(name)) == nil {
+			return ErrNotFound
+		}
+		if err := programs.Delete(key(name)); err != nil {
+			return err
+		}
+
+		domains = make([]string, 0)
+		err := boltScan(tx.Bucket(domainsBucket), nil, false, func(_ []byte, domain models.Domain) bool {
+			if domain.Program == name {
+				domains = append(domains, domain.Name)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, domain := range domains {
+			if err := boltDeleteDomain(tx, domain); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return domains, err
+}
+
+// boltDeleteDomain deletes a domain with its subdomains, snapshots, events and rollups
+func boltDeleteDomain(tx *bolt.Tx, name string) error {
+	domains := tx.Bucket(domainsBucket)
+	if domains.Get(key(name)) == nil {
+		return ErrNotFound
+	}
+	if err := domains.Delete(key(name)); err != nil {
+		return err
+	}
+
+	for _, bucket := range [][]byte{subdomainsBucket, dnsBucket, httpBucket, rollupsBucket} {
+		if err := boltDeletePrefix(tx.Bucket(bucket), prefix(name)); err != nil {
+			return err
+		}
+	}
+	_, err := boltDeleteMatching(tx.Bucket(eventsBucket), false, func(event models.Event) bool {
+		return event.Domain == name
+	})
+	return err
+}
+
+func (r *boltCascades) DeleteSubdomain(ctx context.Context, domain, name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		subdomains := tx.Bucket(subdomainsBucket)
+		if subdomains.Get(key(domain, name)) == nil {
+			return ErrNotFound
+		}
+		if err := subdomains.Delete(key(domain, name)); err != nil {
+			return err
+		}
+
+		for _, bucket := range [][]byte{dnsBucket, httpBucket} {
+			if err := boltDeletePrefix(tx.Bucket(bucket), prefix(domain, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *boltCascades) DeleteOrphans(ctx context.Context, dryRun, deleteDomains bool) (report OrphanReport, err error) {
+	report.DryRun = dryRun
+	// records written from here on are left for the next sweep, the way mongo does
+	start := time.Now()
+	old := func(date bson.DateTime) bool { return date.Time().Before(start) }
+
+	sweep := func(tx *bolt.Tx) error {
+		programs := make(map[string]bool)
+		err := boltScan(tx.Bucket(programsBucket), nil, false, func(_ []byte, program models.Program) bool {
+			programs[program.Name] = true
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		// the domains that stay, the records of deleted domains are orphans as well
+		domains := make(map[string]bool)
+		report.Domains, err = boltDeleteMatching(tx.Bucket(domainsBucket), dryRun || !deleteDomains, func(domain models.Domain) bool {
+			orphaned := domain.Program != "" && !programs[domain.Program]
+			if !orphaned || !deleteDomains {
+				domains[domain.Name] = true
+			}
+			return orphaned
+		})
+		if err != nil {
+			return err
+		}
+
+		// the subdomains that stay, snapshots of orphaned subdomains are orphans as well
+		subdomains := make(map[string]bool)
+		report.Subdomains, err = boltDeleteMatching(tx.Bucket(subdomainsBucket), dryRun, func(subdomain models.Subdomain) bool {
+			if !domains[subdomain.Domain] && old(subdomain.CreatedAt) {
+				return true
+			}
+			subdomains[string(key(subdomain.Domain, subdomain.Name))] = true
+			return false
+		})
+		if err != nil {
+			return err
+		}
+
+		report.DNS, err = boltDeleteMatching(tx.Bucket(dnsBucket), dryRun, func(record models.DNS) bool {
+			return !subdomains[string(key(record.Domain, record.Subdomain))] && old(record.ResolutionDate)
+		})
+		if err != nil {
+			return err
+		}
+		report.HTTP, err = boltDeleteMatching(tx.Bucket(httpBucket), dryRun, func(record models.HTTP) bool {
+			return !subdomains[string(key(record.Domain, record.Subdomain))] && old(record.ScanningDate)
+		})
+		if err != nil {
+			return err
+		}
+		report.Events, err = boltDeleteMatching(tx.Bucket(eventsBucket), dryRun, func(event models.Event) bool {
+			return !domains[event.Domain] && old(event.Timestamp)
+		})
+		if err != nil {
+			return err
+		}
+		// the global rollups don't have a domain
+		report.Rollups, err = boltDeleteMatching(tx.Bucket(rollupsBucket), dryRun, func(rollup models.StatsRollup) bool {
+			return rollup.Domain != "" && !domains[rollup.Domain] && old(rollup.Date)
+		})
+		return err
+	}
+
+	if dryRun {
+		err = r.db.View(sweep)
+	} else {
+		err = r.db.Update(sweep)
+	}
+	return report, err
+}
+
+// boltSearcher scans the subdomains and matches them with their latest snapshots in one read transaction
+type boltSearcher struct {
+	db *bolt.DB
+}
+
+func (r *boltSearcher) Find(ctx context.Context, page SearchPage) ([]search.Result, error) {
+	var p []byte
+	if page.Filter.Domain != "" {
+		p = prefix(page.Filter.Domain)
+	}
+
+	results := make([]search.Result, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var scanErr error
+		err := boltScan(tx.Bucket(subdomainsBucket), p, false, func(_ []byte, subdomain models.Subdomain) bool {
+			if !matchSubdomain(page.Filter, subdomain) {
+				return true
+			}
+			if page.After != nil && compareCursors(CursorOf(SortByName, subdomain), *page.After) <= 0 {
+				return true
+			}
+
+			result := search.Result{Subdomain: subdomain}
+			if result.DNS, scanErr = boltLatest[models.DNS](tx.Bucket(dnsBucket), subdomain.Domain, subdomain.Name); scanErr != nil {
+				return false
+			}
+			if result.HTTP, scanErr = boltLatest[models.HTTP](tx.Bucket(httpBucket), subdomain.Domain, subdomain.Name); scanErr != nil {
+				return false
+			}
+			if page.Query.Match(result) {
+				results = append(results, result)
+			}
+			return page.Limit <= 0 || len(results) < page.Limit
+		})
+		if err != nil {
+			return err
+		}
+		return scanErr
+	})
+	return results, err
+}
+
+// boltLatest returns the latest snapshot of a subdomain, nil if it has none
+func boltLatest[T any](bucket *bolt.Bucket, domain, subdomain string) (latest *T, err error) {
+	err = boltScan(bucket, prefix(domain, subdomain), true, func(_ []byte, record T) bool {
+		latest = &record
+		return false
+	})
+	return latest, err
+}
@@ -0,0 +1,1059 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/search"
+)
+
+func TestBoltStore(t *testing.T) {
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "sentinel.db"))
+	if err != nil {
+		t.Fatalf("failed to open bolt store: %v", err)
+	}
+	defer store.Close()
+
+	testStore(t, store)
+}
+
+// TestMongoStore runs the conformance suite against the mongodb at SENTINEL_TEST_MONGODB_URI,
+// which CI always has to set since mongo is the default backend
+func TestMongoStore(t *testing.T) {
+	uri := os.Getenv("SENTINEL_TEST_MONGODB_URI")
+	if uri == "" && os.Getenv("CI") != "" {
+		t.Fatal("SENTINEL_TEST_MONGODB_URI must be set in CI")
+	}
+	if uri == "" {
+		t.Skip("SENTINEL_TEST_MONGODB_URI is not set")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect to mongodb: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database("sentinel_test_" + bson.NewObjectID().Hex())
+	defer db.Drop(context.Background())
+
+	testStore(t, NewMongoStore(db))
+	t.Run("updates", func(t *testing.T) { testMongoUpdates(t, db) })
+}
+
+// testMongoUpdates checks that updates only write the fields they change
+func testMongoUpdates(t *testing.T, db *mongo.Database) {
+	ctx := context.Background()
+	coll := db.Collection("subdomains")
+
+	if _, err := coll.InsertOne(ctx, bson.M{"domain": "legacy.com", "name": "www.legacy.com", "legacy_field": "kept"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+	_, err := NewMongoStore(db).Subdomains.Update(ctx, "legacy.com", "www.legacy.com", func(subdomain *models.Subdomain) error {
+		subdomain.Tags = []string{"cdn"}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	stored, err := coll.FindOne(ctx, bson.M{"domain": "legacy.com", "name": "www.legacy.com"}).Raw()
+	if err != nil {
+		t.Fatalf("FindOne failed: %v", err)
+	}
+	if legacy, err := stored.LookupErr("legacy_field"); err != nil || legacy.StringValue() != "kept" {
+		t.Errorf("the update dropped a field the model doesn't know: %v", stored)
+	}
+	if version, err := stored.LookupErr("version"); err != nil || version.AsInt64() != 1 {
+		t.Errorf("expected the update to bump the version: %v", stored)
+	}
+}
+
+// testStore is the conformance suite every backend has to pass
+func testStore(t *testing.T, store *Store) {
+	t.Run("domains", func(t *testing.T) { testDomains(t, store) })
+	t.Run("subdomains", func(t *testing.T) { testSubdomains(t, store) })
+	t.Run("subdomain pages", func(t *testing.T) { testSubdomainPages(t, store) })
+	t.Run("snapshots", func(t *testing.T) { testSnapshots(t, store) })
+	t.Run("search", func(t *testing.T) { testSearch(t, store) })
+	t.Run("jobs", func(t *testing.T) { testJobs(t, store) })
+	t.Run("events", func(t *testing.T) { testEvents(t, store) })
+	t.Run("stats", func(t *testing.T) { testStats(t, store) })
+	t.Run("programs", func(t *testing.T) { testPrograms(t, store) })
+	t.Run("cascades", func(t *testing.T) { testCascades(t, store) })
+}
+
+func testDomains(t *testing.T, store *Store) {
+	ctx := context.Background()
+
+	for _, name := range []string{"b.com", "a.com"} {
+		if err := store.Domains.Create(ctx, models.Domain{Name: name, InScope: []string{"*." + name}}); err != nil {
+			t.Fatalf("Create(%s) failed: %v", name, err)
+		}
+	}
+	if err := store.Domains.Create(ctx, models.Domain{Name: "a.com"}); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists for a duplicate domain, got %v", err)
+	}
+	if _, err := store.Domains.Get(ctx, "missing.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing domain, got %v", err)
+	}
+
+	updated, err := store.Domains.Update(ctx, "a.com", func(domain *models.Domain) error {
+		domain.Program = "acme"
+		domain.Tags = []string{"prod"}
+		return nil
+	})
+	if err != nil || updated.Program != "acme" {
+		t.Fatalf("Update failed: %v %+v", err, updated)
+	}
+	domain, err := store.Domains.Get(ctx, "a.com")
+	if err != nil || domain.Program != "acme" || !slices.Equal(domain.InScope, []string{"*.a.com"}) {
+		t.Fatalf("expected the update to be stored: %v %+v", err, domain)
+	}
+
+	abort := errors.New("abort")
+	if _, err := store.Domains.Update(ctx, "b.com", func(domain *models.Domain) error {
+		domain.Program = "acme"
+		return abort
+	}); !errors.Is(err, abort) {
+		t.Fatalf("expected the error of the change to be returned, got %v", err)
+	}
+
+	domains, err := store.Domains.List(ctx, DomainFilter{})
+	if err != nil || len(domains) != 2 || domains[0].Name != "a.com" {
+		t.Fatalf("expected two domains sorted by name: %v %+v", err, domains)
+	}
+	domains, _ = store.Domains.List(ctx, DomainFilter{Program: "acme"})
+	if len(domains) != 1 || domains[0].Name != "a.com" {
+		t.Fatalf("expected the aborted update not to be stored: %+v", domains)
+	}
+	domains, _ = store.Domains.List(ctx, DomainFilter{Tag: "prod"})
+	if len(domains) != 1 {
+		t.Fatalf("expected one domain with the tag: %+v", domains)
+	}
+	domains, _ = store.Domains.List(ctx, DomainFilter{Triage: models.TriageNew})
+	if len(domains) != 2 {
+		t.Fatalf("expected untriaged domains to be new: %+v", domains)
+	}
+
+	if err := store.Domains.Delete(ctx, "b.com"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Domains.Delete(ctx, "b.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a deleted domain, got %v", err)
+	}
+}
+
+func testSubdomains(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	subdomains := []models.Subdomain{
+		{Domain: "sub.com", Name: "www.sub.com", Seed: "sub.com", WatchDNS: true, DNSStatus: models.FreshSubdomain},
+		{Domain: "sub.com", Name: "api.sub.com", Seed: "sub.com", WatchDNS: true, NextDNSCheck: bson.NewDateTimeFromTime(now.Add(time.Hour)),
+			OutOfScopeAt: bson.NewDateTimeFromTime(now)},
+		{Domain: "sub.com", Name: "dev.other.com", Seed: "other.com", WatchHTTP: true, HTTPStatus: models.FreshService},
+		{Domain: "else.com", Name: "www.else.com"},
+		{Domain: "sub.com", Name: "old.sub.com", WatchDNS: true, ArchivedAt: bson.NewDateTimeFromTime(now)},
+	}
+	if err := store.Subdomains.Create(ctx, subdomains...); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	err := store.Subdomains.Create(ctx, models.Subdomain{Domain: "sub.com", Name: "new.sub.com"}, subdomains[0])
+	if !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists for an existing subdomain, got %v", err)
+	}
+	if _, err := store.Subdomains.Get(ctx, "sub.com", "new.sub.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected nothing to be stored when a subdomain exists, got %v", err)
+	}
+	existing, err := store.Subdomains.Existing(ctx, "sub.com", []string{"www.sub.com", "old.sub.com", "new.sub.com", "www.else.com"})
+	if err != nil || !maps.Equal(existing, map[string]bool{"www.sub.com": true, "old.sub.com": true}) {
+		t.Fatalf("Existing = %v, %v, expected the active and archived subdomains of the domain", existing, err)
+	}
+
+	names := func(filter SubdomainFilter) []string {
+		t.Helper()
+		found, err := store.Subdomains.List(ctx, filter)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		names := make([]string, 0, len(found))
+		for _, subdomain := range found {
+			names = append(names, subdomain.Name)
+		}
+		return names
+	}
+
+	watch, excluded := true, false
+	tests := []struct {
+		filter   SubdomainFilter
+		expected []string
+	}{
+		{SubdomainFilter{Domain: "sub.com"}, []string{"api.sub.com", "dev.other.com", "www.sub.com"}},
+		{SubdomainFilter{Domain: "sub.com", Seed: "other.com"}, []string{"dev.other.com"}},
+		{SubdomainFilter{WatchDNS: &watch}, []string{"api.sub.com", "www.sub.com"}},
+		{SubdomainFilter{WatchDNS: &watch, DNSCheckDue: now}, []string{"www.sub.com"}},
+		{SubdomainFilter{WatchHTTP: &watch}, []string{"dev.other.com"}},
+		{SubdomainFilter{Domain: "sub.com", InScope: &watch}, []string{"dev.other.com", "www.sub.com"}},
+		{SubdomainFilter{InScope: &excluded}, []string{"api.sub.com"}},
+		{SubdomainFilter{Statuses: []models.StatusType{models.FreshSubdomain, models.FreshService}}, []string{"dev.other.com", "www.sub.com"}},
+		{SubdomainFilter{}, []string{"www.else.com", "api.sub.com", "dev.other.com", "www.sub.com"}},
+		{SubdomainFilter{Domain: "sub.com", Archived: OnlyArchived}, []string{"old.sub.com"}},
+		{SubdomainFilter{Domain: "sub.com", Archived: IncludeArchived}, []string{"api.sub.com", "dev.other.com", "old.sub.com", "www.sub.com"}},
+		{SubdomainFilter{DNSStatuses: []models.StatusType{models.FreshSubdomain}}, []string{"www.sub.com"}},
+		{SubdomainFilter{HTTPStatuses: []models.StatusType{models.FreshSubdomain}}, []string{}},
+		{SubdomainFilter{NamePattern: "www.*"}, []string{"www.else.com", "www.sub.com"}},
+		{SubdomainFilter{NamePattern: "*.sub.*"}, []string{"api.sub.com", "www.sub.com"}},
+	}
+	for _, test := range tests {
+		if got := names(test.filter); !slices.Equal(got, test.expected) {
+			t.Errorf("List(%+v) = %v, expected %v", test.filter, got, test.expected)
+		}
+	}
+
+	updated, err := store.Subdomains.Update(ctx, "sub.com", "www.sub.com", func(subdomain *models.Subdomain) error {
+		subdomain.Tags = []string{"login"}
+		subdomain.Triage = &models.Triage{State: models.TriageInteresting}
+		return nil
+	})
+	if err != nil || !slices.Equal(updated.Tags, []string{"login"}) {
+		t.Fatalf("Update failed: %v %+v", err, updated)
+	}
+	if got := names(SubdomainFilter{Tag: "login"}); !slices.Equal(got, []string{"www.sub.com"}) {
+		t.Errorf("expected the tag to be stored, got %v", got)
+	}
+	if got := names(SubdomainFilter{Domain: "sub.com", Triage: models.TriageNew}); !slices.Equal(got, []string{"api.sub.com", "dev.other.com"}) {
+		t.Errorf("expected untriaged subdomains to be new, got %v", got)
+	}
+	if _, err := store.Subdomains.Update(ctx, "sub.com", "missing.sub.com", func(*models.Subdomain) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing subdomain, got %v", err)
+	}
+
+	// writers changing different fields at the same time keep each other's changes
+	var wg sync.WaitGroup
+	for _, field := range []string{"providers", "tags"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 10 {
+				_, err := store.Subdomains.Update(ctx, "sub.com", "dev.other.com", func(subdomain *models.Subdomain) error {
+					if field == "providers" {
+						subdomain.Providers = append(subdomain.Providers, fmt.Sprint("provider", i))
+					} else {
+						subdomain.Tags = append(subdomain.Tags, fmt.Sprint("tag", i))
+					}
+					return nil
+				})
+				if err != nil {
+					t.Errorf("concurrent Update failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	raced, err := store.Subdomains.Get(ctx, "sub.com", "dev.other.com")
+	if err != nil || len(raced.Providers) != 10 || len(raced.Tags) != 10 {
+		t.Errorf("concurrent updates left providers %v and tags %v, %v", raced.Providers, raced.Tags, err)
+	}
+
+	stats, err := store.Subdomains.Stats(ctx, "sub.com")
+	if err != nil || stats.Total != 3 || stats.PerDomain["sub.com"] != 3 ||
+		stats.DNSStatus[string(models.FreshSubdomain)] != 1 || stats.DNSStatus["none"] != 2 || stats.HTTPStatus[string(models.FreshService)] != 1 {
+		t.Errorf("unexpected stats: %v %+v", err, stats)
+	}
+
+	// a bulk update changes every matching subdomain at once and reports the watch flags it changed
+	off := false
+	changes := SubdomainChanges{
+		WatchDNS:   &off,
+		AddTags:    []string{"bulk"},
+		RemoveTags: []string{"login"},
+		Triage:     &models.Triage{State: models.TriageInteresting},
+		Now:        bson.NewDateTimeFromTime(now),
+	}
+	bulk, err := store.Subdomains.UpdateMany(ctx, SubdomainFilter{Domain: "sub.com"}, changes)
+	if err != nil || bulk.Matched != 3 || bulk.Updated != 3 || len(bulk.WatchChanged) != 2 ||
+		bulk.WatchChanged[0].Name != "api.sub.com" || !bulk.WatchChanged[0].WatchDNS || bulk.WatchChanged[1].Name != "www.sub.com" {
+		t.Fatalf("unexpected bulk update: %v %+v", err, bulk)
+	}
+	if got := names(SubdomainFilter{Tag: "bulk"}); !slices.Equal(got, []string{"api.sub.com", "dev.other.com", "www.sub.com"}) {
+		t.Errorf("expected the tag to be added to every subdomain, got %v", got)
+	}
+	if got := names(SubdomainFilter{Tag: "login"}); len(got) != 0 {
+		t.Errorf("expected the tag to be removed, got %v", got)
+	}
+	api, err := store.Subdomains.Get(ctx, "sub.com", "api.sub.com")
+	if err != nil || api.WatchDNS || api.NextDNSCheck != 0 || len(api.TriageHistory) != 1 || api.UpdatedAt != changes.Now {
+		t.Errorf("expected the dns schedule to be reset and the triage recorded: %v %+v", err, api)
+	}
+	www, err := store.Subdomains.Get(ctx, "sub.com", "www.sub.com")
+	if err != nil || len(www.TriageHistory) != 0 {
+		t.Errorf("expected an unchanged triage state not to be recorded: %v %+v", err, www)
+	}
+	if old, _ := store.Subdomains.Get(ctx, "sub.com", "old.sub.com"); !old.WatchDNS {
+		t.Error("expected archived subdomains to be left alone")
+	}
+	bulk, err = store.Subdomains.UpdateMany(ctx, SubdomainFilter{Domain: "sub.com"}, changes)
+	if err != nil || bulk.Matched != 3 || bulk.Updated != 0 || len(bulk.WatchChanged) != 0 {
+		t.Errorf("expected a repeated bulk update to change nothing: %v %+v", err, bulk)
+	}
+
+	// scope moves only change the named subdomains, a rescan watches dns again only where it was turned off automatically
+	_, err = store.Subdomains.Update(ctx, "sub.com", "www.sub.com", func(subdomain *models.Subdomain) error {
+		subdomain.DNSAutoUnwatched = true
+		subdomain.DNSMisses = 3
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	outOfScopeAt := bson.NewDateTimeFromTime(now.Add(time.Minute))
+	moved := SubdomainFilter{Domain: "sub.com", Names: []string{"api.sub.com", "www.sub.com"}}
+	bulk, err = store.Subdomains.UpdateMany(ctx, moved, SubdomainChanges{OutOfScopeAt: &outOfScopeAt, Now: changes.Now})
+	if err != nil || bulk.Matched != 2 || bulk.Updated != 2 {
+		t.Fatalf("unexpected scope update: %v %+v", err, bulk)
+	}
+	outside := false
+	if got := names(SubdomainFilter{InScope: &outside}); !slices.Equal(got, []string{"api.sub.com", "www.sub.com"}) {
+		t.Errorf("expected the named subdomains to leave the scope, got %v", got)
+	}
+	var inScopeAt bson.DateTime
+	bulk, err = store.Subdomains.UpdateMany(ctx, moved, SubdomainChanges{OutOfScopeAt: &inScopeAt, Rescan: true, Now: changes.Now})
+	if err != nil || bulk.Matched != 2 || bulk.Updated != 2 || len(bulk.WatchChanged) != 1 || bulk.WatchChanged[0].Name != "www.sub.com" {
+		t.Fatalf("unexpected rescan: %v %+v", err, bulk)
+	}
+	if got := names(SubdomainFilter{InScope: &outside}); len(got) != 0 {
+		t.Errorf("expected the subdomains to be back in scope, got %v", got)
+	}
+	if www, err := store.Subdomains.Get(ctx, "sub.com", "www.sub.com"); err != nil || !www.WatchDNS || www.DNSAutoUnwatched || www.DNSMisses != 0 {
+		t.Errorf("expected dns to be watched again: %v %+v", err, www)
+	}
+	if api, err := store.Subdomains.Get(ctx, "sub.com", "api.sub.com"); err != nil || api.WatchDNS {
+		t.Errorf("expected dns turned off by hand to stay off: %v %+v", err, api)
+	}
+
+	// archiving a domain moves its active subdomains, restoring it brings back exactly these
+	archivedAt := bson.NewDateTimeFromTime(now.Add(time.Minute))
+	if moved, err := store.Subdomains.SetArchivedAt(ctx, "sub.com", 0, archivedAt); err != nil || moved != 3 {
+		t.Fatalf("expected 3 archived subdomains: %v %d", err, moved)
+	}
+	if got := names(SubdomainFilter{Domain: "sub.com"}); len(got) != 0 {
+		t.Errorf("expected no active subdomains after archiving, got %v", got)
+	}
+	if got := names(SubdomainFilter{}); !slices.Equal(got, []string{"www.else.com"}) {
+		t.Errorf("expected the subdomains of other domains to stay active, got %v", got)
+	}
+	if moved, err := store.Subdomains.SetArchivedAt(ctx, "sub.com", archivedAt, 0); err != nil || moved != 3 {
+		t.Fatalf("expected 3 restored subdomains: %v %d", err, moved)
+	}
+	if got := names(SubdomainFilter{Domain: "sub.com", Archived: OnlyArchived}); !slices.Equal(got, []string{"old.sub.com"}) {
+		t.Errorf("expected the subdomain archived on its own to stay archived, got %v", got)
+	}
+
+	if err := store.Subdomains.Delete(ctx, "sub.com", "api.sub.com"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Subdomains.Delete(ctx, "sub.com", "api.sub.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a deleted subdomain, got %v", err)
+	}
+	if err := store.Subdomains.DeleteAll(ctx, "sub.com"); err != nil {
+		t.Fatalf("DeleteAll failed: %v", err)
+	}
+	if got := names(SubdomainFilter{}); !slices.Equal(got, []string{"www.else.com"}) {
+		t.Errorf("expected only the subdomains of other domains to be left, got %v", got)
+	}
+}
+
+func testSubdomainPages(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	// c and d share their creation time so that the name breaks the tie
+	at := func(hours int) bson.DateTime {
+		return bson.NewDateTimeFromTime(now.Add(time.Duration(hours) * time.Hour))
+	}
+	subdomains := []models.Subdomain{
+		{Domain: "page.com", Name: "a.page.com", CreatedAt: at(3), UpdatedAt: at(3), Providers: []string{"crtsh"}},
+		{Domain: "page.com", Name: "b.page.com", CreatedAt: at(1), UpdatedAt: at(4)},
+		{Domain: "page.com", Name: "c.page.com", CreatedAt: at(2), UpdatedAt: at(2), Providers: []string{"crtsh", "subfinder"}},
+		{Domain: "page.com", Name: "d.page.com", CreatedAt: at(2), UpdatedAt: at(5), DNSStatusChangedAt: at(1)},
+	}
+	if err := store.Subdomains.Create(ctx, subdomains...); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// pages walks the listing a page at a time and returns the names in order
+	pages := func(page SubdomainPage) []string {
+		t.Helper()
+		names := []string{}
+		for range len(subdomains) + 1 {
+			found, err := store.Subdomains.Page(ctx, page)
+			if err != nil {
+				t.Fatalf("Page failed: %v", err)
+			}
+			for _, subdomain := range found {
+				names = append(names, subdomain.Name)
+			}
+			if len(found) < page.Limit {
+				return names
+			}
+			cursor := CursorOf(page.Sort, found[len(found)-1])
+			page.After = &cursor
+		}
+		t.Fatalf("Page(%+v) never ended", page)
+		return nil
+	}
+
+	domain := SubdomainFilter{Domain: "page.com"}
+	tests := []struct {
+		page     SubdomainPage
+		expected []string
+	}{
+		{SubdomainPage{Filter: domain, Sort: SortByName, Limit: 3}, []string{"a.page.com", "b.page.com", "c.page.com", "d.page.com"}},
+		{SubdomainPage{Filter: domain, Sort: SortByName, Descending: true, Limit: 3}, []string{"d.page.com", "c.page.com", "b.page.com", "a.page.com"}},
+		{SubdomainPage{Filter: domain, Sort: SortByCreatedAt, Limit: 1}, []string{"b.page.com", "c.page.com", "d.page.com", "a.page.com"}},
+		{SubdomainPage{Filter: domain, Sort: SortByCreatedAt, Descending: true, Limit: 2}, []string{"a.page.com", "d.page.com", "c.page.com", "b.page.com"}},
+		{SubdomainPage{Filter: domain, Sort: SortByDNSStatusChangedAt, Descending: true, Limit: 2}, []string{"d.page.com", "c.page.com", "b.page.com", "a.page.com"}},
+		{SubdomainPage{Filter: SubdomainFilter{Domain: "page.com", Provider: "crtsh"}, Sort: SortByName, Limit: 5}, []string{"a.page.com", "c.page.com"}},
+		{SubdomainPage{Filter: SubdomainFilter{Domain: "page.com", CreatedSince: now.Add(2 * time.Hour)}, Sort: SortByName, Limit: 5}, []string{"a.page.com", "c.page.com", "d.page.com"}},
+		{SubdomainPage{Filter: SubdomainFilter{Domain: "page.com", UpdatedUntil: now.Add(3 * time.Hour)}, Sort: SortByUpdatedAt, Limit: 5}, []string{"c.page.com", "a.page.com"}},
+	}
+	for _, test := range tests {
+		if got := pages(test.page); !slices.Equal(got, test.expected) {
+			t.Errorf("Page(%+v) = %v, expected %v", test.page, got, test.expected)
+		}
+	}
+}
+
+func testSnapshots(t *testing.T, store *Store) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour)
+
+	for i := range 3 {
+		record := models.DNS{
+			ResolutionDate: bson.NewDateTimeFromTime(start.Add(time.Duration(i) * time.Minute)),
+			Domain:         "snap.com",
+			Subdomain:      "www.snap.com",
+			ARecords:       []string{"10.0.0." + string(rune('1'+i))},
+			SeenCount:      1,
+		}
+		if err := store.DNS.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := store.DNS.Insert(ctx, models.DNS{Domain: "snap.com", Subdomain: "api.snap.com", ResolutionDate: bson.NewDateTimeFromTime(start)}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	latest, err := store.DNS.Latest(ctx, "snap.com", "www.snap.com")
+	if err != nil || !slices.Equal(latest.ARecords, []string{"10.0.0.3"}) {
+		t.Fatalf("expected the newest snapshot: %v %+v", err, latest)
+	}
+	if _, err := store.DNS.Latest(ctx, "snap.com", "missing.snap.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without snapshots, got %v", err)
+	}
+
+	history, err := store.DNS.History(ctx, "snap.com", "www.snap.com", 2)
+	if err != nil || len(history) != 2 || history[1].ARecords[0] != "10.0.0.2" {
+		t.Fatalf("expected the two newest snapshots: %v %+v", err, history)
+	}
+	if history, _ := store.DNS.History(ctx, "snap.com", "www.snap.com", 0); len(history) != 3 {
+		t.Fatalf("expected every snapshot without a limit, got %d", len(history))
+	}
+
+	latest.SeenCount = 5
+	if err := store.DNS.Replace(ctx, latest); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if latest, _ = store.DNS.Latest(ctx, "snap.com", "www.snap.com"); latest.SeenCount != 5 {
+		t.Fatalf("expected the replaced snapshot, got %+v", latest)
+	}
+	if history, _ := store.DNS.History(ctx, "snap.com", "www.snap.com", 0); len(history) != 3 {
+		t.Fatalf("expected Replace not to add a snapshot, got %d", len(history))
+	}
+	latest.ResolutionDate = bson.NewDateTimeFromTime(start.Add(-time.Hour))
+	if err := store.DNS.Replace(ctx, latest); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound when replacing a missing snapshot, got %v", err)
+	}
+
+	// a snapshot is expired once it was neither taken nor last seen after the cutoff
+	history, _ = store.DNS.History(ctx, "snap.com", "www.snap.com", 0)
+	oldest := history[len(history)-1]
+	oldest.LastSeen = bson.NewDateTimeFromTime(time.Now())
+	if err := store.DNS.Replace(ctx, oldest); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	expired, err := store.DNS.Expired(ctx, "snap.com", start.Add(90*time.Second))
+	if err != nil || len(expired) != 2 || expired[0].Subdomain != "api.snap.com" || expired[1].ARecords[0] != "10.0.0.2" {
+		t.Fatalf("expected the snapshots taken and last seen before the cutoff: %v %+v", err, expired)
+	}
+	pruned, err := store.DNS.Prune(ctx, "snap.com", "www.snap.com", []bson.DateTime{expired[1].ResolutionDate})
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected one pruned snapshot: %v %d", err, pruned)
+	}
+	if count, err := store.DNS.Count(ctx, "snap.com"); err != nil || count != 3 {
+		t.Fatalf("expected 3 snapshots left: %v %d", err, count)
+	}
+
+	if err := store.DNS.Delete(ctx, "snap.com", "www.snap.com"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if history, _ := store.DNS.History(ctx, "snap.com", "api.snap.com", 0); len(history) != 1 {
+		t.Fatalf("expected the snapshots of other subdomains to be kept, got %d", len(history))
+	}
+	if err := store.DNS.Delete(ctx, "snap.com", ""); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if history, _ := store.DNS.History(ctx, "snap.com", "api.snap.com", 0); len(history) != 0 {
+		t.Fatalf("expected every snapshot of the domain to be deleted, got %d", len(history))
+	}
+
+	// http snapshots share the behaviour, check the ordering and replacement
+	for i, code := range []int{200, 302} {
+		record := models.HTTP{
+			ScanningDate: bson.NewDateTimeFromTime(start.Add(time.Duration(i) * time.Minute)),
+			Domain:       "snap.com",
+			Subdomain:    "www.snap.com",
+			StatusCode:   code,
+		}
+		if err := store.HTTP.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	service, err := store.HTTP.Latest(ctx, "snap.com", "www.snap.com")
+	if err != nil || service.StatusCode != 302 {
+		t.Fatalf("expected the newest http snapshot: %v %+v", err, service)
+	}
+	service.SeenCount = 2
+	if err := store.HTTP.Replace(ctx, service); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if err := store.HTTP.Delete(ctx, "snap.com", ""); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.HTTP.Latest(ctx, "snap.com", "www.snap.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected every http snapshot to be deleted, got %v", err)
+	}
+}
+
+func testSearch(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	err := store.Subdomains.Create(ctx,
+		models.Subdomain{Domain: "search.com", Name: "app.search.com", DNSStatus: models.FreshResolved},
+		models.Subdomain{Domain: "search.com", Name: "blog.search.com", DNSStatus: models.ResolvedSubdomain},
+		models.Subdomain{Domain: "search.com", Name: "old.search.com", ArchivedAt: bson.NewDateTimeFromTime(now)},
+		models.Subdomain{Domain: "search.com", Name: "www.search.com"},
+	)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// only the latest snapshots count, app used to run apache
+	snapshots := []error{
+		store.DNS.Insert(ctx, models.DNS{Domain: "search.com", Subdomain: "app.search.com", ResolutionDate: bson.NewDateTimeFromTime(now), CnameRecords: []string{"app.azurewebsites.net"}}),
+		store.DNS.Insert(ctx, models.DNS{Domain: "search.com", Subdomain: "blog.search.com", ResolutionDate: bson.NewDateTimeFromTime(now), CnameRecords: []string{"blog.example.net"}}),
+		store.HTTP.Insert(ctx, models.HTTP{Domain: "search.com", Subdomain: "app.search.com", ScanningDate: bson.NewDateTimeFromTime(now.Add(-time.Hour)), StatusCode: 200, Technologies: []string{"Apache"}}),
+		store.HTTP.Insert(ctx, models.HTTP{Domain: "search.com", Subdomain: "app.search.com", ScanningDate: bson.NewDateTimeFromTime(now), StatusCode: 200, Title: "Login Portal", Technologies: []string{"Nginx:1.25"}}),
+		store.HTTP.Insert(ctx, models.HTTP{Domain: "search.com", Subdomain: "blog.search.com", ScanningDate: bson.NewDateTimeFromTime(now), StatusCode: 503, Technologies: []string{"nginx"}}),
+	}
+	if err := errors.Join(snapshots...); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	find := func(input string, after *SubdomainCursor, limit int) []string {
+		t.Helper()
+		query, err := search.Parse(input)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", input, err)
+		}
+		results, err := store.Search.Find(ctx, SearchPage{Query: query, Filter: SubdomainFilter{Domain: "search.com"}, After: after, Limit: limit})
+		if err != nil {
+			t.Fatalf("Find(%q) failed: %v", input, err)
+		}
+		names := make([]string, 0, len(results))
+		for _, result := range results {
+			names = append(names, result.Subdomain.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"app.search.com", "blog.search.com", "www.search.com"}},
+		{`tech:nginx status:200 title:"login" cname:*.azurewebsites.net dns_status:fresh_resolved`, []string{"app.search.com"}},
+		{"tech:nginx", []string{"app.search.com", "blog.search.com"}},
+		{"tech:apache", []string{}},
+		{"status:>=500", []string{"blog.search.com"}},
+		{"-status:200", []string{"blog.search.com", "www.search.com"}},
+		{"-cname:*.azurewebsites.net blog", []string{"blog.search.com"}},
+		{"w*.search.com", []string{"www.search.com"}},
+	}
+	for _, test := range tests {
+		if got := find(test.query, nil, 0); !slices.Equal(got, test.expected) {
+			t.Errorf("Find(%q) = %v, expected %v", test.query, got, test.expected)
+		}
+	}
+
+	after := &SubdomainCursor{Domain: "search.com", Name: "app.search.com"}
+	if got := find("tech:nginx", after, 1); !slices.Equal(got, []string{"blog.search.com"}) {
+		t.Errorf("expected the page after app to hold blog, got %v", got)
+	}
+	if got := find("", nil, 1); !slices.Equal(got, []string{"app.search.com"}) {
+		t.Errorf("expected the first page to hold app, got %v", got)
+	}
+}
+
+func testJobs(t *testing.T, store *Store) {
+	ctx := context.Background()
+
+	if _, err := store.Jobs.Latest(ctx, "dnsx"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without jobs, got %v", err)
+	}
+
+	job, err := store.Jobs.Start(ctx, models.Job{Type: "dnsx", StartTime: time.Now(), Status: models.JobStatusPending})
+	if err != nil || job.ID.IsZero() {
+		t.Fatalf("Start failed: %v %+v", err, job)
+	}
+	running, err := store.Jobs.Running(ctx, "dnsx")
+	if err != nil || running.ID != job.ID {
+		t.Fatalf("expected the started job to be running: %v %+v", err, running)
+	}
+	if _, err := store.Jobs.Running(ctx, "httpx"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected no running job of another type, got %v", err)
+	}
+
+	err = store.Jobs.Finish(ctx, models.Job{Type: "dnsx", EndTime: time.Now(), Status: models.JobStatusFailed, Error: "boom"})
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if _, err := store.Jobs.Running(ctx, "dnsx"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected no running job after finishing it, got %v", err)
+	}
+	latest, err := store.Jobs.Latest(ctx, "dnsx")
+	if err != nil || latest.ID != job.ID || latest.Status != models.JobStatusFailed || latest.Error != "boom" || latest.EndTime.IsZero() {
+		t.Fatalf("expected the finished job: %v %+v", err, latest)
+	}
+	// jobs with an id are finished on their own
+	first, _ := store.Jobs.Start(ctx, models.Job{Type: "deletion", Target: "a.com", StartTime: time.Now(), Status: models.JobStatusPending})
+	second, _ := store.Jobs.Start(ctx, models.Job{Type: "deletion", Target: "b.com", StartTime: time.Now(), Status: models.JobStatusPending})
+	if err := store.Jobs.Finish(ctx, models.Job{ID: first.ID, Type: "deletion", EndTime: time.Now(), Status: models.JobStatusSuccess}); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if got, err := store.Jobs.Get(ctx, first.ID); err != nil || got.Status != models.JobStatusSuccess || got.Target != "a.com" {
+		t.Fatalf("expected the first job to be finished: %v %+v", err, got)
+	}
+	if got, err := store.Jobs.Get(ctx, second.ID); err != nil || !got.EndTime.IsZero() {
+		t.Fatalf("expected the second job to keep running: %v %+v", err, got)
+	}
+	if _, err := store.Jobs.Get(ctx, bson.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unknown job, got %v", err)
+	}
+
+	if jobs, err := store.Jobs.List(ctx, JobFilter{}); err != nil || len(jobs) != 3 || jobs[0].ID != second.ID {
+		t.Fatalf("expected every job latest first: %v %+v", err, jobs)
+	}
+	if jobs, err := store.Jobs.List(ctx, JobFilter{Type: "deletion", Limit: 1}); err != nil || len(jobs) != 1 || jobs[0].ID != second.ID {
+		t.Fatalf("expected the latest deletion job: %v %+v", err, jobs)
+	}
+	if jobs, err := store.Jobs.List(ctx, JobFilter{Since: time.Now().Add(time.Hour)}); err != nil || len(jobs) != 0 {
+		t.Fatalf("expected no job started in the future: %v %+v", err, jobs)
+	}
+
+	// only finished jobs are deleted, the first deletion and the dnsx job
+	if count, err := store.Jobs.DeleteFinished(ctx, time.Now().Add(time.Minute), true); err != nil || count != 2 {
+		t.Fatalf("expected 2 finished jobs to count: %v %d", err, count)
+	}
+	if jobs, _ := store.Jobs.List(ctx, JobFilter{}); len(jobs) != 3 {
+		t.Fatalf("expected a dry run to keep the jobs, got %d", len(jobs))
+	}
+	if deleted, err := store.Jobs.DeleteFinished(ctx, time.Now().Add(time.Minute), false); err != nil || deleted != 2 {
+		t.Fatalf("expected 2 finished jobs to be deleted: %v %d", err, deleted)
+	}
+	if jobs, _ := store.Jobs.List(ctx, JobFilter{}); len(jobs) != 1 || jobs[0].ID != second.ID {
+		t.Fatalf("expected the running job to be kept: %+v", jobs)
+	}
+}
+
+func testStats(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	day := func(daysAgo int) bson.DateTime { return bson.NewDateTimeFromTime(now.AddDate(0, 0, -daysAgo)) }
+
+	subdomains := []models.Subdomain{
+		{Domain: "stats.com", Name: "a.stats.com", CreatedAt: day(0), Providers: []string{"crtsh", "subfinder"}},
+		{Domain: "stats.com", Name: "b.stats.com", CreatedAt: day(0), Providers: []string{"subfinder"}},
+		{Domain: "stats.com", Name: "c.stats.com", CreatedAt: day(3), Providers: []string{"subfinder"}},
+		{Domain: "stats.com", Name: "d.stats.com", CreatedAt: day(0), Providers: []string{"subfinder"}, ArchivedAt: day(0)},
+	}
+	if err := store.Subdomains.Create(ctx, subdomains...); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// only the latest http snapshot counts
+	snapshots := []models.HTTP{
+		{Domain: "stats.com", Subdomain: "a.stats.com", ScanningDate: day(2), Technologies: []string{"PHP"}},
+		{Domain: "stats.com", Subdomain: "a.stats.com", ScanningDate: day(1), Technologies: []string{"Nginx", "React"}},
+		{Domain: "stats.com", Subdomain: "b.stats.com", ScanningDate: day(1), Technologies: []string{"Nginx"}},
+	}
+	for _, snapshot := range snapshots {
+		if err := store.HTTP.Insert(ctx, snapshot); err != nil {
+			t.Fatalf("Insert http failed: %v", err)
+		}
+	}
+
+	assets, err := store.Subdomains.Assets(ctx, now.AddDate(0, 0, -1), "stats.com")
+	if err != nil {
+		t.Fatalf("Assets failed: %v", err)
+	}
+	if assets.Providers["subfinder"] != 3 || assets.Providers["crtsh"] != 1 {
+		t.Errorf("unexpected providers %v", assets.Providers)
+	}
+	if len(assets.Technologies) != 2 || assets.Technologies["Nginx"] != 2 || assets.Technologies["React"] != 1 {
+		t.Errorf("unexpected technologies %v", assets.Technologies)
+	}
+	if len(assets.Discovered) != 1 || assets.Discovered[now.Format(time.DateOnly)] != 2 {
+		t.Errorf("unexpected discoveries %v", assets.Discovered)
+	}
+
+	discovered, err := store.Subdomains.Discovered(ctx, now.AddDate(0, 0, -1), "stats.com")
+	if err != nil || !maps.Equal(discovered, assets.Discovered) {
+		t.Errorf("expected the discoveries Assets counts, got %v %v", discovered, err)
+	}
+
+	// rollups replace the one of the same day and domain
+	midnight := now.Truncate(24 * time.Hour)
+	rollups := []models.StatsRollup{
+		{Date: bson.NewDateTimeFromTime(midnight), Domain: "stats.com", Subdomains: 1},
+		{Date: bson.NewDateTimeFromTime(midnight.AddDate(0, 0, -1)), Domain: "stats.com", Subdomains: 2},
+		{Date: bson.NewDateTimeFromTime(midnight), Domain: "stats.com", Subdomains: 3},
+		{Date: bson.NewDateTimeFromTime(midnight), Subdomains: 4},
+	}
+	for _, rollup := range rollups {
+		if err := store.Rollups.Put(ctx, rollup); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	found, err := store.Rollups.List(ctx, RollupFilter{Domain: "stats.com"})
+	if err != nil || len(found) != 2 || found[0].Subdomains != 2 || found[1].Subdomains != 3 {
+		t.Fatalf("expected the rollups of the domain oldest first: %v %+v", err, found)
+	}
+	if found, _ := store.Rollups.List(ctx, RollupFilter{Domain: "stats.com", Since: midnight}); len(found) != 1 {
+		t.Errorf("expected the rollups since today, got %+v", found)
+	}
+	if found, _ := store.Rollups.List(ctx, RollupFilter{}); len(found) != 1 || found[0].Subdomains != 4 {
+		t.Errorf("expected the global rollup, got %+v", found)
+	}
+	if latest, err := store.Rollups.Latest(ctx, "stats.com"); err != nil || latest.Subdomains != 3 {
+		t.Errorf("expected the rollup of today to be the latest: %v %+v", err, latest)
+	}
+	if latest, err := store.Rollups.Latest(ctx, ""); err != nil || latest.Subdomains != 4 {
+		t.Errorf("expected the global rollup to be the latest: %v %+v", err, latest)
+	}
+	if _, err := store.Rollups.Latest(ctx, "missing.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound without rollups, got %v", err)
+	}
+	if err := store.Rollups.DeleteAll(ctx, "stats.com"); err != nil {
+		t.Fatalf("DeleteAll failed: %v", err)
+	}
+	if found, _ := store.Rollups.List(ctx, RollupFilter{Domain: "stats.com"}); len(found) != 0 {
+		t.Errorf("expected the rollups of the domain to be deleted, got %+v", found)
+	}
+}
+
+func testEvents(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	events := []models.Event{
+		{Type: models.SubdomainDiscovered, Domain: "ev.com", Subdomain: "a.ev.com", Timestamp: bson.NewDateTimeFromTime(now.Add(-3 * time.Hour))},
+		{Type: models.SubdomainResolved, Domain: "ev.com", Subdomain: "a.ev.com", Timestamp: bson.NewDateTimeFromTime(now.Add(-2 * time.Hour))},
+		{Type: models.SubdomainDiscovered, Domain: "ev.com", Subdomain: "b.ev.com", Timestamp: bson.NewDateTimeFromTime(now.Add(-time.Hour))},
+		{Type: models.SubdomainDiscovered, Domain: "other.com", Subdomain: "a.other.com", Timestamp: bson.NewDateTimeFromTime(now)},
+	}
+	for _, event := range events {
+		if err := store.Events.Insert(ctx, event); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	all, err := store.Events.List(ctx, EventFilter{})
+	if err != nil || len(all) != 4 || all[0].Domain != "other.com" || all[0].ID.IsZero() {
+		t.Fatalf("expected every event newest first with an id: %v %+v", err, all)
+	}
+
+	tests := []struct {
+		filter   EventFilter
+		expected int
+	}{
+		{EventFilter{Domain: "ev.com"}, 3},
+		{EventFilter{Domains: []string{"ev.com", "other.com"}}, 4},
+		{EventFilter{Domain: "ev.com", Domains: []string{"other.com"}}, 0},
+		{EventFilter{Subdomain: "a.ev.com"}, 2},
+		{EventFilter{Types: []models.EventType{models.SubdomainResolved}}, 1},
+		{EventFilter{Since: now.Add(-90 * time.Minute)}, 2},
+		{EventFilter{Until: now.Add(-90 * time.Minute)}, 2},
+		{EventFilter{Before: all[1].ID}, 2},
+		{EventFilter{After: all[2].ID}, 2},
+		{EventFilter{After: all[3].ID, Before: all[1].ID}, 1},
+		{EventFilter{Limit: 3}, 3},
+	}
+	for _, test := range tests {
+		found, err := store.Events.List(ctx, test.filter)
+		if err != nil || len(found) != test.expected {
+			t.Errorf("List(%+v) returned %d events, expected %d (%v)", test.filter, len(found), test.expected, err)
+		}
+	}
+
+	if err := store.Events.DeleteAll(ctx, "ev.com"); err != nil {
+		t.Fatalf("DeleteAll failed: %v", err)
+	}
+	if left, _ := store.Events.List(ctx, EventFilter{}); len(left) != 1 || left[0].Domain != "other.com" {
+		t.Fatalf("expected only the events of other domains to be left: %+v", left)
+	}
+}
+
+func testPrograms(t *testing.T, store *Store) {
+	ctx := context.Background()
+
+	for _, name := range []string{"zeta", "acme"} {
+		if err := store.Programs.Create(ctx, models.Program{Name: name, Platform: "hackerone"}); err != nil {
+			t.Fatalf("Create(%s) failed: %v", name, err)
+		}
+	}
+	if err := store.Programs.Create(ctx, models.Program{Name: "acme"}); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists for a duplicate program, got %v", err)
+	}
+
+	updated, err := store.Programs.Update(ctx, "acme", func(program *models.Program) error {
+		program.URL = "https://hackerone.com/acme"
+		return nil
+	})
+	if err != nil || updated.URL == "" || updated.Platform != "hackerone" {
+		t.Fatalf("Update failed: %v %+v", err, updated)
+	}
+
+	programs, err := store.Programs.List(ctx)
+	if err != nil || len(programs) != 2 || programs[0].Name != "acme" || programs[0].URL == "" {
+		t.Fatalf("expected two programs sorted by name: %v %+v", err, programs)
+	}
+
+	if err := store.Programs.Delete(ctx, "zeta"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Programs.Get(ctx, "zeta"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a deleted program, got %v", err)
+	}
+}
+
+func testCascades(t *testing.T, store *Store) {
+	ctx := context.Background()
+	now := bson.NewDateTimeFromTime(time.Now())
+
+	seed := func(domain string, subdomains ...string) {
+		t.Helper()
+		if err := store.Domains.Create(ctx, models.Domain{Name: domain}); err != nil {
+			t.Fatalf("Create domain failed: %v", err)
+		}
+		for _, name := range subdomains {
+			if err := store.Subdomains.Create(ctx, models.Subdomain{Domain: domain, Name: name}); err != nil {
+				t.Fatalf("Create subdomain failed: %v", err)
+			}
+			if err := store.DNS.Insert(ctx, models.DNS{Domain: domain, Subdomain: name, ResolutionDate: now}); err != nil {
+				t.Fatalf("Insert dns failed: %v", err)
+			}
+			if err := store.HTTP.Insert(ctx, models.HTTP{Domain: domain, Subdomain: name, ScanningDate: now}); err != nil {
+				t.Fatalf("Insert http failed: %v", err)
+			}
+		}
+		if err := store.Events.Insert(ctx, models.Event{Type: models.SubdomainDiscovered, Domain: domain, Timestamp: now}); err != nil {
+			t.Fatalf("Insert event failed: %v", err)
+		}
+		if err := store.Rollups.Put(ctx, models.StatsRollup{Date: now, Domain: domain}); err != nil {
+			t.Fatalf("Put rollup failed: %v", err)
+		}
+	}
+
+	seed("cascade.com", "a.cascade.com", "b.cascade.com")
+	err := store.Cascades.DeleteSubdomain(ctx, "cascade.com", "a.cascade.com")
+	if errors.Is(err, ErrNoTransactions) {
+		t.Log("the backend can't run transactions, skipping cascading deletes")
+	} else {
+		if err != nil {
+			t.Fatalf("DeleteSubdomain failed: %v", err)
+		}
+		if _, err := store.DNS.Latest(ctx, "cascade.com", "a.cascade.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected the dns snapshots of the subdomain to be deleted, got %v", err)
+		}
+		if _, err := store.HTTP.Latest(ctx, "cascade.com", "b.cascade.com"); err != nil {
+			t.Fatalf("expected the snapshots of other subdomains to stay: %v", err)
+		}
+		if err := store.Cascades.DeleteSubdomain(ctx, "cascade.com", "a.cascade.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound deleting a missing subdomain, got %v", err)
+		}
+
+		if err := store.Cascades.DeleteDomain(ctx, "cascade.com"); err != nil {
+			t.Fatalf("DeleteDomain failed: %v", err)
+		}
+		if _, err := store.Subdomains.Get(ctx, "cascade.com", "b.cascade.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected the subdomains to be deleted, got %v", err)
+		}
+		if events, _ := store.Events.List(ctx, EventFilter{Domain: "cascade.com"}); len(events) != 0 {
+			t.Fatalf("expected the events to be deleted, got %+v", events)
+		}
+		if rollups, _ := store.Rollups.List(ctx, RollupFilter{Domain: "cascade.com"}); len(rollups) != 0 {
+			t.Fatalf("expected the rollups to be deleted, got %+v", rollups)
+		}
+		if err := store.Cascades.DeleteDomain(ctx, "cascade.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound deleting a missing domain, got %v", err)
+		}
+
+		seed("a.program.com", "www.a.program.com")
+		seed("b.program.com")
+		seed("other.program.com", "www.other.program.com")
+		if err := store.Programs.Create(ctx, models.Program{Name: "cascade"}); err != nil {
+			t.Fatalf("Create program failed: %v", err)
+		}
+		for _, domain := range []string{"a.program.com", "b.program.com"} {
+			_, err := store.Domains.Update(ctx, domain, func(domain *models.Domain) error {
+				domain.Program = "cascade"
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Update domain failed: %v", err)
+			}
+		}
+		domains, err := store.Cascades.DeleteProgram(ctx, "cascade")
+		slices.Sort(domains)
+		if err != nil || !slices.Equal(domains, []string{"a.program.com", "b.program.com"}) {
+			t.Fatalf("expected the program to be deleted with its domains: %v %v", err, domains)
+		}
+		if _, err := store.Programs.Get(ctx, "cascade"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected the program to be deleted, got %v", err)
+		}
+		if _, err := store.DNS.Latest(ctx, "a.program.com", "www.a.program.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected the snapshots of the domains to be deleted, got %v", err)
+		}
+		if _, err := store.Subdomains.Get(ctx, "other.program.com", "www.other.program.com"); err != nil {
+			t.Fatalf("expected the domains outside of the program to stay: %v", err)
+		}
+		if _, err := store.Cascades.DeleteProgram(ctx, "cascade"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound deleting a missing program, got %v", err)
+		}
+		if err := store.Cascades.DeleteDomain(ctx, "other.program.com"); err != nil {
+			t.Fatalf("DeleteDomain failed: %v", err)
+		}
+	}
+
+	// the other tests leave records of domains they never created behind
+	if _, err := store.Cascades.DeleteOrphans(ctx, false, false); err != nil {
+		t.Fatalf("DeleteOrphans failed: %v", err)
+	}
+
+	// leave orphans behind the way an interrupted delete does
+	seed("orphans.com", "a.orphans.com", "b.orphans.com")
+	if err := store.Subdomains.Delete(ctx, "orphans.com", "a.orphans.com"); err != nil {
+		t.Fatalf("Delete subdomain failed: %v", err)
+	}
+	seed("gone.com", "a.gone.com")
+	if err := store.Domains.Delete(ctx, "gone.com"); err != nil {
+		t.Fatalf("Delete domain failed: %v", err)
+	}
+	// and the way an interrupted program delete does
+	seed("ended.com", "a.ended.com")
+	if err := store.Programs.Create(ctx, models.Program{Name: "ended"}); err != nil {
+		t.Fatalf("Create program failed: %v", err)
+	}
+	_, err = store.Domains.Update(ctx, "ended.com", func(domain *models.Domain) error {
+		domain.Program = "ended"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update domain failed: %v", err)
+	}
+	if err := store.Programs.Delete(ctx, "ended"); err != nil {
+		t.Fatalf("Delete program failed: %v", err)
+	}
+	// a domain outside of any program and the global rollups stay
+	if err := store.Rollups.Put(ctx, models.StatsRollup{Date: now}); err != nil {
+		t.Fatalf("Put rollup failed: %v", err)
+	}
+	seed("kept.com")
+
+	// records newer than the sweep may belong to a domain created while it runs
+	late := bson.NewDateTimeFromTime(time.Now().Add(time.Hour))
+	if err := store.Subdomains.Create(ctx, models.Subdomain{Domain: "late.com", Name: "a.late.com", CreatedAt: late}); err != nil {
+		t.Fatalf("Create subdomain failed: %v", err)
+	}
+	if err := store.DNS.Insert(ctx, models.DNS{Domain: "late.com", Subdomain: "a.late.com", ResolutionDate: late}); err != nil {
+		t.Fatalf("Insert dns failed: %v", err)
+	}
+	if err := store.Events.Insert(ctx, models.Event{Type: models.SubdomainDiscovered, Domain: "late.com", Timestamp: late}); err != nil {
+		t.Fatalf("Insert event failed: %v", err)
+	}
+
+	// domains whose program is gone are only counted
+	report, err := store.Cascades.DeleteOrphans(ctx, true, false)
+	want := OrphanReport{DryRun: true, Domains: 1, Subdomains: 1, DNS: 2, HTTP: 2, Events: 1, Rollups: 1}
+	if err != nil || report != want {
+		t.Fatalf("expected the dry run to count the orphans: %v %+v", err, report)
+	}
+	if _, err := store.Subdomains.Get(ctx, "gone.com", "a.gone.com"); err != nil {
+		t.Fatalf("expected the dry run to keep the orphans: %v", err)
+	}
+
+	report, err = store.Cascades.DeleteOrphans(ctx, false, false)
+	want.DryRun = false
+	if err != nil || report != want {
+		t.Fatalf("expected the orphans to be deleted: %v %+v", err, report)
+	}
+	if _, err := store.DNS.Latest(ctx, "orphans.com", "a.orphans.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the orphaned snapshots to be deleted, got %v", err)
+	}
+	if _, err := store.DNS.Latest(ctx, "orphans.com", "b.orphans.com"); err != nil {
+		t.Fatalf("expected the snapshots of existing subdomains to stay: %v", err)
+	}
+	if _, err := store.Subdomains.Get(ctx, "ended.com", "a.ended.com"); err != nil {
+		t.Fatalf("expected the domain of the deleted program to be kept with its subdomains: %v", err)
+	}
+	if _, err := store.Subdomains.Get(ctx, "late.com", "a.late.com"); err != nil {
+		t.Fatalf("expected the records newer than the sweep to stay: %v", err)
+	}
+	if _, err := store.DNS.Latest(ctx, "late.com", "a.late.com"); err != nil {
+		t.Fatalf("expected the snapshots newer than the sweep to stay: %v", err)
+	}
+
+	// unless they are asked to be deleted
+	report, err = store.Cascades.DeleteOrphans(ctx, false, true)
+	want = OrphanReport{Domains: 1, Subdomains: 1, DNS: 1, HTTP: 1, Events: 1, Rollups: 1}
+	if err != nil || report != want {
+		t.Fatalf("expected the domain of the deleted program to be deleted with its records: %v %+v", err, report)
+	}
+	if _, err := store.Domains.Get(ctx, "ended.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the domain of the deleted program to be deleted, got %v", err)
+	}
+	if _, err := store.Domains.Get(ctx, "kept.com"); err != nil {
+		t.Fatalf("expected the domain without a program to stay: %v", err)
+	}
+	if rollups, _ := store.Rollups.List(ctx, RollupFilter{}); !slices.ContainsFunc(rollups, func(rollup models.StatsRollup) bool { return rollup.Date == now }) {
+		t.Fatalf("expected the global rollup to stay, got %+v", rollups)
+	}
+	if report, _ := store.Cascades.DeleteOrphans(ctx, true, true); report != (OrphanReport{DryRun: true}) {
+		t.Fatalf("expected no orphans left, got %+v", report)
+	}
+}
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/models"
+)
+
+// The backends that can't query documents match them in go with these,
+// they must keep the semantics of the mongo queries.
+
+func matchAnnotations(annotations models.Annotations, tag string, triage models.TriageState) bool {
+	if tag != "" && !slices.Contains(annotations.Tags, tag) {
+		return false
+	}
+
+	if triage != "" {
+		state := models.TriageNew
+		if annotations.Triage != nil {
+			state = annotations.Triage.State
+		}
+		if state != triage {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchArchived(archived ArchiveFilter, archivedAt bson.DateTime) bool {
+	switch archived {
+	case ExcludeArchived:
+		return archivedAt == 0
+	case OnlyArchived:
+		return archivedAt != 0
+	}
+	return true
+}
+
+func matchDomain(filter DomainFilter, domain models.Domain) bool {
+	if !matchArchived(filter.Archived, domain.ArchivedAt) {
+		return false
+	}
+	if filter.Program != "" && domain.Program != filter.Program {
+		return false
+	}
+	return matchAnnotations(domain.Annotations, filter.Tag, filter.Triage)
+}
+
+// Apply changes a subdomain the way the update pipeline of mongo does and reports whether anything changed
+func (c SubdomainChanges) Apply(subdomain *models.Subdomain) bool {
+	before := *subdomain
+	beforeTags := slices.Clone(subdomain.Tags)
+
+	if c.WatchDNS != nil && *c.WatchDNS != subdomain.WatchDNS {
+		// watching again starts the adaptive schedule over, turning it off by hand isn't an automatic unwatch
+		subdomain.WatchDNS = *c.WatchDNS
+		subdomain.DNSAutoUnwatched = false
+		subdomain.DNSMisses = 0
+		subdomain.DNSCheckInterval = 0
+		subdomain.NextDNSCheck = 0
+	}
+	if c.WatchHTTP != nil {
+		subdomain.WatchHTTP = *c.WatchHTTP
+	}
+	if c.Rescan {
+		if subdomain.DNSAutoUnwatched {
+			subdomain.WatchDNS = true
+			subdomain.DNSAutoUnwatched = false
+		}
+		subdomain.DNSMisses = 0
+		subdomain.DNSCheckInterval = 0
+		subdomain.NextDNSCheck = 0
+	}
+	if c.OutOfScopeAt != nil {
+		subdomain.OutOfScopeAt = *c.OutOfScopeAt
+	}
+
+	if c.Tags != nil {
+		subdomain.Tags = slices.Clone(*c.Tags)
+	}
+	for _, tag := range c.AddTags {
+		if !slices.Contains(subdomain.Tags, tag) {
+			subdomain.Tags = append(subdomain.Tags, tag)
+		}
+	}
+	subdomain.Tags = slices.DeleteFunc(subdomain.Tags, func(tag string) bool { return slices.Contains(c.RemoveTags, tag) })
+	if len(subdomain.Tags) == 0 {
+		subdomain.Tags = nil
+	}
+
+	// the triage history only records actual changes of the state
+	triageChanged := c.Triage != nil && (subdomain.Triage == nil || subdomain.Triage.State != c.Triage.State)
+	if triageChanged {
+		triage := *c.Triage
+		subdomain.Triage = &triage
+		subdomain.TriageHistory = append(subdomain.TriageHistory, triage)
+	}
+
+	changed := subdomain.WatchDNS != before.WatchDNS || subdomain.WatchHTTP != before.WatchHTTP ||
+		subdomain.DNSAutoUnwatched != before.DNSAutoUnwatched || subdomain.DNSMisses != before.DNSMisses ||
+		subdomain.DNSCheckInterval != before.DNSCheckInterval || subdomain.NextDNSCheck != before.NextDNSCheck ||
+		subdomain.OutOfScopeAt != before.OutOfScopeAt || !slices.Equal(subdomain.Tags, beforeTags) || triageChanged
+	if changed {
+		subdomain.UpdatedAt = c.Now
+	}
+	return changed
+}
+
+func matchSubdomain(filter SubdomainFilter, subdomain models.Subdomain) bool {
+	if !matchArchived(filter.Archived, subdomain.ArchivedAt) {
+		return false
+	}
+	if filter.Domain != "" && subdomain.Domain != filter.Domain {
+		return false
+	}
+	if len(filter.Names) > 0 && !slices.Contains(filter.Names, subdomain.Name) {
+		return false
+	}
+	if filter.Seed != "" && subdomain.Seed != filter.Seed && (subdomain.Seed != "" || filter.Seed != subdomain.Domain) {
+		return false
+	}
+	if !matchAnnotations(subdomain.Annotations, filter.Tag, filter.Triage) {
+		return false
+	}
+	if filter.WatchDNS != nil && subdomain.WatchDNS != *filter.WatchDNS {
+		return false
+	}
+	if filter.WatchHTTP != nil && subdomain.WatchHTTP != *filter.WatchHTTP {
+		return false
+	}
+	if filter.InScope != nil && (subdomain.OutOfScopeAt == 0) != *filter.InScope {
+		return false
+	}
+	if !filter.DNSCheckDue.IsZero() && subdomain.NextDNSCheck != 0 && subdomain.NextDNSCheck.Time().After(filter.DNSCheckDue) {
+		return false
+	}
+	if len(filter.Statuses) > 0 &&
+		!slices.Contains(filter.Statuses, subdomain.DNSStatus) && !slices.Contains(filter.Statuses, subdomain.HTTPStatus) {
+		return false
+	}
+	if len(filter.DNSStatuses) > 0 && !slices.Contains(filter.DNSStatuses, subdomain.DNSStatus) {
+		return false
+	}
+	if len(filter.HTTPStatuses) > 0 && !slices.Contains(filter.HTTPStatuses, subdomain.HTTPStatus) {
+		return false
+	}
+	if filter.Provider != "" && !slices.Contains(subdomain.Providers, filter.Provider) {
+		return false
+	}
+	if filter.NamePattern != "" && !matchNamePattern(filter.NamePattern, subdomain.Name) {
+		return false
+	}
+	if !within(subdomain.CreatedAt, filter.CreatedSince, filter.CreatedUntil) ||
+		!within(subdomain.UpdatedAt, filter.UpdatedSince, filter.UpdatedUntil) {
+		return false
+	}
+
+	return true
+}
+
+// within reports whether date is inside the bounds, zero bounds are open
+func within(date bson.DateTime, since, until time.Time) bool {
+	if !since.IsZero() && date.Time().Before(since) {
+		return false
+	}
+	if !until.IsZero() && date.Time().After(until) {
+		return false
+	}
+	return true
+}
+
+// matchNamePattern reports whether name matches the pattern, * matches any run of characters
+func matchNamePattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+
+	// the first part is a prefix, the last a suffix and the others appear in order between them
+	first, last := parts[0], parts[len(parts)-1]
+	if len(name) < len(first)+len(last) || !strings.HasPrefix(name, first) || !strings.HasSuffix(name, last) {
+		return false
+	}
+	middle := name[len(first) : len(name)-len(last)]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(middle, part)
+		if i < 0 {
+			return false
+		}
+		middle = middle[i+len(part):]
+	}
+	return true
+}
+
+// namePatternRegex converts a name pattern, where * matches any run of characters, to an anchored regex
+func namePatternRegex(pattern string) string {
+	return "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+}
+
+// sortValue returns the value a subdomain is sorted by, missing dates sort as the zero date
+func sortValue(sort SubdomainSort, subdomain models.Subdomain) bson.DateTime {
+	switch sort {
+	case SortByCreatedAt:
+		return subdomain.CreatedAt
+	case SortByUpdatedAt:
+		return subdomain.UpdatedAt
+	case SortByDNSStatusChangedAt:
+		return subdomain.DNSStatusChangedAt
+	case SortByHTTPStatusChangedAt:
+		return subdomain.HTTPStatusChangedAt
+	case SortByNextDNSCheck:
+		return subdomain.NextDNSCheck
+	case SortByArchivedAt:
+		return subdomain.ArchivedAt
+	}
+	return 0
+}
+
+// CursorOf returns the position of a subdomain in a listing sorted by sort
+func CursorOf(sort SubdomainSort, subdomain models.Subdomain) SubdomainCursor {
+	return SubdomainCursor{
+		Value:  sortValue(sort, subdomain),
+		Domain: subdomain.Domain,
+		Name:   subdomain.Name,
+	}
+}
+
+func compareCursors(a, b SubdomainCursor) int {
+	return cmp.Or(
+		cmp.Compare(a.Value, b.Value),
+		strings.Compare(a.Domain, b.Domain),
+		strings.Compare(a.Name, b.Name),
+	)
+}
+
+func matchEvent(filter EventFilter, event models.Event) bool {
+	if filter.Domain != "" && event.Domain != filter.Domain {
+		return false
+	}
+	if len(filter.Domains) > 0 && !slices.Contains(filter.Domains, event.Domain) {
+		return false
+	}
+	if filter.Subdomain != "" && event.Subdomain != filter.Subdomain {
+		return false
+	}
+	if len(filter.Types) > 0 && !slices.Contains(filter.Types, event.Type) {
+		return false
+	}
+	if !filter.Since.IsZero() && event.Timestamp.Time().Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && event.Timestamp.Time().After(filter.Until) {
+		return false
+	}
+	if !filter.Before.IsZero() && bytes.Compare(event.ID[:], filter.Before[:]) >= 0 {
+		return false
+	}
+	if !filter.After.IsZero() && bytes.Compare(event.ID[:], filter.After[:]) <= 0 {
+		return false
+	}
+
+	return true
+}
+
+func newAssetStats() AssetStats {
+	return AssetStats{
+		Providers:    make(map[string]int),
+		Technologies: make(map[string]int),
+		Discovered:   make(map[string]int),
+	}
+}
+
+// dayKey returns the key a day is counted under in the stats
+func dayKey(date bson.DateTime) string {
+	return date.Time().UTC().Format(time.DateOnly)
+}
+
+func matchJob(filter JobFilter, job models.Job) bool {
+	if filter.Type != "" && job.Type != filter.Type {
+		return false
+	}
+	return filter.Since.IsZero() || !job.StartTime.Before(filter.Since)
+}
+
+func matchRollup(filter RollupFilter, rollup models.StatsRollup) bool {
+	if rollup.Domain != filter.Domain {
+		return false
+	}
+	if !filter.Since.IsZero() && rollup.Date.Time().Before(filter.Since) {
+		return false
+	}
+	return filter.Until.IsZero() || !rollup.Date.Time().After(filter.Until)
+}
+
+func newSubdomainStats() SubdomainStats {
+	return SubdomainStats{
+		PerDomain:  make(map[string]int),
+		DNSStatus:  make(map[string]int),
+		HTTPStatus: make(map[string]int),
+	}
+}
+
+// statusKey returns the key a status is counted under in the stats
+func statusKey(status models.StatusType) string {
+	if status == "" {
+		return "none"
+	}
+	return string(status)
+}
@@ -1,4 +1,4 @@
-package database
+package storage
 
 import (
 	"context"
@@ -8,7 +8,8 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-func InsertMockData() error {
+// InsertMockData fills the store with example programs, domains, subdomains and snapshots
+func InsertMockData(ctx context.Context, store *Store) error {
 	now := time.Now()
 
 	// Create domain documents
@@ -18,10 +19,21 @@ func InsertMockData() error {
 		OutOfScope: []string{"*.test.microsoft.com", "internal.microsoft.com"},
 	}
 
+	program1 := models.Program{
+		Name:       "meta",
+		Platform:   "hackerone",
+		URL:        "https://hackerone.com/meta",
+		InScope:    []string{"*.facebook.com", "*.instagram.com"},
+		OutOfScope: []string{"*.internal.meta.com"},
+		Rewards:    &models.Rewards{Bounty: true, Currency: "USD", Min: 500, Max: 300000},
+		CreatedAt:  bson.NewDateTimeFromTime(now.Add(-120 * time.Hour)),
+	}
+
 	domain2 := models.Domain{
 		Name:       "meta.com",
 		InScope:    []string{"*.meta.com", "*.facebook.com", "*.instagram.com"},
 		OutOfScope: []string{"*.internal.meta.com", "*.dev.meta.com"},
+		Program:    "meta",
 	}
 
 	// Create subdomains
@@ -85,20 +97,18 @@ func InsertMockData() error {
 		HTTPStatus: models.FreshService,
 	}
 
-	// Insert domains and subdomains
-	domainColl := GetDBCollection("domains")
-	subdomainColl := GetDBCollection("subdomains")
-	dnsColl := GetDBCollection("dns")
-	httpColl := GetDBCollection("http")
-
-	_, err := domainColl.InsertMany(context.Background(), []models.Domain{domain1, domain2})
-	if err != nil {
+	// Insert the program, domains and subdomains
+	if err := store.Programs.Create(ctx, program1); err != nil {
 		return err
 	}
 
-	subdomains := []models.Subdomain{sub1_1, sub1_2, sub1_3, sub2_1, sub2_2}
-	_, err = subdomainColl.InsertMany(context.Background(), subdomains)
-	if err != nil {
+	for _, domain := range []models.Domain{domain1, domain2} {
+		if err := store.Domains.Create(ctx, domain); err != nil {
+			return err
+		}
+	}
+
+	if err := store.Subdomains.Create(ctx, sub1_1, sub1_2, sub1_3, sub2_1, sub2_2); err != nil {
 		return err
 	}
 
@@ -124,9 +134,10 @@ func InsertMockData() error {
 		{Domain: "meta.com", Subdomain: "developers.meta.com", ResolutionDate: bson.NewDateTimeFromTime(now.Add(-24 * time.Hour)), ARecords: []string{"157.240.195.37", "157.240.195.38"}, NSRecords: []string{"ns3.meta.com", "ns4.meta.com"}},
 		{Domain: "meta.com", Subdomain: "developers.meta.com", ResolutionDate: bson.NewDateTimeFromTime(now.Add(-48 * time.Hour)), ARecords: []string{"157.240.195.39", "157.240.195.40"}, NSRecords: []string{"ns3.meta.com", "ns4.meta.com"}},
 	}
-	_, err = dnsColl.InsertMany(context.Background(), dnsRecords)
-	if err != nil {
-		return err
+	for _, record := range dnsRecords {
+		if err := store.DNS.Insert(ctx, record); err != nil {
+			return err
+		}
 	}
 
 	// HTTP records
@@ -146,9 +157,10 @@ func InsertMockData() error {
 		{Domain: "meta.com", Subdomain: "developers.meta.com", ScanningDate: bson.NewDateTimeFromTime(now), Location: "https://developers.meta.com", StatusCode: 200, Title: "Meta for Developers", CDNName: "Akamai", CDNType: "Enterprise", Technologies: []string{"React", "GraphQL", "Express"}, Words: 3000, Lines: 1000, Port: "443", ContentLength: 789012, ResponseHeaders: map[string]any{"x-fb-debug": "abc789", "x-content-type-options": "nosniff"}, Hashes: map[string]any{"sha256": "c3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}},
 		{Domain: "meta.com", Subdomain: "developers.meta.com", ScanningDate: bson.NewDateTimeFromTime(now.Add(-24 * time.Hour)), StatusCode: 200, Title: "Meta for Developers", CDNName: "Akamai", Technologies: []string{"React", "GraphQL", "Express"}, Words: 2900, Lines: 980, Port: "443", ContentLength: 785000},
 	}
-	_, err = httpColl.InsertMany(context.Background(), httpRecords)
-	if err != nil {
-		return err
+	for _, record := range httpRecords {
+		if err := store.HTTP.Insert(ctx, record); err != nil {
+			return err
+		}
 	}
 
 	return nil
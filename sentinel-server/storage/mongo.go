@@ -0,0 +1,1350 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/search"
+)
+
+// existingBatchSize is how many names a query checking which subdomains exist looks up
+const existingBatchSize = 1000
+
+// NewMongoStore returns a store keeping its data in the collections of db
+func NewMongoStore(db *mongo.Database) *Store {
+	return &Store{
+		Backend:    MongoBackend,
+		Domains:    &mongoDomains{coll: db.Collection("domains")},
+		Subdomains: &mongoSubdomains{coll: db.Collection("subdomains")},
+		DNS:        &mongoDNS{coll: db.Collection("dns")},
+		HTTP:       &mongoHTTP{coll: db.Collection("http")},
+		Jobs:       &mongoJobs{coll: db.Collection("jobs")},
+		Events:     &mongoEvents{coll: db.Collection("events")},
+		Rollups:    &mongoRollups{coll: db.Collection("rollups")},
+		Programs:   &mongoPrograms{coll: db.Collection("programs")},
+		Cascades:   &mongoCascades{db: db},
+		Search:     &mongoSearcher{db: db},
+	}
+}
+
+// findOne decodes the first matching document, ErrNotFound if nothing matches
+func findOne[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	var document T
+	err := coll.FindOne(ctx, filter, opts...).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return document, ErrNotFound
+	}
+	return document, err
+}
+
+// findAll decodes every matching document
+func findAll[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	cursor, err := coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	documents := make([]T, 0)
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// replaceOne overwrites the matching document, ErrNotFound if nothing matches
+func replaceOne(ctx context.Context, coll *mongo.Collection, filter bson.M, document any) error {
+	result, err := coll.ReplaceOne(ctx, filter, document)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// updateAttempts is how many times an update starts over when another writer changed the document in between
+const updateAttempts = 10
+
+// errUpdateConflict is returned when an update lost the race to other writers every time it was tried
+var errUpdateConflict = errors.New("the document kept changing during the update")
+
+// updateOne loads the document matching filter, applies change to it and writes back only the fields change
+// touched, so that fields the model doesn't know are kept. The write only lands if nobody wrote the document
+// since it was loaded, which the version field tells, otherwise the update starts over from the new document.
+// key restores the natural key of the document after change.
+func updateOne[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, change func(*T) error, key func(*T)) (T, error) {
+	var document T
+	for range updateAttempts {
+		stored, err := coll.FindOne(ctx, filter).Raw()
+		if err == mongo.ErrNoDocuments {
+			return document, ErrNotFound
+		}
+		if err != nil {
+			return document, err
+		}
+
+		document = *new(T)
+		if err := bson.Unmarshal(stored, &document); err != nil {
+			return document, err
+		}
+		before, err := bson.Marshal(document)
+		if err != nil {
+			return document, err
+		}
+		if err := change(&document); err != nil {
+			return document, err
+		}
+		key(&document)
+		after, err := bson.Marshal(document)
+		if err != nil {
+			return document, err
+		}
+
+		update, err := changedFields(before, after)
+		if err != nil || len(update) == 0 {
+			return document, err
+		}
+		update["$inc"] = bson.M{"version": int64(1)}
+
+		// documents written before versions were kept don't have one
+		versioned := maps.Clone(filter)
+		if version, err := stored.LookupErr("version"); err == nil {
+			versioned["version"] = version
+		} else {
+			versioned["version"] = bson.M{"$exists": false}
+		}
+		result, err := coll.UpdateOne(ctx, versioned, update)
+		if err != nil {
+			return document, err
+		}
+		if result.MatchedCount > 0 {
+			return document, nil
+		}
+	}
+	return document, errUpdateConflict
+}
+
+// changedFields returns the $set and $unset operators turning the before document into the after one
+func changedFields(before, after bson.Raw) (bson.M, error) {
+	set, unset := bson.M{}, bson.M{}
+
+	afterElements, err := after.Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range afterElements {
+		previous, err := before.LookupErr(element.Key())
+		if err != nil || !previous.Equal(element.Value()) {
+			set[element.Key()] = element.Value()
+		}
+	}
+	beforeElements, err := before.Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range beforeElements {
+		if _, err := after.LookupErr(element.Key()); err != nil {
+			unset[element.Key()] = ""
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+// deleteOne deletes the matching document, ErrNotFound if nothing matches
+func deleteOne(ctx context.Context, coll *mongo.Collection, filter bson.M) error {
+	result, err := coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// insertNew inserts a document unless one matches the filter already
+func insertNew(ctx context.Context, coll *mongo.Collection, filter bson.M, document any) error {
+	count, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrExists
+	}
+
+	_, err = coll.InsertOne(ctx, document)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	return err
+}
+
+var withoutID = bson.M{"_id": 0}
+
+// archiveQuery adds the archived condition to a query
+func archiveQuery(query bson.M, archived ArchiveFilter) {
+	switch archived {
+	case ExcludeArchived:
+		query["archived_at"] = bson.M{"$exists": false}
+	case OnlyArchived:
+		query["archived_at"] = bson.M{"$exists": true}
+	}
+}
+
+// annotationQuery adds the tag and triage conditions to a query
+func annotationQuery(query bson.M, and *bson.A, tag string, triage models.TriageState) {
+	if tag != "" {
+		query["tags"] = tag
+	}
+
+	if triage == models.TriageNew {
+		// assets nobody triaged yet are new as well
+		*and = append(*and, bson.M{"$or": bson.A{
+			bson.M{"triage.state": models.TriageNew},
+			bson.M{"triage": bson.M{"$exists": false}},
+		}})
+	} else if triage != "" {
+		query["triage.state"] = triage
+	}
+}
+
+type mongoDomains struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoDomains) Get(ctx context.Context, name string) (models.Domain, error) {
+	return findOne[models.Domain](ctx, r.coll, bson.M{"name": name}, options.FindOne().SetProjection(withoutID))
+}
+
+func (r *mongoDomains) List(ctx context.Context, filter DomainFilter) ([]models.Domain, error) {
+	query := bson.M{}
+	and := bson.A{}
+	archiveQuery(query, filter.Archived)
+	if filter.Program != "" {
+		query["program"] = filter.Program
+	}
+	annotationQuery(query, &and, filter.Tag, filter.Triage)
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.D{{Key: "name", Value: 1}})
+	return findAll[models.Domain](ctx, r.coll, query, opts)
+}
+
+func (r *mongoDomains) Create(ctx context.Context, domain models.Domain) error {
+	return insertNew(ctx, r.coll, bson.M{"name": domain.Name}, domain)
+}
+
+func (r *mongoDomains) Update(ctx context.Context, name string, change func(*models.Domain) error) (models.Domain, error) {
+	return updateOne(ctx, r.coll, bson.M{"name": name}, change, func(domain *models.Domain) {
+		domain.Name = name
+	})
+}
+
+func (r *mongoDomains) Delete(ctx context.Context, name string) error {
+	return deleteOne(ctx, r.coll, bson.M{"name": name})
+}
+
+type mongoSubdomains struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoSubdomains) Get(ctx context.Context, domain, name string) (models.Subdomain, error) {
+	return findOne[models.Subdomain](ctx, r.coll, bson.M{"domain": domain, "name": name}, options.FindOne().SetProjection(withoutID))
+}
+
+func (r *mongoSubdomains) Existing(ctx context.Context, domain string, names []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	// the names are looked up in batches to keep the queries small
+	for batch := range slices.Chunk(names, existingBatchSize) {
+		opts := options.Find().SetProjection(bson.M{"_id": 0, "name": 1})
+		found, err := findAll[models.Subdomain](ctx, r.coll, bson.M{"domain": domain, "name": bson.M{"$in": batch}}, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, subdomain := range found {
+			existing[subdomain.Name] = true
+		}
+	}
+	return existing, nil
+}
+
+func (r *mongoSubdomains) List(ctx context.Context, filter SubdomainFilter) ([]models.Subdomain, error) {
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.D{{Key: "domain", Value: 1}, {Key: "name", Value: 1}})
+	return findAll[models.Subdomain](ctx, r.coll, subdomainQuery(filter), opts)
+}
+
+func (r *mongoSubdomains) Page(ctx context.Context, page SubdomainPage) ([]models.Subdomain, error) {
+	direction, after := 1, "$gt"
+	if page.Descending {
+		direction, after = -1, "$lt"
+	}
+
+	// sort by the value, domain and name on the stored fields so that the (domain, value, name) indexes serve it,
+	// the domain of a single domain is the same for every subdomain and goes first
+	sort := bson.D{{Key: "domain", Value: direction}, {Key: "name", Value: direction}}
+	field := ""
+	if page.Sort != SortByName && page.Sort != "" {
+		field = string(page.Sort)
+		if page.Filter.Domain != "" {
+			sort = bson.D{{Key: "domain", Value: direction}, {Key: field, Value: direction}, {Key: "name", Value: direction}}
+		} else {
+			sort = append(bson.D{{Key: field, Value: direction}}, sort...)
+		}
+	}
+
+	query := subdomainQuery(page.Filter)
+	if page.After != nil {
+		query = bson.M{"$and": bson.A{query, afterCursor(field, after, *page.After, page.Filter.Domain == "")}}
+	}
+
+	opts := options.Find().SetProjection(withoutID).SetSort(sort).SetLimit(int64(page.Limit))
+	return findAll[models.Subdomain](ctx, r.coll, query, opts)
+}
+
+// afterCursor builds the query of the subdomains past the cursor with plain range predicates on the stored fields,
+// op is $gt or $lt for the sort direction. A missing date sorts as the zero date, which {field: null} matches.
+func afterCursor(field, op string, cursor SubdomainCursor, byDomain bool) bson.M {
+	or := bson.A{}
+	tie := bson.M{}
+	if field != "" {
+		past := bson.M{field: bson.M{op: cursor.Value}}
+		if op == "$lt" && cursor.Value != 0 {
+			// missing dates come last in a descending sort
+			past = bson.M{"$or": bson.A{past, bson.M{field: nil}}}
+		}
+		or = append(or, past)
+
+		tie[field] = cursor.Value
+		if cursor.Value == 0 {
+			tie[field] = nil
+		}
+	}
+	if byDomain {
+		or = append(or, withFields(tie, bson.M{"domain": bson.M{op: cursor.Domain}}))
+		tie = withFields(tie, bson.M{"domain": cursor.Domain})
+	}
+	or = append(or, withFields(tie, bson.M{"name": bson.M{op: cursor.Name}}))
+	return bson.M{"$or": or}
+}
+
+// withFields returns a copy of query with the fields added
+func withFields(query bson.M, fields bson.M) bson.M {
+	merged := maps.Clone(query)
+	maps.Copy(merged, fields)
+	return merged
+}
+
+// subdomainQuery builds the query matching the subdomains selected by the filter
+func subdomainQuery(filter SubdomainFilter) bson.M {
+	query := bson.M{}
+	and := bson.A{}
+	archiveQuery(query, filter.Archived)
+	if filter.Domain != "" {
+		query["domain"] = filter.Domain
+	}
+	if len(filter.Names) > 0 {
+		and = append(and, bson.M{"name": bson.M{"$in": filter.Names}})
+	}
+	if filter.Seed != "" && filter.Seed == filter.Domain {
+		// subdomains found before seeds were recorded came from the domain itself
+		query["seed"] = bson.M{"$in": bson.A{filter.Seed, nil}}
+	} else if filter.Seed != "" {
+		query["seed"] = filter.Seed
+	}
+	annotationQuery(query, &and, filter.Tag, filter.Triage)
+	if filter.WatchDNS != nil {
+		query["watch_dns"] = *filter.WatchDNS
+	}
+	if filter.WatchHTTP != nil {
+		query["watch_http"] = *filter.WatchHTTP
+	}
+	if filter.InScope != nil {
+		query["out_of_scope_at"] = bson.M{"$exists": !*filter.InScope}
+	}
+	if !filter.DNSCheckDue.IsZero() {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"next_dns_check": bson.M{"$exists": false}},
+			bson.M{"next_dns_check": bson.M{"$lte": bson.NewDateTimeFromTime(filter.DNSCheckDue)}},
+		}})
+	}
+	if len(filter.Statuses) > 0 {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"dns_status": bson.M{"$in": filter.Statuses}},
+			bson.M{"http_status": bson.M{"$in": filter.Statuses}},
+		}})
+	}
+	if len(filter.DNSStatuses) > 0 {
+		query["dns_status"] = bson.M{"$in": filter.DNSStatuses}
+	}
+	if len(filter.HTTPStatuses) > 0 {
+		query["http_status"] = bson.M{"$in": filter.HTTPStatuses}
+	}
+	if filter.Provider != "" {
+		query["providers"] = filter.Provider
+	}
+	if filter.NamePattern != "" {
+		query["name"] = bson.M{"$regex": namePatternRegex(filter.NamePattern)}
+	}
+	rangeQuery(query, "created_at", filter.CreatedSince, filter.CreatedUntil)
+	rangeQuery(query, "updated_at", filter.UpdatedSince, filter.UpdatedUntil)
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+
+	return query
+}
+
+// rangeQuery limits field to the bounds, zero bounds are open
+func rangeQuery(query bson.M, field string, since, until time.Time) {
+	bounds := bson.M{}
+	if !since.IsZero() {
+		bounds["$gte"] = bson.NewDateTimeFromTime(since)
+	}
+	if !until.IsZero() {
+		bounds["$lte"] = bson.NewDateTimeFromTime(until)
+	}
+	if len(bounds) > 0 {
+		query[field] = bounds
+	}
+}
+
+func (r *mongoSubdomains) Create(ctx context.Context, subdomains ...models.Subdomain) error {
+	if len(subdomains) == 0 {
+		return nil
+	}
+
+	// Check all of them first so that either all or none are stored
+	keys := make(bson.A, 0, len(subdomains))
+	for _, subdomain := range subdomains {
+		keys = append(keys, bson.M{"domain": subdomain.Domain, "name": subdomain.Name})
+	}
+	count, err := r.coll.CountDocuments(ctx, bson.M{"$or": keys})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrExists
+	}
+
+	_, err = r.coll.InsertMany(ctx, subdomains)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	return err
+}
+
+func (r *mongoSubdomains) Update(ctx context.Context, domain, name string, change func(*models.Subdomain) error) (models.Subdomain, error) {
+	return updateOne(ctx, r.coll, bson.M{"domain": domain, "name": name}, change, func(subdomain *models.Subdomain) {
+		subdomain.Domain, subdomain.Name = domain, name
+	})
+}
+
+func (r *mongoSubdomains) Delete(ctx context.Context, domain, name string) error {
+	return deleteOne(ctx, r.coll, bson.M{"domain": domain, "name": name})
+}
+
+func (r *mongoSubdomains) DeleteAll(ctx context.Context, domain string) error {
+	_, err := r.coll.DeleteMany(ctx, bson.M{"domain": domain})
+	return err
+}
+
+func (r *mongoSubdomains) UpdateMany(ctx context.Context, filter SubdomainFilter, changes SubdomainChanges) (BulkUpdate, error) {
+	result := BulkUpdate{WatchChanged: make([]models.Subdomain, 0)}
+	query := subdomainQuery(filter)
+
+	// the subdomains whose watch flags change are looked up before they do
+	flags := bson.A{}
+	if changes.WatchDNS != nil {
+		flags = append(flags, bson.M{"watch_dns": bson.M{"$ne": *changes.WatchDNS}})
+	}
+	if changes.WatchHTTP != nil {
+		flags = append(flags, bson.M{"watch_http": bson.M{"$ne": *changes.WatchHTTP}})
+	}
+	if changes.Rescan {
+		flags = append(flags, bson.M{"dns_auto_unwatched": true})
+	}
+	if len(flags) > 0 {
+		var err error
+		opts := options.Find().SetProjection(withoutID).SetSort(bson.D{{Key: "domain", Value: 1}, {Key: "name", Value: 1}})
+		result.WatchChanged, err = findAll[models.Subdomain](ctx, r.coll, bson.M{"$and": bson.A{query, bson.M{"$or": flags}}}, opts)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	updated, err := r.coll.UpdateMany(ctx, query, subdomainChangesPipeline(changes))
+	if err != nil {
+		return result, err
+	}
+	result.Matched, result.Updated = updated.MatchedCount, updated.ModifiedCount
+	return result, nil
+}
+
+// subdomainChangesPipeline is the update pipeline applying the changes the way SubdomainChanges.Apply does,
+// subdomains that end up unchanged are left as they were
+func subdomainChangesPipeline(changes SubdomainChanges) mongo.Pipeline {
+	// what the changes compare, the update time and version only move along with them
+	compared := func() bson.D {
+		return bson.D{{Key: "watch_dns", Value: "$watch_dns"}, {Key: "watch_http", Value: "$watch_http"},
+			{Key: "dns_auto_unwatched", Value: "$dns_auto_unwatched"}, {Key: "dns_misses", Value: "$dns_misses"},
+			{Key: "dns_check_interval", Value: "$dns_check_interval"}, {Key: "next_dns_check", Value: "$next_dns_check"},
+			{Key: "out_of_scope_at", Value: "$out_of_scope_at"}, {Key: "tags", Value: "$tags"}, {Key: "triage", Value: "$triage.state"}}
+	}
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.M{"_before": compared()}}}}
+
+	if changes.WatchDNS != nil {
+		// watching again starts the adaptive schedule over
+		same := bson.M{"$eq": bson.A{"$watch_dns", *changes.WatchDNS}}
+		set := bson.M{"watch_dns": *changes.WatchDNS}
+		for _, field := range []string{"dns_auto_unwatched", "dns_misses", "dns_check_interval", "next_dns_check"} {
+			set[field] = bson.M{"$cond": bson.A{same, "$" + field, "$$REMOVE"}}
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: set}})
+	}
+	if changes.WatchHTTP != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{"watch_http": *changes.WatchHTTP}}})
+	}
+	if changes.Rescan {
+		// the stage sees the subdomain as it was before it, so the automatic unwatch is read before it is cleared
+		set := bson.M{"watch_dns": bson.M{"$or": bson.A{"$watch_dns", bson.M{"$eq": bson.A{"$dns_auto_unwatched", true}}}}}
+		for _, field := range []string{"dns_auto_unwatched", "dns_misses", "dns_check_interval", "next_dns_check"} {
+			set[field] = "$$REMOVE"
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: set}})
+	}
+	if changes.OutOfScopeAt != nil {
+		// subdomains in scope don't store the time
+		outOfScopeAt := any(*changes.OutOfScopeAt)
+		if *changes.OutOfScopeAt == 0 {
+			outOfScopeAt = "$$REMOVE"
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{"out_of_scope_at": outOfScopeAt}}})
+	}
+
+	if changes.Tags != nil || len(changes.AddTags) > 0 || len(changes.RemoveTags) > 0 {
+		tags := any(bson.M{"$ifNull": bson.A{"$tags", bson.A{}}})
+		if changes.Tags != nil {
+			tags = bson.M{"$literal": *changes.Tags}
+		}
+		if len(changes.AddTags) > 0 {
+			added := bson.M{"$filter": bson.M{"input": bson.M{"$literal": changes.AddTags}, "cond": bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", tags}}}}}}
+			tags = bson.M{"$concatArrays": bson.A{tags, added}}
+		}
+		if len(changes.RemoveTags) > 0 {
+			tags = bson.M{"$filter": bson.M{"input": tags, "cond": bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", bson.M{"$literal": changes.RemoveTags}}}}}}}
+		}
+		// subdomains without tags don't store them
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{"tags": bson.M{"$let": bson.M{
+			"vars": bson.M{"tags": tags},
+			"in":   bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{bson.M{"$size": "$$tags"}, 0}}, "$$REMOVE", "$$tags"}},
+		}}}}})
+	}
+
+	if changes.Triage != nil {
+		// the triage history only records actual changes of the state
+		triage := bson.M{"$literal": changes.Triage}
+		changed := bson.M{"$ne": bson.A{"$triage.state", changes.Triage.State}}
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{
+			"triage":         bson.M{"$cond": bson.A{changed, triage, "$triage"}},
+			"triage_history": bson.M{"$cond": bson.A{changed, bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$triage_history", bson.A{}}}, bson.A{triage}}}, "$triage_history"}},
+		}}})
+	}
+
+	changed := bson.M{"$ne": bson.A{"$_before", compared()}}
+	return append(pipeline,
+		bson.D{{Key: "$set", Value: bson.M{
+			"updated_at": bson.M{"$cond": bson.A{changed, changes.Now, "$updated_at"}},
+			"version":    bson.M{"$cond": bson.A{changed, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", int64(0)}}, int64(1)}}, "$version"}},
+		}}},
+		bson.D{{Key: "$unset", Value: "_before"}},
+	)
+}
+
+func (r *mongoSubdomains) SetArchivedAt(ctx context.Context, domain string, from, to bson.DateTime) (int64, error) {
+	filter := bson.M{"domain": domain, "archived_at": from}
+	if from == 0 {
+		// active subdomains don't have an archive time
+		filter["archived_at"] = bson.M{"$in": bson.A{nil, from}}
+	}
+	update := bson.M{
+		"$set": bson.M{"archived_at": to, "updated_at": bson.NewDateTimeFromTime(time.Now())},
+		"$inc": bson.M{"version": int64(1)},
+	}
+	if to == 0 {
+		update["$set"] = bson.M{"updated_at": bson.NewDateTimeFromTime(time.Now())}
+		update["$unset"] = bson.M{"archived_at": ""}
+	}
+
+	result, err := r.coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
+
+func (r *mongoSubdomains) Stats(ctx context.Context, domains ...string) (SubdomainStats, error) {
+	stats := newSubdomainStats()
+
+	// count the subdomains by their statuses in one go
+	match := bson.M{"archived_at": bson.M{"$exists": false}}
+	if len(domains) > 0 {
+		match["domain"] = bson.M{"$in": domains}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"total":       bson.A{bson.M{"$count": "count"}},
+			"dns_status":  bson.A{bson.M{"$group": bson.M{"_id": "$dns_status", "count": bson.M{"$sum": 1}}}},
+			"http_status": bson.A{bson.M{"$group": bson.M{"_id": "$http_status", "count": bson.M{"$sum": 1}}}},
+			"domains":     bson.A{bson.M{"$group": bson.M{"_id": "$domain", "count": bson.M{"$sum": 1}}}},
+		}}},
+	}
+	cursor, err := r.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+
+	type group struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	var facets []struct {
+		Total      []struct{ Count int } `bson:"total"`
+		DNSStatus  []group               `bson:"dns_status"`
+		HTTPStatus []group               `bson:"http_status"`
+		Domains    []group               `bson:"domains"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return stats, err
+	}
+	if len(facets) == 0 {
+		return stats, nil
+	}
+
+	if len(facets[0].Total) > 0 {
+		stats.Total = facets[0].Total[0].Count
+	}
+	for _, g := range facets[0].DNSStatus {
+		stats.DNSStatus[statusKey(models.StatusType(g.ID))] += g.Count
+	}
+	for _, g := range facets[0].HTTPStatus {
+		stats.HTTPStatus[statusKey(models.StatusType(g.ID))] += g.Count
+	}
+	for _, g := range facets[0].Domains {
+		stats.PerDomain[g.ID] += g.Count
+	}
+
+	return stats, nil
+}
+
+func (r *mongoSubdomains) Assets(ctx context.Context, since time.Time, domains ...string) (AssetStats, error) {
+	stats := newAssetStats()
+
+	match := bson.M{"archived_at": bson.M{"$exists": false}}
+	if len(domains) > 0 {
+		match["domain"] = bson.M{"$in": domains}
+	}
+	countBy := func(field any) bson.M {
+		return bson.M{"$group": bson.M{"_id": field, "count": bson.M{"$sum": 1}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"providers": bson.A{bson.M{"$unwind": "$providers"}, countBy("$providers")},
+			"discovered": bson.A{
+				bson.M{"$match": bson.M{"created_at": bson.M{"$gte": bson.NewDateTimeFromTime(since)}}},
+				countBy(bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at"}}),
+			},
+			"technologies": bson.A{
+				latestSnapshot("http", "scanning_date"),
+				bson.M{"$unwind": "$http"},
+				bson.M{"$unwind": "$http.technologies"},
+				countBy("$http.technologies"),
+			},
+		}}},
+	}
+	cursor, err := r.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+
+	type group struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	var facets []struct {
+		Providers    []group `bson:"providers"`
+		Discovered   []group `bson:"discovered"`
+		Technologies []group `bson:"technologies"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return stats, err
+	}
+	if len(facets) == 0 {
+		return stats, nil
+	}
+
+	for _, g := range facets[0].Providers {
+		stats.Providers[g.ID] += g.Count
+	}
+	for _, g := range facets[0].Discovered {
+		stats.Discovered[g.ID] += g.Count
+	}
+	for _, g := range facets[0].Technologies {
+		stats.Technologies[g.ID] += g.Count
+	}
+
+	return stats, nil
+}
+
+func (r *mongoSubdomains) Discovered(ctx context.Context, since time.Time, domains ...string) (map[string]int, error) {
+	discovered := make(map[string]int)
+
+	match := bson.M{"archived_at": bson.M{"$exists": false}, "created_at": bson.M{"$gte": bson.NewDateTimeFromTime(since)}}
+	if len(domains) > 0 {
+		match["domain"] = bson.M{"$in": domains}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at"}},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+	cursor, err := r.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return discovered, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return discovered, err
+	}
+	for _, g := range groups {
+		discovered[g.ID] += g.Count
+	}
+
+	return discovered, nil
+}
+
+type mongoDNS struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoDNS) Latest(ctx context.Context, domain, subdomain string) (models.DNS, error) {
+	opts := options.FindOne().SetProjection(withoutID).SetSort(bson.M{"resolution_date": -1})
+	return findOne[models.DNS](ctx, r.coll, bson.M{"domain": domain, "subdomain": subdomain}, opts)
+}
+
+func (r *mongoDNS) History(ctx context.Context, domain, subdomain string, limit int) ([]models.DNS, error) {
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.M{"resolution_date": -1}).SetLimit(int64(limit))
+	return findAll[models.DNS](ctx, r.coll, bson.M{"domain": domain, "subdomain": subdomain}, opts)
+}
+
+func (r *mongoDNS) Insert(ctx context.Context, record models.DNS) error {
+	_, err := r.coll.InsertOne(ctx, record)
+	return err
+}
+
+func (r *mongoDNS) Replace(ctx context.Context, record models.DNS) error {
+	filter := bson.M{"domain": record.Domain, "subdomain": record.Subdomain, "resolution_date": record.ResolutionDate}
+	return replaceOne(ctx, r.coll, filter, record)
+}
+
+func (r *mongoDNS) Delete(ctx context.Context, domain, subdomain string) error {
+	_, err := r.coll.DeleteMany(ctx, snapshotFilter(domain, subdomain))
+	return err
+}
+
+func (r *mongoDNS) Expired(ctx context.Context, domain string, before time.Time) ([]models.DNS, error) {
+	// snapshots stored before last_seen was tracked don't have one
+	filter := bson.M{"domain": domain, "resolution_date": bson.M{"$lt": before}, "last_seen": bson.M{"$not": bson.M{"$gte": before}}}
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.D{{Key: "subdomain", Value: 1}, {Key: "resolution_date", Value: 1}})
+	return findAll[models.DNS](ctx, r.coll, filter, opts)
+}
+
+func (r *mongoDNS) Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error) {
+	return pruneSnapshots(ctx, r.coll, "resolution_date", domain, subdomain, dates)
+}
+
+func (r *mongoDNS) Count(ctx context.Context, domain string) (int64, error) {
+	return r.coll.CountDocuments(ctx, bson.M{"domain": domain})
+}
+
+type mongoHTTP struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoHTTP) Latest(ctx context.Context, domain, subdomain string) (models.HTTP, error) {
+	opts := options.FindOne().SetProjection(withoutID).SetSort(bson.M{"scanning_date": -1})
+	return findOne[models.HTTP](ctx, r.coll, bson.M{"domain": domain, "subdomain": subdomain}, opts)
+}
+
+func (r *mongoHTTP) History(ctx context.Context, domain, subdomain string, limit int) ([]models.HTTP, error) {
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.M{"scanning_date": -1}).SetLimit(int64(limit))
+	return findAll[models.HTTP](ctx, r.coll, bson.M{"domain": domain, "subdomain": subdomain}, opts)
+}
+
+func (r *mongoHTTP) Insert(ctx context.Context, record models.HTTP) error {
+	_, err := r.coll.InsertOne(ctx, record)
+	return err
+}
+
+func (r *mongoHTTP) Replace(ctx context.Context, record models.HTTP) error {
+	filter := bson.M{"domain": record.Domain, "subdomain": record.Subdomain, "scanning_date": record.ScanningDate}
+	return replaceOne(ctx, r.coll, filter, record)
+}
+
+func (r *mongoHTTP) Delete(ctx context.Context, domain, subdomain string) error {
+	_, err := r.coll.DeleteMany(ctx, snapshotFilter(domain, subdomain))
+	return err
+}
+
+func (r *mongoHTTP) Expired(ctx context.Context, domain string, before time.Time) ([]models.HTTP, error) {
+	// snapshots stored before last_seen was tracked don't have one
+	filter := bson.M{"domain": domain, "scanning_date": bson.M{"$lt": before}, "last_seen": bson.M{"$not": bson.M{"$gte": before}}}
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.D{{Key: "subdomain", Value: 1}, {Key: "scanning_date", Value: 1}})
+	return findAll[models.HTTP](ctx, r.coll, filter, opts)
+}
+
+func (r *mongoHTTP) Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error) {
+	return pruneSnapshots(ctx, r.coll, "scanning_date", domain, subdomain, dates)
+}
+
+func (r *mongoHTTP) Count(ctx context.Context, domain string) (int64, error) {
+	return r.coll.CountDocuments(ctx, bson.M{"domain": domain})
+}
+
+// pruneSnapshots deletes the snapshots of a subdomain whose date field is one of the dates
+func pruneSnapshots(ctx context.Context, coll *mongo.Collection, dateField, domain, subdomain string, dates []bson.DateTime) (int64, error) {
+	if len(dates) == 0 {
+		return 0, nil
+	}
+	result, err := coll.DeleteMany(ctx, bson.M{"domain": domain, "subdomain": subdomain, dateField: bson.M{"$in": dates}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func snapshotFilter(domain, subdomain string) bson.M {
+	filter := bson.M{"domain": domain}
+	if subdomain != "" {
+		filter["subdomain"] = subdomain
+	}
+	return filter
+}
+
+type mongoJobs struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoJobs) Latest(ctx context.Context, jobType models.JobType) (models.Job, error) {
+	opts := options.FindOne().SetSort(bson.M{"start_time": -1})
+	return findOne[models.Job](ctx, r.coll, bson.M{"type": jobType}, opts)
+}
+
+func (r *mongoJobs) Running(ctx context.Context, jobType models.JobType) (models.Job, error) {
+	opts := options.FindOne().SetSort(bson.M{"start_time": -1})
+	return findOne[models.Job](ctx, r.coll, bson.M{"type": jobType, "end_time": bson.M{"$exists": false}}, opts)
+}
+
+func (r *mongoJobs) Start(ctx context.Context, job models.Job) (models.Job, error) {
+	if job.ID.IsZero() {
+		job.ID = bson.NewObjectID()
+	}
+	_, err := r.coll.InsertOne(ctx, job)
+	return job, err
+}
+
+func (r *mongoJobs) Get(ctx context.Context, id bson.ObjectID) (models.Job, error) {
+	return findOne[models.Job](ctx, r.coll, bson.M{"_id": id})
+}
+
+func (r *mongoJobs) Finish(ctx context.Context, job models.Job) error {
+	set := bson.M{"end_time": job.EndTime, "status": job.Status}
+	if job.Error != "" {
+		set["error"] = job.Error
+	}
+
+	filter := bson.M{"type": job.Type, "end_time": bson.M{"$exists": false}}
+	if !job.ID.IsZero() {
+		filter = bson.M{"_id": job.ID}
+	}
+	_, err := r.coll.UpdateMany(ctx, filter, bson.M{"$set": set})
+	return err
+}
+
+func (r *mongoJobs) DeleteFinished(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	filter := bson.M{"end_time": bson.M{"$lt": before}}
+	if dryRun {
+		return r.coll.CountDocuments(ctx, filter)
+	}
+	result, err := r.coll.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoJobs) List(ctx context.Context, filter JobFilter) ([]models.Job, error) {
+	query := bson.M{}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if !filter.Since.IsZero() {
+		query["start_time"] = bson.M{"$gte": filter.Since}
+	}
+	opts := options.Find().SetSort(bson.M{"start_time": -1}).SetLimit(int64(filter.Limit))
+	return findAll[models.Job](ctx, r.coll, query, opts)
+}
+
+type mongoEvents struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoEvents) Insert(ctx context.Context, events ...models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	documents := make([]any, 0, len(events))
+	for _, event := range events {
+		if event.ID.IsZero() {
+			event.ID = bson.NewObjectID()
+		}
+		documents = append(documents, event)
+	}
+
+	_, err := r.coll.InsertMany(ctx, documents)
+	return err
+}
+
+func (r *mongoEvents) List(ctx context.Context, filter EventFilter) ([]models.Event, error) {
+	query := bson.M{}
+	domain := bson.M{}
+	if filter.Domain != "" {
+		domain["$eq"] = filter.Domain
+	}
+	if len(filter.Domains) > 0 {
+		domain["$in"] = filter.Domains
+	}
+	if len(domain) > 0 {
+		query["domain"] = domain
+	}
+	if filter.Subdomain != "" {
+		query["subdomain"] = filter.Subdomain
+	}
+	if len(filter.Types) > 0 {
+		query["type"] = bson.M{"$in": filter.Types}
+	}
+
+	timeRange := bson.M{}
+	if !filter.Since.IsZero() {
+		timeRange["$gte"] = bson.NewDateTimeFromTime(filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		timeRange["$lte"] = bson.NewDateTimeFromTime(filter.Until)
+	}
+	if len(timeRange) > 0 {
+		query["timestamp"] = timeRange
+	}
+
+	idRange := bson.M{}
+	if !filter.Before.IsZero() {
+		idRange["$lt"] = filter.Before
+	}
+	if !filter.After.IsZero() {
+		idRange["$gt"] = filter.After
+	}
+	if len(idRange) > 0 {
+		query["_id"] = idRange
+	}
+
+	// newest first, ids grow with insertion time
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(filter.Limit))
+	return findAll[models.Event](ctx, r.coll, query, opts)
+}
+
+func (r *mongoEvents) DeleteAll(ctx context.Context, domain string) error {
+	_, err := r.coll.DeleteMany(ctx, bson.M{"domain": domain})
+	return err
+}
+
+type mongoRollups struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoRollups) Put(ctx context.Context, rollup models.StatsRollup) error {
+	filter := bson.M{"domain": rollup.Domain, "date": rollup.Date}
+	_, err := r.coll.ReplaceOne(ctx, filter, rollup, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoRollups) List(ctx context.Context, filter RollupFilter) ([]models.StatsRollup, error) {
+	query := bson.M{"domain": filter.Domain}
+	dateRange := bson.M{}
+	if !filter.Since.IsZero() {
+		dateRange["$gte"] = bson.NewDateTimeFromTime(filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		dateRange["$lte"] = bson.NewDateTimeFromTime(filter.Until)
+	}
+	if len(dateRange) > 0 {
+		query["date"] = dateRange
+	}
+
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.M{"date": 1})
+	return findAll[models.StatsRollup](ctx, r.coll, query, opts)
+}
+
+func (r *mongoRollups) Latest(ctx context.Context, domain string) (models.StatsRollup, error) {
+	opts := options.FindOne().SetProjection(withoutID).SetSort(bson.M{"date": -1})
+	return findOne[models.StatsRollup](ctx, r.coll, bson.M{"domain": domain}, opts)
+}
+
+func (r *mongoRollups) DeleteAll(ctx context.Context, domain string) error {
+	_, err := r.coll.DeleteMany(ctx, bson.M{"domain": domain})
+	return err
+}
+
+type mongoPrograms struct {
+	coll *mongo.Collection
+}
+
+func (r *mongoPrograms) Get(ctx context.Context, name string) (models.Program, error) {
+	return findOne[models.Program](ctx, r.coll, bson.M{"name": name}, options.FindOne().SetProjection(withoutID))
+}
+
+func (r *mongoPrograms) List(ctx context.Context) ([]models.Program, error) {
+	opts := options.Find().SetProjection(withoutID).SetSort(bson.D{{Key: "name", Value: 1}})
+	return findAll[models.Program](ctx, r.coll, bson.M{}, opts)
+}
+
+func (r *mongoPrograms) Create(ctx context.Context, program models.Program) error {
+	return insertNew(ctx, r.coll, bson.M{"name": program.Name}, program)
+}
+
+func (r *mongoPrograms) Update(ctx context.Context, name string, change func(*models.Program) error) (models.Program, error) {
+	return updateOne(ctx, r.coll, bson.M{"name": name}, change, func(program *models.Program) {
+		program.Name = name
+	})
+}
+
+func (r *mongoPrograms) Delete(ctx context.Context, name string) error {
+	return deleteOne(ctx, r.coll, bson.M{"name": name})
+}
+
+type mongoCascades struct {
+	db *mongo.Database
+
+	// whether the deployment is a replica set or sharded cluster, the only ones running transactions
+	checked      bool
+	transactions bool
+	mu           sync.Mutex
+}
+
+// supportsTransactions asks the deployment once whether it can run transactions
+func (r *mongoCascades) supportsTransactions(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.checked {
+		var hello struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		if err := r.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+			return false, err
+		}
+		r.checked = true
+		r.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+	}
+
+	return r.transactions, nil
+}
+
+// transaction runs fn in a transaction, ErrNoTransactions if the deployment can't run one
+func (r *mongoCascades) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	supported, err := r.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return ErrNoTransactions
+	}
+
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+func (r *mongoCascades) DeleteDomain(ctx context.Context, name string) error {
+	return r.transaction(ctx, func(ctx context.Context) error {
+		if err := deleteOne(ctx, r.db.Collection("domains"), bson.M{"name": name}); err != nil {
+			return err
+		}
+		for _, collection := range []string{"subdomains", "dns", "http", "events", "rollups"} {
+			if _, err := r.db.Collection(collection).DeleteMany(ctx, bson.M{"domain": name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *mongoCascades) DeleteProgram(ctx context.Context, name string) (domains []string, err error) {
+	err = r.transaction(ctx, func(ctx context.Context) error {
+		domains = make([]string, 0)
+		if err := r.db.Collection("domains").Distinct(ctx, "name", bson.M{"program": name}).Decode(&domains); err != nil {
+			return err
+		}
+		if err := deleteOne(ctx, r.db.Collection("programs"), bson.M{"name": name}); err != nil {
+			return err
+		}
+		if _, err := r.db.Collection("domains").DeleteMany(ctx, bson.M{"program": name}); err != nil {
+			return err
+		}
+		for _, collection := range []string{"subdomains", "dns", "http", "events", "rollups"} {
+			if _, err := r.db.Collection(collection).DeleteMany(ctx, bson.M{"domain": bson.M{"$in": domains}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return domains, err
+}
+
+func (r *mongoCascades) DeleteSubdomain(ctx context.Context, domain, name string) error {
+	return r.transaction(ctx, func(ctx context.Context) error {
+		if err := deleteOne(ctx, r.db.Collection("subdomains"), bson.M{"domain": domain, "name": name}); err != nil {
+			return err
+		}
+		for _, collection := range []string{"dns", "http"} {
+			if _, err := r.db.Collection(collection).DeleteMany(ctx, bson.M{"domain": domain, "subdomain": name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *mongoCascades) DeleteOrphans(ctx context.Context, dryRun, deleteDomains bool) (OrphanReport, error) {
+	report := OrphanReport{DryRun: dryRun}
+	// records written from here on may belong to a domain created after the domains were read
+	before := bson.M{"$not": bson.M{"$gte": bson.NewDateTimeFromTime(time.Now())}}
+
+	programs := bson.A{}
+	if err := r.db.Collection("programs").Distinct(ctx, "name", bson.M{}).Decode(&programs); err != nil {
+		return report, err
+	}
+	// the program of a domain is only set while it belongs to one
+	orphanedDomains := bson.M{"program": bson.M{"$exists": true, "$nin": append(programs, "")}}
+
+	// the domains that stay, the records of deleted domains are orphans as well
+	staying := bson.M{}
+	if deleteDomains {
+		staying = bson.M{"$nor": bson.A{orphanedDomains}}
+	}
+	domains := bson.A{}
+	if err := r.db.Collection("domains").Distinct(ctx, "name", staying).Decode(&domains); err != nil {
+		return report, err
+	}
+	if domains == nil {
+		// $nin needs an array even without domains
+		domains = bson.A{}
+	}
+
+	// count or delete the documents matching filter
+	sweep := func(collection string, filter bson.M) (int64, error) {
+		if dryRun {
+			return r.db.Collection(collection).CountDocuments(ctx, filter)
+		}
+		result, err := r.db.Collection(collection).DeleteMany(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+		return result.DeletedCount, nil
+	}
+
+	var err error
+	if deleteDomains {
+		report.Domains, err = sweep("domains", orphanedDomains)
+	} else {
+		report.Domains, err = r.db.Collection("domains").CountDocuments(ctx, orphanedDomains)
+	}
+	if err != nil {
+		return report, err
+	}
+	orphaned := bson.M{"domain": bson.M{"$nin": domains}}
+	if report.Subdomains, err = sweep("subdomains", withFields(orphaned, bson.M{"created_at": before})); err != nil {
+		return report, err
+	}
+	if report.Events, err = sweep("events", withFields(orphaned, bson.M{"timestamp": before})); err != nil {
+		return report, err
+	}
+	// the global rollups don't have a domain
+	if report.Rollups, err = sweep("rollups", bson.M{"domain": bson.M{"$nin": append(domains, "")}, "date": before}); err != nil {
+		return report, err
+	}
+
+	// snapshots are orphans when their subdomain is gone, or about to be as an orphan itself
+	for _, snapshots := range []struct {
+		collection string
+		date       string
+		count      *int64
+	}{{"dns", "resolution_date", &report.DNS}, {"http", "scanning_date", &report.HTTP}} {
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{snapshots.date: before}}},
+			{{Key: "$group", Value: bson.M{"_id": bson.M{"domain": "$domain", "subdomain": "$subdomain"}}}},
+			{{Key: "$lookup", Value: bson.M{
+				"from": "subdomains",
+				"let":  bson.M{"domain": "$_id.domain", "subdomain": "$_id.subdomain"},
+				"pipeline": bson.A{
+					bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+						bson.M{"$eq": bson.A{"$domain", "$$domain"}},
+						bson.M{"$eq": bson.A{"$name", "$$subdomain"}},
+					}}}},
+					bson.M{"$limit": 1},
+				},
+				"as": "subdomain",
+			}}},
+			{{Key: "$match", Value: bson.M{"$or": bson.A{
+				bson.M{"subdomain": bson.M{"$size": 0}},
+				bson.M{"_id.domain": bson.M{"$nin": domains}},
+			}}}},
+		}
+		cursor, err := r.db.Collection(snapshots.collection).Aggregate(ctx, pipeline)
+		if err != nil {
+			return report, err
+		}
+		var pairs []struct {
+			ID struct {
+				Domain    string `bson:"domain"`
+				Subdomain string `bson:"subdomain"`
+			} `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &pairs); err != nil {
+			return report, err
+		}
+
+		for _, pair := range pairs {
+			count, err := sweep(snapshots.collection, bson.M{"domain": pair.ID.Domain, "subdomain": pair.ID.Subdomain, snapshots.date: before})
+			if err != nil {
+				return report, err
+			}
+			*snapshots.count += count
+		}
+	}
+
+	return report, nil
+}
+
+// mongoSearcher compiles searches into aggregations over the subdomains joined with their latest snapshots
+type mongoSearcher struct {
+	db *mongo.Database
+}
+
+func (r *mongoSearcher) Find(ctx context.Context, page SearchPage) ([]search.Result, error) {
+	// the terms on the subdomain itself narrow it down before anything is joined
+	match := bson.A{
+		subdomainQuery(page.Filter),
+		page.Query.Filter(search.SubdomainSource),
+	}
+	if page.After != nil {
+		match = append(match, bson.M{"$or": bson.A{
+			bson.M{"domain": bson.M{"$gt": page.After.Domain}},
+			bson.M{"domain": page.After.Domain, "name": bson.M{"$gt": page.After.Name}},
+		}})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": match}}},
+		{{Key: "$sort", Value: bson.D{{Key: "domain", Value: 1}, {Key: "name", Value: 1}}}},
+	}
+
+	// without terms on the snapshots only the subdomains of the page have to be joined
+	joinedTerms := page.Query.Needs(search.DNSSource) || page.Query.Needs(search.HTTPSource)
+	limit := bson.D{{Key: "$limit", Value: page.Limit}}
+	if page.Limit > 0 && !joinedTerms {
+		pipeline = append(pipeline, limit)
+	}
+	pipeline = append(pipeline,
+		latestSnapshot("dns", "resolution_date"),
+		latestSnapshot("http", "scanning_date"),
+		bson.D{{Key: "$set", Value: bson.M{
+			"dns":  bson.M{"$arrayElemAt": bson.A{"$dns", 0}},
+			"http": bson.M{"$arrayElemAt": bson.A{"$http", 0}},
+		}}},
+	)
+	if joinedTerms {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: page.Query.Filter(search.DNSSource, search.HTTPSource)}})
+		if page.Limit > 0 {
+			pipeline = append(pipeline, limit)
+		}
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.M{
+		"_id":       0,
+		"subdomain": "$$ROOT",
+		"dns":       "$dns",
+		"http":      "$http",
+	}}})
+
+	cursor, err := r.db.Collection("subdomains").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]search.Result, 0)
+	return results, cursor.All(ctx, &results)
+}
+
+// latestSnapshot joins the latest snapshot of a subdomain from coll, sorted by date, as a one element array
+func latestSnapshot(coll, date string) bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.M{
+		"from": coll,
+		"let":  bson.M{"domain": "$domain", "name": "$name"},
+		"pipeline": bson.A{
+			bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$domain", "$$domain"}},
+				bson.M{"$eq": bson.A{"$subdomain", "$$name"}},
+			}}}},
+			bson.M{"$sort": bson.M{date: -1}},
+			bson.M{"$limit": 1},
+			bson.M{"$project": bson.M{"_id": 0}},
+		},
+		"as": coll,
+	}}}
+}
@@ -0,0 +1,510 @@
+// Package storage puts the assets sentinel keeps track of behind repository interfaces.
+// MongoDB is the default backend, a single bbolt file can be used instead for small or offline deployments.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/0xgwyn/sentinel/config"
+	"github.com/0xgwyn/sentinel/database"
+	"github.com/0xgwyn/sentinel/models"
+	"github.com/0xgwyn/sentinel/search"
+)
+
+var (
+	// ErrNoTransactions is returned by cascading deletes when the backend can't run them in a transaction
+	ErrNoTransactions = errors.New("transactions are not supported")
+	// ErrNotFound is returned when the requested document doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrExists is returned when a document with the same natural key already exists
+	ErrExists = errors.New("already exists")
+)
+
+// Backend is the kind of database a store keeps its data in
+type Backend string
+
+const (
+	MongoBackend Backend = "mongo"
+	BoltBackend  Backend = "bolt"
+)
+
+// ArchiveFilter selects archived assets in a listing
+type ArchiveFilter int
+
+const (
+	// ExcludeArchived hides archived assets, the default
+	ExcludeArchived ArchiveFilter = iota
+	// IncludeArchived lists archived and active assets
+	IncludeArchived
+	// OnlyArchived lists archived assets only
+	OnlyArchived
+)
+
+// DomainFilter narrows down a domain listing, empty fields match everything but archived domains
+type DomainFilter struct {
+	Archived ArchiveFilter
+	Program  string
+	Tag      string
+	// TriageNew also matches domains nobody triaged yet
+	Triage models.TriageState
+}
+
+// SubdomainFilter narrows down a subdomain listing, empty fields match everything but archived subdomains
+type SubdomainFilter struct {
+	Archived ArchiveFilter
+	Domain   string
+	// only subdomains with one of these names
+	Names []string
+	Seed  string
+	Tag   string
+	// TriageNew also matches subdomains nobody triaged yet
+	Triage    models.TriageState
+	WatchDNS  *bool
+	WatchHTTP *bool
+	// only subdomains in, or out of, the scope of their domain
+	InScope *bool
+	// only subdomains whose next dns check is due at this time
+	DNSCheckDue time.Time
+	// only subdomains whose dns or http status is one of these
+	Statuses []models.StatusType
+	// only subdomains whose dns status, or http status, is one of these
+	DNSStatuses  []models.StatusType
+	HTTPStatuses []models.StatusType
+	// only subdomains reported by this provider
+	Provider string
+	// only subdomains whose name matches this pattern, * matches any run of characters
+	NamePattern string
+	// only subdomains created, or updated, within these bounds
+	CreatedSince time.Time
+	CreatedUntil time.Time
+	UpdatedSince time.Time
+	UpdatedUntil time.Time
+}
+
+// SubdomainSort is the field a page of subdomains is sorted by, subdomains with the same value are sorted by domain and name
+type SubdomainSort string
+
+const (
+	SortByName                SubdomainSort = "name"
+	SortByCreatedAt           SubdomainSort = "created_at"
+	SortByUpdatedAt           SubdomainSort = "updated_at"
+	SortByDNSStatusChangedAt  SubdomainSort = "dns_status_changed_at"
+	SortByHTTPStatusChangedAt SubdomainSort = "http_status_changed_at"
+	SortByNextDNSCheck        SubdomainSort = "next_dns_check"
+	SortByArchivedAt          SubdomainSort = "archived_at"
+)
+
+// SubdomainSorts are the fields subdomains can be sorted by
+var SubdomainSorts = []SubdomainSort{
+	SortByName,
+	SortByCreatedAt,
+	SortByUpdatedAt,
+	SortByDNSStatusChangedAt,
+	SortByHTTPStatusChangedAt,
+	SortByNextDNSCheck,
+	SortByArchivedAt,
+}
+
+// SubdomainCursor is the position of a subdomain in a sorted listing
+type SubdomainCursor struct {
+	Value  bson.DateTime `json:"v,omitempty"`
+	Domain string        `json:"d"`
+	Name   string        `json:"n"`
+}
+
+// SubdomainPage selects a page of a subdomain listing
+type SubdomainPage struct {
+	Filter     SubdomainFilter
+	Sort       SubdomainSort
+	Descending bool
+	// the page starts after this position, nil starts at the beginning
+	After *SubdomainCursor
+	// maximum number of subdomains, 0 means no limit
+	Limit int
+}
+
+// SubdomainChanges are the changes an update applies to subdomains, nil and empty fields are left alone
+type SubdomainChanges struct {
+	WatchDNS  *bool
+	WatchHTTP *bool
+	// Tags replaces the tags, AddTags and RemoveTags change the existing ones
+	Tags       *[]string
+	AddTags    []string
+	RemoveTags []string
+	// Triage is set on the subdomains in another triage state and added to their triage history
+	Triage *models.Triage
+	// OutOfScopeAt moves the subdomains out of their scope at that time, 0 brings them back into it
+	OutOfScopeAt *bson.DateTime
+	// Rescan makes the next dns check of the subdomains due right away and watches dns again
+	// on the subdomains whose watching was turned off automatically after too many misses
+	Rescan bool
+	// the update time of the subdomains that change
+	Now bson.DateTime
+}
+
+// BulkUpdate reports what an update of many subdomains did
+type BulkUpdate struct {
+	Matched int64
+	Updated int64
+	// the subdomains whose watch flags changed, as they were before the update
+	WatchChanged []models.Subdomain
+}
+
+// SubdomainStats counts subdomains by domain and status, subdomains without a status are counted as "none"
+type SubdomainStats struct {
+	Total      int            `json:"total"`
+	PerDomain  map[string]int `json:"per_domain"`
+	DNSStatus  map[string]int `json:"dns_status"`
+	HTTPStatus map[string]int `json:"http_status"`
+}
+
+// AssetStats counts active subdomains by what found them, what runs behind them and when they were found
+type AssetStats struct {
+	Providers map[string]int `json:"providers"`
+	// technologies of the latest http snapshots
+	Technologies map[string]int `json:"technologies"`
+	// subdomains by the day (UTC, 2006-01-02) they were discovered on
+	Discovered map[string]int `json:"discovered"`
+}
+
+// JobFilter narrows down a job listing, empty fields match everything
+type JobFilter struct {
+	Type models.JobType
+	// only jobs started at or after this time
+	Since time.Time
+	// maximum number of jobs, 0 means no limit
+	Limit int
+}
+
+// RollupFilter selects the daily rollups of a domain, or the global ones if Domain is empty
+type RollupFilter struct {
+	Domain string
+	Since  time.Time
+	Until  time.Time
+}
+
+// EventFilter narrows down the timeline, empty fields match everything
+type EventFilter struct {
+	Domain string
+	// only events of one of these domains, e.g. the ones of a program
+	Domains   []string
+	Subdomain string
+	Types     []models.EventType
+	Since     time.Time
+	Until     time.Time
+	// only events older than this one
+	Before bson.ObjectID
+	// only events newer than this one
+	After bson.ObjectID
+	// maximum number of events, 0 means no limit
+	Limit int
+}
+
+// Domains stores the root domains
+type Domains interface {
+	Get(ctx context.Context, name string) (models.Domain, error)
+	// List returns the matching domains sorted by name
+	List(ctx context.Context, filter DomainFilter) ([]models.Domain, error)
+	Create(ctx context.Context, domain models.Domain) error
+	// Update loads a domain, applies change to it and stores the fields it changed, an error of change aborts
+	// the update. change runs again on the new domain when another writer got in between, so it must not
+	// depend on what it saw on an earlier run.
+	Update(ctx context.Context, name string, change func(*models.Domain) error) (models.Domain, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Subdomains stores the subdomains of every domain
+type Subdomains interface {
+	Get(ctx context.Context, domain, name string) (models.Subdomain, error)
+	// Existing returns which of the names are subdomains of the domain, archived ones included
+	Existing(ctx context.Context, domain string, names []string) (map[string]bool, error)
+	// List returns the matching subdomains sorted by domain and name
+	List(ctx context.Context, filter SubdomainFilter) ([]models.Subdomain, error)
+	// Page returns a page of the matching subdomains in the order it asks for
+	Page(ctx context.Context, page SubdomainPage) ([]models.Subdomain, error)
+	// Create stores new subdomains, nothing is stored if one of them already exists
+	Create(ctx context.Context, subdomains ...models.Subdomain) error
+	// Update loads a subdomain, applies change to it and stores the fields it changed, an error of change aborts
+	// the update. change runs again on the new subdomain when another writer got in between, so it must not
+	// depend on what it saw on an earlier run.
+	Update(ctx context.Context, domain, name string, change func(*models.Subdomain) error) (models.Subdomain, error)
+	Delete(ctx context.Context, domain, name string) error
+	// UpdateMany applies the changes to every matching subdomain in one go
+	UpdateMany(ctx context.Context, filter SubdomainFilter, changes SubdomainChanges) (BulkUpdate, error)
+	// DeleteAll deletes every subdomain of a domain
+	DeleteAll(ctx context.Context, domain string) error
+	// SetArchivedAt moves the subdomains of a domain archived at from, 0 for the active ones, to the archive
+	// time to in one go and returns how many there were
+	SetArchivedAt(ctx context.Context, domain string, from, to bson.DateTime) (int64, error)
+	// Stats counts the subdomains of the given domains, or of every domain if none is given, archived ones aren't counted
+	Stats(ctx context.Context, domains ...string) (SubdomainStats, error)
+	// Assets breaks the subdomains down the way Stats does, only counting discoveries since the given time.
+	// It looks up the latest http snapshot of every subdomain, the daily rollups keep its results.
+	Assets(ctx context.Context, since time.Time, domains ...string) (AssetStats, error)
+	// Discovered counts the active subdomains by the day (UTC, 2006-01-02) they were discovered on since the given time
+	Discovered(ctx context.Context, since time.Time, domains ...string) (map[string]int, error)
+}
+
+// DNSRecords stores the dns snapshots of subdomains
+type DNSRecords interface {
+	Latest(ctx context.Context, domain, subdomain string) (models.DNS, error)
+	// History returns the snapshots of a subdomain newest first, limit 0 means all of them
+	History(ctx context.Context, domain, subdomain string, limit int) ([]models.DNS, error)
+	Insert(ctx context.Context, record models.DNS) error
+	// Replace overwrites the snapshot with the same domain, subdomain and resolution date
+	Replace(ctx context.Context, record models.DNS) error
+	// Expired returns the snapshots of a domain taken and last seen before the given time,
+	// sorted by subdomain and oldest first
+	Expired(ctx context.Context, domain string, before time.Time) ([]models.DNS, error)
+	// Prune deletes the snapshots of a subdomain taken at the given dates and returns how many there were
+	Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error)
+	// Count counts the snapshots of every subdomain of a domain
+	Count(ctx context.Context, domain string) (int64, error)
+	// Delete deletes the snapshots of a subdomain, or of every subdomain of the domain if subdomain is empty
+	Delete(ctx context.Context, domain, subdomain string) error
+}
+
+// HTTPRecords stores the http snapshots of subdomains
+type HTTPRecords interface {
+	Latest(ctx context.Context, domain, subdomain string) (models.HTTP, error)
+	// History returns the snapshots of a subdomain newest first, limit 0 means all of them
+	History(ctx context.Context, domain, subdomain string, limit int) ([]models.HTTP, error)
+	Insert(ctx context.Context, record models.HTTP) error
+	// Replace overwrites the snapshot with the same domain, subdomain and scanning date
+	Replace(ctx context.Context, record models.HTTP) error
+	// Expired returns the snapshots of a domain taken and last seen before the given time,
+	// sorted by subdomain and oldest first
+	Expired(ctx context.Context, domain string, before time.Time) ([]models.HTTP, error)
+	// Prune deletes the snapshots of a subdomain taken at the given dates and returns how many there were
+	Prune(ctx context.Context, domain, subdomain string, dates []bson.DateTime) (int64, error)
+	// Count counts the snapshots of every subdomain of a domain
+	Count(ctx context.Context, domain string) (int64, error)
+	// Delete deletes the snapshots of a subdomain, or of every subdomain of the domain if subdomain is empty
+	Delete(ctx context.Context, domain, subdomain string) error
+}
+
+// Jobs stores the runs of the scheduled jobs
+type Jobs interface {
+	// Latest returns the last started job of a type
+	Latest(ctx context.Context, jobType models.JobType) (models.Job, error)
+	// Running returns the unfinished job of a type
+	Running(ctx context.Context, jobType models.JobType) (models.Job, error)
+	// Start stores a new job and returns it with its id
+	Start(ctx context.Context, job models.Job) (models.Job, error)
+	Get(ctx context.Context, id bson.ObjectID) (models.Job, error)
+	// List returns the matching jobs, latest first
+	List(ctx context.Context, filter JobFilter) ([]models.Job, error)
+	// Finish sets the end time, status and error of the job with the job's id,
+	// or of every unfinished job of the job's type if it has no id
+	Finish(ctx context.Context, job models.Job) error
+	// DeleteFinished deletes the jobs that finished before the given time and returns how many there were,
+	// a dry run only counts them
+	DeleteFinished(ctx context.Context, before time.Time, dryRun bool) (int64, error)
+}
+
+// Events stores the asset timeline
+type Events interface {
+	// Insert stores events, events without an id get one
+	Insert(ctx context.Context, events ...models.Event) error
+	// List returns the matching events newest first
+	List(ctx context.Context, filter EventFilter) ([]models.Event, error)
+	// DeleteAll deletes every event of a domain
+	DeleteAll(ctx context.Context, domain string) error
+}
+
+// Rollups stores the daily rollups of the statistics
+type Rollups interface {
+	// Put stores a rollup, replacing the one of the same day and domain
+	Put(ctx context.Context, rollup models.StatsRollup) error
+	// List returns the matching rollups oldest first
+	List(ctx context.Context, filter RollupFilter) ([]models.StatsRollup, error)
+	// Latest returns the newest rollup of a domain, or the global one if domain is empty
+	Latest(ctx context.Context, domain string) (models.StatsRollup, error)
+	// DeleteAll deletes every rollup of a domain
+	DeleteAll(ctx context.Context, domain string) error
+}
+
+// Programs stores the programs domains are grouped in
+type Programs interface {
+	Get(ctx context.Context, name string) (models.Program, error)
+	// List returns every program sorted by name
+	List(ctx context.Context) ([]models.Program, error)
+	Create(ctx context.Context, program models.Program) error
+	// Update loads a program, applies change to it and stores the fields it changed, an error of change aborts
+	// the update. change runs again on the new program when another writer got in between, so it must not
+	// depend on what it saw on an earlier run.
+	Update(ctx context.Context, name string, change func(*models.Program) error) (models.Program, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// OrphanReport counts the records whose program, domain or subdomain no longer exists
+type OrphanReport struct {
+	DryRun bool `json:"dry_run"`
+	// domains whose program no longer exists, their records are only orphans when they are deleted too
+	Domains    int64 `json:"domains"`
+	Subdomains int64 `json:"subdomains"`
+	DNS        int64 `json:"dns"`
+	HTTP       int64 `json:"http"`
+	Events     int64 `json:"events"`
+	Rollups    int64 `json:"rollups"`
+}
+
+// Cascades deletes assets along with everything recorded about them
+type Cascades interface {
+	// DeleteDomain deletes a domain with its subdomains, snapshots and events in one transaction,
+	// ErrNoTransactions if the backend can't run one
+	DeleteDomain(ctx context.Context, name string) error
+	// DeleteSubdomain deletes a subdomain with its snapshots in one transaction,
+	// ErrNoTransactions if the backend can't run one
+	DeleteSubdomain(ctx context.Context, domain, name string) error
+	// DeleteProgram deletes a program with its domains, archived ones included, and everything DeleteDomain
+	// deletes with them in one transaction and returns the names of the domains, ErrNoTransactions if the
+	// backend can't run one
+	DeleteProgram(ctx context.Context, name string) ([]string, error)
+	// DeleteOrphans deletes the subdomains, snapshots, events and rollups whose domain or subdomain no longer
+	// exists, a dry run only counts them. Records newer than the sweep are left for the next one, their domain
+	// may have been created while it ran. Domains whose program no longer exists are only counted, unless
+	// deleteDomains is set, then they are deleted along with their records.
+	DeleteOrphans(ctx context.Context, dryRun, deleteDomains bool) (OrphanReport, error)
+}
+
+// SearchPage selects a page of the results of a search, sorted by domain and name
+type SearchPage struct {
+	Query search.Query
+	// the subdomains to search
+	Filter SubdomainFilter
+	// the page starts after this subdomain, nil starts at the beginning
+	After *SubdomainCursor
+	// maximum number of results, 0 means no limit
+	Limit int
+}
+
+// Searcher searches subdomains together with their latest dns and http snapshots
+type Searcher interface {
+	Find(ctx context.Context, page SearchPage) ([]search.Result, error)
+}
+
+// Store bundles the repositories of one backend
+type Store struct {
+	Backend    Backend
+	Domains    Domains
+	Subdomains Subdomains
+	DNS        DNSRecords
+	HTTP       HTTPRecords
+	Jobs       Jobs
+	Events     Events
+	Rollups    Rollups
+	Programs   Programs
+	Cascades   Cascades
+	Search     Searcher
+
+	close func() error
+}
+
+// Close releases the resources of the backend
+func (s *Store) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// Program returns the program with the given name, or nil if it doesn't exist
+func (s *Store) Program(ctx context.Context, name string) (*models.Program, error) {
+	program, err := s.Programs.Get(ctx, name)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &program, nil
+}
+
+// DomainProgram returns the program a domain belongs to, or nil if it doesn't belong to any
+func (s *Store) DomainProgram(ctx context.Context, domainName string) (*models.Program, error) {
+	domain, err := s.Domains.Get(ctx, domainName)
+	if err == ErrNotFound || (err == nil && domain.Program == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Program(ctx, domain.Program)
+}
+
+// DomainNames returns the names of every domain, archived ones included
+func (s *Store) DomainNames(ctx context.Context) ([]string, error) {
+	domains, err := s.Domains.List(ctx, DomainFilter{Archived: IncludeArchived})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		names = append(names, domain.Name)
+	}
+	return names, nil
+}
+
+var store *Store
+
+// GetStore returns the store opened by InitStore
+func GetStore() *Store {
+	return store
+}
+
+// SetStore replaces the store returned by GetStore, mostly useful in tests
+func SetStore(s *Store) {
+	store = s
+}
+
+// InitStore opens the backend selected by STORAGE, either "mongo" (the default) or "bolt".
+// The mongo backend uses the database opened by database.InitDB, the bolt backend the file at BOLT_PATH.
+func InitStore() error {
+	backend, err := config.LoadEnv("STORAGE")
+	if err != nil {
+		return err
+	}
+
+	switch Backend(backend) {
+	case "", MongoBackend:
+		store = NewMongoStore(database.GetDB())
+	case BoltBackend:
+		path, _ := config.LoadEnv("BOLT_PATH")
+		if path == "" {
+			path = "sentinel.db"
+		}
+		if store, err = OpenBoltStore(path); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid storage backend: %s", backend)
+	}
+
+	return nil
+}
+
+// CloseStore closes the store opened by InitStore
+func CloseStore() error {
+	if store == nil {
+		return nil
+	}
+	return store.Close()
+}
+
+// Selected returns the backend chosen by STORAGE without opening it
+func Selected() Backend {
+	backend, _ := config.LoadEnv("STORAGE")
+	if backend == "" {
+		return MongoBackend
+	}
+	return Backend(backend)
+}
@@ -0,0 +1,389 @@
+'use strict';
+
+// The api key is kept for the browser session only, it is sent with every api request
+const session = {
+  get key() {
+    return sessionStorage.getItem('sentinel.apiKey');
+  },
+  set key(value) {
+    if (value) {
+      sessionStorage.setItem('sentinel.apiKey', value);
+    } else {
+      sessionStorage.removeItem('sentinel.apiKey');
+    }
+  },
+};
+
+const dnsStatuses = ['fresh_subdomain', 'fresh_resolved', 'resolved_subdomain', 'last_resolved', 'unresolved_subdomain'];
+const httpStatuses = ['fresh_service', 'normal_service', 'changed_service', 'last_service'];
+const triageStates = ['new', 'reviewed', 'interesting', 'ignored', 'reported'];
+const sorts = ['name', 'created_at', 'updated_at', 'dns_status_changed_at', 'http_status_changed_at', 'next_dns_check'];
+
+class APIError extends Error {
+  constructor(status, message) {
+    super(message);
+    this.status = status;
+  }
+}
+
+// api calls the api and returns the decoded response, errors are thrown as APIError
+async function api(method, path, query, body) {
+  const headers = { 'X-API-Key': session.key };
+  const init = { method, headers };
+  if (body !== undefined) {
+    headers['Content-Type'] = 'application/json';
+    init.body = JSON.stringify(body);
+  }
+  const search = query ? new URLSearchParams(clean(query)).toString() : '';
+  const resp = await fetch('/api/v1' + path + (search ? '?' + search : ''), init);
+  const data = await resp.json().catch(() => ({}));
+  if (resp.status === 401 && path !== '/domains/') {
+    signOut();
+  }
+  if (!resp.ok) {
+    throw new APIError(resp.status, data.error ? data.error.message : resp.statusText);
+  }
+  return data;
+}
+
+// clean drops the empty values of a query
+function clean(query) {
+  return Object.fromEntries(Object.entries(query).filter(([, value]) => value !== undefined && value !== ''));
+}
+
+// el creates an element, children are appended as text unless they are nodes
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (name.startsWith('on')) {
+      node.addEventListener(name.slice(2), value);
+    } else if (value === true) {
+      node.setAttribute(name, '');
+    } else if (value !== false && value !== undefined && value !== null) {
+      node.setAttribute(name, value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child !== undefined && child !== null) {
+      node.append(child instanceof Node ? child : String(child));
+    }
+  }
+  return node;
+}
+
+function link(text, ...path) {
+  return el('a', { href: '#/' + path.map(encodeURIComponent).join('/') }, text);
+}
+
+function date(value) {
+  if (!value) {
+    return '';
+  }
+  const parsed = new Date(value);
+  return parsed.getTime() > 0 ? parsed.toLocaleString() : '';
+}
+
+function list(values) {
+  return (values || []).join(', ');
+}
+
+function table(headings, rows) {
+  return el('table', {},
+    el('thead', {}, el('tr', {}, headings.map((heading) => el('th', {}, heading)))),
+    el('tbody', {}, rows.length
+      ? rows.map((row) => el('tr', {}, row.map((cell) => el('td', {}, cell))))
+      : el('tr', {}, el('td', { colspan: headings.length, class: 'muted' }, 'Nothing found'))));
+}
+
+function details(fields) {
+  return el('dl', {}, fields.flatMap(([name, value]) => [el('dt', {}, name), el('dd', {}, value)]));
+}
+
+function select(name, options, value, label) {
+  return el('label', {}, label,
+    el('select', { name }, el('option', { value: '' }, 'any'),
+      options.map((option) => el('option', { value: option, selected: option === value }, option))));
+}
+
+function input(name, value, label, placeholder) {
+  return el('label', {}, label, el('input', { name, value: value || '', placeholder }));
+}
+
+// filterForm renders filters that are kept in the query of the route, so they survive a reload
+function filterForm(route, query, fields) {
+  return el('form', {
+    class: 'filters',
+    onsubmit(event) {
+      event.preventDefault();
+      const values = clean(Object.fromEntries(new FormData(event.target)));
+      const search = new URLSearchParams(values).toString();
+      location.hash = route + (search ? '?' + search : '');
+    },
+  }, fields, el('button', { type: 'submit' }, 'Filter'));
+}
+
+function failure(err) {
+  return el('p', { class: 'error' }, err.message);
+}
+
+// views render a route into the main element
+
+async function signInView(view) {
+  const message = el('p', { class: 'error' });
+  const form = el('form', {
+    class: 'sign-in',
+    async onsubmit(event) {
+      event.preventDefault();
+      session.key = new FormData(form).get('key');
+      try {
+        await api('GET', '/domains/');
+        location.hash = '#/domains';
+      } catch (err) {
+        session.key = null;
+        message.textContent = err.status === 401 ? 'Invalid API key' : err.message;
+      }
+    },
+  },
+  el('h1', {}, 'Sign in'),
+  el('label', {}, 'API key', el('input', { name: 'key', type: 'password', required: true, autocomplete: 'off' })),
+  el('button', { type: 'submit' }, 'Sign in'),
+  message);
+  view.append(form);
+}
+
+async function domainsView(view, query) {
+  view.append(el('h1', {}, 'Domains'), filterForm('#/domains', query, [
+    input('tag', query.get('tag'), 'Tag'),
+    select('triage', triageStates, query.get('triage'), 'Triage'),
+    select('archived', ['exclude', 'include', 'only'], query.get('archived'), 'Archived'),
+  ]));
+
+  const { domains } = await api('GET', '/domains/', {
+    tag: query.get('tag'),
+    triage: query.get('triage'),
+    archived: query.get('archived'),
+  });
+  view.append(table(['Domain'], domains.map((name) => [link(name, 'domains', name)])));
+}
+
+async function domainView(view, query, domainName) {
+  const { domain, seeds } = await api('GET', '/domains/' + encodeURIComponent(domainName));
+  view.append(el('h1', {}, domain.name), details([
+    ['Program', domain.program || '-'],
+    ['Seeds', list(seeds)],
+    ['Tags', list(domain.tags)],
+    ['Triage', domain.triage ? domain.triage.state : '-'],
+    ['Archived', date(domain.archived_at) || 'no'],
+  ]));
+
+  // scope editing, one pattern per line. A preview tells which subdomains the rules move before saving them.
+  const message = el('p');
+  const impact = el('div');
+  const changeScope = async (dryRun) => {
+    const lines = (name) => new FormData(scope).get(name).split('\n').map((line) => line.trim()).filter(Boolean);
+    try {
+      const report = await api('PUT', '/domains/' + encodeURIComponent(domain.name) + '/scope', { dry_run: dryRun || undefined }, {
+        in_scope: lines('in_scope'),
+        out_of_scope: lines('out_of_scope'),
+      });
+      const { entering, leaving, in_scope: inScope, out_of_scope: outOfScope } = report.domains[0];
+      message.className = 'notice';
+      message.textContent = (dryRun ? 'Would leave ' : 'Scope saved, ') + inScope + ' subdomains in scope and ' + outOfScope + ' out of it';
+      impact.replaceChildren(details([
+        ['Entering scope', list(entering)],
+        ['Leaving scope', list(leaving)],
+      ]));
+    } catch (err) {
+      message.className = 'error';
+      message.textContent = err.message;
+    }
+  };
+  const scope = el('form', {
+    onsubmit(event) {
+      event.preventDefault();
+      changeScope(false);
+    },
+  },
+  el('div', { class: 'scope' },
+    el('label', {}, 'In scope', el('textarea', { name: 'in_scope' }, (domain.in_scope || []).join('\n'))),
+    el('label', {}, 'Out of scope', el('textarea', { name: 'out_of_scope' }, (domain.out_of_scope || []).join('\n')))),
+  el('button', { type: 'button', onclick: () => changeScope(true) }, 'Preview'),
+  el('button', { type: 'submit' }, 'Save scope'),
+  message,
+  impact);
+  view.append(el('h2', {}, 'Scope'), scope);
+
+  const route = '#/domains/' + encodeURIComponent(domain.name);
+  view.append(el('h2', {}, 'Subdomains'), filterForm(route, query, [
+    input('name', query.get('name'), 'Name', '*.example.com'),
+    select('dns_status', dnsStatuses, query.get('dns_status'), 'DNS status'),
+    select('http_status', httpStatuses, query.get('http_status'), 'HTTP status'),
+    input('tag', query.get('tag'), 'Tag'),
+    select('triage', triageStates, query.get('triage'), 'Triage'),
+    select('archived', ['exclude', 'include', 'only'], query.get('archived'), 'Archived'),
+    select('in_scope', ['true', 'false'], query.get('in_scope'), 'In scope'),
+    select('sort', sorts, query.get('sort'), 'Sort'),
+    select('order', ['asc', 'desc'], query.get('order'), 'Order'),
+  ]));
+
+  const filter = Object.fromEntries(query);
+  const rows = el('tbody');
+  const more = el('button', { type: 'button', class: 'secondary', hidden: true }, 'Load more');
+  const count = el('p', { class: 'muted' });
+  const listing = el('table', {},
+    el('thead', {}, el('tr', {}, ['Subdomain', 'DNS', 'HTTP', 'Tags', 'Triage', 'Created', 'Updated'].map((heading) => el('th', {}, heading)))),
+    rows);
+  view.append(count, listing, more);
+
+  // pages are appended as long as there is a next cursor
+  let cursor = '';
+  let shown = 0;
+  const load = async () => {
+    const page = await api('GET', '/domains/' + encodeURIComponent(domain.name) + '/subdomains', { ...filter, limit: 50, cursor });
+    for (const subdomain of page.subdomains) {
+      rows.append(el('tr', {},
+        el('td', {}, link(subdomain.name, 'domains', domain.name, subdomain.name)),
+        el('td', {}, subdomain.dns_status || ''),
+        el('td', {}, subdomain.http_status || ''),
+        el('td', {}, list(subdomain.tags)),
+        el('td', {}, subdomain.triage ? subdomain.triage.state : ''),
+        el('td', {}, date(subdomain.created_at)),
+        el('td', {}, date(subdomain.updated_at))));
+    }
+    shown += page.subdomains.length;
+    count.textContent = `${shown} of ${page.count} subdomains`;
+    cursor = page.next_cursor || '';
+    more.hidden = !cursor;
+  };
+  more.addEventListener('click', () => load().catch((err) => more.replaceWith(failure(err))));
+  await load();
+}
+
+async function subdomainView(view, query, domainName, subdomainName) {
+  const path = '/domains/' + encodeURIComponent(domainName) + '/' + encodeURIComponent(subdomainName);
+  const { subdomain, latest_dns: dns, latest_http: http } = await api('GET', path);
+  view.append(
+    el('p', {}, link(domainName, 'domains', domainName)),
+    el('h1', {}, subdomain.name),
+    details([
+      ['DNS status', subdomain.dns_status || '-'],
+      ['HTTP status', subdomain.http_status || '-'],
+      ['Providers', list(subdomain.providers)],
+      ['Watch', [subdomain.watch_dns && 'dns', subdomain.watch_http && 'http'].filter(Boolean).join(', ') || '-'],
+      ['Tags', list(subdomain.tags)],
+      ['Triage', subdomain.triage ? subdomain.triage.state : '-'],
+      ['Out of scope', date(subdomain.out_of_scope_at) || 'no'],
+      ['Created', date(subdomain.created_at)],
+      ['Updated', date(subdomain.updated_at)],
+    ]),
+    el('h2', {}, 'Latest DNS'),
+    details([
+      ['Resolved', date(dns.resolution_date) || '-'],
+      ['A', list(dns.a_records)],
+      ['AAAA', list(dns.aaaa_records)],
+      ['CNAME', list(dns.cname_records)],
+    ]),
+    el('h2', {}, 'Latest HTTP'),
+    details([
+      ['Scanned', date(http.scanning_date) || '-'],
+      ['Status code', http.status_code || '-'],
+      ['Title', http.title || ''],
+      ['Location', http.location || ''],
+      ['Technologies', list(http.technologies)],
+      ['CDN', http.cdn_name || ''],
+    ]));
+
+  // a subdomain without snapshots has no history
+  const history = (kind) => api('GET', path + '/' + kind).catch((err) => {
+    if (err.status === 404) {
+      return { snapshots: [], diffs: [] };
+    }
+    throw err;
+  });
+  const [dnsHistory, httpHistory] = await Promise.all([history('dns'), history('http')]);
+
+  view.append(el('h2', {}, 'DNS history'), table(['Resolved', 'A', 'AAAA', 'CNAME', 'Last seen', 'Seen'],
+    dnsHistory.snapshots.map((snapshot) => [
+      date(snapshot.resolution_date),
+      list(snapshot.a_records),
+      list(snapshot.aaaa_records),
+      list(snapshot.cname_records),
+      date(snapshot.last_seen),
+      snapshot.seen_count || 1,
+    ])));
+  view.append(el('h2', {}, 'HTTP history'), table(['Scanned', 'Status code', 'Title', 'Technologies', 'Last seen', 'Seen'],
+    httpHistory.snapshots.map((snapshot) => [
+      date(snapshot.scanning_date),
+      snapshot.status_code || '',
+      snapshot.title || '',
+      list(snapshot.technologies),
+      date(snapshot.last_seen),
+      snapshot.seen_count || 1,
+    ])));
+  view.append(el('h2', {}, 'HTTP changes'), table(['From', 'To', 'Changes'],
+    httpHistory.diffs.map((diff) => [
+      date(diff.from),
+      date(diff.to),
+      diff.changes.map((change) => change.field).join(', '),
+    ])));
+}
+
+async function jobsView(view, query) {
+  view.append(el('h1', {}, 'Jobs'), filterForm('#/jobs', query, [
+    input('type', query.get('type'), 'Type'),
+  ]));
+
+  const { jobs } = await api('GET', '/jobs', { type: query.get('type'), limit: 100 });
+  view.append(table(['Type', 'Target', 'Status', 'Started', 'Duration', 'Error'], jobs.map((job) => {
+    const ended = job.end_time ? new Date(job.end_time) : null;
+    return [
+      job.type,
+      job.target || '',
+      el('span', { class: job.status === 'failed' ? 'status failed' : 'status' }, ended ? job.status : 'running'),
+      date(job.start_time),
+      ended ? `${Math.round((ended - new Date(job.start_time)) / 1000)}s` : '',
+      job.error || '',
+    ];
+  })));
+}
+
+const routes = [
+  [/^\/signin$/, signInView],
+  [/^\/domains$/, domainsView],
+  [/^\/domains\/([^/]+)$/, domainView],
+  [/^\/domains\/([^/]+)\/([^/]+)$/, subdomainView],
+  [/^\/jobs$/, jobsView],
+];
+
+function signOut() {
+  session.key = null;
+  location.hash = '#/signin';
+}
+
+async function render() {
+  const [path, search] = location.hash.slice(1).split('?');
+  if (!session.key && path !== '/signin') {
+    location.hash = '#/signin';
+    return;
+  }
+  document.getElementById('nav').hidden = !session.key;
+
+  // a fresh container keeps a slow view from rendering into the next one
+  const view = el('div');
+  document.getElementById('view').replaceChildren(view);
+  const route = routes.find(([pattern]) => pattern.test(path));
+  if (!route) {
+    location.hash = '#/domains';
+    return;
+  }
+  const params = path.match(route[0]).slice(1).map(decodeURIComponent);
+  try {
+    await route[1](view, new URLSearchParams(search), ...params);
+  } catch (err) {
+    view.append(failure(err));
+  }
+}
+
+document.getElementById('sign-out').addEventListener('click', signOut);
+window.addEventListener('hashchange', render);
+render();
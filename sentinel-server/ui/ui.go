@@ -0,0 +1,31 @@
+// Package ui serves the web dashboard. Its files are embedded in the binary and talk to the api with
+// the api key the user signs in with, so the dashboard itself needs no authentication.
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+//go:embed static
+var static embed.FS
+
+// Register serves the dashboard at /ui/ and redirects the root to it
+func Register(app *fiber.App) {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.Redirect("/ui/")
+	})
+	app.Use("/ui", filesystem.New(filesystem.Config{
+		Root:  http.FS(files),
+		Index: "index.html",
+	}))
+}
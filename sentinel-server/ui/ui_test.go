@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/0xgwyn/sentinel/handler"
+	"github.com/0xgwyn/sentinel/middleware"
+)
+
+func TestRegister(t *testing.T) {
+	t.Setenv("PROD", "true")
+	t.Setenv("API_KEY", "secret")
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: handler.ErrorHandler})
+	app.Use(middleware.NewAuthMiddleware())
+	app.Get("/api/domains", func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+	Register(app)
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"root redirects to the dashboard", "/", 302, "", ""},
+		{"index without a key", "/ui/", 200, "text/html", "<title>Sentinel</title>"},
+		{"script", "/ui/app.js", 200, "javascript", "X-API-Key"},
+		{"stylesheet", "/ui/style.css", 200, "text/css", ""},
+		{"missing file", "/ui/missing.js", 404, "", ""},
+		{"api still needs a key", "/api/domains", 401, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if tt.status == 302 && resp.Header.Get("Location") != "/ui/" {
+				t.Errorf("expected a redirect to /ui/, got %q", resp.Header.Get("Location"))
+			}
+			if !strings.Contains(resp.Header.Get("Content-Type"), tt.contentType) {
+				t.Errorf("expected content type %q, got %q", tt.contentType, resp.Header.Get("Content-Type"))
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("expected the body to contain %q", tt.body)
+			}
+		})
+	}
+}